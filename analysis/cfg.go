@@ -0,0 +1,282 @@
+package analysis
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// EdgeKind is how control passes along an edge of the graph
+type EdgeKind string
+
+const (
+	// EdgeNext runs on into the next block, including after a call returns
+	// or a skip doesn't skip
+	EdgeNext EdgeKind = "next"
+	// EdgeJump is a 1nnn jump
+	EdgeJump EdgeKind = "jump"
+	// EdgeSkip is a skip instruction skipping
+	EdgeSkip EdgeKind = "skip"
+	// EdgeCall is a 2nnn call into a subroutine
+	EdgeCall EdgeKind = "call"
+	// EdgeTable is a computed Bnnn jump to one of its guessed targets
+	EdgeTable EdgeKind = "table"
+)
+
+// Edge leads from a block to the block starting at To
+type Edge struct {
+	To   uint16   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+// Block is a basic block: instructions that run one after another,
+// entered only at the first and left only after the last
+type Block struct {
+	Start uint16 `json:"start"`
+	// End is the address after the last instruction
+	End          uint16         `json:"end"`
+	Instructions []*Instruction `json:"-"`
+	Edges        []Edge         `json:"edges"`
+	// Subroutines are the entries of the subroutines the block is part of,
+	// more than one when they share code
+	Subroutines []uint16 `json:"subroutines"`
+}
+
+// Last is the instruction that ends the block
+func (b *Block) Last() *Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// Subroutine is the code reachable from a call target, or from
+// RamProgramStart for the main program, without following calls
+type Subroutine struct {
+	Name  string `json:"name"`
+	Entry uint16 `json:"entry"`
+	// Blocks are the starts of the subroutine's blocks in order
+	Blocks []uint16 `json:"blocks"`
+	// Callers are the addresses of the calls to it
+	Callers []uint16 `json:"callers"`
+}
+
+// CFG is the control-flow graph of a program's reachable code
+type CFG struct {
+	Blocks map[uint16]*Block
+	// Subroutines are the main program then the subroutines by address
+	Subroutines []*Subroutine
+}
+
+// SubroutineName names a subroutine after its address, or main
+// for the program's start
+func SubroutineName(addr uint16) string {
+	if addr == emu.RamProgramStart {
+		return "main"
+	}
+
+	return fmt.Sprintf("sub_%03X", addr)
+}
+
+// CFG splits a program into basic blocks, which start at the program's
+// start, the targets of jumps, calls, skips and jump tables, and the
+// instructions after them, then groups the blocks into subroutines
+func (p *Program) CFG() *CFG {
+	leaders := map[uint16]bool{emu.RamProgramStart: true}
+	for _, ins := range p.Instructions {
+		if ins.Flow == FlowNext {
+			continue
+		}
+		for _, next := range ins.Next {
+			leaders[next] = true
+		}
+		if ins.Flow == FlowCall {
+			leaders[ins.Target] = true
+		}
+	}
+
+	g := &CFG{Blocks: make(map[uint16]*Block)}
+	for addr := range leaders {
+		if _, ok := p.Instructions[addr]; ok {
+			g.Blocks[addr] = p.block(addr, leaders)
+		}
+	}
+
+	entries := []uint16{emu.RamProgramStart}
+	for entry := range p.Subroutines {
+		if entry != emu.RamProgramStart {
+			entries = append(entries, entry)
+		}
+	}
+	subroutines := entries[1:]
+	sort.Slice(subroutines, func(i, j int) bool { return subroutines[i] < subroutines[j] })
+	for _, entry := range entries {
+		if g.Blocks[entry] == nil {
+			continue
+		}
+		s := &Subroutine{Name: SubroutineName(entry), Entry: entry, Blocks: g.reachable(entry)}
+		s.Callers = append([]uint16{}, p.Subroutines[entry]...)
+		for _, start := range s.Blocks {
+			b := g.Blocks[start]
+			b.Subroutines = append(b.Subroutines, entry)
+		}
+		g.Subroutines = append(g.Subroutines, s)
+	}
+
+	return g
+}
+
+// block gathers the instructions from a leader up to the next leader
+// or the end of straight-line code
+func (p *Program) block(start uint16, leaders map[uint16]bool) *Block {
+	b := &Block{Start: start, Edges: []Edge{}}
+	for addr := start; ; {
+		ins := p.Instructions[addr]
+		b.Instructions = append(b.Instructions, ins)
+		b.End = addr + ins.Size
+		next, ok := p.Instructions[b.End]
+		if ins.Flow != FlowNext || !ok || leaders[b.End] {
+			break
+		}
+		addr = next.Addr
+	}
+
+	last := b.Last()
+	kind := EdgeNext
+	switch last.Flow {
+	case FlowJump:
+		kind = EdgeJump
+	case FlowComputed:
+		kind = EdgeTable
+	case FlowCall:
+		b.Edges = append(b.Edges, Edge{last.Target, EdgeCall})
+	}
+	for i, next := range last.Next {
+		if _, ok := p.Instructions[next]; !ok {
+			continue
+		}
+		if last.Flow == FlowSkip && i > 0 {
+			kind = EdgeSkip
+		}
+		b.Edges = append(b.Edges, Edge{next, kind})
+	}
+
+	return b
+}
+
+// reachable lists the blocks reachable from an entry without following
+// calls, in order of address
+func (g *CFG) reachable(entry uint16) []uint16 {
+	seen := map[uint16]bool{entry: true}
+	work := []uint16{entry}
+	for len(work) > 0 {
+		b := g.Blocks[work[len(work)-1]]
+		work = work[:len(work)-1]
+		for _, e := range b.Edges {
+			if e.Kind != EdgeCall && !seen[e.To] {
+				seen[e.To] = true
+				work = append(work, e.To)
+			}
+		}
+	}
+
+	blocks := make([]uint16, 0, len(seen))
+	for start := range seen {
+		blocks = append(blocks, start)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+
+	return blocks
+}
+
+// Starts returns the starts of the blocks in order
+func (g *CFG) Starts() []uint16 {
+	starts := make([]uint16, 0, len(g.Blocks))
+	for start := range g.Blocks {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	return starts
+}
+
+// edgeStyles are the DOT attributes for each kind of edge
+var edgeStyles = map[EdgeKind]string{
+	EdgeNext:  "",
+	EdgeJump:  ` [color="#2060C0"]`,
+	EdgeSkip:  ` [style=dashed label="skip"]`,
+	EdgeCall:  ` [style=bold color="#C02020" label="call"]`,
+	EdgeTable: ` [style=dotted label="table"]`,
+}
+
+// WriteDOT writes the graph for Graphviz, with a box for each block
+// listing its disassembly and a cluster for each subroutine. A block
+// shared by several subroutines is drawn in the first.
+func (g *CFG) WriteDOT(w io.Writer, name string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %q {\n", name)
+	fmt.Fprintf(bw, "\tnode [shape=box fontname=\"monospace\"];\n")
+	for _, s := range g.Subroutines {
+		fmt.Fprintf(bw, "\tsubgraph cluster_%s {\n", s.Name)
+		fmt.Fprintf(bw, "\t\tlabel=%q;\n", s.Name)
+		for _, start := range s.Blocks {
+			b := g.Blocks[start]
+			if b.Subroutines[0] != s.Entry {
+				continue
+			}
+			var label strings.Builder
+			for _, ins := range b.Instructions {
+				fmt.Fprintf(&label, "%03X  %s\\l", ins.Addr, emu.Disassemble(ins.Opcode))
+			}
+			fmt.Fprintf(bw, "\t\tb%03X [label=\"%s\"];\n", b.Start, label.String())
+		}
+		fmt.Fprintf(bw, "\t}\n")
+	}
+	for _, start := range g.Starts() {
+		for _, e := range g.Blocks[start].Edges {
+			fmt.Fprintf(bw, "\tb%03X -> b%03X%s;\n", start, e.To, edgeStyles[e.Kind])
+		}
+	}
+	fmt.Fprintf(bw, "}\n")
+
+	return bw.Flush()
+}
+
+// jsonInstruction is an instruction as WriteJSON writes it
+type jsonInstruction struct {
+	Addr   uint16 `json:"addr"`
+	Opcode string `json:"opcode"`
+	Text   string `json:"text"`
+}
+
+// jsonBlock is a block with its instructions as WriteJSON writes it
+type jsonBlock struct {
+	*Block
+	Instructions []jsonInstruction `json:"instructions"`
+}
+
+// WriteJSON writes the graph as JSON, with the subroutines and the
+// blocks by address, each with its instructions, edges and subroutines
+func (g *CFG) WriteJSON(w io.Writer, name string) error {
+	out := struct {
+		ROM         string        `json:"rom"`
+		Entry       uint16        `json:"entry"`
+		Subroutines []*Subroutine `json:"subroutines"`
+		Blocks      []jsonBlock   `json:"blocks"`
+	}{ROM: name, Entry: emu.RamProgramStart, Subroutines: g.Subroutines}
+
+	for _, start := range g.Starts() {
+		b := jsonBlock{Block: g.Blocks[start]}
+		for _, ins := range b.Block.Instructions {
+			b.Instructions = append(b.Instructions, jsonInstruction{ins.Addr, fmt.Sprintf("%04X", ins.Opcode), emu.Disassemble(ins.Opcode)})
+		}
+		out.Blocks = append(out.Blocks, b)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(out)
+}
@@ -0,0 +1,108 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cfgROM calls a subroutine that loops until the delay timer runs out,
+// then jumps through a table
+var cfgROM = []byte{
+	0x22, 0x08, // 200 CALL 0x208
+	0x60, 0x00, // 202 LD V0, 0x00
+	0xB2, 0x12, // 204 JP V0, 0x212
+	0xFF, 0xFF, // 206 data
+	0xF0, 0x07, // 208 LD V0, DT
+	0x30, 0x00, // 20A SE V0, 0x00
+	0x12, 0x08, // 20C JP 0x208
+	0x00, 0xEE, // 20E RET
+	0xFF, 0xFF, // 210 data
+	0x12, 0x02, // 212 JP 0x202
+	0x12, 0x16, // 214 JP 0x216
+	0x00, 0xFD, // 216 EXIT
+}
+
+func TestCFG(t *testing.T) {
+	g := Analyze(cfgROM).CFG()
+
+	want := []uint16{0x200, 0x202, 0x208, 0x20C, 0x20E, 0x212, 0x214, 0x216}
+	if starts := g.Starts(); !reflect.DeepEqual(starts, want) {
+		t.Fatalf("Expected blocks at %X but were at %X", want, starts)
+	}
+	if b := g.Blocks[0x208]; len(b.Instructions) != 2 || b.End != 0x20C {
+		t.Errorf("Expected the block at 0x208 to end after the skip but was %+v", b)
+	}
+
+	edges := []struct {
+		from uint16
+		want []Edge
+	}{
+		{0x200, []Edge{{0x208, EdgeCall}, {0x202, EdgeNext}}},
+		{0x202, []Edge{{0x212, EdgeTable}, {0x214, EdgeTable}}},
+		{0x208, []Edge{{0x20C, EdgeNext}, {0x20E, EdgeSkip}}},
+		{0x20C, []Edge{{0x208, EdgeJump}}},
+		{0x20E, []Edge{}},
+	}
+	for _, test := range edges {
+		if e := g.Blocks[test.from].Edges; !reflect.DeepEqual(e, test.want) {
+			t.Errorf("Expected edges %v from 0x%03X but were %v", test.want, test.from, e)
+		}
+	}
+
+	if len(g.Subroutines) != 2 {
+		t.Fatalf("Expected main and a subroutine but were %d", len(g.Subroutines))
+	}
+	sub := g.Subroutines[1]
+	if sub.Name != "sub_208" || !reflect.DeepEqual(sub.Blocks, []uint16{0x208, 0x20C, 0x20E}) || !reflect.DeepEqual(sub.Callers, []uint16{0x200}) {
+		t.Errorf("Expected sub_208 to have three blocks and a caller but was %+v", sub)
+	}
+	if main := g.Subroutines[0]; main.Name != "main" || len(main.Blocks) != 5 {
+		t.Errorf("Expected five blocks in main but was %+v", main)
+	}
+}
+
+func TestCFGExport(t *testing.T) {
+	g := Analyze(cfgROM).CFG()
+
+	var dot bytes.Buffer
+	if err := g.WriteDOT(&dot, "cfg.ch8"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`digraph "cfg.ch8" {`,
+		"subgraph cluster_sub_208 {",
+		`b208 [label="208  LD V0, DT\l20A  SE V0, 0x00\l"];`,
+		`b200 -> b208 [style=bold color="#C02020" label="call"];`,
+		`b208 -> b20E [style=dashed label="skip"];`,
+	} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("Expected %q in the DOT graph:\n%s", want, dot.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf, "cfg.ch8"); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		ROM         string
+		Subroutines []Subroutine
+		Blocks      []struct {
+			Start        uint16
+			Edges        []Edge
+			Instructions []struct{ Addr uint16 }
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ROM != "cfg.ch8" || len(out.Subroutines) != 2 || len(out.Blocks) != 8 {
+		t.Errorf("Expected the JSON to have 2 subroutines and 8 blocks but was %+v", out)
+	}
+	if b := out.Blocks[2]; b.Start != 0x208 || len(b.Instructions) != 2 || len(b.Edges) != 2 {
+		t.Errorf("Expected the block at 0x208 in the JSON but was %+v", b)
+	}
+}
@@ -0,0 +1,248 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/romdb"
+)
+
+// etiLoadAddress is where the ETI 660 loads programs, while
+// other CHIP-8 interpreters load them at RamProgramStart
+const etiLoadAddress = 0x600
+
+// Platform is the machine a program was written for
+type Platform int
+
+const (
+	PlatformCHIP8 Platform = iota
+	// PlatformHires is CHIP-8 with a 64x64 display, whose programs start
+	// by jumping over a patched interpreter to 0x260
+	PlatformHires
+	PlatformSCHIP
+	PlatformXOCHIP
+)
+
+var platformNames = [...]string{"CHIP-8", "CHIP-8 hires", "SCHIP", "XO-CHIP"}
+
+// platformIDs are the names ParsePlatform takes, as the ROM database uses
+var platformIDs = [...]string{"chip8", "hires", "schip", "xochip"}
+
+// platformQuirks are the quirks each platform's interpreter has,
+// in the form ParseQuirks takes
+var platformQuirks = [...]string{"default", "cosmac", "schip", "loadstore"}
+
+func (p Platform) String() string {
+	return platformNames[p]
+}
+
+// emulated are the SCHIP instructions the emulator runs, those of
+// the hires display and its 16x16 sprites
+var emulated = map[string]bool{"00FE": true, "00FF": true, "Dxy0": true}
+
+// ParsePlatform parses a platform name: chip8, hires, schip or xochip
+func ParsePlatform(s string) (Platform, error) {
+	for i, id := range platformIDs {
+		if strings.EqualFold(s, id) {
+			return Platform(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown platform %q (want one of %s)", s, strings.Join(platformIDs[:], ", "))
+}
+
+// Detection is the platform and quirks a program looks to be written for,
+// with how sure the guess is and why
+type Detection struct {
+	Platform Platform
+	// Quirks are the quirks to run the program with, as ParseQuirks takes them
+	Quirks string
+	// Confidence is from 0 for a guess to 1 for a known ROM
+	Confidence float64
+	// LoadAddress is where the program looks to be written to be loaded
+	LoadAddress uint16
+	// Unsupported are the SCHIP instructions in an SCHIP program's
+	// reachable code that the emulator doesn't run
+	Unsupported []string
+	Reasons     []string
+}
+
+// Supported reports whether the emulator runs the program: a CHIP-8
+// program, or an SCHIP one using only the hires display and 16x16
+// sprites, loaded at RamProgramStart
+func (d Detection) Supported() bool {
+	switch {
+	case d.LoadAddress != emu.RamProgramStart:
+		return false
+	case d.Platform == PlatformSCHIP:
+		return len(d.Unsupported) == 0
+	}
+
+	return d.Platform == PlatformCHIP8
+}
+
+func (d Detection) String() string {
+	return fmt.Sprintf("%s, quirks %s (%.0f%% confident)", d.Platform, d.Quirks, 100*d.Confidence)
+}
+
+// Detect works out the platform and quirks for a ROM. A ROM in the
+// database is known; otherwise the guess goes by the size of the ROM, the
+// SCHIP and XO-CHIP instructions in its reachable code, the jump to 0x260
+// hires programs start with and the addresses its instructions use, then
+// the quirks the linter suggests.
+func Detect(rom []byte) Detection {
+	d := Detection{LoadAddress: emu.RamProgramStart}
+	if entry, ok := romdb.Lookup(emu.HashROM(rom)); ok && entry.Platform != "" {
+		if platform, err := ParsePlatform(entry.Platform); err == nil {
+			d.Platform, d.Quirks, d.Confidence = platform, entry.Quirks, 1
+			if d.Quirks == "" {
+				d.Quirks = platformQuirks[platform]
+			}
+			d.Reasons = append(d.Reasons, fmt.Sprintf("known ROM: %s", entry.Title))
+			if platform == PlatformSCHIP {
+				d.Unsupported = unsupported(Analyze(rom))
+			}
+			return d
+		}
+	}
+	if len(rom) > emu.RamProgramSize {
+		d.Platform, d.Quirks, d.Confidence = PlatformXOCHIP, platformQuirks[PlatformXOCHIP], 0.9
+		d.Reasons = append(d.Reasons, fmt.Sprintf("%d bytes is more than fits in 4KB", len(rom)))
+		return d
+	}
+
+	p := Analyze(rom)
+	warnings, suggestion := Lint(p)
+	found := make(map[Extension]map[string]bool)
+	for _, ins := range p.Instructions {
+		if found[ins.Extension] == nil {
+			found[ins.Extension] = make(map[string]bool)
+		}
+		found[ins.Extension][ins.Name] = true
+	}
+	hires := len(rom) >= 2 && rom[0] == 0x12 && rom[1] == 0x60
+
+	switch {
+	case len(found[XOCHIP]) > 0:
+		d.Platform, d.Confidence = PlatformXOCHIP, evidence(len(found[XOCHIP]))
+		d.Reasons = append(d.Reasons, "XO-CHIP instructions "+names(found[XOCHIP]))
+	case len(found[SCHIP]) > 0:
+		d.Platform, d.Confidence = PlatformSCHIP, evidence(len(found[SCHIP]))
+		d.Reasons = append(d.Reasons, "SCHIP instructions "+names(found[SCHIP]))
+		d.Unsupported = unsupported(p)
+	case hires:
+		d.Platform, d.Confidence = PlatformHires, 0.7
+		d.Reasons = append(d.Reasons, "starts with a jump to 0x260")
+		// hires programs clear their larger screen with a call to 0x230
+		if containsOpcode(p, 0x0230) {
+			d.Confidence = 0.95
+			d.Reasons = append(d.Reasons, "clears the screen with 0230")
+		}
+	default:
+		d.Platform, d.Confidence = PlatformCHIP8, 0.9
+		d.Reasons = append(d.Reasons, "no SCHIP or XO-CHIP instructions")
+	}
+
+	if len(found[Invalid]) > 0 {
+		d.Confidence /= 2
+		var invalid []uint16
+		for _, w := range warnings {
+			if w.Check == CheckInvalid {
+				invalid = append(invalid, w.Addr)
+			}
+		}
+		d.Reasons = append(d.Reasons, "invalid instructions"+at(invalid))
+	}
+	if addr := loadAddress(rom); addr != emu.RamProgramStart {
+		d.LoadAddress = addr
+		d.Confidence /= 2
+		d.Reasons = append(d.Reasons, fmt.Sprintf("its addresses are for loading at 0x%03X, as on the ETI 660", addr))
+	}
+
+	d.Quirks = platformQuirks[d.Platform]
+	if d.Platform == PlatformCHIP8 {
+		d.Quirks = suggestion.Preset
+		d.Reasons = append(d.Reasons, suggestion.Reasons...)
+	}
+
+	return d
+}
+
+// evidence is how sure finding some different instructions makes a guess
+func evidence(kinds int) float64 {
+	return 1 - 0.5/float64(kinds+1)
+}
+
+// unsupported lists the SCHIP instruction forms in a program
+// that the emulator doesn't run, in order
+func unsupported(p *Program) []string {
+	found := make(map[string]bool)
+	for _, ins := range p.Instructions {
+		if ins.Extension == SCHIP && !emulated[ins.Name] {
+			found[ins.Name] = true
+		}
+	}
+
+	return sorted(found)
+}
+
+// names lists the instruction forms found, in order
+func names(found map[string]bool) string {
+	return strings.Join(sorted(found), ", ")
+}
+
+// sorted lists the instruction forms found in order, or nil for none
+func sorted(found map[string]bool) []string {
+	var list []string
+	for name := range found {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// containsOpcode reports whether a reachable instruction is op
+func containsOpcode(p *Program, op uint16) bool {
+	for _, ins := range p.Instructions {
+		if ins.Opcode == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadAddress guesses where a ROM is meant to be loaded from the addresses
+// its jumps, calls and Annn use, counting those that land inside the ROM
+// loaded at RamProgramStart and at the ETI 660's 0x600
+func loadAddress(rom []byte) uint16 {
+	if len(rom) > emu.RamSize-etiLoadAddress {
+		return emu.RamProgramStart
+	}
+	inside := func(nnn, start int) bool {
+		return nnn >= start && nnn < start+len(rom)
+	}
+
+	var standard, eti int
+	for i := 0; i+1 < len(rom); i += 2 {
+		op := rom[i] >> 4
+		if op != 0x1 && op != 0x2 && op != 0xA {
+			continue
+		}
+		nnn := int(rom[i]&0xF)<<8 | int(rom[i+1])
+		if inside(nnn, emu.RamProgramStart) {
+			standard++
+		}
+		if inside(nnn, etiLoadAddress) {
+			eti++
+		}
+	}
+	if eti >= 3 && eti > 2*standard {
+		return etiLoadAddress
+	}
+
+	return emu.RamProgramStart
+}
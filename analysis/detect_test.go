@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+func TestDetect(t *testing.T) {
+	tetris, err := emu.ReadROM("../games/TETRIS.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := append(append([]byte(nil), tetris...), 0)
+
+	hires := append([]byte{0x12, 0x60}, make([]byte, 0x5E)...)
+	hires = append(hires, 0x02, 0x30, 0x12, 0x62)
+
+	eti := []byte{
+		0xA6, 0x0A, // 200 LD I, 0x60A
+		0x26, 0x08, // 202 CALL 0x608
+		0x16, 0x04, // 204 JP 0x604
+		0x12, 0x06, // 206 JP 0x206
+		0x00, 0xEE, // 208 RET
+		0xF0, 0x90, // 20A data
+	}
+
+	tests := []struct {
+		name       string
+		rom        []byte
+		platform   Platform
+		quirks     string
+		confidence float64
+		reason     string
+		supported  bool
+	}{
+		{"known", tetris, PlatformCHIP8, "default", 1, "known ROM: Tetris", true},
+		{"unknown", changed, PlatformCHIP8, "default", 0.9, "no SCHIP or XO-CHIP instructions", true},
+		{"schip", []byte{0x00, 0xFF, 0x00, 0xFE, 0x00, 0xFD}, PlatformSCHIP, "schip", evidence(3), "SCHIP instructions 00FD, 00FE, 00FF", false},
+		{"xochip", []byte{0xF0, 0x02, 0x00, 0xFD}, PlatformXOCHIP, "loadstore", evidence(1), "XO-CHIP instructions F002", false},
+		{"large", make([]byte, emu.RamProgramSize+1), PlatformXOCHIP, "loadstore", 0.9, "3585 bytes", false},
+		{"hires", hires, PlatformHires, "cosmac", 0.95, "clears the screen with 0230", false},
+		{"eti", eti, PlatformCHIP8, "default", 0.45, "loading at 0x600", false},
+		{"invalid", []byte{0xFF, 0xFF}, PlatformCHIP8, "default", 0.45, "invalid instructions at 0x200", true},
+		{"schip hires", []byte{0x00, 0xFF, 0xD0, 0x10, 0x12, 0x04}, PlatformSCHIP, "schip", evidence(2), "SCHIP instructions 00FF, Dxy0", true},
+	}
+	for _, test := range tests {
+		d := Detect(test.rom)
+		if d.Platform != test.platform || d.Quirks != test.quirks || d.Confidence != test.confidence {
+			t.Errorf("%s: expected %s, quirks %s (%.0f%% confident) but was %s", test.name, test.platform, test.quirks, 100*test.confidence, d)
+		}
+		if reasons := strings.Join(d.Reasons, "; "); !strings.Contains(reasons, test.reason) {
+			t.Errorf("%s: expected the reasons %q to include %q", test.name, reasons, test.reason)
+		}
+		if d.Supported() != test.supported {
+			t.Errorf("%s: expected supported to be %t but unsupported were %v", test.name, test.supported, d.Unsupported)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	for _, name := range []string{"chip8", "hires", "schip", "XOCHIP"} {
+		if _, err := ParsePlatform(name); err != nil {
+			t.Errorf("Expected %s to parse but was %v", name, err)
+		}
+	}
+	if _, err := ParsePlatform("megachip"); err == nil {
+		t.Error("Expected megachip to be unknown")
+	}
+}
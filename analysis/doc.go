@@ -0,0 +1,4 @@
+// Package analysis reads CHIP-8 programs without running them: which bytes
+// are reachable code, how control flows between them, and what the
+// instructions can do to memory, for the linter and other tools.
+package analysis
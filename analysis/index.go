@@ -0,0 +1,252 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+const (
+	// maxSpans is how many separate spans of addresses an IndexRange keeps
+	// before merging the closest, so that I holding one of several tables
+	// doesn't cover the code between them
+	maxSpans = 8
+	// maxWidening is how often the range before an instruction can grow
+	// before it is given up as unknown, so that loops stepping I settle
+	maxWidening = 16
+)
+
+// Span is the addresses from Lo to Hi inclusive
+type Span struct {
+	Lo, Hi int
+}
+
+func (s Span) String() string {
+	if s.Lo == s.Hi {
+		return fmt.Sprintf("0x%03X", s.Lo)
+	}
+
+	return fmt.Sprintf("0x%03X-0x%03X", s.Lo, s.Hi)
+}
+
+// IndexRange is the values I can hold at an instruction, as a few spans of
+// addresses, or Unknown when they can't be worked out, such as after a
+// subroutine returns
+type IndexRange struct {
+	Unknown bool
+	Spans   []Span
+}
+
+func (r IndexRange) String() string {
+	if r.Unknown {
+		return "unknown"
+	}
+	spans := make([]string, len(r.Spans))
+	for i, s := range r.Spans {
+		spans[i] = s.String()
+	}
+
+	return strings.Join(spans, ", ")
+}
+
+// exactly is the range of a single value
+func exactly(v int) IndexRange {
+	return IndexRange{Spans: []Span{{v, v}}}
+}
+
+// add moves the range by lo to hi more, as adding Vx to I does
+func (r IndexRange) add(lo, hi int) IndexRange {
+	if r.Unknown {
+		return r
+	}
+	spans := make([]Span, len(r.Spans))
+	for i, s := range r.Spans {
+		spans[i] = Span{s.Lo + lo, s.Hi + hi}
+	}
+
+	return normalize(spans)
+}
+
+// extend gives the addresses an access of length bytes from I touches
+func (r IndexRange) extend(length int) IndexRange {
+	return r.add(0, length-1)
+}
+
+// union is the values in either range
+func (r IndexRange) union(o IndexRange) IndexRange {
+	if r.Unknown || o.Unknown {
+		return IndexRange{Unknown: true}
+	}
+
+	return normalize(append(append([]Span(nil), r.Spans...), o.Spans...))
+}
+
+func (r IndexRange) equal(o IndexRange) bool {
+	if r.Unknown != o.Unknown || len(r.Spans) != len(o.Spans) {
+		return false
+	}
+	for i := range r.Spans {
+		if r.Spans[i] != o.Spans[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Max is the highest value in the range
+func (r IndexRange) Max() int {
+	if len(r.Spans) == 0 {
+		return 0
+	}
+
+	return r.Spans[len(r.Spans)-1].Hi
+}
+
+// normalize sorts spans and merges those that touch, then the closest
+// until there are at most maxSpans
+func normalize(spans []Span) IndexRange {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Lo < spans[j].Lo })
+	var merged []Span
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.Lo <= merged[n-1].Hi+1 {
+			if s.Hi > merged[n-1].Hi {
+				merged[n-1].Hi = s.Hi
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+
+	for len(merged) > maxSpans {
+		closest := 0
+		for i := 1; i+1 < len(merged); i++ {
+			if merged[i+1].Lo-merged[i].Hi < merged[closest+1].Lo-merged[closest].Hi {
+				closest = i
+			}
+		}
+		merged[closest].Hi = merged[closest+1].Hi
+		merged = append(merged[:closest+1], merged[closest+2:]...)
+	}
+
+	return IndexRange{Spans: merged}
+}
+
+// IndexRanges works out the values I can hold as each reachable instruction
+// starts. I is 0 at the start, and Annn, Fx29 and F000 nnnn set it, while
+// Fx1E adds up to 255 to it and Fx55 and Fx65 may move it past the registers
+// they store or load, depending on the quirks. A subroutine starts with the
+// ranges of all the calls to it, while I after a call is unknown.
+func (p *Program) IndexRanges() map[uint16]IndexRange {
+	ranges := map[uint16]IndexRange{emu.RamProgramStart: exactly(0)}
+	changes := make(map[uint16]int)
+	work := []uint16{emu.RamProgramStart}
+
+	flow := func(addr uint16, r IndexRange) {
+		if _, ok := p.Instructions[addr]; !ok {
+			return
+		}
+		old, ok := ranges[addr]
+		if ok {
+			r = old.union(r)
+			if r.equal(old) {
+				return
+			}
+			if changes[addr]++; changes[addr] > maxWidening {
+				r = IndexRange{Unknown: true}
+			}
+		}
+		ranges[addr] = r
+		work = append(work, addr)
+	}
+
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		ins := p.Instructions[addr]
+		in := ranges[addr]
+
+		out := p.indexAfter(ins, in)
+		if ins.Flow == FlowCall {
+			flow(ins.Target, in)
+			out = IndexRange{Unknown: true}
+		}
+		for _, next := range ins.Next {
+			flow(next, out)
+		}
+	}
+
+	return ranges
+}
+
+// indexAfter is the range of I after an instruction runs
+func (p *Program) indexAfter(ins *Instruction, in IndexRange) IndexRange {
+	x := int(ins.X())
+	switch ins.Name {
+	case "Annn":
+		return exactly(int(ins.Opcode & 0xFFF))
+	case "Fx1E":
+		return in.add(0, 0xFF)
+	case "Fx29":
+		return IndexRange{Spans: []Span{{int(emu.RamFontStart), int(emu.RamFontStart) + emu.RamFontSize - 1}}}
+	case "Fx55", "Fx65":
+		return in.union(in.add(x+1, x+1))
+	case "F000":
+		return exactly(int(p.Memory.Opcode(ins.Addr + 2)))
+	}
+
+	return in
+}
+
+// Access is the memory an instruction reads or writes through I
+type Access struct {
+	// Length is the number of bytes from I
+	Length int
+	Write  bool
+}
+
+// IndexAccess gives the bytes an instruction reads or writes from I,
+// if it does
+func (ins *Instruction) IndexAccess() (Access, bool) {
+	x := int(ins.X())
+	switch ins.Name {
+	case "Dxyn":
+		return Access{Length: int(ins.Opcode & 0xF)}, true
+	case "Dxy0":
+		// a 16x16 SCHIP sprite is two bytes a row
+		return Access{Length: 32}, true
+	case "Fx33":
+		return Access{Length: 3, Write: true}, true
+	case "Fx55":
+		return Access{Length: x + 1, Write: true}, true
+	case "Fx65":
+		return Access{Length: x + 1}, true
+	}
+
+	return Access{}, false
+}
+
+// CodeWrites gives the bytes of reachable code that writes through I can
+// change, as far as the values of I are known
+func (p *Program) CodeWrites() map[uint16]bool {
+	written := make(map[uint16]bool)
+	ranges := p.IndexRanges()
+	for _, ins := range p.Instructions {
+		a, ok := ins.IndexAccess()
+		r := ranges[ins.Addr]
+		if !ok || !a.Write || r.Unknown {
+			continue
+		}
+		for _, s := range r.extend(a.Length).Spans {
+			for addr := s.Lo; addr <= s.Hi; addr++ {
+				if p.IsCode(addr) {
+					written[uint16(addr)] = true
+				}
+			}
+		}
+	}
+
+	return written
+}
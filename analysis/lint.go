@@ -0,0 +1,313 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// stackDepth is how many calls can be nested: 2nnn moves SP up before
+// storing the return address, so the first entry of the stack goes unused
+const stackDepth = len(emu.CPU{}.Stack) - 1
+
+// Checks the linter makes, which name its warnings
+const (
+	CheckInvalid       = "invalid"
+	CheckExtension     = "extension"
+	CheckSelfModifying = "self-modifying"
+	CheckStack         = "stack"
+	CheckIndex         = "index"
+	CheckQuirk         = "quirk"
+)
+
+// Warning is something the linter found at an address
+type Warning struct {
+	Addr    uint16
+	Check   string
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("0x%03X: %s: %s", w.Addr, w.Check, w.Message)
+}
+
+// Suggestion is the quirks profile that a program looks to be written for,
+// as a preset name, with the reasons for it
+type Suggestion struct {
+	Preset  string
+	Reasons []string
+}
+
+func (s Suggestion) String() string {
+	if len(s.Reasons) == 0 {
+		return s.Preset
+	}
+
+	return fmt.Sprintf("%s (%s)", s.Preset, strings.Join(s.Reasons, "; "))
+}
+
+// Lint looks through a program's reachable code for instructions that would
+// stop the emulator or that behave differently between interpreters:
+// invalid instructions, SCHIP and XO-CHIP instructions, writes through I
+// over code, calls nested deeper than the stack, accesses through I past
+// the end of memory and instructions that depend on the quirks. It returns
+// the warnings in order of address, with the quirks profile to run it with.
+func Lint(p *Program) ([]Warning, Suggestion) {
+	l := &linter{p: p, ranges: p.IndexRanges(), main: make(map[uint16]bool)}
+	for _, ins := range l.body(emu.RamProgramStart) {
+		l.main[ins.Addr] = true
+	}
+	for _, addr := range p.Addresses() {
+		l.instruction(p.Instructions[addr])
+	}
+	l.stack()
+
+	sort.SliceStable(l.warnings, func(i, j int) bool {
+		return l.warnings[i].Addr < l.warnings[j].Addr
+	})
+
+	return l.warnings, l.suggest()
+}
+
+// linter gathers the warnings and the evidence for each quirk
+type linter struct {
+	p      *Program
+	ranges map[uint16]IndexRange
+	// main holds the instructions of the main program, outside subroutines
+	main     map[uint16]bool
+	warnings []Warning
+
+	schip     []uint16
+	jump      []uint16
+	shift     []uint16
+	loadstore []uint16
+}
+
+func (l *linter) warn(addr uint16, check, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, Warning{Addr: addr, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// instruction makes the checks on a single instruction
+func (l *linter) instruction(ins *Instruction) {
+	switch ins.Extension {
+	case Invalid:
+		if int(ins.Addr)+1 >= emu.RamSize {
+			l.warn(ins.Addr, CheckInvalid, "the program runs off the end of memory")
+		} else {
+			l.warn(ins.Addr, CheckInvalid, "%04X isn't a CHIP-8, SCHIP or XO-CHIP instruction", ins.Opcode)
+		}
+		return
+	case SCHIP, XOCHIP:
+		l.warn(ins.Addr, CheckExtension, "%s is a %s instruction, which the emulator doesn't run", ins.Name, ins.Extension)
+		if ins.Extension == SCHIP {
+			l.schip = append(l.schip, ins.Addr)
+		}
+	}
+
+	if ins.Flow == FlowReturn && l.main[ins.Addr] {
+		l.warn(ins.Addr, CheckStack, "00EE returns from the main program, with nothing on the stack")
+	}
+
+	l.access(ins)
+
+	switch ins.Name {
+	case "8xy6", "8xyE":
+		if ins.X() != ins.Y() {
+			l.warn(ins.Addr, CheckQuirk, "%s shifts V%X into V%X with the shift quirk, or V%X in place without it", ins.Name, ins.Y(), ins.X(), ins.X())
+			l.shift = append(l.shift, ins.Addr)
+		}
+	case "Fx55", "Fx65":
+		if use := l.indexUse(ins); use != nil {
+			l.warn(ins.Addr, CheckQuirk, "%s leaves I for the %s at 0x%03X, which the loadstore quirk moves it on for", ins.Name, use.Name, use.Addr)
+			l.loadstore = append(l.loadstore, ins.Addr)
+		}
+	case "Bnnn":
+		if ins.X() != 0 {
+			l.warn(ins.Addr, CheckQuirk, "Bnnn adds V%X to 0x%03X with the jump quirk, or V0 without it", ins.X(), ins.Opcode&0xFFF)
+			l.jump = append(l.jump, ins.Addr)
+		}
+	}
+}
+
+// access checks the memory an instruction reads or writes through I
+func (l *linter) access(ins *Instruction) {
+	a, ok := ins.IndexAccess()
+	r := l.ranges[ins.Addr]
+	if !ok || a.Length == 0 || r.Unknown {
+		return
+	}
+	touched := r.extend(a.Length)
+
+	verb := "reads"
+	if a.Write {
+		verb = "writes"
+	}
+	if end := touched.Max(); end >= emu.RamSize {
+		l.warn(ins.Addr, CheckIndex, "%s %s up to 0x%03X, past the end of memory", ins.Name, verb, end)
+	}
+	if !a.Write {
+		return
+	}
+	for _, s := range touched.Spans {
+		for addr := s.Lo; addr <= s.Hi; addr++ {
+			if l.p.IsCode(addr) {
+				l.warn(ins.Addr, CheckSelfModifying, "%s can write %s, over the code at 0x%03X", ins.Name, touched, addr)
+				return
+			}
+		}
+	}
+}
+
+// indexUse looks along the paths from a load or store for an instruction
+// that uses I before anything sets it again, following calls but not returns
+func (l *linter) indexUse(from *Instruction) *Instruction {
+	seen := make(map[uint16]bool)
+	work := append([]uint16(nil), from.Next...)
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		ins, ok := l.p.Instructions[addr]
+		if !ok || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		if _, uses := ins.IndexAccess(); uses || ins.Name == "Fx1E" {
+			return ins
+		}
+		switch ins.Name {
+		case "Annn", "Fx29", "F000":
+			continue
+		}
+		if ins.Flow == FlowCall {
+			work = append(work, ins.Target)
+		}
+		work = append(work, ins.Next...)
+	}
+
+	return nil
+}
+
+// body is the code of a subroutine: the instructions reachable from its
+// start without going into the subroutines it calls
+func (l *linter) body(start uint16) []*Instruction {
+	var body []*Instruction
+	seen := make(map[uint16]bool)
+	work := []uint16{start}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		ins, ok := l.p.Instructions[addr]
+		if !ok || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		body = append(body, ins)
+		work = append(work, ins.Next...)
+	}
+	sort.Slice(body, func(i, j int) bool { return body[i].Addr < body[j].Addr })
+
+	return body
+}
+
+// stack checks how deep calls can nest from the main program, warning
+// about recursion and about nesting deeper than the stack
+func (l *linter) stack() {
+	depths := make(map[uint16]int)
+	// deepest is the call in each subroutine that leads to the most nesting
+	deepest := make(map[uint16]*Instruction)
+	active := make(map[uint16]bool)
+
+	var depth func(start uint16) int
+	depth = func(start uint16) int {
+		if d, ok := depths[start]; ok {
+			return d
+		}
+		active[start] = true
+		max := 0
+		for _, ins := range l.body(start) {
+			if ins.Flow != FlowCall {
+				continue
+			}
+			if active[ins.Target] {
+				l.warn(ins.Addr, CheckStack, "calls 0x%03X while it is still running, using another stack entry each time round", ins.Target)
+				continue
+			}
+			if d := 1 + depth(ins.Target); d > max {
+				max = d
+				deepest[start] = ins
+			}
+		}
+		active[start] = false
+		depths[start] = max
+
+		return max
+	}
+
+	if depth(emu.RamProgramStart) <= stackDepth {
+		return
+	}
+	var chain []string
+	var over *Instruction
+	for start := uint16(emu.RamProgramStart); deepest[start] != nil; start = deepest[start].Target {
+		chain = append(chain, fmt.Sprintf("0x%03X", deepest[start].Target))
+		if len(chain) == stackDepth+1 {
+			over = deepest[start]
+		}
+	}
+	l.warn(over.Addr, CheckStack, "calls nest %d deep, through %s, but the stack holds %d", len(chain), strings.Join(chain, ", "), stackDepth)
+}
+
+// suggest picks the quirks preset the evidence points to: schip for SCHIP
+// instructions or a Bnnn that depends on the jump quirk, then cosmac for
+// loads and stores that depend on I moving, or shifts of another register
+// than V0 into Vx, as later interpreters ignore Vy, and default otherwise
+func (l *linter) suggest() Suggestion {
+	var s Suggestion
+	if len(l.schip) > 0 {
+		s.Reasons = append(s.Reasons, "SCHIP instructions"+at(l.schip))
+	}
+	if len(l.jump) > 0 {
+		s.Reasons = append(s.Reasons, "Bxnn jumps"+at(l.jump))
+	}
+	if len(s.Reasons) > 0 {
+		s.Preset = "schip"
+		return s
+	}
+
+	if len(l.loadstore) > 0 {
+		s.Reasons = append(s.Reasons, "loads and stores leaving I to be used"+at(l.loadstore))
+	}
+	var shifts []uint16
+	for _, addr := range l.shift {
+		if l.p.Instructions[addr].Y() != 0 {
+			shifts = append(shifts, addr)
+		}
+	}
+	if len(shifts) > 0 {
+		s.Reasons = append(s.Reasons, "shifts reading Vy"+at(shifts))
+	}
+	s.Preset = "default"
+	if len(s.Reasons) > 0 {
+		s.Preset = "cosmac"
+	}
+
+	return s
+}
+
+// at lists the first few addresses some evidence was found at
+func at(addrs []uint16) string {
+	const shown = 3
+	list := make([]string, 0, shown)
+	for i, addr := range addrs {
+		if i == shown {
+			list = append(list, "...")
+			break
+		}
+		list = append(list, fmt.Sprintf("0x%03X", addr))
+	}
+
+	return " at " + strings.Join(list, ", ")
+}
@@ -0,0 +1,102 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+)
+
+// lintWarnings runs the linter on a ROM, giving its warnings as
+// "addr check" strings and the suggested preset
+func lintWarnings(rom []byte) ([]string, []Warning, Suggestion) {
+	warnings, suggestion := Lint(Analyze(rom))
+	var found []string
+	for _, w := range warnings {
+		found = append(found, strings.SplitN(w.String(), ":", 3)[0]+" "+w.Check)
+	}
+
+	return found, warnings, suggestion
+}
+
+func TestLint(t *testing.T) {
+	found, warnings, suggestion := lintWarnings([]byte{
+		0xA2, 0x0A, // 200 LD I, 0x20A
+		0xF1, 0x55, // 202 LD [I], V1
+		0xAF, 0xFE, // 204 LD I, 0xFFE
+		0xD0, 0x05, // 206 DRW V0, V0, 5
+		0x80, 0x16, // 208 SHR V0, V1
+		0x12, 0x0C, // 20A JP 0x20C
+		0x00, 0xEE, // 20C RET
+	})
+
+	want := "0x202 self-modifying, 0x206 index, 0x208 quirk, 0x20C stack"
+	if got := strings.Join(found, ", "); got != want {
+		t.Errorf("Expected warnings %s but were %s", want, got)
+	}
+	for _, w := range warnings {
+		if w.Check == CheckSelfModifying && !strings.Contains(w.Message, "0x20A-0x20B") {
+			t.Errorf("Expected the store's range in %q", w)
+		}
+	}
+	if suggestion.Preset != "cosmac" || !strings.Contains(suggestion.String(), "shifts reading Vy at 0x208") {
+		t.Errorf("Expected the shift to suggest cosmac but was %s", suggestion)
+	}
+}
+
+func TestLintExtensions(t *testing.T) {
+	found, _, suggestion := lintWarnings([]byte{
+		0x22, 0x04, // 200 CALL 0x204
+		0xFF, 0xFF, // 202 invalid
+		0x22, 0x04, // 204 CALL 0x204
+		0x00, 0xFF, // 206 HIGH
+		0xB3, 0x0C, // 208 JP V3, 0x30C
+	})
+
+	want := "0x202 invalid, 0x204 stack, 0x206 extension, 0x208 quirk"
+	if got := strings.Join(found, ", "); got != want {
+		t.Errorf("Expected warnings %s but were %s", want, got)
+	}
+	if suggestion.Preset != "schip" || len(suggestion.Reasons) != 2 {
+		t.Errorf("Expected SCHIP instructions and Bxnn to suggest schip but was %s", suggestion)
+	}
+}
+
+func TestLintLoadStore(t *testing.T) {
+	found, _, suggestion := lintWarnings([]byte{
+		0xA3, 0x00, // 200 LD I, 0x300
+		0xF1, 0x65, // 202 LD V1, [I]
+		0xA3, 0x00, // 204 LD I, 0x300
+		0xF1, 0x65, // 206 LD V1, [I]
+		0xF1, 0x33, // 208 LD B, V1
+		0x12, 0x08, // 20A JP 0x208
+	})
+
+	if got := strings.Join(found, ", "); got != "0x206 quirk" {
+		t.Errorf("Expected only the second load to depend on the loadstore quirk but were %s", got)
+	}
+	if suggestion.Preset != "cosmac" {
+		t.Errorf("Expected cosmac but was %s", suggestion)
+	}
+}
+
+func TestLintStackDepth(t *testing.T) {
+	var rom []byte
+	for i := 1; i <= stackDepth+1; i++ {
+		addr := 0x200 + 2*i
+		rom = append(rom, byte(0x20|addr>>8), byte(addr))
+	}
+	rom = append(rom, 0x12, 0x00) // 220 JP 0x200
+
+	_, warnings, suggestion := lintWarnings(rom)
+	var deep []Warning
+	for _, w := range warnings {
+		if w.Check == CheckStack && strings.Contains(w.Message, "nest") {
+			deep = append(deep, w)
+		}
+	}
+	if len(deep) != 1 || deep[0].Addr != 0x21E || !strings.Contains(deep[0].Message, "nest 16 deep") {
+		t.Errorf("Expected the 16th call to overflow the stack but was %v", deep)
+	}
+	if suggestion.Preset != "default" {
+		t.Errorf("Expected default but was %s", suggestion)
+	}
+}
@@ -0,0 +1,257 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// maxJumpTable is the most entries a jump table for Bnnn can have,
+// as V0 picks one of 128 two-byte jumps
+const maxJumpTable = 128
+
+// Extension is the interpreter an instruction was made for
+type Extension int
+
+const (
+	CHIP8 Extension = iota
+	SCHIP
+	XOCHIP
+	// Invalid instructions aren't in any of them
+	Invalid
+)
+
+func (e Extension) String() string {
+	return [...]string{"CHIP-8", "SCHIP", "XO-CHIP", "invalid"}[e]
+}
+
+// Flow is how an instruction passes control on
+type Flow int
+
+const (
+	// FlowNext carries on with the next instruction
+	FlowNext Flow = iota
+	// FlowJump goes to Target, for 1nnn
+	FlowJump
+	// FlowSkip carries on with the next instruction or the one after it
+	FlowSkip
+	// FlowCall calls the subroutine at Target, then carries on after it
+	FlowCall
+	// FlowReturn returns from a subroutine, for 00EE
+	FlowReturn
+	// FlowComputed jumps to an address worked out as it runs, for Bnnn
+	FlowComputed
+	// FlowStop ends the program, for SCHIP's 00FD exit and invalid instructions
+	FlowStop
+)
+
+// Instruction is an instruction found by following a program from its start
+type Instruction struct {
+	Addr   uint16
+	Opcode uint16
+	// Size is 4 for XO-CHIP's F000 nnnn, which loads I from
+	// the two bytes after it, and 2 for the rest
+	Size      uint16
+	Extension Extension
+	// Name is the instruction's form as the specifications write it,
+	// such as 8xy6 or 00FF, or DW for an invalid instruction
+	Name string
+	Flow Flow
+	// Target is where a jump goes or the subroutine a call calls
+	Target uint16
+	// Next are the addresses that can run after the instruction,
+	// including after a call returns but not the subroutine it calls
+	Next []uint16
+}
+
+func (ins *Instruction) String() string {
+	return fmt.Sprintf("0x%03X %04X %s", ins.Addr, ins.Opcode, emu.Disassemble(ins.Opcode))
+}
+
+// X and Y are the register numbers in the instruction
+func (ins *Instruction) X() byte { return byte(ins.Opcode >> 8 & 0xF) }
+func (ins *Instruction) Y() byte { return byte(ins.Opcode >> 4 & 0xF) }
+
+// Program is the code reachable from the start of a ROM
+type Program struct {
+	ROM []byte
+	// Memory is laid out as the emulator starts, with the font and the ROM
+	Memory *emu.Memory
+	// Instructions are the reachable instructions by address
+	Instructions map[uint16]*Instruction
+	// Subroutines maps the address of each subroutine to the calls to it
+	Subroutines map[uint16][]uint16
+	// Tables are the targets guessed for each computed Bnnn jump. A Bnnn
+	// usually jumps into a table of 1nnn jumps, so the jumps from nnn on
+	// are taken as its targets, or nnn alone if there are none.
+	Tables map[uint16][]uint16
+
+	code [emu.RamSize]bool
+}
+
+// Analyze follows a ROM's control flow from RamProgramStart, through
+// jumps, skips, calls and guessed jump tables, to find its reachable code
+func Analyze(rom []byte) *Program {
+	p := &Program{
+		ROM:          rom,
+		Memory:       &emu.Memory{},
+		Instructions: make(map[uint16]*Instruction),
+		Subroutines:  make(map[uint16][]uint16),
+		Tables:       make(map[uint16][]uint16),
+	}
+	p.Memory.Setup()
+	if len(rom) <= emu.RamProgramSize {
+		p.Memory.LoadROM(rom)
+	}
+
+	work := []uint16{emu.RamProgramStart}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		if _, ok := p.Instructions[addr]; ok {
+			continue
+		}
+
+		ins := p.decode(addr)
+		p.Instructions[addr] = ins
+		for i := uint16(0); i < ins.Size && int(addr+i) < emu.RamSize; i++ {
+			p.code[addr+i] = true
+		}
+		if ins.Flow == FlowCall {
+			p.Subroutines[ins.Target] = append(p.Subroutines[ins.Target], addr)
+			work = append(work, ins.Target)
+		}
+		for _, next := range ins.Next {
+			if next < emu.RamSize {
+				work = append(work, next)
+			}
+		}
+	}
+	for _, calls := range p.Subroutines {
+		sort.Slice(calls, func(i, j int) bool { return calls[i] < calls[j] })
+	}
+
+	return p
+}
+
+// Addresses returns the addresses of the reachable instructions in order
+func (p *Program) Addresses() []uint16 {
+	addrs := make([]uint16, 0, len(p.Instructions))
+	for addr := range p.Instructions {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	return addrs
+}
+
+// IsCode reports whether a byte is part of a reachable instruction
+func (p *Program) IsCode(addr int) bool {
+	return addr >= 0 && addr < emu.RamSize && p.code[addr]
+}
+
+// decode reads the instruction at an address and works out where it goes
+func (p *Program) decode(addr uint16) *Instruction {
+	ins := &Instruction{Addr: addr, Size: 2, Name: "DW", Extension: Invalid, Flow: FlowStop}
+	// the last byte of memory can't hold an instruction
+	if int(addr)+1 >= emu.RamSize {
+		return ins
+	}
+	ins.Opcode = p.Memory.Opcode(addr)
+	ins.Name, ins.Extension = classify(ins.Opcode)
+	if ins.Name == "F000" {
+		ins.Size = 4
+	}
+
+	next := addr + ins.Size
+	switch {
+	case ins.Extension == Invalid:
+		return ins
+	case ins.Name == "00FD":
+		ins.Flow = FlowStop
+	case ins.Name == "00EE":
+		ins.Flow = FlowReturn
+	case ins.Name == "1nnn":
+		ins.Flow, ins.Target = FlowJump, ins.Opcode&0xFFF
+		ins.Next = []uint16{ins.Target}
+	case ins.Name == "2nnn":
+		ins.Flow, ins.Target = FlowCall, ins.Opcode&0xFFF
+		ins.Next = []uint16{next}
+	case ins.Name == "Bnnn":
+		ins.Flow = FlowComputed
+		ins.Next = p.jumpTable(ins.Opcode & 0xFFF)
+		p.Tables[addr] = ins.Next
+	case isSkip(ins.Name):
+		ins.Flow = FlowSkip
+		// XO-CHIP skips all four bytes of an F000 nnnn
+		skipped := uint16(2)
+		if int(next)+1 < emu.RamSize && p.Memory.Opcode(next) == 0xF000 {
+			skipped = 4
+		}
+		ins.Next = []uint16{next, next + skipped}
+	default:
+		ins.Flow = FlowNext
+		ins.Next = []uint16{next}
+	}
+
+	return ins
+}
+
+// jumpTable guesses the targets of a Bnnn jumping to base
+func (p *Program) jumpTable(base uint16) []uint16 {
+	var targets []uint16
+	for addr := base; len(targets) < maxJumpTable && int(addr)+1 < emu.RamSize; addr += 2 {
+		if p.Memory.Opcode(addr)&0xF000 != 0x1000 {
+			break
+		}
+		targets = append(targets, addr)
+	}
+	if len(targets) == 0 {
+		targets = append(targets, base)
+	}
+
+	return targets
+}
+
+// isSkip reports whether an instruction can skip the next one
+func isSkip(name string) bool {
+	switch name {
+	case "3xkk", "4xkk", "5xy0", "9xy0", "Ex9E", "ExA1":
+		return true
+	}
+
+	return false
+}
+
+// classify names an instruction's form and the interpreter it is from
+func classify(op uint16) (string, Extension) {
+	kk := op & 0xFF
+	switch {
+	case op&0xFFF0 == 0x00C0:
+		return "00Cn", SCHIP
+	case op&0xFFF0 == 0x00D0:
+		return "00Dn", XOCHIP
+	case op >= 0x00FB && op <= 0x00FF:
+		return fmt.Sprintf("%04X", op), SCHIP
+	case op&0xF00F == 0xD000:
+		// CHIP-8 draws nothing for n = 0, where SCHIP draws a 16x16 sprite
+		return "Dxy0", SCHIP
+	case op&0xF00F == 0x5002, op&0xF00F == 0x5003:
+		return fmt.Sprintf("5xy%X", op&0xF), XOCHIP
+	case op == 0xF000, op == 0xF002:
+		return fmt.Sprintf("%04X", op), XOCHIP
+	case op&0xF0FF == 0xF001:
+		return "Fn01", XOCHIP
+	case op&0xF000 == 0xF000 && kk == 0x3A:
+		return "Fx3A", XOCHIP
+	case op&0xF000 == 0xF000 && (kk == 0x30 || kk == 0x75 || kk == 0x85):
+		return fmt.Sprintf("Fx%02X", kk), SCHIP
+	}
+
+	if name := emu.OpcodeClass(op); name != "DW" {
+		return name, CHIP8
+	}
+
+	return "DW", Invalid
+}
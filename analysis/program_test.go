@@ -0,0 +1,115 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+// tableROM jumps through a table of jumps, leaving data unreachable
+var tableROM = []byte{
+	0xB2, 0x06, // 200 JP V0, 0x206
+	0xFF, 0xFF, // 202 data
+	0xFF, 0xFF, // 204 data
+	0x12, 0x0C, // 206 JP 0x20C
+	0x12, 0x0E, // 208 JP 0x20E
+	0xFF, 0xFF, // 20A data
+	0x30, 0x00, // 20C SE V0, 0x00
+	0xF0, 0x00, // 20E LD I, long 0x00FD
+	0x00, 0xFD, // 210
+	0x00, 0xFD, // 212 EXIT
+}
+
+func TestAnalyze(t *testing.T) {
+	p := Analyze(tableROM)
+
+	want := []uint16{0x200, 0x206, 0x208, 0x20C, 0x20E, 0x212}
+	if addrs := p.Addresses(); !reflect.DeepEqual(addrs, want) {
+		t.Errorf("Expected instructions at %X but were at %X", want, addrs)
+	}
+	if table := p.Tables[0x200]; !reflect.DeepEqual(table, []uint16{0x206, 0x208}) {
+		t.Errorf("Expected the jump table to be 206 and 208 but was %X", table)
+	}
+	if next := p.Instructions[0x20C].Next; !reflect.DeepEqual(next, []uint16{0x20E, 0x212}) {
+		t.Errorf("Expected the skip to go over all of F000 nnnn but went to %X", next)
+	}
+	if ins := p.Instructions[0x20E]; ins.Size != 4 || ins.Extension != XOCHIP || !p.IsCode(0x211) {
+		t.Errorf("Expected F000 nnnn to be a four byte XO-CHIP instruction but was %+v", ins)
+	}
+	if ins := p.Instructions[0x212]; ins.Flow != FlowStop || ins.Extension != SCHIP {
+		t.Errorf("Expected 00FD to stop the program but was %+v", ins)
+	}
+	if p.IsCode(0x202) || p.IsCode(0x20A) {
+		t.Error("Expected the data to be unreachable")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		op        uint16
+		name      string
+		extension Extension
+	}{
+		{0x00E0, "00E0", CHIP8},
+		{0x0123, "0nnn", CHIP8},
+		{0x00C4, "00Cn", SCHIP},
+		{0x00D4, "00Dn", XOCHIP},
+		{0x00FF, "00FF", SCHIP},
+		{0x8126, "8xy6", CHIP8},
+		{0xD120, "Dxy0", SCHIP},
+		{0x5122, "5xy2", XOCHIP},
+		{0x5124, "DW", Invalid},
+		{0xF201, "Fn01", XOCHIP},
+		{0xF130, "Fx30", SCHIP},
+		{0xF13A, "Fx3A", XOCHIP},
+		{0xF1FF, "DW", Invalid},
+	}
+
+	for _, test := range tests {
+		name, extension := classify(test.op)
+		if name != test.name || extension != test.extension {
+			t.Errorf("Expected %04X to be %s %s but was %s %s", test.op, test.extension, test.name, extension, name)
+		}
+	}
+}
+
+func TestIndexRanges(t *testing.T) {
+	p := Analyze([]byte{
+		0xA3, 0x00, // 200 LD I, 0x300
+		0xF0, 0x1E, // 202 ADD I, V0
+		0x22, 0x0A, // 204 CALL 0x20A
+		0xD0, 0x01, // 206 DRW V0, V0, 1
+		0x12, 0x08, // 208 JP 0x208
+		0xD0, 0x01, // 20A DRW V0, V0, 1
+		0x00, 0xEE, // 20C RET
+	})
+	ranges := p.IndexRanges()
+
+	tests := []struct {
+		addr uint16
+		want string
+	}{
+		{0x200, "0x000"},
+		{0x202, "0x300"},
+		{0x204, "0x300-0x3FF"},
+		{0x20A, "0x300-0x3FF"},
+		{0x206, "unknown"},
+	}
+	for _, test := range tests {
+		if r := ranges[test.addr].String(); r != test.want {
+			t.Errorf("Expected I at 0x%03X to be %s but was %s", test.addr, test.want, r)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	var spans []Span
+	for i := 0; i < 10; i++ {
+		spans = append(spans, Span{0x300 + i*0x10, 0x300 + i*0x10})
+	}
+	spans = append(spans, Span{0x301, 0x310})
+
+	r := normalize(spans)
+	if len(r.Spans) != maxSpans || r.Spans[0] != (Span{0x300, 0x320}) || r.Max() != 0x390 {
+		t.Errorf("Expected the closest spans to merge but were %s", r)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"io"
+
+	"github.com/hajimehoshi/ebiten/audio"
+	"github.com/szTheory/chip8go/emu"
+)
+
+// newAudioPlayer plays an infinite stream of beeper samples
+func newAudioPlayer(stream io.ReadCloser) (*audio.Player, error) {
+	audioContext := audio.CurrentContext()
+	if audioContext == nil {
+		var err error
+		if audioContext, err = audio.NewContext(emu.BeeperSampleRate); err != nil {
+			return nil, err
+		}
+	}
+
+	audioPlayer, err := audio.NewPlayer(audioContext, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	// After calling Play, the stream never ends as long as the player object lives.
+	if err := audioPlayer.Play(); err != nil {
+		return nil, err
+	}
+
+	return audioPlayer, nil
+}
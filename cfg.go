@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/szTheory/chip8go/analysis"
+	"github.com/szTheory/chip8go/emu"
+)
+
+// runCFG writes a ROM's control-flow graph as Graphviz DOT or JSON,
+// picking the format from -format or the -o file's extension
+func runCFG(args []string) error {
+	fs := cfgFlags("cfg")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagError("cfg", err)
+	}
+	if len(rest) != 1 {
+		return usageError("cfg", "expected exactly one ROM file")
+	}
+	out, format := fs.Lookup("o").Value.String(), fs.Lookup("format").Value.String()
+	if format == "" {
+		format = "dot"
+		if strings.EqualFold(filepath.Ext(out), ".json") {
+			format = "json"
+		}
+	}
+	if format != "dot" && format != "json" {
+		return usageError("cfg", "unknown format %q (want dot or json)", format)
+	}
+
+	rom, err := emu.ReadROM(rest[0])
+	if err != nil {
+		return err
+	}
+	g := analysis.Analyze(rom).CFG()
+	write := func(w io.Writer) error {
+		if format == "json" {
+			return g.WriteJSON(w, filepath.Base(rest[0]))
+		}
+		return g.WriteDOT(w, filepath.Base(rest[0]))
+	}
+
+	if out == "" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func cfgFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.String("format", "", "write the graph as `dot` or json, by default from the -o file's extension")
+	fs.String("o", "", "write the graph to this `file` instead of stdout")
+
+	return fs
+}
@@ -0,0 +1,225 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/szTheory/chip8go/emu"
+)
+
+// cheatView is the cheat finder, which F6 opens over the game. It searches
+// memory and the registers for a variable such as the number of lives,
+// narrowing the search down as the game runs, and turns the ROM's cheats
+// on and off.
+// N starts a search, and = ! + and - keep the addresses that are equal,
+// changed, increased or decreased since the last step, while V searches
+// for a value. F freezes a byte with a new cheat, 1 to 9 turn cheats on
+// and off, D deletes one and W saves them to the ROM's cheat file.
+type cheatView struct {
+	open bool
+	// resume is set if the game was running when the finder opened
+	resume bool
+	search *emu.CheatSearch
+
+	prompt  textPrompt
+	message string
+}
+
+// toggleCheatView opens or closes the cheat finder
+func (g *Game) toggleCheatView() {
+	v := &g.cheatView
+	if v.open {
+		v.open = false
+		if v.resume {
+			g.debugger.Continue()
+		}
+		return
+	}
+
+	g.closeOverlays()
+	g.attachDebugger()
+	v.open = true
+	v.resume = !g.debugger.Stopped()
+	v.message = ""
+	g.debugger.Pause()
+}
+
+// updateCheatView handles the keyboard while the cheat finder is open
+func (g *Game) updateCheatView() {
+	v := &g.cheatView
+	if v.prompt.active() {
+		if label, line, entered := v.prompt.update(); entered {
+			v.message = ""
+			if err := g.runCheatPrompt(label, line); err != nil {
+				v.message = err.Error()
+			}
+		}
+		return
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.toggleCheatView()
+		return
+	}
+
+	for _, c := range ebiten.InputChars() {
+		if v.prompt.active() {
+			v.prompt.input = append(v.prompt.input, c)
+			continue
+		}
+		switch c {
+		case ' ':
+			g.togglePause()
+		case 'n', 'N':
+			g.debugger.View(func(e *emu.Emulator) {
+				v.search = emu.NewCheatSearch(e)
+			})
+			v.message = "searching all memory"
+		case '=':
+			g.filterCheatSearch(emu.SearchEqual, 0)
+		case '!':
+			g.filterCheatSearch(emu.SearchChanged, 0)
+		case '+':
+			g.filterCheatSearch(emu.SearchIncreased, 0)
+		case '-':
+			g.filterCheatSearch(emu.SearchDecreased, 0)
+		case 'v', 'V':
+			v.prompt.start("value ")
+		case 'f', 'F':
+			v.prompt.start("cheat ")
+			v.prompt.input = []rune(g.candidateCheat())
+		case 'd', 'D':
+			v.prompt.start("delete ")
+		case 'w', 'W':
+			v.message = "saved " + g.cheatsFile
+			if err := g.saveCheats(); err != nil {
+				v.message = err.Error()
+			}
+		default:
+			if c >= '1' && c <= '9' {
+				g.toggleCheat(int(c - '1'))
+			}
+		}
+	}
+}
+
+func (g *Game) runCheatPrompt(prompt, line string) error {
+	switch prompt {
+	case "value ":
+		f, value, err := emu.ParseSearchFilter(line)
+		if err != nil {
+			return err
+		}
+		g.filterCheatSearch(f, value)
+	case "cheat ":
+		cheat, err := emu.ParseCheat(line)
+		if err != nil {
+			return err
+		}
+		g.setCheats(append(append([]emu.Cheat(nil), g.cheats...), cheat))
+	case "delete ":
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 1 || n > len(g.cheats) {
+			return fmt.Errorf("no cheat %q", line)
+		}
+		cheats := append([]emu.Cheat(nil), g.cheats[:n-1]...)
+		g.setCheats(append(cheats, g.cheats[n:]...))
+	}
+
+	return nil
+}
+
+// filterCheatSearch takes a step of the search, starting one if there isn't one
+func (g *Game) filterCheatSearch(f emu.SearchFilter, value byte) {
+	v := &g.cheatView
+	var n int
+	g.debugger.View(func(e *emu.Emulator) {
+		if v.search == nil {
+			v.search = emu.NewCheatSearch(e)
+		}
+		n = v.search.Filter(e, f, value)
+	})
+	v.message = fmt.Sprintf("%d addresses left", n)
+}
+
+// candidateCheat is a cheat holding the first address left in the search
+// at its current value, for F to start from
+func (g *Game) candidateCheat() string {
+	v := &g.cheatView
+	if v.search == nil || len(v.search.Candidates()) == 0 {
+		return ""
+	}
+	cheat := emu.Cheat{Addr: v.search.Candidates()[0]}
+	g.debugger.View(func(e *emu.Emulator) {
+		cheat.Value = e.CheatByte(cheat.Addr)
+	})
+
+	return cheat.Code()
+}
+
+// toggleCheat turns the ith cheat on or off
+func (g *Game) toggleCheat(i int) {
+	if i >= len(g.cheats) {
+		return
+	}
+	cheats := append([]emu.Cheat(nil), g.cheats...)
+	cheats[i].Off = !cheats[i].Off
+	g.setCheats(cheats)
+}
+
+// drawCheatView draws the cheat finder over the game
+func (g *Game) drawCheatView(screen *ebiten.Image) {
+	v := &g.cheatView
+	w, h := screen.Size()
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), memBackground)
+
+	rows := h/charH - 3
+	lines := make([]string, 0, rows)
+	lines = append(lines, "cheats")
+	for i, c := range g.cheats {
+		state := "on "
+		if c.Off {
+			state = "off"
+		}
+		lines = append(lines, fmt.Sprintf("%d %s  %s", i+1, state, c))
+	}
+	if len(g.cheats) == 0 {
+		lines = append(lines, "  none")
+	}
+
+	lines = append(lines, "")
+	switch {
+	case v.search == nil:
+		lines = append(lines, "n starts a search")
+	default:
+		candidates := v.search.Candidates()
+		lines = append(lines, fmt.Sprintf("%d addresses", len(candidates)))
+		g.debugger.View(func(e *emu.Emulator) {
+			for _, addr := range candidates {
+				if len(lines) >= rows {
+					break
+				}
+				lines = append(lines, fmt.Sprintf("%-4s %02X  was %02X", emu.FormatCheatAddr(addr), e.CheatByte(addr), v.search.Previous(addr)))
+			}
+		})
+	}
+	for i, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, 0, (i+1)*charH)
+	}
+
+	ebitenutil.DebugPrintAt(screen, "cheat finder  "+g.runState(), 0, 0)
+	status := "n new  = ! + - filter  v value  f freeze  1-9 toggle  d delete  w save  F6 close"
+	switch {
+	case v.prompt.active():
+		status = v.prompt.String()
+	case v.message != "":
+		status = v.message
+	}
+	ebitenutil.DebugPrintAt(screen, status, 0, h-charH)
+}
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/szTheory/chip8go/analysis"
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/romdb"
+	"github.com/szTheory/chip8go/video"
+)
+
+const (
+	defaultScale = 10
+	defaultSpeed = 10
+
+	// paletteAuto uses the ROM's preferred colours when it has any
+	paletteAuto = "auto"
+	// quirksAuto uses the quirks detected from the ROM
+	quirksAuto = "auto"
+)
+
+// errUsage is returned by commands whose arguments were invalid,
+// after the problem has already been reported
+var errUsage = errors.New("usage")
+
+// options controls how the emulator runs a game.
+// See settings for where they come from.
+type options struct {
+	Scale      int     `json:"scale"`
+	Scaling    string  `json:"scaling"`
+	Aspect     string  `json:"aspect"`
+	Border     string  `json:"border"`
+	Speed      int     `json:"speed"`
+	Quirks     string  `json:"quirks"`
+	Palette    string  `json:"palette"`
+	Filter     string  `json:"filter"`
+	Fullscreen bool    `json:"fullscreen"`
+	Mute       bool    `json:"mute"`
+	Volume     float64 `json:"volume"`
+	Wave       string  `json:"wave"`
+	Tone       float64 `json:"tone"`
+	Seed       int64   `json:"seed"`
+
+	Config   string    `json:"-"`
+	Settings string    `json:"-"`
+	Record   string    `json:"-"`
+	GDB      string    `json:"-"`
+	Watch    watchList `json:"-"`
+	Monitor  bool      `json:"-"`
+	Cheats   string    `json:"-"`
+	Cheat    cheatList `json:"-"`
+	Coverage string    `json:"-"`
+}
+
+func defaultOptions() options {
+	return options{
+		Scale:   defaultScale,
+		Scaling: scaleInteger,
+		Aspect:  "square",
+		Border:  "000000",
+		Speed:   defaultSpeed,
+		Quirks:  quirksAuto,
+		Palette: paletteAuto,
+		Filter:  "none",
+		Volume:  1,
+		Wave:    emu.WaveSine.String(),
+		Tone:    440,
+	}
+}
+
+func (o *options) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.IntVar(&o.Scale, "scale", o.Scale, "initial window size as a multiple of the display size")
+	fs.StringVar(&o.Scaling, "scaling", o.Scaling, "how the display fills the window: "+strings.Join(scalingModes, ", "))
+	fs.StringVar(&o.Aspect, "aspect", o.Aspect, "pixel aspect ratio: square, vip or a width/height ratio")
+	fs.StringVar(&o.Border, "border", o.Border, "hex colour around the display")
+	fs.IntVar(&o.Speed, "speed", o.Speed, "instructions executed per 60Hz frame")
+	fs.StringVar(&o.Quirks, "quirks", o.Quirks, "interpreter quirks, or auto to detect them from the ROM: "+emu.QuirkNames())
+	fs.StringVar(&o.Palette, "palette", o.Palette, "auto, a theme ("+strings.Join(video.ThemeNames(), ", ")+") or hex colours fg,bg[,plane2,overlap]")
+	fs.StringVar(&o.Filter, "filter", o.Filter, "display filters applied in order: "+strings.Join(video.FilterNames(), ", "))
+	fs.BoolVar(&o.Fullscreen, "fullscreen", o.Fullscreen, "start in fullscreen mode")
+	fs.BoolVar(&o.Mute, "mute", o.Mute, "disable the beeper")
+	fs.Float64Var(&o.Volume, "volume", o.Volume, "beeper volume from 0 to 1")
+	fs.StringVar(&o.Wave, "wave", o.Wave, "beeper waveform: "+strings.Join(emu.WaveformNames(), ", "))
+	fs.Float64Var(&o.Tone, "tone", o.Tone, "beeper pitch in Hz")
+	fs.Int64Var(&o.Seed, "seed", o.Seed, "random number seed for Cxkk (0 picks one from the clock)")
+	fs.StringVar(&o.Record, "record", o.Record, "record the keypad to a movie `file` for replaying with wav")
+	fs.StringVar(&o.GDB, "gdb", o.GDB, "serve the GDB remote protocol on this TCP `address`, such as localhost:1234")
+	fs.Var(&o.Watch, "watch", "log reads and writes of a memory `range` such as 0x300-0x30F:w to stderr (repeatable)")
+	fs.BoolVar(&o.Monitor, "monitor", o.Monitor, "read debugger commands such as break and trace from stdin")
+	fs.StringVar(&o.Cheats, "cheats", o.Cheats, "load cheats from this `file` and save changes made in the game to it (default the ROM's file in the config directory)")
+	fs.Var(&o.Cheat, "cheat", "freeze a byte with a cheat `code` such as 2F6:03, or 2F6:03:02 to only change 02 (repeatable)")
+	fs.StringVar(&o.Coverage, "coverage", o.Coverage, "add the instructions run and bytes read while playing to a coverage `file`, as the coverage command does")
+	fs.StringVar(&o.Config, "config", o.Config, "read default options from a JSON `file`, over the settings file's, without ever writing to it")
+	fs.StringVar(&o.Settings, "settings", o.Settings, "read and save settings in this `file` instead of the one in the user config directory")
+
+	return fs
+}
+
+// validate checks the options that can't be checked by the flag package
+func (o *options) validate() error {
+	if o.Scale < 1 {
+		return fmt.Errorf("invalid scale %d: must be at least 1", o.Scale)
+	}
+	if err := validScaling(o.Scaling); err != nil {
+		return err
+	}
+	if _, err := parseAspect(o.Aspect); err != nil {
+		return err
+	}
+	if _, err := video.ParseFilters(o.Filter); err != nil {
+		return err
+	}
+	if _, err := video.ParseColor(o.Border); err != nil {
+		return err
+	}
+	if o.Speed < 1 {
+		return fmt.Errorf("invalid speed %d: must be at least 1", o.Speed)
+	}
+	if o.Volume < 0 || o.Volume > 1 {
+		return fmt.Errorf("invalid volume %g: must be from 0 to 1", o.Volume)
+	}
+	if _, err := emu.ParseWaveform(o.Wave); err != nil {
+		return err
+	}
+	if o.Tone < 20 || o.Tone > 20000 {
+		return fmt.Errorf("invalid tone %g: must be from 20 to 20000 Hz", o.Tone)
+	}
+	if o.Quirks != quirksAuto {
+		if _, err := emu.ParseQuirks(o.Quirks); err != nil {
+			return err
+		}
+	}
+	if o.Palette != paletteAuto {
+		if _, err := video.ParsePalette(o.Palette); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// beeperSettings are the beeper settings for validated options
+func (o *options) beeperSettings() emu.BeeperSettings {
+	settings := emu.DefaultBeeperSettings()
+	settings.Waveform, _ = emu.ParseWaveform(o.Wave)
+	settings.Frequency = o.Tone
+	settings.Volume = o.Volume
+	settings.Mute = o.Mute
+
+	return settings
+}
+
+// watchList is the memory ranges given with --watch
+type watchList []debug.Watchpoint
+
+func (w *watchList) String() string {
+	if w == nil {
+		return ""
+	}
+	ranges := make([]string, len(*w))
+	for i, wp := range *w {
+		ranges[i] = wp.Range()
+	}
+
+	return strings.Join(ranges, ",")
+}
+
+func (w *watchList) Set(s string) error {
+	wp, err := debug.ParseWatchpoint(s)
+	if err != nil {
+		return err
+	}
+	wp.Log = true
+	*w = append(*w, wp)
+
+	return nil
+}
+
+// logWatches has a debugger log accesses to the --watch ranges,
+// and the messages of tracepoints, to stderr
+func logWatches(d *debug.Debugger, w watchList) {
+	d.SetWatchpoints("watch", w)
+	d.OnLog(func(msg string) {
+		fmt.Fprintf(os.Stderr, "chip8go: %s\n", msg)
+	})
+}
+
+// cheatList is the codes given with --cheat
+type cheatList []emu.Cheat
+
+func (c *cheatList) String() string {
+	if c == nil {
+		return ""
+	}
+	codes := make([]string, len(*c))
+	for i, cheat := range *c {
+		codes[i] = cheat.Code()
+	}
+
+	return strings.Join(codes, ",")
+}
+
+func (c *cheatList) Set(s string) error {
+	cheat, err := emu.ParseCheat(s)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, cheat)
+
+	return nil
+}
+
+// loadCheats reads a cheat file, which doesn't need to exist,
+// and adds the --cheat codes
+func loadCheats(filename string, codes cheatList) ([]emu.Cheat, error) {
+	var cheats []emu.Cheat
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			cheats, err = emu.ReadCheats(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", filename, err)
+			}
+		}
+	}
+
+	return append(cheats, codes...), nil
+}
+
+// romPalette parses a palette option, where auto means the colours
+// from the ROM metadata if the ROM has any
+func romPalette(s, romHash string) (video.Palette, error) {
+	if s == paletteAuto {
+		s = video.DefaultTheme
+		if entry, ok := romdb.Lookup(romHash); ok && entry.Palette != "" {
+			s = entry.Palette
+		}
+	}
+
+	return video.ParsePalette(s)
+}
+
+// romQuirks parses a quirks option, where auto means the quirks
+// detected from the ROM
+func romQuirks(s string, d analysis.Detection) (emu.Quirks, error) {
+	if s == quirksAuto {
+		s = d.Quirks
+	}
+
+	return emu.ParseQuirks(s)
+}
+
+// warnPlatform tells the user when a ROM looks to be written for
+// a platform or load address the emulator doesn't run
+func warnPlatform(name, romFilename string, d analysis.Detection) {
+	if d.Supported() {
+		return
+	}
+	platform := d.Platform.String() + " ROM"
+	if len(d.Unsupported) > 0 {
+		platform += " using " + strings.Join(d.Unsupported, ", ")
+	}
+	if d.LoadAddress != emu.RamProgramStart {
+		platform += fmt.Sprintf(" loaded at 0x%03X", d.LoadAddress)
+	}
+	fmt.Fprintf(os.Stderr, "chip8go %s: warning: %s looks like a %s (%.0f%% confident), which may not run\n",
+		name, filepath.Base(romFilename), platform, 100*d.Confidence)
+}
+
+// command is a chip8go subcommand
+type command struct {
+	usage string
+	help  string
+	run   func(args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"run": {
+			usage: "run [options] [rom.ch8]",
+			help:  "play a game, picking the ROM with a file dialog if none is given",
+			run:   runGame,
+		},
+		"info": {
+			usage: "info rom.ch8",
+			help:  "print the size and hash of a ROM",
+			run:   runInfo,
+		},
+		"disasm": {
+			usage: "disasm rom.ch8",
+			help:  "print a linear disassembly of a ROM",
+			run:   runDisasm,
+		},
+		"lint": {
+			usage: "lint rom.ch8",
+			help:  "check a ROM's reachable code for problems without running it, and suggest the quirks to run it with",
+			run:   runLint,
+		},
+		"cfg": {
+			usage: "cfg [-format dot|json] [-o file] rom.ch8",
+			help:  "write a ROM's control-flow graph of basic blocks and subroutines as Graphviz DOT or JSON",
+			run:   runCFG,
+		},
+		"recompile": {
+			usage: "recompile [-o game.go] [-package name] [-standalone] [-quirks q] rom.ch8",
+			help:  "translate a ROM's reachable code into Go source that the emulator runs in place of interpreting it",
+			run:   runRecompile,
+		},
+		"wav": {
+			usage: "wav [options] [-movie file] [-frames n] [-o out.wav] rom.ch8",
+			help:  "render the beeper to a WAV file without a window",
+			run:   runWAV,
+		},
+		"render": {
+			usage: "render [options] [-movie file] [-frames n] [-out clip.avi|clip.y4m] rom.ch8",
+			help:  "render video and sound to an AVI file, or a Y4M file with a WAV alongside, without a window",
+			run:   runRender,
+		},
+		"dump": {
+			usage: "dump [options] [-movie file] [-frames n] [-range 0x200-0x2FF] [-format hex|bin] [-o file] rom.ch8",
+			help:  "run a game without a window, then dump its memory in hex or as raw bytes",
+			run:   runDump,
+		},
+		"sprites": {
+			usage: "sprites [options] [-movie file] [-frames n] [-range 0x300-0x3FF] [-size 8x5] [-o sheet.png] rom.ch8\n       chip8go sprites -import sheet.png [-range 0x300-0x3FF] [-size 8x5] [-o patched.ch8] rom.ch8",
+			help:  "export a ROM's sprites as a PNG sheet marking the ones drawn, or import an edited sheet as a patched ROM",
+			run:   runSprites,
+		},
+		"profile": {
+			usage: "profile [options] [-movie file] [-frames n] [-top n] [-pprof file] [-o report.txt] rom.ch8",
+			help:  "run a game without a window, counting the instructions run, and report where its time goes",
+			run:   runProfile,
+		},
+		"coverage": {
+			usage: "coverage [options] [-movie file] [-frames n] [-data file.cov] [-reset] [-heatmap file.png] [-o listing.txt] rom.ch8",
+			help:  "run a game without a window, adding what it runs and reads to its coverage, and write an annotated listing",
+			run:   runCoverage,
+		},
+		"dap": {
+			usage: "dap [-listen address] [-settings file] [-config file]",
+			help:  "serve the Debug Adapter Protocol on stdio or TCP, for debugging from an editor",
+			run:   runDAP,
+		},
+		"recent": {
+			usage: "recent [n]",
+			help:  "list recently played ROMs, or play the nth one",
+			run:   runRecent,
+		},
+		"help": {
+			usage: "help [command]",
+			help:  "show usage for chip8go or one of its commands",
+			run:   runHelp,
+		},
+	}
+}
+
+// runCLI runs the command named by args and returns the process exit code.
+// Anything that isn't a command name is treated as arguments to run.
+func runCLI(args []string) int {
+	name := "run"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			name, args = args[0], args[1:]
+		}
+	}
+
+	err := commands[name].run(args)
+	switch {
+	case err == nil:
+		return 0
+	case err == errUsage:
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "chip8go: %v\n", err)
+		return 1
+	}
+}
+
+// usageError reports a problem with the arguments to a command
+func usageError(name string, format string, args ...interface{}) error {
+	fmt.Fprintf(os.Stderr, "chip8go %s: %s\n", name, fmt.Sprintf(format, args...))
+	fmt.Fprintf(os.Stderr, "usage: chip8go %s\n", commands[name].usage)
+	fmt.Fprintf(os.Stderr, "Run 'chip8go help %s' for details.\n", name)
+
+	return errUsage
+}
+
+// flagError reports a flag parsing error, or shows help for -h
+func flagError(name string, err error) error {
+	if err == flag.ErrHelp {
+		runHelp([]string{name})
+		return errUsage
+	}
+
+	return usageError(name, "%v", err)
+}
+
+// runArgs are the parsed arguments to run
+type runArgs struct {
+	options     options
+	settings    *settings
+	romFilename string
+	// explicit holds the names of flags given on the command line
+	explicit map[string]bool
+}
+
+// parseRunArgs reads the settings file and command-line flags for run
+func parseRunArgs(args []string) (*runArgs, error) {
+	// find --settings and --config first so that flags can override the files
+	probe := defaultOptions()
+	if err := probe.flags("run").Parse(args); err != nil {
+		return nil, flagError("run", err)
+	}
+	s, err := openSettings(probe.Settings)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &runArgs{options: s.options, settings: s, explicit: make(map[string]bool)}
+	if probe.Config != "" {
+		if err := r.options.loadConfig(probe.Config); err != nil {
+			return nil, err
+		}
+	}
+	fs := r.options.flags("run")
+	if err := fs.Parse(args); err != nil {
+		return nil, flagError("run", err)
+	}
+	if err := r.options.validate(); err != nil {
+		return nil, usageError("run", "%v", err)
+	}
+	if fs.NArg() > 1 {
+		return nil, usageError("run", "too many arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	fs.Visit(func(f *flag.Flag) {
+		r.explicit[f.Name] = true
+	})
+	r.romFilename = fs.Arg(0)
+
+	return r, nil
+}
+
+// openSettings loads the named settings file, or the default one
+func openSettings(filename string) (*settings, error) {
+	if filename == "" {
+		var err error
+		if filename, err = defaultSettingsFilename(); err != nil {
+			return nil, err
+		}
+	}
+
+	return loadSettings(filename)
+}
+
+func runGame(args []string) error {
+	r, err := parseRunArgs(args)
+	if err != nil {
+		return err
+	}
+
+	return playGame(r)
+}
+
+// romArg reads the single ROM argument taken by the non-GUI commands
+func romArg(name string, args []string) ([]byte, string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, "", flagError(name, err)
+	}
+	if fs.NArg() != 1 {
+		return nil, "", usageError(name, "expected exactly one ROM file")
+	}
+
+	rom, err := emu.ReadROM(fs.Arg(0))
+	return rom, fs.Arg(0), err
+}
+
+func runInfo(args []string) error {
+	rom, romFilename, err := romArg("info", args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("file:     %s\n", romFilename)
+	fmt.Printf("size:     %d bytes (%d free)\n", len(rom), emu.RamProgramSize-len(rom))
+	hash := emu.HashROM(rom)
+	fmt.Printf("sha1:     %s\n", hash)
+	if entry, ok := romdb.Lookup(hash); ok {
+		fmt.Printf("title:    %s\n", entry.Title)
+		fmt.Printf("author:   %s (%d)\n", entry.Author, entry.Year)
+	}
+	d := analysis.Detect(rom)
+	fmt.Printf("platform: %s (%.0f%% confident)\n", d.Platform, 100*d.Confidence)
+	fmt.Printf("quirks:   %s\n", d.Quirks)
+	if d.LoadAddress != emu.RamProgramStart {
+		fmt.Printf("load at:  0x%03X\n", d.LoadAddress)
+	}
+	if !d.Supported() {
+		fmt.Printf("runs:     no")
+		if len(d.Unsupported) > 0 {
+			fmt.Printf(", it uses %s", strings.Join(d.Unsupported, ", "))
+		}
+		fmt.Println()
+	}
+	for _, reason := range d.Reasons {
+		fmt.Printf("  %s\n", reason)
+	}
+
+	return nil
+}
+
+func runDisasm(args []string) error {
+	rom, _, err := romArg("disasm", args)
+	if err != nil {
+		return err
+	}
+
+	return emu.WriteListing(os.Stdout, rom)
+}
+
+func runLint(args []string) error {
+	rom, _, err := romArg("lint", args)
+	if err != nil {
+		return err
+	}
+
+	p := analysis.Analyze(rom)
+	warnings, suggestion := analysis.Lint(p)
+	for _, w := range warnings {
+		fmt.Println(w)
+	}
+	fmt.Printf("%d warnings in %d reachable instructions\n", len(warnings), len(p.Instructions))
+	fmt.Printf("suggested quirks: %s\n", suggestion)
+
+	return nil
+}
+
+func runRecent(args []string) error {
+	if len(args) > 1 {
+		return usageError("recent", "too many arguments")
+	}
+	s, err := openSettings("")
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		for i, f := range s.Recent {
+			fmt.Printf("%2d  %s\n", i+1, f)
+		}
+		return nil
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(s.Recent) {
+		return usageError("recent", "no recent ROM %q, see 'chip8go recent'", args[0])
+	}
+
+	return playGame(&runArgs{
+		options:     s.options,
+		settings:    s,
+		romFilename: s.Recent[n-1],
+		explicit:    make(map[string]bool),
+	})
+}
+
+// commandFlags returns the flags for a command with options, for help
+func commandFlags(name string) *flag.FlagSet {
+	defaults := defaultOptions()
+	switch name {
+	case "run":
+		return defaults.flags(name)
+	case "wav":
+		var movieFilename string
+		return headlessFlags(name, &headlessArgs{options: defaults}, &movieFilename)
+	case "render":
+		r := &renderArgs{headlessArgs: headlessArgs{options: defaults}}
+		return r.flags(name)
+	case "dump":
+		d := &dumpArgs{headlessArgs: headlessArgs{options: defaults}}
+		return d.flags(name)
+	case "sprites":
+		s := &spritesArgs{headlessArgs: headlessArgs{options: defaults}}
+		return s.flags(name)
+	case "profile":
+		p := &profileArgs{headlessArgs: headlessArgs{options: defaults}}
+		return p.flags(name)
+	case "coverage":
+		c := &coverageArgs{headlessArgs: headlessArgs{options: defaults}}
+		return c.flags(name)
+	case "cfg":
+		return cfgFlags(name)
+	case "recompile":
+		r := new(recompileArgs)
+		return r.flags(name)
+	}
+
+	return nil
+}
+
+func runHelp(args []string) error {
+	if len(args) > 1 {
+		return usageError("help", "too many arguments")
+	}
+	if len(args) == 1 {
+		cmd, ok := commands[args[0]]
+		if !ok {
+			return usageError("help", "unknown command %q", args[0])
+		}
+		fmt.Printf("usage: chip8go %s\n\n%s\n", cmd.usage, cmd.help)
+		if fs := commandFlags(args[0]); fs != nil {
+			fmt.Println("\noptions:")
+			fs.SetOutput(os.Stdout)
+			fs.PrintDefaults()
+		}
+		return nil
+	}
+
+	fmt.Println("usage: chip8go [command] [arguments]")
+	fmt.Println("\nWith no command, chip8go runs a game.")
+	fmt.Println("\ncommands:")
+	var names []string
+	width := 0
+	for name := range commands {
+		names = append(names, name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-*s %s\n", width, name, commands[name].help)
+	}
+
+	return nil
+}
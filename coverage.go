@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/video"
+)
+
+// coverageArgs are the arguments to the coverage command
+type coverageArgs struct {
+	headlessArgs
+	movieFilename string
+	data          string
+	heatmap       string
+	reset         bool
+}
+
+func (c *coverageArgs) flags(name string) *flag.FlagSet {
+	o := &c.options
+	fs := headlessFlags(name, &c.headlessArgs, &c.movieFilename)
+	fs.StringVar(&c.data, "data", "", "coverage `file` to add this run to (default the ROM name with .cov)")
+	fs.BoolVar(&c.reset, "reset", false, "start the coverage over instead of adding to it")
+	fs.StringVar(&c.heatmap, "heatmap", "", "also draw the coverage of the 4KB of memory as a PNG `file`")
+	fs.IntVar(&o.Scale, "scale", 8, "heatmap pixels per byte")
+
+	return fs
+}
+
+// runCoverage runs a game for some frames, adds the instructions it ran
+// and the bytes it read to the ROM's coverage file, and writes an annotated
+// listing to the -o file or stdout
+func runCoverage(args []string) error {
+	c := &coverageArgs{headlessArgs: headlessArgs{options: defaultOptions()}}
+	fs := c.flags("coverage")
+	if err := parseHeadless("coverage", fs, &c.headlessArgs, &c.movieFilename, args); err != nil {
+		return err
+	}
+	if c.data == "" {
+		base := filepath.Base(c.romFilename)
+		c.data = strings.TrimSuffix(base, filepath.Ext(base)) + ".cov"
+	}
+
+	hash := emu.HashROM(c.rom)
+	coverage := &debug.Coverage{ROM: hash}
+	if !c.reset {
+		var err error
+		if coverage, err = loadCoverage(c.data, hash); err != nil {
+			return err
+		}
+	}
+
+	e := c.emulator()
+	c.debugger = debug.New(e)
+	c.debugger.TrackCoverage(coverage)
+	if err := c.run(e, func(n int) error { return nil }); err != nil {
+		return err
+	}
+	c.debugger.TrackCoverage(nil)
+	if err := saveCoverage(c.data, coverage); err != nil {
+		return err
+	}
+
+	if c.heatmap != "" {
+		img := coverage.Heatmap(len(c.rom))
+		img = video.Resize(img, img.Rect.Dx()*c.Scale, img.Rect.Dy()*c.Scale)
+		if err := writePNG(c.heatmap, img); err != nil {
+			return err
+		}
+	}
+
+	if c.out == "" {
+		return coverage.WriteListing(os.Stdout, c.rom)
+	}
+	f, err := os.Create(c.out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := coverage.WriteListing(f, c.rom); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// loadCoverage reads a coverage file to add to, starting a new record
+// for the ROM if the file doesn't exist yet
+func loadCoverage(filename, hash string) (*debug.Coverage, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return &debug.Coverage{ROM: hash}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	coverage, err := debug.ReadCoverage(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if coverage.ROM != hash {
+		return nil, fmt.Errorf("%s: coverage of a different ROM", filename)
+	}
+
+	return coverage, nil
+}
+
+// saveCoverage writes a coverage file
+func saveCoverage(filename string, coverage *debug.Coverage) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := coverage.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+)
+
+// launchRequest asks the main goroutine, which owns the window,
+// to start a program for the debugging client
+type launchRequest struct {
+	run   *runArgs
+	debug *debug.Debugger
+	// ready reports whether the program loaded, once it has
+	ready chan error
+}
+
+// stdio is the client connection when the editor starts chip8go itself
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+func runDAP(args []string) error {
+	fs := flag.NewFlagSet("dap", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	listen := fs.String("listen", "", "serve one client on this TCP `address`, such as localhost:4711, instead of stdio")
+	settingsFilename := fs.String("settings", "", "read and save settings in this `file` instead of the one in the user config directory")
+	config := fs.String("config", "", "read default options from a JSON `file`, over the settings file's, without ever writing to it")
+	if err := fs.Parse(args); err != nil {
+		return flagError("dap", err)
+	}
+	if fs.NArg() > 0 {
+		return usageError("dap", "too many arguments")
+	}
+	s, err := openSettings(*settingsFilename)
+	if err != nil {
+		return err
+	}
+	opts := s.options
+	if *config != "" {
+		if err := opts.loadConfig(*config); err != nil {
+			return err
+		}
+	}
+
+	var conn io.ReadWriter = stdio{os.Stdin, os.Stdout}
+	if *listen != "" {
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			return err
+		}
+		c, err := l.Accept()
+		l.Close()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		conn = c
+	}
+
+	launches := make(chan launchRequest)
+	server := debug.NewDAPServer(conn, func(config debug.LaunchConfig) (*debug.Debugger, error) {
+		r, err := launchArgs(s, opts, config)
+		if err != nil {
+			return nil, err
+		}
+		d := debug.New(nil)
+		if config.SourceMap != "" {
+			if d.Symbols, err = debug.ReadSourceMapFile(config.SourceMap); err != nil {
+				return nil, err
+			}
+		}
+
+		req := launchRequest{run: r, debug: d, ready: make(chan error)}
+		launches <- req
+		if err := <-req.ready; err != nil {
+			return nil, err
+		}
+
+		return d, nil
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	// the game runs here, since windows must be on the main goroutine
+	select {
+	case req := <-launches:
+		err := debugGame(req)
+		if err == debug.ErrDetached {
+			return <-served
+		}
+		server.Terminate()
+		if serveErr := <-served; err == nil {
+			err = serveErr
+		}
+		return err
+	case err := <-served:
+		return err
+	}
+}
+
+// launchArgs are the run arguments for a launch request: the options from
+// the settings and --config file, with any the launch configuration gives
+func launchArgs(s *settings, opts options, config debug.LaunchConfig) (*runArgs, error) {
+	r := &runArgs{
+		options:     opts,
+		settings:    s,
+		romFilename: config.Program,
+		explicit:    make(map[string]bool),
+	}
+	if config.Speed != 0 {
+		r.options.Speed = config.Speed
+		r.explicit["speed"] = true
+	}
+	if config.Quirks != "" {
+		r.options.Quirks = config.Quirks
+		r.explicit["quirks"] = true
+	}
+	if config.Seed != 0 {
+		r.options.Seed = config.Seed
+		r.explicit["seed"] = true
+	}
+	if err := r.options.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := emu.ReadROM(r.romFilename); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,249 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// coverageHeader starts a coverage file, with the version of the format
+const coverageHeader = "chip8go coverage 1"
+
+// HeatmapWidth is the width of a coverage heatmap, a pixel per address,
+// so that each row is 64 bytes of memory
+const HeatmapWidth = 64
+
+// Heatmap colours: instructions run shade towards green and bytes read
+// towards blue, the more often the brighter, while the rest of the ROM
+// is grey and the memory outside it black
+var (
+	HeatmapROM      = color.RGBA{0x30, 0x30, 0x30, 0xFF}
+	HeatmapExecuted = color.RGBA{0x40, 0xFF, 0x40, 0xFF}
+	HeatmapRead     = color.RGBA{0x40, 0x80, 0xFF, 0xFF}
+)
+
+// Coverage records which bytes of memory a program has run as instructions
+// and which it has read as data, such as sprite rows drawn by Dxyn or
+// registers loaded by Fx65, counting each. It is saved to a file so that
+// coverage accumulates over several runs of a ROM.
+type Coverage struct {
+	// ROM is the hash of the ROM, as HashROM gives it
+	ROM string
+	// Executed counts the instructions run at each address
+	Executed [emu.RamSize]int64
+	// Read counts the reads of each byte as data
+	Read [emu.RamSize]int64
+}
+
+// ReadCoverage loads a coverage file, which has the ROM's hash and a line
+// for each address run or read: "exec 0x200 12" or "read 0x30C 34"
+func ReadCoverage(r io.Reader) (*Coverage, error) {
+	c := &Coverage{}
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != coverageHeader {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("not a coverage file: want %q first", coverageHeader)
+	}
+
+	for n := 2; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "rom" && len(fields) == 2 {
+			c.ROM = fields[1]
+			continue
+		}
+
+		var counts *[emu.RamSize]int64
+		switch fields[0] {
+		case "exec":
+			counts = &c.Executed
+		case "read":
+			counts = &c.Read
+		}
+		if counts == nil || len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want exec or read, an address and a count", n)
+		}
+		addr, err := strconv.ParseUint(fields[1], 0, 16)
+		if err != nil || addr >= emu.RamSize {
+			return nil, fmt.Errorf("line %d: invalid address %q", n, fields[1])
+		}
+		count, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("line %d: invalid count %q", n, fields[2])
+		}
+		counts[addr] += count
+	}
+
+	return c, scanner.Err()
+}
+
+// Write saves the coverage in the form ReadCoverage loads
+func (c *Coverage) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, coverageHeader)
+	if c.ROM != "" {
+		fmt.Fprintf(bw, "rom %s\n", c.ROM)
+	}
+	for addr, count := range c.Executed {
+		if count > 0 {
+			fmt.Fprintf(bw, "exec 0x%03X %d\n", addr, count)
+		}
+	}
+	for addr, count := range c.Read {
+		if count > 0 {
+			fmt.Fprintf(bw, "read 0x%03X %d\n", addr, count)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// executedByte reports whether a byte was run as part of an instruction
+func (c *Coverage) executedByte(addr int) bool {
+	return c.Executed[addr] > 0 || addr > 0 && c.Executed[addr-1] > 0
+}
+
+// Summary counts the bytes of a ROM loaded at RamProgramStart that were
+// run as instructions or read as data, and those that were either
+func (c *Coverage) Summary(romLength int) (executed, read, covered int) {
+	for i := 0; i < romLength && emu.RamProgramStart+i < emu.RamSize; i++ {
+		addr := emu.RamProgramStart + i
+		x, r := c.executedByte(addr), c.Read[addr] > 0
+		if x {
+			executed++
+		}
+		if r {
+			read++
+		}
+		if x || r {
+			covered++
+		}
+	}
+
+	return executed, read, covered
+}
+
+// WriteListing writes a disassembly of a ROM marking each instruction that
+// ran with x and each that didn't with -, followed by r if it was read as
+// data, then how often, after a line with the percentage covered
+func (c *Coverage) WriteListing(w io.Writer, rom []byte) error {
+	executed, read, covered := c.Summary(len(rom))
+	percent := 0.0
+	if len(rom) > 0 {
+		percent = 100 * float64(covered) / float64(len(rom))
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; %d of %d bytes covered (%.1f%%): %d executed, %d read as data\n", covered, len(rom), percent, executed, read)
+
+	for i := 0; i < len(rom); {
+		addr := emu.RamProgramStart + i
+		// an instruction that ran at an odd address leaves a byte before it
+		single := i+1 == len(rom) || c.Executed[addr] == 0 && c.Executed[addr+1] > 0
+		if single {
+			fmt.Fprintf(bw, "%s  %03X  %02X    DB 0x%02X\n", c.marker(addr, 1), addr, rom[i], rom[i])
+			i++
+			continue
+		}
+
+		instruction := uint16(rom[i])<<8 | uint16(rom[i+1])
+		fmt.Fprintf(bw, "%s  %03X  %04X  %s\n", c.marker(addr, 2), addr, instruction, emu.Disassemble(instruction))
+		i += 2
+	}
+
+	return bw.Flush()
+}
+
+// marker is the start of a listing line: whether the instruction at addr
+// ran and whether its bytes were read, and the number of times
+func (c *Coverage) marker(addr, length int) string {
+	mark := []byte("- ")
+	count := c.Executed[addr]
+	if length < 2 {
+		count = 0
+	}
+	if count > 0 {
+		mark[0] = 'x'
+	}
+	for i := 0; i < length && addr+i < emu.RamSize; i++ {
+		if c.Read[addr+i] > 0 {
+			mark[1] = 'r'
+			count += c.Read[addr+i]
+		}
+	}
+	if count == 0 {
+		return string(mark) + strings.Repeat(" ", 9)
+	}
+
+	return fmt.Sprintf("%s %8d", mark, count)
+}
+
+// Heatmap draws the 4KB of memory as an image HeatmapWidth pixels across,
+// a pixel per byte, shading the bytes run and read by how often
+func (c *Coverage) Heatmap(romLength int) *image.RGBA {
+	var maxExecuted, maxRead int64
+	for addr := range c.Executed {
+		if c.Executed[addr] > maxExecuted {
+			maxExecuted = c.Executed[addr]
+		}
+		if c.Read[addr] > maxRead {
+			maxRead = c.Read[addr]
+		}
+	}
+	// counts vary too much for a straight scale, so brightness goes by the log
+	level := func(count, max int64) float64 {
+		if count == 0 {
+			return 0
+		}
+		return 0.25 + 0.75*math.Log1p(float64(count))/math.Log1p(float64(max))
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, HeatmapWidth, emu.RamSize/HeatmapWidth))
+	for addr := 0; addr < emu.RamSize; addr++ {
+		col := color.RGBA{A: 0xFF}
+		if addr >= emu.RamProgramStart && addr < emu.RamProgramStart+romLength {
+			col = HeatmapROM
+		}
+		x := level(c.Executed[addr], maxExecuted)
+		if addr > 0 && c.Executed[addr] == 0 {
+			x = level(c.Executed[addr-1], maxExecuted)
+		}
+		r := level(c.Read[addr], maxRead)
+		if x > 0 || r > 0 {
+			col = color.RGBA{
+				R: blend(HeatmapExecuted.R, x, HeatmapRead.R, r),
+				G: blend(HeatmapExecuted.G, x, HeatmapRead.G, r),
+				B: blend(HeatmapExecuted.B, x, HeatmapRead.B, r),
+				A: 0xFF,
+			}
+		}
+		img.SetRGBA(addr%HeatmapWidth, addr/HeatmapWidth, col)
+	}
+
+	return img
+}
+
+// blend adds two colour channels at some brightness, up to the brightest
+func blend(a byte, x float64, b byte, y float64) byte {
+	return byte(math.Min(255, float64(a)*x+float64(b)*y))
+}
+
+// TrackCoverage starts adding the instructions the program runs and the
+// bytes it reads to a coverage record, or stops if c is nil
+func (d *Debugger) TrackCoverage(c *Coverage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.coverage = c
+	d.updateWatchpoints()
+}
@@ -0,0 +1,93 @@
+package debug
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+func TestCoverage(t *testing.T) {
+	e := &emu.Emulator{Seed: 1}
+	e.SetupROM(profileROM)
+	c := &Coverage{ROM: emu.HashROM(profileROM)}
+	d := New(e)
+	d.TrackCoverage(c)
+	d.Continue()
+	for i := 0; i < 6; i++ {
+		if err := d.RunFrame(10, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if c.Executed[0x200] != 1 || c.Executed[0x202] != 1 || c.Executed[0x204] != 0 {
+		t.Errorf("Expected the call and Fx0A to run once, but ran % d", c.Executed[0x200:0x206])
+	}
+	// the sprite is drawn from I, which is 0
+	if c.Read[0x000] != 1 || c.Read[0x210] != 0 {
+		t.Errorf("Expected the sprite row to be read once but was %d", c.Read[0x000])
+	}
+	if executed, read, covered := c.Summary(len(profileROM)); executed != 18 || read != 0 || covered != 18 {
+		t.Errorf("Expected 18 bytes covered but was %d executed, %d read, %d covered", executed, read, covered)
+	}
+
+	var listing strings.Builder
+	if err := c.WriteListing(&listing, profileROM); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"; 18 of 20 bytes covered (90.0%): 18 executed, 0 read as data\n",
+		"x         1  200  2206  CALL 0x206\n",
+		"-            204  1204  JP 0x204\n",
+	} {
+		if !strings.Contains(listing.String(), want) {
+			t.Errorf("Expected the listing to contain %q but was\n%s", want, listing.String())
+		}
+	}
+
+	img := c.Heatmap(len(profileROM))
+	if img.Rect.Dx() != HeatmapWidth || img.Rect.Dy() != emu.RamSize/HeatmapWidth {
+		t.Errorf("Unexpected heatmap size %v", img.Rect)
+	}
+	for addr, want := range map[int]func(r, g, b uint8) bool{
+		0x000: func(r, g, b uint8) bool { return b > g && b > r },
+		0x200: func(r, g, b uint8) bool { return g > b && g > r },
+		0x204: func(r, g, b uint8) bool { return r == HeatmapROM.R && g == HeatmapROM.G },
+		0xFFF: func(r, g, b uint8) bool { return r == 0 && g == 0 && b == 0 },
+	} {
+		p := img.RGBAAt(addr%HeatmapWidth, addr/HeatmapWidth)
+		if !want(p.R, p.G, p.B) || p.A != 0xFF {
+			t.Errorf("Unexpected heatmap colour %v at 0x%03X", p, addr)
+		}
+	}
+}
+
+func TestCoverageRoundTrip(t *testing.T) {
+	c := &Coverage{ROM: "abc"}
+	c.Executed[0x200] = 3
+	c.Read[0x30C] = 12
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "chip8go coverage 1\nrom abc\nexec 0x200 3\nread 0x30C 12\n"
+	if buf.String() != want {
+		t.Errorf("Expected\n%s\nbut was\n%s", want, buf.String())
+	}
+	actual, err := ReadCoverage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, actual) {
+		t.Errorf("Expected the coverage to read back the same")
+	}
+
+	for _, bad := range []string{"", "exec 0x200 1\n", coverageHeader + "\nexec 0x1000 1\n", coverageHeader + "\nrun 0x200 1\n", coverageHeader + "\nread 0x200 -1\n"} {
+		if _, err := ReadCoverage(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error reading %q", bad)
+		}
+	}
+}
@@ -0,0 +1,872 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// LaunchConfig is the launch request from a Debug Adapter Protocol client,
+// as written in a launch.json configuration
+type LaunchConfig struct {
+	// Program is the ROM file to debug
+	Program string `json:"program"`
+	// SourceMap is an optional source map from the assembler
+	SourceMap   string `json:"sourceMap"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+	// Speed, Quirks and Seed override the settings when given
+	Speed  int    `json:"speed"`
+	Quirks string `json:"quirks"`
+	Seed   int64  `json:"seed"`
+}
+
+// dapThreadID is the only thread, the CHIP-8 CPU
+const dapThreadID = 1
+
+// variable references for the scopes; memory pages follow dapMemoryPages
+const (
+	dapRegisters = iota + 1
+	dapTimers
+	dapStack
+	dapMemory
+	dapMemoryPages = 0x100
+)
+
+type dapMessage struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapBreakpoint struct {
+	Verified             bool       `json:"verified"`
+	Message              string     `json:"message,omitempty"`
+	Line                 int        `json:"line,omitempty"`
+	Source               *dapSource `json:"source,omitempty"`
+	InstructionReference string     `json:"instructionReference,omitempty"`
+}
+
+type dapStackFrame struct {
+	ID                          int        `json:"id"`
+	Name                        string     `json:"name"`
+	Source                      *dapSource `json:"source,omitempty"`
+	Line                        int        `json:"line"`
+	Column                      int        `json:"column"`
+	InstructionPointerReference string     `json:"instructionPointerReference"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+	MemoryReference    string `json:"memoryReference,omitempty"`
+}
+
+type dapInstruction struct {
+	Address          string     `json:"address"`
+	InstructionBytes string     `json:"instructionBytes,omitempty"`
+	Instruction      string     `json:"instruction"`
+	Symbol           string     `json:"symbol,omitempty"`
+	Location         *dapSource `json:"location,omitempty"`
+	Line             int        `json:"line,omitempty"`
+}
+
+// DAPServer speaks the Debug Adapter Protocol to one client, such as an
+// editor, over a stream like stdio or a TCP connection
+type DAPServer struct {
+	r      *textproto.Reader
+	w      io.Writer
+	writeM sync.Mutex
+	seq    int
+
+	launch      func(LaunchConfig) (*Debugger, error)
+	d           *Debugger
+	console     *Monitor
+	stopOnEntry bool
+	// reverseStop is why going backwards stopped, to send after the response
+	reverseStop string
+}
+
+// NewDAPServer makes a server for a client on rw. The launch function
+// loads the program and starts its frame loop when the client asks.
+func NewDAPServer(rw io.ReadWriter, launch func(LaunchConfig) (*Debugger, error)) *DAPServer {
+	return &DAPServer{
+		r:      textproto.NewReader(bufio.NewReader(rw)),
+		w:      rw,
+		launch: launch,
+	}
+}
+
+// Serve handles requests until the client disconnects
+func (s *DAPServer) Serve() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			s.detach()
+			return nil
+		}
+		if err != nil {
+			s.detach()
+			return err
+		}
+		if msg.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(msg)
+		s.respond(msg, body, err)
+		if err == nil {
+			s.after(msg)
+		}
+		if msg.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// Terminate tells the client the program has ended,
+// such as when the game window is closed
+func (s *DAPServer) Terminate() {
+	s.send(&dapEvent{Type: "event", Event: "exited", Body: map[string]int{"exitCode": 0}})
+	s.send(&dapEvent{Type: "event", Event: "terminated"})
+}
+
+func (s *DAPServer) detach() {
+	if s.d != nil {
+		s.d.Detach()
+	}
+}
+
+// read reads one message, framed by a Content-Length header
+func (s *DAPServer) read() (*dapMessage, error) {
+	header, err := s.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, errors.New("dap: missing Content-Length")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.r.R, data); err != nil {
+		return nil, err
+	}
+
+	msg := new(dapMessage)
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("dap: %v", err)
+	}
+
+	return msg, nil
+}
+
+// send numbers and writes a response or event
+func (s *DAPServer) send(msg interface{}) {
+	s.writeM.Lock()
+	defer s.writeM.Unlock()
+
+	s.seq++
+	switch m := msg.(type) {
+	case *dapResponse:
+		m.Seq = s.seq
+	case *dapEvent:
+		m.Seq = s.seq
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *DAPServer) respond(msg *dapMessage, body interface{}, err error) {
+	resp := &dapResponse{
+		Type:       "response",
+		RequestSeq: msg.Seq,
+		Success:    err == nil,
+		Command:    msg.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+		resp.Body = nil
+	}
+	s.send(resp)
+}
+
+func (s *DAPServer) event(name string, body interface{}) {
+	s.send(&dapEvent{Type: "event", Event: name, Body: body})
+}
+
+func (s *DAPServer) stopped(reason string) {
+	body := map[string]interface{}{
+		"reason":            reason,
+		"threadId":          dapThreadID,
+		"allThreadsStopped": true,
+	}
+	if reason == StopData {
+		body["description"] = s.d.LastHit().String()
+	}
+	s.event("stopped", body)
+}
+
+// after sends the events that must follow a response
+func (s *DAPServer) after(msg *dapMessage) {
+	switch msg.Command {
+	case "launch":
+		s.event("initialized", nil)
+	case "configurationDone":
+		if s.stopOnEntry {
+			s.stopped(StopEntry)
+		} else {
+			s.d.Continue()
+		}
+	case "pause":
+		s.stopped(StopPause)
+	case "stepBack", "reverseContinue":
+		s.stopped(s.reverseStop)
+	}
+}
+
+func (s *DAPServer) handle(msg *dapMessage) (interface{}, error) {
+	if s.d == nil {
+		switch msg.Command {
+		case "initialize", "launch", "disconnect":
+		default:
+			return nil, errors.New("no program has been launched")
+		}
+	}
+
+	switch msg.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest":  true,
+			"supportsFunctionBreakpoints":       true,
+			"supportsInstructionBreakpoints":    true,
+			"supportsSetVariable":               true,
+			"supportsReadMemoryRequest":         true,
+			"supportsDisassembleRequest":        true,
+			"supportsDataBreakpoints":           true,
+			"supportsConditionalBreakpoints":    true,
+			"supportsHitConditionalBreakpoints": true,
+			"supportsLogPoints":                 true,
+			"supportsEvaluateForHovers":         true,
+		}, nil
+	case "launch":
+		return nil, s.handleLaunch(msg.Arguments)
+	case "configurationDone":
+		return nil, nil
+	case "setBreakpoints":
+		return s.setBreakpoints(msg.Arguments)
+	case "setFunctionBreakpoints":
+		return s.setFunctionBreakpoints(msg.Arguments)
+	case "setInstructionBreakpoints":
+		return s.setInstructionBreakpoints(msg.Arguments)
+	case "dataBreakpointInfo":
+		return s.dataBreakpointInfo(msg.Arguments)
+	case "setDataBreakpoints":
+		return s.setDataBreakpoints(msg.Arguments)
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": dapThreadID, "name": "CHIP-8"}},
+		}, nil
+	case "stackTrace":
+		return s.stackTrace(), nil
+	case "scopes":
+		return map[string]interface{}{
+			"scopes": []map[string]interface{}{
+				{"name": "Registers", "variablesReference": dapRegisters, "expensive": false},
+				{"name": "Timers", "variablesReference": dapTimers, "expensive": false},
+				{"name": "Stack", "variablesReference": dapStack, "expensive": false},
+				{"name": "Memory", "variablesReference": dapMemory, "expensive": true},
+			},
+		}, nil
+	case "variables":
+		return s.variables(msg.Arguments)
+	case "setVariable":
+		return s.setVariable(msg.Arguments)
+	case "readMemory":
+		return s.readMemory(msg.Arguments)
+	case "disassemble":
+		return s.disassemble(msg.Arguments)
+	case "evaluate":
+		return s.evaluate(msg.Arguments)
+	case "continue":
+		s.d.Continue()
+		return map[string]bool{"allThreadsContinued": true}, nil
+	case "next":
+		s.d.StepOver()
+		return nil, nil
+	case "stepIn":
+		s.d.StepIn()
+		return nil, nil
+	case "stepOut":
+		s.d.StepOut()
+		return nil, nil
+	case "stepBack":
+		var err error
+		s.reverseStop, err = s.d.StepBack()
+		return nil, err
+	case "reverseContinue":
+		var err error
+		s.reverseStop, err = s.d.ReverseContinue()
+		return nil, err
+	case "pause":
+		s.d.Pause()
+		return nil, nil
+	case "disconnect":
+		s.detach()
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported request %q", msg.Command)
+}
+
+func (s *DAPServer) handleLaunch(arguments json.RawMessage) error {
+	if s.d != nil {
+		return errors.New("a program is already running")
+	}
+	var config LaunchConfig
+	if err := json.Unmarshal(arguments, &config); err != nil {
+		return err
+	}
+	if config.Program == "" {
+		return errors.New("launch needs a program")
+	}
+
+	d, err := s.launch(config)
+	if err != nil {
+		return err
+	}
+	d.OnStop(s.stopped)
+	d.OnLog(func(msg string) {
+		s.event("output", map[string]string{"category": "console", "output": msg + "\n"})
+	})
+	s.d = d
+	s.console = NewMonitor(d, "console")
+	s.stopOnEntry = config.StopOnEntry
+
+	return nil
+}
+
+// dapBreakpointOptions are the conditions and log message any kind
+// of breakpoint can have
+type dapBreakpointOptions struct {
+	Condition    string
+	HitCondition string
+	LogMessage   string
+}
+
+// breakpoint makes a breakpoint at an address with its options
+func (s *DAPServer) breakpoint(addr uint16, o dapBreakpointOptions) (Breakpoint, error) {
+	bp := Breakpoint{Addr: addr}
+	var err error
+	if o.Condition != "" {
+		if bp.Condition, err = ParseExpr(o.Condition, s.d.Symbols); err != nil {
+			return bp, err
+		}
+	}
+	if o.HitCondition != "" {
+		if bp.Hits, err = ParseHitCondition(o.HitCondition); err != nil {
+			return bp, err
+		}
+	}
+	if o.LogMessage != "" {
+		if bp.Log, err = ParseMessage(o.LogMessage, s.d.Symbols); err != nil {
+			return bp, err
+		}
+	}
+
+	return bp, nil
+}
+
+func (s *DAPServer) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source      dapSource
+		Breakpoints []struct {
+			Line int
+			dapBreakpointOptions
+		}
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	var breakpoints []Breakpoint
+	results := make([]dapBreakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		results[i] = dapBreakpoint{Line: b.Line, Source: &args.Source}
+		addrs := s.d.Symbols.Addresses(args.Source.Path, b.Line)
+		if len(addrs) == 0 {
+			results[i].Message = "no code at this line in the source map"
+			continue
+		}
+		var bps []Breakpoint
+		for _, addr := range addrs {
+			bp, err := s.breakpoint(addr, b.dapBreakpointOptions)
+			if err != nil {
+				results[i].Message = err.Error()
+				break
+			}
+			bps = append(bps, bp)
+		}
+		if results[i].Message == "" {
+			results[i].Verified = true
+			breakpoints = append(breakpoints, bps...)
+		}
+	}
+	s.d.SetBreakpoints("source:"+args.Source.Path, breakpoints)
+
+	return map[string]interface{}{"breakpoints": results}, nil
+}
+
+func (s *DAPServer) setFunctionBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			Name string
+			dapBreakpointOptions
+		}
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	var breakpoints []Breakpoint
+	results := make([]dapBreakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		addr, err := s.d.Symbols.Resolve(b.Name)
+		if err != nil {
+			results[i].Message = err.Error()
+			continue
+		}
+		bp, err := s.breakpoint(addr, b.dapBreakpointOptions)
+		if err != nil {
+			results[i].Message = err.Error()
+			continue
+		}
+		results[i] = s.verified(addr)
+		breakpoints = append(breakpoints, bp)
+	}
+	s.d.SetBreakpoints("function", breakpoints)
+
+	return map[string]interface{}{"breakpoints": results}, nil
+}
+
+func (s *DAPServer) setInstructionBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			InstructionReference string
+			Offset               int
+			dapBreakpointOptions
+		}
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	var breakpoints []Breakpoint
+	results := make([]dapBreakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		base, err := parseAddr(b.InstructionReference)
+		addr := int(base) + b.Offset
+		if err != nil || addr < 0 || addr >= emu.RamSize {
+			results[i].Message = "invalid instruction address"
+			continue
+		}
+		bp, err := s.breakpoint(uint16(addr), b.dapBreakpointOptions)
+		if err != nil {
+			results[i].Message = err.Error()
+			continue
+		}
+		results[i] = s.verified(uint16(addr))
+		breakpoints = append(breakpoints, bp)
+	}
+	s.d.SetBreakpoints("instruction", breakpoints)
+
+	return map[string]interface{}{"breakpoints": results}, nil
+}
+
+// dataBreakpointInfo offers to watch a row of a memory page, or memory
+// named by a label or range such as 0x300-0x30F. The data ID is the range.
+func (s *DAPServer) dataBreakpointInfo(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int
+		Name               string
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	var w Watchpoint
+	var err error
+	switch ref := args.VariablesReference; {
+	case ref >= dapMemoryPages && ref < dapMemoryPages+emu.RamSize/0x100:
+		w, err = ParseWatchpoint(args.Name)
+		w.Len = 0x10
+	case ref == 0:
+		if addr, ok := s.d.Symbols.Label(args.Name); ok {
+			w = Watchpoint{Addr: addr, Len: 1}
+		} else {
+			w, err = ParseWatchpoint(args.Name)
+		}
+	default:
+		err = errors.New("only memory can be watched")
+	}
+	if err == nil && int(w.Addr)+int(w.Len) > emu.RamSize {
+		err = errors.New("the range is outside memory")
+	}
+	if err != nil {
+		return map[string]interface{}{"dataId": nil, "description": err.Error()}, nil
+	}
+
+	return map[string]interface{}{
+		"dataId":      w.Range(),
+		"description": w.Range(),
+		"accessTypes": []string{"read", "write", "readWrite"},
+		"canPersist":  true,
+	}, nil
+}
+
+func (s *DAPServer) setDataBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			DataID     string `json:"dataId"`
+			AccessType string
+		}
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	var watchpoints []Watchpoint
+	results := make([]dapBreakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		w, err := ParseWatchpoint(b.DataID)
+		if err != nil {
+			results[i].Message = err.Error()
+			continue
+		}
+		switch b.AccessType {
+		case "read":
+			w.Access = AccessRead
+		case "write", "":
+			w.Access = AccessWrite
+		case "readWrite":
+			w.Access = AccessRead | AccessWrite
+		}
+		results[i] = dapBreakpoint{Verified: true}
+		watchpoints = append(watchpoints, w)
+	}
+	s.d.SetWatchpoints("data", watchpoints)
+
+	return map[string]interface{}{"breakpoints": results}, nil
+}
+
+// evaluate runs a monitor command typed in the debug console, or
+// evaluates an expression to watch or hover over
+func (s *DAPServer) evaluate(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Expression string
+		Context    string
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	var result string
+	if args.Context == "repl" {
+		var err error
+		if result, err = s.console.Exec(args.Expression); err != nil {
+			return nil, err
+		}
+	} else {
+		x, err := ParseExpr(args.Expression, s.d.Symbols)
+		if err != nil {
+			return nil, err
+		}
+		s.d.View(func(e *emu.Emulator) {
+			result = x.Format(e)
+		})
+	}
+
+	return map[string]interface{}{"result": result, "variablesReference": 0}, nil
+}
+
+// verified describes a breakpoint at an address, with its source line if known
+func (s *DAPServer) verified(addr uint16) dapBreakpoint {
+	bp := dapBreakpoint{Verified: true, InstructionReference: hexAddr(addr)}
+	if src, ok := s.d.Symbols.Source(addr); ok {
+		bp.Source = sourceOf(src)
+		bp.Line = src.Line
+	}
+
+	return bp
+}
+
+// stackTrace lists the current instruction, then the call of each
+// subroutine on the stack back to the main program
+func (s *DAPServer) stackTrace() interface{} {
+	var addrs []uint16
+	s.d.View(func(e *emu.Emulator) {
+		cpu := e.CPU()
+		addrs = append(addrs, cpu.PC)
+		for i := int(cpu.SP); i > 0 && i < len(cpu.Stack); i-- {
+			// the stack holds the return address, after the call
+			addrs = append(addrs, cpu.Stack[i]-2)
+		}
+	})
+
+	frames := make([]dapStackFrame, len(addrs))
+	for i, addr := range addrs {
+		frames[i] = dapStackFrame{
+			ID:                          i,
+			Name:                        s.symbol(addr),
+			Column:                      1,
+			InstructionPointerReference: hexAddr(addr),
+		}
+		if src, ok := s.d.Symbols.Source(addr); ok {
+			frames[i].Source = sourceOf(src)
+			frames[i].Line = src.Line
+		}
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// symbol names an address by its label, like main+0x4
+func (s *DAPServer) symbol(addr uint16) string {
+	if label, ok := s.d.Symbols.Function(addr); ok {
+		labelAddr, _ := s.d.Symbols.Label(label)
+		if addr == labelAddr {
+			return label
+		}
+		return fmt.Sprintf("%s+0x%X", label, addr-labelAddr)
+	}
+
+	return hexAddr(addr)
+}
+
+func (s *DAPServer) variables(arguments json.RawMessage) (interface{}, error) {
+	var args struct{ VariablesReference int }
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	var vars []dapVariable
+	s.d.View(func(e *emu.Emulator) {
+		cpu, memory := e.CPU(), e.Memory()
+		switch ref := args.VariablesReference; {
+		case ref == dapRegisters:
+			for i, v := range cpu.V {
+				vars = append(vars, dapVariable{Name: fmt.Sprintf("V%X", i), Value: fmt.Sprintf("0x%02X", v)})
+			}
+			vars = append(vars,
+				dapVariable{Name: "I", Value: hexAddr(cpu.I), MemoryReference: hexAddr(cpu.I)},
+				dapVariable{Name: "PC", Value: hexAddr(cpu.PC), MemoryReference: hexAddr(cpu.PC)},
+				dapVariable{Name: "SP", Value: fmt.Sprintf("0x%X", cpu.SP)},
+			)
+		case ref == dapTimers:
+			vars = []dapVariable{
+				{Name: "DT", Value: strconv.Itoa(int(cpu.DelayTimer))},
+				{Name: "ST", Value: strconv.Itoa(int(cpu.SoundTimer))},
+			}
+		case ref == dapStack:
+			for i := 1; i <= int(cpu.SP) && i < len(cpu.Stack); i++ {
+				vars = append(vars, dapVariable{Name: fmt.Sprintf("[%d]", i), Value: hexAddr(cpu.Stack[i])})
+			}
+		case ref == dapMemory:
+			for page := 0; page < emu.RamSize/0x100; page++ {
+				addr := uint16(page * 0x100)
+				vars = append(vars, dapVariable{
+					Name:               hexAddr(addr),
+					Value:              fmt.Sprintf("%s-%s", hexAddr(addr), hexAddr(addr+0xFF)),
+					VariablesReference: dapMemoryPages + page,
+					MemoryReference:    hexAddr(addr),
+				})
+			}
+		case ref >= dapMemoryPages && ref < dapMemoryPages+emu.RamSize/0x100:
+			start := (ref - dapMemoryPages) * 0x100
+			for addr := start; addr < start+0x100; addr += 0x10 {
+				row := make([]string, 0x10)
+				for i := range row {
+					row[i] = fmt.Sprintf("%02X", memory.RAM[addr+i])
+				}
+				vars = append(vars, dapVariable{
+					Name:            hexAddr(uint16(addr)),
+					Value:           strings.Join(row, " "),
+					MemoryReference: hexAddr(uint16(addr)),
+				})
+			}
+		}
+	})
+
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+func (s *DAPServer) setVariable(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int
+		Name               string
+		Value              string
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(args.Value), 0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", args.Value)
+	}
+
+	var result string
+	s.d.Edit(func(e *emu.Emulator) {
+		cpu := e.CPU()
+		name := strings.ToUpper(args.Name)
+		switch {
+		case len(name) == 2 && name[0] == 'V' && value <= 0xFF:
+			if x, perr := strconv.ParseUint(name[1:], 16, 8); perr == nil {
+				cpu.V[x] = byte(value)
+				result = fmt.Sprintf("0x%02X", value)
+			}
+		case name == "I" && value < emu.RamSize:
+			cpu.I = uint16(value)
+			result = hexAddr(cpu.I)
+		case name == "PC" && value < emu.RamSize:
+			cpu.PC = uint16(value)
+			result = hexAddr(cpu.PC)
+		case name == "DT" && value <= 0xFF:
+			cpu.DelayTimer = byte(value)
+			result = strconv.Itoa(int(value))
+		case name == "ST" && value <= 0xFF:
+			cpu.SoundTimer = byte(value)
+			result = strconv.Itoa(int(value))
+		}
+	})
+	if result == "" {
+		return nil, fmt.Errorf("can't set %s to %s", args.Name, args.Value)
+	}
+
+	return map[string]string{"value": result}, nil
+}
+
+func (s *DAPServer) readMemory(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string
+		Offset          int
+		Count           int
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	base, err := parseAddr(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	start := int(base) + args.Offset
+	end := start + args.Count
+	if start < 0 {
+		start = 0
+	}
+	if end > emu.RamSize {
+		end = emu.RamSize
+	}
+	var data []byte
+	if start < end {
+		data = make([]byte, end-start)
+		s.d.View(func(e *emu.Emulator) {
+			copy(data, e.Memory().RAM[start:end])
+		})
+	}
+
+	return map[string]interface{}{
+		"address":         hexAddr(uint16(start)),
+		"data":            base64.StdEncoding.EncodeToString(data),
+		"unreadableBytes": args.Count - len(data),
+	}, nil
+}
+
+func (s *DAPServer) disassemble(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference   string
+		Offset            int
+		InstructionOffset int
+		InstructionCount  int
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	base, err := parseAddr(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	instructions := make([]dapInstruction, args.InstructionCount)
+	start := int(base) + args.Offset + 2*args.InstructionOffset
+	s.d.View(func(e *emu.Emulator) {
+		ram := &e.Memory().RAM
+		for i := range instructions {
+			addr := start + 2*i
+			if addr < 0 || addr+1 >= emu.RamSize {
+				// the protocol wants a placeholder outside memory
+				instructions[i] = dapInstruction{Address: fmt.Sprintf("0x%X", addr), Instruction: "??"}
+				continue
+			}
+			opcode := uint16(ram[addr])<<8 | uint16(ram[addr+1])
+			instructions[i] = dapInstruction{
+				Address:          hexAddr(uint16(addr)),
+				InstructionBytes: fmt.Sprintf("%02X %02X", ram[addr], ram[addr+1]),
+				Instruction:      emu.Disassemble(opcode),
+			}
+			if label, ok := s.d.Symbols.Function(uint16(addr)); ok {
+				instructions[i].Symbol = label
+			}
+			if src, ok := s.d.Symbols.Source(uint16(addr)); ok {
+				instructions[i].Location = sourceOf(src)
+				instructions[i].Line = src.Line
+			}
+		}
+	})
+
+	return map[string]interface{}{"instructions": instructions}, nil
+}
+
+func sourceOf(src Source) *dapSource {
+	return &dapSource{Name: filepath.Base(src.File), Path: src.File}
+}
+
+func hexAddr(addr uint16) string {
+	return fmt.Sprintf("0x%03X", addr)
+}
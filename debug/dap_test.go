@@ -0,0 +1,185 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// dapClient sends requests and reads replies over a pipe
+type dapClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *textproto.Reader
+	seq  int
+}
+
+func (c *dapClient) request(command string, arguments interface{}) {
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": arguments,
+	})
+	fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// expect reads messages until the response or event with the given name
+func (c *dapClient) expect(name string) map[string]interface{} {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		header, err := c.r.ReadMIMEHeader()
+		if err != nil {
+			c.t.Fatalf("Waiting for %s: %v", name, err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.r.R, data); err != nil {
+			c.t.Fatal(err)
+		}
+
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.t.Fatal(err)
+		}
+		if msg["command"] == name || msg["event"] == name {
+			if msg["type"] == "response" && msg["success"] != true {
+				c.t.Fatalf("%s failed: %v", name, msg["message"])
+			}
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+func TestDAPServer(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	d := newTestDebugger()
+	server := NewDAPServer(serverConn, func(config LaunchConfig) (*Debugger, error) {
+		if config.Program != "call.ch8" {
+			t.Errorf("Expected to launch call.ch8 but was %q", config.Program)
+		}
+		return d, nil
+	})
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	// the frame loop that a frontend would run
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				d.RunFrame(10, 0)
+			}
+		}
+	}()
+
+	c := &dapClient{t: t, conn: clientConn, r: textproto.NewReader(bufio.NewReader(clientConn))}
+	c.request("initialize", map[string]string{"adapterID": "chip8go"})
+	if caps := c.expect("initialize"); caps["supportsFunctionBreakpoints"] != true {
+		t.Errorf("Expected function breakpoint support")
+	}
+	c.request("launch", map[string]string{"program": "call.ch8"})
+	c.expect("launch")
+	c.expect("initialized")
+
+	c.request("setFunctionBreakpoints", map[string]interface{}{
+		"breakpoints": []map[string]string{{"name": "0x206"}, {"name": "nowhere"}},
+	})
+	breakpoints := c.expect("setFunctionBreakpoints")["breakpoints"].([]interface{})
+	if breakpoints[0].(map[string]interface{})["verified"] != true || breakpoints[1].(map[string]interface{})["verified"] == true {
+		t.Errorf("Expected only the address to be verified but was %v", breakpoints)
+	}
+
+	c.request("dataBreakpointInfo", map[string]interface{}{"variablesReference": dapMemoryPages + 3, "name": "0x300"})
+	if info := c.expect("dataBreakpointInfo"); info["dataId"] != "0x300-0x30F" {
+		t.Errorf("Expected to watch the row 0x300-0x30F but was %v", info["dataId"])
+	}
+	c.request("setDataBreakpoints", map[string]interface{}{
+		"breakpoints": []map[string]string{{"dataId": "0x300-0x30F", "accessType": "write"}},
+	})
+	breakpoints = c.expect("setDataBreakpoints")["breakpoints"].([]interface{})
+	if breakpoints[0].(map[string]interface{})["verified"] != true {
+		t.Errorf("Expected the data breakpoint to be verified but was %v", breakpoints)
+	}
+
+	c.request("configurationDone", nil)
+	c.expect("configurationDone")
+	if stop := c.expect("stopped"); stop["reason"] != StopBreakpoint {
+		t.Errorf("Expected to stop at a breakpoint but was %v", stop["reason"])
+	}
+
+	c.request("stackTrace", map[string]int{"threadId": dapThreadID})
+	frames := c.expect("stackTrace")["stackFrames"].([]interface{})
+	if len(frames) != 2 {
+		t.Fatalf("Expected the subroutine and its caller but was %v", frames)
+	}
+	for i, want := range []string{"0x206", "0x200"} {
+		if name := frames[i].(map[string]interface{})["name"]; name != want {
+			t.Errorf("Expected frame %d to be %s but was %v", i, want, name)
+		}
+	}
+
+	c.request("variables", map[string]int{"variablesReference": dapRegisters})
+	vars := c.expect("variables")["variables"].([]interface{})
+	if pc := vars[17].(map[string]interface{}); pc["name"] != "PC" || pc["value"] != "0x206" {
+		t.Errorf("Expected PC 0x206 but was %v", pc)
+	}
+
+	for context, want := range map[string]string{"hover": "0x206", "repl": "0x208"} {
+		expr := "PC"
+		if context == "repl" {
+			expr = "print PC + 2"
+		}
+		c.request("evaluate", map[string]string{"expression": expr, "context": context})
+		if result := c.expect("evaluate")["result"]; result != want {
+			t.Errorf("Expected %s to evaluate to %s but was %v", context, want, result)
+		}
+	}
+
+	c.request("setInstructionBreakpoints", map[string]interface{}{
+		"breakpoints": []map[string]string{{"instructionReference": "0x202", "condition": "V0 =="}},
+	})
+	breakpoints = c.expect("setInstructionBreakpoints")["breakpoints"].([]interface{})
+	if bp := breakpoints[0].(map[string]interface{}); bp["verified"] == true || bp["message"] == nil {
+		t.Errorf("Expected a bad condition to be reported but was %v", bp)
+	}
+
+	c.request("next", map[string]int{"threadId": dapThreadID})
+	c.expect("next")
+	if stop := c.expect("stopped"); stop["reason"] != StopStep {
+		t.Errorf("Expected to stop after a step but was %v", stop["reason"])
+	}
+
+	c.request("stepBack", map[string]int{"threadId": dapThreadID})
+	c.expect("stepBack")
+	if stop := c.expect("stopped"); stop["reason"] != StopStep {
+		t.Errorf("Expected to stop after stepping back but was %v", stop["reason"])
+	}
+	c.request("stackTrace", map[string]int{"threadId": dapThreadID})
+	frames = c.expect("stackTrace")["stackFrames"].([]interface{})
+	if name := frames[0].(map[string]interface{})["name"]; name != "0x206" {
+		t.Errorf("Expected to step back to 0x206 but was %v", name)
+	}
+
+	c.request("disconnect", nil)
+	c.expect("disconnect")
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RunFrame(10, 0); err != ErrDetached {
+		t.Errorf("Expected the debugger to detach but was %v", err)
+	}
+}
@@ -0,0 +1,428 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// Reasons the debugger stopped, as named by the Debug Adapter Protocol
+const (
+	StopEntry      = "entry"
+	StopBreakpoint = "breakpoint"
+	StopStep       = "step"
+	StopPause      = "pause"
+	StopData       = "data breakpoint"
+)
+
+// ErrDetached is returned to end a frontend's frame loop
+// once the debugging client has gone
+var ErrDetached = errors.New("debugger detached")
+
+// Breakpoint stops the program before it runs the instruction at Addr.
+// With a Condition it only counts as hit when the condition is true,
+// and with Hits it only stops on some of the hits. A breakpoint with
+// a Log message is a tracepoint, which logs the message instead of stopping.
+type Breakpoint struct {
+	Addr      uint16
+	Condition *Expr
+	Hits      HitCondition
+	Log       *Message
+}
+
+// HitCondition chooses which hits of a breakpoint stop the program.
+// The zero value stops on every hit.
+type HitCondition struct {
+	// Op is >= to stop from the Nth hit on, == to stop only on the Nth,
+	// > to stop after the Nth, or % to stop on every Nth
+	Op string
+	N  int
+}
+
+// ParseHitCondition parses a hit condition such as 5 or >=5, ==5, >5 or %5.
+// A plain count stops from that hit on.
+func ParseHitCondition(s string) (HitCondition, error) {
+	s = strings.TrimSpace(s)
+	h := HitCondition{Op: ">="}
+	for _, op := range []string{">=", "==", ">", "%"} {
+		if strings.HasPrefix(s, op) {
+			h.Op = op
+			s = strings.TrimSpace(s[len(op):])
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || h.Op == "%" && n == 0 {
+		return HitCondition{}, fmt.Errorf("invalid hit count %q", s)
+	}
+	h.N = n
+
+	return h, nil
+}
+
+// Match reports whether the program stops on a hit, counting from 1
+func (h HitCondition) Match(hits int) bool {
+	switch h.Op {
+	case "==":
+		return hits == h.N
+	case ">":
+		return hits > h.N
+	case "%":
+		return hits%h.N == 0
+	}
+
+	return hits >= h.N
+}
+
+func (h HitCondition) String() string {
+	if h.Op == "" {
+		return ""
+	}
+
+	return h.Op + strconv.Itoa(h.N)
+}
+
+// breakpoint is a breakpoint and the times it has been hit
+type breakpoint struct {
+	Breakpoint
+	hits int
+}
+
+type stepMode int
+
+const (
+	stepNone stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+// Debugger runs an emulator a frame at a time like a frontend would,
+// but stops before any instruction with a breakpoint, after any
+// instruction that touches a watchpoint, and can step one instruction
+// or subroutine at a time. While it is stopped, RunFrame
+// does nothing so the frontend keeps showing the same display.
+//
+// The frame loop and the debugging protocol run on different goroutines,
+// so the emulator must only be touched through the debugger's methods.
+type Debugger struct {
+	mu sync.Mutex
+	e  *emu.Emulator
+
+	// Symbols map addresses to source lines and labels, if there are any
+	Symbols *SourceMap
+
+	// breakpoints are grouped by where they were set, such as one
+	// source file, so each group can be replaced on its own
+	groups      map[string][]*breakpoint
+	breakpoints map[uint16][]*breakpoint
+	watchGroups map[string][]Watchpoint
+	watchpoints []Watchpoint
+
+	// hit is the first watchpoint hit by the running instruction
+	hit        WatchHit
+	hitPending bool
+	lastHit    WatchHit
+	// logs are messages from tracepoints and logging watchpoints waiting for onLog
+	logs []string
+	// written holds the frame each byte was last written in, plus one,
+	// while TrackWrites is on, and sprites the sprites drawn while
+	// TrackSprites is
+	written []int
+	sprites map[uint16]int
+	// coverage counts what the program runs and reads while TrackCoverage is on
+	coverage *Coverage
+
+	// frame and cycle are the position in the run, for going backwards
+	frame     int
+	cycle     int
+	input     frameInput // the current frame's
+	history   history
+	replaying bool
+
+	stopped bool
+	// resuming skips the breakpoint at the PC the debugger stopped on
+	resuming bool
+	step     stepMode
+	depth    int // stack depth when the step began
+	inFrame  bool
+	detached bool
+
+	onStop func(reason string)
+	onLog  func(msg string)
+}
+
+// New makes a debugger for an emulator that has been set up with a ROM.
+// It starts stopped, so breakpoints can be set before anything runs.
+func New(e *emu.Emulator) *Debugger {
+	return &Debugger{
+		e:           e,
+		groups:      make(map[string][]*breakpoint),
+		breakpoints: make(map[uint16][]*breakpoint),
+		watchGroups: make(map[string][]Watchpoint),
+		stopped:     true,
+	}
+}
+
+// OnStop sets a function called whenever the program stops by itself,
+// at a breakpoint or the end of a step. It is called from the frame loop.
+func (d *Debugger) OnStop(f func(reason string)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.onStop = f
+}
+
+// OnLog sets a function called with the messages of tracepoints and
+// logging watchpoints. It is called from the frame loop.
+func (d *Debugger) OnLog(f func(msg string)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.onLog = f
+}
+
+// Reset switches to a new emulator, such as when the game restarts.
+// Breakpoints are kept.
+func (d *Debugger) Reset(e *emu.Emulator) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.e = e
+	d.inFrame = false
+	d.frame = 0
+	d.cycle = 0
+	d.history = history{}
+	if d.written != nil {
+		d.written = make([]int, emu.RamSize)
+	}
+	d.updateWatchpoints()
+}
+
+// View calls f with the emulator while nothing else can change it.
+// Changes must be made with Edit.
+func (d *Debugger) View(f func(e *emu.Emulator)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f(d.e)
+}
+
+// SetBreakpoints replaces the breakpoints in a group, and their hit counts
+func (d *Debugger) SetBreakpoints(group string, breakpoints []Breakpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(breakpoints) == 0 {
+		delete(d.groups, group)
+	} else {
+		bps := make([]*breakpoint, len(breakpoints))
+		for i, bp := range breakpoints {
+			bps[i] = &breakpoint{Breakpoint: bp}
+		}
+		d.groups[group] = bps
+	}
+	d.updateBreakpoints()
+}
+
+func (d *Debugger) updateBreakpoints() {
+	d.breakpoints = make(map[uint16][]*breakpoint)
+	for _, group := range d.groups {
+		for _, bp := range group {
+			d.breakpoints[bp.Addr] = append(d.breakpoints[bp.Addr], bp)
+		}
+	}
+}
+
+// Stopped reports whether the program is stopped
+func (d *Debugger) Stopped() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.stopped
+}
+
+// Pause stops the program before its next instruction
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopped = true
+	d.step = stepNone
+}
+
+// Continue runs until the next breakpoint
+func (d *Debugger) Continue() {
+	d.resume(stepNone)
+}
+
+// StepIn runs one instruction, following 2nnn into the subroutine
+func (d *Debugger) StepIn() {
+	d.resume(stepIn)
+}
+
+// StepOver runs one instruction, running a whole subroutine
+// if the instruction is 2nnn
+func (d *Debugger) StepOver() {
+	d.resume(stepOver)
+}
+
+// StepOut runs until the current subroutine returns with 00EE
+func (d *Debugger) StepOut() {
+	d.resume(stepOut)
+}
+
+func (d *Debugger) resume(step stepMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopped = false
+	d.resuming = true
+	d.step = step
+	d.depth = int(d.e.CPU().SP)
+}
+
+// Detach ends the frame loop, for when the client that launched
+// the program disconnects
+func (d *Debugger) Detach() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.detached = true
+	d.stopped = false
+	d.step = stepNone
+}
+
+// Release removes a group's breakpoints and watchpoints and lets the
+// program run on, for when a client that attached to it disconnects
+func (d *Debugger) Release(group string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopped = false
+	d.step = stepNone
+	delete(d.groups, group)
+	d.updateBreakpoints()
+	delete(d.watchGroups, group)
+	d.updateWatchpoints()
+}
+
+// RunFrame runs the emulator for a frame, or what is left of the
+// frame it stopped in, unless it is stopped. It returns ErrDetached
+// once the debugging client has gone.
+func (d *Debugger) RunFrame(cycles int, keys emu.Keys) error {
+	d.mu.Lock()
+	if d.detached {
+		d.mu.Unlock()
+		return ErrDetached
+	}
+	reason := d.runFrame(cycles, keys)
+	onStop, onLog, logs := d.onStop, d.onLog, d.logs
+	d.logs = nil
+	d.mu.Unlock()
+
+	if onLog != nil {
+		for _, msg := range logs {
+			onLog(msg)
+		}
+	}
+	if reason != "" && onStop != nil {
+		onStop(reason)
+	}
+
+	return nil
+}
+
+// runFrame runs instructions until the frame ends or the program
+// stops, returning why it stopped
+func (d *Debugger) runFrame(cycles int, keys emu.Keys) string {
+	if d.stopped {
+		return ""
+	}
+	if !d.inFrame {
+		d.record(cycles, keys)
+		d.e.StartFrame(cycles, keys)
+		d.inFrame = true
+		d.cycle = 0
+	}
+
+	for {
+		// an instruction waiting on Fx0A has already run
+		if !d.e.Input.WaitingForInput {
+			if reason := d.check(d.e.CPU()); reason != "" {
+				d.stopped = true
+				d.step = stepNone
+				return reason
+			}
+		}
+
+		pc, waiting := d.e.CPU().PC, d.e.Input.WaitingForInput
+		if !d.e.StepFrame() {
+			break
+		}
+		if d.coverage != nil && ranInstruction(d.e, pc, waiting) {
+			d.coverage.Executed[pc%emu.RamSize]++
+		}
+		d.cycle++
+		d.resuming = false
+		if d.hitPending {
+			d.hitPending = false
+			d.stopped = true
+			d.step = stepNone
+			d.lastHit = d.hit
+			return StopData
+		}
+		if d.step == stepIn && !d.e.Input.WaitingForInput {
+			d.stopped = true
+			d.step = stepNone
+			return StopStep
+		}
+	}
+
+	d.e.EndFrame()
+	d.inFrame = false
+	d.frame++
+	d.cycle = 0
+
+	return ""
+}
+
+// check decides whether to stop before the instruction at the PC
+func (d *Debugger) check(cpu *emu.CPU) string {
+	if d.resuming {
+		return ""
+	}
+
+	depth := int(cpu.SP)
+	switch {
+	case d.step == stepOver && depth <= d.depth:
+		return StopStep
+	case d.step == stepOut && depth < d.depth:
+		return StopStep
+	}
+
+	stop := false
+	for _, bp := range d.breakpoints[cpu.PC] {
+		if bp.Condition != nil && !bp.Condition.True(d.e) {
+			continue
+		}
+		bp.hits++
+		if !bp.Hits.Match(bp.hits) {
+			continue
+		}
+		if bp.Log != nil {
+			d.logs = append(d.logs, bp.Log.Format(d.e))
+		} else {
+			stop = true
+		}
+	}
+	if stop {
+		return StopBreakpoint
+	}
+
+	return ""
+}
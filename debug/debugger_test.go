@@ -0,0 +1,331 @@
+package debug
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// callROM calls a subroutine then loops forever
+var callROM = []byte{
+	0x22, 0x06, // 0x200 CALL 0x206
+	0x60, 0x01, // 0x202 LD V0, 1
+	0x12, 0x04, // 0x204 JP 0x204
+	0x61, 0x02, // 0x206 LD V1, 2
+	0x00, 0xEE, // 0x208 RET
+}
+
+// storeROM stores V0 at 0x300, then loops forever
+var storeROM = []byte{
+	0xA3, 0x00, // 0x200 LD I, 0x300
+	0x60, 0x05, // 0x202 LD V0, 5
+	0xF0, 0x55, // 0x204 LD [I], V0
+	0x12, 0x06, // 0x206 JP 0x206
+}
+
+// countROM counts up in V0 forever
+var countROM = []byte{
+	0x60, 0x00, // 0x200 LD V0, 0
+	0x70, 0x01, // 0x202 ADD V0, 1
+	0x12, 0x02, // 0x204 JP 0x202
+}
+
+func newTestDebugger() *Debugger {
+	return newDebuggerFor(callROM)
+}
+
+func newDebuggerFor(rom []byte) *Debugger {
+	e := &emu.Emulator{Seed: 1}
+	e.SetupROM(rom)
+
+	return New(e)
+}
+
+// runUntilStopped runs frames until the debugger stops, returning why
+func runUntilStopped(t *testing.T, d *Debugger) string {
+	var reason string
+	d.OnStop(func(r string) {
+		reason = r
+	})
+	for frame := 0; frame < 10 && reason == ""; frame++ {
+		if err := d.RunFrame(10, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reason == "" {
+		t.Fatal("Expected the debugger to stop")
+	}
+
+	return reason
+}
+
+func cpuState(d *Debugger) (pc uint16, sp byte, v [16]byte) {
+	d.View(func(e *emu.Emulator) {
+		cpu := e.CPU()
+		pc, sp, v = cpu.PC, cpu.SP, cpu.V
+	})
+
+	return
+}
+
+func TestDebuggerStartsStopped(t *testing.T) {
+	d := newTestDebugger()
+	if err := d.RunFrame(10, 0); err != nil {
+		t.Fatal(err)
+	}
+	if pc, _, _ := cpuState(d); pc != 0x200 {
+		t.Errorf("Expected no instructions to run but PC was 0x%X", pc)
+	}
+}
+
+func TestDebuggerBreakpoint(t *testing.T) {
+	d := newTestDebugger()
+	d.SetBreakpoints("test", []Breakpoint{{Addr: 0x206}})
+	d.Continue()
+
+	if reason := runUntilStopped(t, d); reason != StopBreakpoint {
+		t.Errorf("Expected a breakpoint stop but was %q", reason)
+	}
+	pc, sp, v := cpuState(d)
+	if pc != 0x206 || sp != 1 || v[1] != 0 {
+		t.Errorf("Expected to stop before 0x206 in the subroutine but was at 0x%X with SP %d", pc, sp)
+	}
+
+	// continuing runs on past the breakpoint it stopped at
+	d.SetBreakpoints("test", []Breakpoint{{Addr: 0x206}, {Addr: 0x204}})
+	d.Continue()
+	runUntilStopped(t, d)
+	if pc, _, _ := cpuState(d); pc != 0x204 {
+		t.Errorf("Expected to stop at 0x204 but was at 0x%X", pc)
+	}
+}
+
+func TestDebuggerConditionalBreakpoint(t *testing.T) {
+	tests := []struct {
+		condition string
+		hits      string
+		want      byte
+	}{
+		{"V0 == 5", "", 5},
+		{"", "3", 3},
+		{"V0 > 2", "==2", 4},
+		{"V0 & 1", "%3", 5},
+	}
+	for _, test := range tests {
+		d := newDebuggerFor(countROM)
+		bp := Breakpoint{Addr: 0x204}
+		var err error
+		if test.condition != "" {
+			if bp.Condition, err = ParseExpr(test.condition, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.hits != "" {
+			if bp.Hits, err = ParseHitCondition(test.hits); err != nil {
+				t.Fatal(err)
+			}
+		}
+		d.SetBreakpoints("test", []Breakpoint{bp})
+		d.Continue()
+
+		runUntilStopped(t, d)
+		if _, _, v := cpuState(d); v[0] != test.want {
+			t.Errorf("%s hits %s: expected to stop with V0 = %d but was %d", test.condition, test.hits, test.want, v[0])
+		}
+	}
+}
+
+func TestDebuggerTracepoint(t *testing.T) {
+	d := newDebuggerFor(countROM)
+	message, err := ParseMessage("count={V0} at {PC}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition, _ := ParseExpr("V0 <= 3", nil)
+	d.SetBreakpoints("test", []Breakpoint{{Addr: 0x204, Condition: condition, Log: message}})
+	var logs []string
+	d.OnLog(func(msg string) {
+		logs = append(logs, msg)
+	})
+	d.Continue()
+
+	d.RunFrame(20, 0)
+	if d.Stopped() {
+		t.Errorf("Expected a tracepoint not to stop")
+	}
+	want := "count=1 at 0x204,count=2 at 0x204,count=3 at 0x204"
+	if got := strings.Join(logs, ","); got != want {
+		t.Errorf("Expected logs %q but was %q", want, got)
+	}
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	tests := []struct {
+		name string
+		step func(d *Debugger)
+		pc   uint16
+		sp   byte
+		v1   byte
+	}{
+		{"in", (*Debugger).StepIn, 0x206, 1, 0},
+		{"over", (*Debugger).StepOver, 0x202, 0, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newTestDebugger()
+			test.step(d)
+			if reason := runUntilStopped(t, d); reason != StopStep {
+				t.Errorf("Expected a step stop but was %q", reason)
+			}
+			pc, sp, v := cpuState(d)
+			if pc != test.pc || sp != test.sp || v[1] != test.v1 {
+				t.Errorf("Expected PC 0x%X, SP %d, V1 %d but was 0x%X, %d, %d", test.pc, test.sp, test.v1, pc, sp, v[1])
+			}
+		})
+	}
+}
+
+func TestDebuggerStepOut(t *testing.T) {
+	d := newTestDebugger()
+	d.StepIn()
+	runUntilStopped(t, d)
+
+	d.StepOut()
+	if reason := runUntilStopped(t, d); reason != StopStep {
+		t.Errorf("Expected a step stop but was %q", reason)
+	}
+	if pc, sp, v := cpuState(d); pc != 0x202 || sp != 0 || v[1] != 2 {
+		t.Errorf("Expected to return to 0x202 but was at 0x%X with SP %d", pc, sp)
+	}
+}
+
+func TestDebuggerWatchpoint(t *testing.T) {
+	d := newDebuggerFor(storeROM)
+	// reads don't trigger a write watchpoint
+	d.SetWatchpoints("test", []Watchpoint{{Addr: 0x2FF, Len: 2, Access: AccessWrite}})
+	d.Continue()
+
+	if reason := runUntilStopped(t, d); reason != StopData {
+		t.Errorf("Expected a data breakpoint stop but was %q", reason)
+	}
+	// the stop comes after the instruction that wrote
+	if pc, _, _ := cpuState(d); pc != 0x206 {
+		t.Errorf("Expected to stop after the store at 0x206 but was at 0x%X", pc)
+	}
+	if hit := d.LastHit(); hit.Addr != 0x300 || hit.Access != AccessWrite {
+		t.Errorf("Expected a write to 0x300 but was %+v", hit)
+	}
+}
+
+func TestDebuggerLogWatchpoint(t *testing.T) {
+	d := newDebuggerFor(storeROM)
+	d.SetWatchpoints("test", []Watchpoint{{Addr: 0x300, Len: 1, Access: AccessWrite, Log: true}})
+	var logs []string
+	d.OnLog(func(msg string) {
+		logs = append(logs, msg)
+	})
+	d.Continue()
+
+	for i := 0; i < 3; i++ {
+		d.RunFrame(10, 0)
+	}
+	if d.Stopped() {
+		t.Errorf("Expected a logging watchpoint not to stop")
+	}
+	if want := []string{"frame 0: 0x204 wrote 0x05 at 0x300"}; strings.Join(logs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected logs %q but was %q", want, logs)
+	}
+
+	// without watchpoints the memory hook is removed
+	d.SetWatchpoints("test", nil)
+	d.Reset(d.e)
+	d.Continue()
+	d.RunFrame(10, 0)
+	if len(logs) != 1 {
+		t.Errorf("Expected no more logs but was %q", logs)
+	}
+}
+
+func TestParseWatchpoint(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Watchpoint
+	}{
+		{"0x300", Watchpoint{Addr: 0x300, Len: 1, Access: AccessRead | AccessWrite}},
+		{"300-30F", Watchpoint{Addr: 0x300, Len: 0x10, Access: AccessRead | AccessWrite}},
+		{"0x300-0x301:w", Watchpoint{Addr: 0x300, Len: 2, Access: AccessWrite}},
+		{"0x2A0:R", Watchpoint{Addr: 0x2A0, Len: 1, Access: AccessRead}},
+	}
+	for _, test := range tests {
+		w, err := ParseWatchpoint(test.s)
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+		} else if w != test.want {
+			t.Errorf("%s: expected %+v but was %+v", test.s, test.want, w)
+		}
+	}
+
+	for _, s := range []string{"", "0x300:x", "0x30F-0x300", "0x1000", "here"} {
+		if _, err := ParseWatchpoint(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestDebuggerRelease(t *testing.T) {
+	d := newTestDebugger()
+	d.SetBreakpoints("test", []Breakpoint{{Addr: 0x206}})
+	d.Release("test")
+	for i := 0; i < 3; i++ {
+		if err := d.RunFrame(10, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d.Stopped() {
+		t.Error("Expected a released program to run past its breakpoints")
+	}
+}
+
+func TestDebuggerDetach(t *testing.T) {
+	d := newTestDebugger()
+	d.Detach()
+	if err := d.RunFrame(10, 0); err != ErrDetached {
+		t.Errorf("Expected ErrDetached but was %v", err)
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	m, err := ReadSourceMap(strings.NewReader(`chip8go sourcemap 1
+# comment
+label 0x200 main
+label 0x206 draw
+line 0x200 3 game.8o
+line 0x202 4 game.8o
+line 0x206 10 lib/draw.8o
+`), "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if addr, ok := m.Label("draw"); !ok || addr != 0x206 {
+		t.Errorf("Expected draw at 0x206 but was 0x%X", addr)
+	}
+	if name, _ := m.Function(0x208); name != "draw" {
+		t.Errorf("Expected 0x208 in draw but was %q", name)
+	}
+	if src, _ := m.Source(0x204); src.Line != 4 || src.File != "/src/game.8o" {
+		t.Errorf("Expected 0x204 at game.8o:4 but was %v", src)
+	}
+	if addrs := m.Addresses("/src/lib/draw.8o", 10); len(addrs) != 1 || addrs[0] != 0x206 {
+		t.Errorf("Expected draw.8o:10 at 0x206 but was %v", addrs)
+	}
+	// a client may only know the file name
+	if addrs := m.Addresses("/elsewhere/game.8o", 3); len(addrs) != 1 || addrs[0] != 0x200 {
+		t.Errorf("Expected game.8o:3 at 0x200 but was %v", addrs)
+	}
+
+	if _, err := ReadSourceMap(strings.NewReader("chip8go sourcemap 1\nline 0x1000 1 a.8o\n"), ""); err == nil {
+		t.Error("Expected an error for an address past the end of memory")
+	}
+}
@@ -0,0 +1,3 @@
+// Package debug stops and steps the emulator for debugging CHIP-8
+// programs, and serves the protocols that editors use to drive it.
+package debug
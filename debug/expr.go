@@ -0,0 +1,406 @@
+package debug
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// Expr is an expression evaluated against the emulator state, such as
+// V3 == 0x10 && I > 0x300. Its operands are numbers, the registers V0-VF,
+// I, PC, SP, DT and ST, labels from the source map, and [addr] for
+// a byte of memory. The operators are those of C, with C's precedence.
+// Comparisons and logical operators give 1 or 0, and dividing
+// by zero gives 0.
+type Expr struct {
+	src  string
+	eval func(e *emu.Emulator) int
+	// addr is set for expressions that are addresses, such as PC,
+	// so they are shown in hex
+	addr bool
+}
+
+// ParseExpr parses an expression, looking up labels in symbols if it isn't nil
+func ParseExpr(s string, symbols *SourceMap) (*Expr, error) {
+	p := &exprParser{symbols: symbols}
+	if err := p.tokenize(s); err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", s, err)
+	}
+	x, err := p.parse(0)
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", s, err)
+	}
+	x.src = strings.TrimSpace(s)
+
+	return x, nil
+}
+
+func (x *Expr) String() string {
+	return x.src
+}
+
+// Eval evaluates the expression. It doesn't change the emulator, and reading
+// memory doesn't trigger watchpoints.
+func (x *Expr) Eval(e *emu.Emulator) int {
+	return x.eval(e)
+}
+
+// True reports whether the expression is non-zero, as a condition
+func (x *Expr) True(e *emu.Emulator) bool {
+	return x.eval(e) != 0
+}
+
+// Format evaluates the expression and formats the result, addresses in hex
+func (x *Expr) Format(e *emu.Emulator) string {
+	v := x.eval(e)
+	if x.addr && v >= 0 {
+		return fmt.Sprintf("0x%03X", v)
+	}
+
+	return strconv.Itoa(v)
+}
+
+// binaryOps lists the binary operators from the lowest precedence
+var binaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// operators are the operator tokens, longest first so they tokenize greedily
+var operators = []string{
+	"||", "&&", "==", "!=", "<=", ">=", "<<", ">>",
+	"|", "^", "&", "<", ">", "+", "-", "*", "/", "%", "!", "~", "(", ")", "[", "]",
+}
+
+type exprParser struct {
+	symbols *SourceMap
+	tokens  []string
+	pos     int
+}
+
+func (p *exprParser) tokenize(s string) error {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case isWordByte(c):
+			j := i
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+			p.tokens = append(p.tokens, s[i:j])
+			i = j
+			continue
+		}
+
+		op := ""
+		for _, o := range operators {
+			if strings.HasPrefix(s[i:], o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return fmt.Errorf("unexpected %q", c)
+		}
+		p.tokens = append(p.tokens, op)
+		i += len(op)
+	}
+	if len(p.tokens) == 0 {
+		return fmt.Errorf("empty")
+	}
+
+	return nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	if t != "" {
+		p.pos++
+	}
+
+	return t
+}
+
+// parse parses binary operators of a precedence level and above
+func (p *exprParser) parse(level int) (*Expr, error) {
+	if level == len(binaryOps) {
+		return p.unary()
+	}
+
+	x, err := p.parse(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, o := range binaryOps[level] {
+			found = found || op == o
+		}
+		if !found {
+			return x, nil
+		}
+		p.next()
+		y, err := p.parse(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binary(op, x, y)
+	}
+}
+
+func binary(op string, x, y *Expr) *Expr {
+	a, b := x.eval, y.eval
+	var f func(e *emu.Emulator) int
+	switch op {
+	case "||":
+		f = func(e *emu.Emulator) int { return truth(a(e) != 0 || b(e) != 0) }
+	case "&&":
+		f = func(e *emu.Emulator) int { return truth(a(e) != 0 && b(e) != 0) }
+	case "|":
+		f = func(e *emu.Emulator) int { return a(e) | b(e) }
+	case "^":
+		f = func(e *emu.Emulator) int { return a(e) ^ b(e) }
+	case "&":
+		f = func(e *emu.Emulator) int { return a(e) & b(e) }
+	case "==":
+		f = func(e *emu.Emulator) int { return truth(a(e) == b(e)) }
+	case "!=":
+		f = func(e *emu.Emulator) int { return truth(a(e) != b(e)) }
+	case "<":
+		f = func(e *emu.Emulator) int { return truth(a(e) < b(e)) }
+	case "<=":
+		f = func(e *emu.Emulator) int { return truth(a(e) <= b(e)) }
+	case ">":
+		f = func(e *emu.Emulator) int { return truth(a(e) > b(e)) }
+	case ">=":
+		f = func(e *emu.Emulator) int { return truth(a(e) >= b(e)) }
+	case "<<":
+		f = func(e *emu.Emulator) int { return a(e) << uint(b(e)&31) }
+	case ">>":
+		f = func(e *emu.Emulator) int { return a(e) >> uint(b(e)&31) }
+	case "+":
+		f = func(e *emu.Emulator) int { return a(e) + b(e) }
+	case "-":
+		f = func(e *emu.Emulator) int { return a(e) - b(e) }
+	case "*":
+		f = func(e *emu.Emulator) int { return a(e) * b(e) }
+	case "/":
+		f = func(e *emu.Emulator) int {
+			if d := b(e); d != 0 {
+				return a(e) / d
+			}
+			return 0
+		}
+	case "%":
+		f = func(e *emu.Emulator) int {
+			if d := b(e); d != 0 {
+				return a(e) % d
+			}
+			return 0
+		}
+	}
+
+	// address arithmetic such as PC+2 is still an address
+	addr := (op == "+" || op == "-") && (x.addr || y.addr)
+
+	return &Expr{eval: f, addr: addr}
+}
+
+func truth(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func (p *exprParser) unary() (*Expr, error) {
+	switch op := p.peek(); op {
+	case "!", "~", "-":
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		a := x.eval
+		switch op {
+		case "!":
+			return &Expr{eval: func(e *emu.Emulator) int { return truth(a(e) == 0) }}, nil
+		case "~":
+			return &Expr{eval: func(e *emu.Emulator) int { return ^a(e) }}, nil
+		default:
+			return &Expr{eval: func(e *emu.Emulator) int { return -a(e) }}, nil
+		}
+	}
+
+	return p.primary()
+}
+
+func (p *exprParser) primary() (*Expr, error) {
+	t := p.next()
+	switch t {
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	case "(", "[":
+		x, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		closing := ")"
+		if t == "[" {
+			closing = "]"
+		}
+		if p.next() != closing {
+			return nil, fmt.Errorf("missing %q", closing)
+		}
+		if t == "(" {
+			return x, nil
+		}
+		a := x.eval
+		return &Expr{eval: func(e *emu.Emulator) int {
+			return int(e.Memory().RAM[a(e)&(emu.RamSize-1)])
+		}}, nil
+	}
+
+	if t[0] >= '0' && t[0] <= '9' {
+		v, err := parseNumber(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t)
+		}
+		return &Expr{eval: func(*emu.Emulator) int { return v }}, nil
+	}
+	if x := register(t); x != nil {
+		return x, nil
+	}
+	if addr, ok := p.symbols.Label(t); ok {
+		return &Expr{eval: func(*emu.Emulator) int { return int(addr) }, addr: true}, nil
+	}
+
+	return nil, fmt.Errorf("unknown name %q", t)
+}
+
+// parseNumber parses a decimal number, or hex with 0x or binary with 0b
+func parseNumber(s string) (int, error) {
+	base, digits := 10, s
+	if len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			base, digits = 16, s[2:]
+		case 'b', 'B':
+			base, digits = 2, s[2:]
+		}
+	}
+	v, err := strconv.ParseInt(digits, base, 32)
+
+	return int(v), err
+}
+
+// register looks up a register by name, in any case
+func register(name string) *Expr {
+	switch n := strings.ToUpper(name); n {
+	case "I":
+		return &Expr{eval: func(e *emu.Emulator) int { return int(e.CPU().I) }, addr: true}
+	case "PC":
+		return &Expr{eval: func(e *emu.Emulator) int { return int(e.CPU().PC) }, addr: true}
+	case "SP":
+		return &Expr{eval: func(e *emu.Emulator) int { return int(e.CPU().SP) }}
+	case "DT":
+		return &Expr{eval: func(e *emu.Emulator) int { return int(e.CPU().DelayTimer) }}
+	case "ST":
+		return &Expr{eval: func(e *emu.Emulator) int { return int(e.CPU().SoundTimer) }}
+	default:
+		if len(n) == 2 && n[0] == 'V' {
+			if x, err := strconv.ParseUint(n[1:], 16, 4); err == nil {
+				return &Expr{eval: func(e *emu.Emulator) int { return int(e.CPU().V[x]) }}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Message is a log message with expressions in braces, such as
+// "score={V5} at {PC}". Doubled braces are literal.
+type Message struct {
+	src   string
+	text  []string
+	exprs []*Expr
+}
+
+// ParseMessage parses a log message, looking up labels in symbols if it isn't nil
+func ParseMessage(s string, symbols *SourceMap) (*Message, error) {
+	m := &Message{src: s}
+	var text strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{") || strings.HasPrefix(s[i:], "}}"):
+			text.WriteByte(s[i])
+			i++
+		case s[i] == '}':
+			return nil, fmt.Errorf("invalid message %q: unmatched }", s)
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid message %q: unmatched {", s)
+			}
+			x, err := ParseExpr(s[i+1:i+end], symbols)
+			if err != nil {
+				return nil, err
+			}
+			m.text = append(m.text, text.String())
+			m.exprs = append(m.exprs, x)
+			text.Reset()
+			i += end
+		default:
+			text.WriteByte(s[i])
+		}
+	}
+	m.text = append(m.text, text.String())
+
+	return m, nil
+}
+
+func (m *Message) String() string {
+	return m.src
+}
+
+// Format fills in the message's expressions
+func (m *Message) Format(e *emu.Emulator) string {
+	var b strings.Builder
+	for i, x := range m.exprs {
+		b.WriteString(m.text[i])
+		b.WriteString(x.Format(e))
+	}
+	b.WriteString(m.text[len(m.text)-1])
+
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package debug
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+func TestExpr(t *testing.T) {
+	e := &emu.Emulator{Seed: 1}
+	e.SetupROM(storeROM)
+	cpu := e.CPU()
+	cpu.V[3] = 0x10
+	cpu.V[0xA] = 7
+	cpu.I = 0x301
+	e.Memory().RAM[0x301] = 0x42
+
+	symbols, err := ReadSourceMap(strings.NewReader("chip8go sourcemap 1\nlabel 0x300 score\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"V3 == 0x10 && I > 0x300", "1"},
+		{"v3 == 16 && I > 0x301", "0"},
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"VA % 4 | 8", "11"},
+		{"-VA + 1", "-6"},
+		{"!V1 && ~0 == -1", "1"},
+		{"1 << 4 >> 2", "4"},
+		{"0b101 ^ 1", "4"},
+		{"VA / 0", "0"},
+		{"[I]", "66"},
+		{"[score + 1] == 0x42", "1"},
+		{"PC", "0x200"},
+		{"I + 2", "0x303"},
+		{"score", "0x300"},
+		{"SP + DT + ST", "0"},
+	}
+	for _, test := range tests {
+		x, err := ParseExpr(test.expr, symbols)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := x.Format(e); got != test.want {
+			t.Errorf("%s: expected %s but was %s", test.expr, test.want, got)
+		}
+	}
+
+	for _, s := range []string{"", "V3 ==", "(V3", "[I", "VG", "3 $ 4", "V3 V4", "0x"} {
+		if _, err := ParseExpr(s, symbols); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	e := &emu.Emulator{Seed: 1}
+	e.SetupROM(storeROM)
+	e.CPU().V[5] = 12
+
+	m, err := ParseMessage("score={V5} at {PC} {{literal}}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Format(e), "score=12 at 0x200 {literal}"; got != want {
+		t.Errorf("Expected %q but was %q", want, got)
+	}
+
+	for _, s := range []string{"{V5", "V5}", "{V5 +}"} {
+		if _, err := ParseMessage(s, nil); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestHitCondition(t *testing.T) {
+	tests := []struct {
+		s    string
+		hits []bool
+	}{
+		{"3", []bool{false, false, true, true}},
+		{">=2", []bool{false, true, true, true}},
+		{"==2", []bool{false, true, false, false}},
+		{"> 2", []bool{false, false, true, true}},
+		{"%2", []bool{false, true, false, true}},
+	}
+	for _, test := range tests {
+		h, err := ParseHitCondition(test.s)
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+			continue
+		}
+		for i, want := range test.hits {
+			if got := h.Match(i + 1); got != want {
+				t.Errorf("%s: expected hit %d to be %v but was %v", test.s, i+1, want, got)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "x", "%0", "-1"} {
+		if _, err := ParseHitCondition(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
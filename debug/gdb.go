@@ -0,0 +1,590 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// GDB register numbers. V0-VF come first, then I, PC and SP.
+// Values are sent most significant byte first, like CHIP-8 memory.
+const (
+	gdbRegI  = 16
+	gdbRegPC = 17
+	gdbRegSP = 18
+	gdbRegs  = 19
+)
+
+// gdbTargetXML describes the registers to the client
+var gdbTargetXML = func() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+<feature name="org.chip8go.cpu">
+`)
+	for i := 0; i < 16; i++ {
+		fmt.Fprintf(&b, "<reg name=\"v%x\" bitsize=\"8\" type=\"uint8\" regnum=\"%d\"/>\n", i, i)
+	}
+	b.WriteString(`<reg name="i" bitsize="16" type="data_ptr" regnum="16"/>
+<reg name="pc" bitsize="16" type="code_ptr" regnum="17"/>
+<reg name="sp" bitsize="8" type="uint8" regnum="18"/>
+</feature>
+</target>
+`)
+	return b.String()
+}()
+
+// gdbGroup holds the breakpoints and watchpoints set by the client,
+// and gdbMonitorGroup those set with its monitor command
+const (
+	gdbGroup        = "gdb"
+	gdbMonitorGroup = "gdb monitor"
+)
+
+// gdbPacket is a packet from the client, or an interrupt
+type gdbPacket struct {
+	data      string
+	interrupt bool
+	badSum    bool
+	err       error
+}
+
+// GDBServer is a GDB remote serial protocol stub for one client.
+// Attaching stops the program, and disconnecting lets it run on.
+type GDBServer struct {
+	conn    io.ReadWriter
+	d       *Debugger
+	monitor *Monitor
+
+	noAck       bool
+	swbreak     bool // the client understands swbreak stop replies
+	running     bool
+	breakpoints map[uint16]bool
+	watchpoints map[Watchpoint]bool
+	stops       chan string
+	lastStop    string
+}
+
+// NewGDBServer makes a stub for a client connected on conn
+func NewGDBServer(conn io.ReadWriter, d *Debugger) *GDBServer {
+	return &GDBServer{
+		conn:        conn,
+		d:           d,
+		monitor:     NewMonitor(d, gdbMonitorGroup),
+		breakpoints: make(map[uint16]bool),
+		watchpoints: make(map[Watchpoint]bool),
+		stops:       make(chan string, 1),
+		lastStop:    StopPause,
+	}
+}
+
+// Serve handles packets until the client detaches or disconnects
+func (s *GDBServer) Serve() error {
+	s.d.Pause()
+	s.d.OnStop(func(reason string) {
+		select {
+		case s.stops <- reason:
+		default:
+		}
+	})
+	defer func() {
+		s.d.OnStop(nil)
+		s.d.Release(gdbGroup)
+		s.d.Release(gdbMonitorGroup)
+	}()
+
+	packets := make(chan gdbPacket)
+	done := make(chan struct{})
+	defer close(done)
+	go s.readPackets(packets, done)
+
+	for {
+		select {
+		case reason := <-s.stops:
+			if s.running {
+				s.running = false
+				s.lastStop = reason
+				s.send(s.stopReply())
+			}
+		case p := <-packets:
+			switch {
+			case p.err == io.EOF:
+				return nil
+			case p.err != nil:
+				return p.err
+			case p.interrupt:
+				if s.running {
+					s.d.Pause()
+					s.running = false
+					s.lastStop = StopPause
+					s.send(s.stopReply())
+				}
+			case p.badSum:
+				s.write("-")
+			default:
+				if !s.noAck {
+					s.write("+")
+				}
+				reply, more := s.handle(p.data)
+				if reply != nil {
+					s.send(*reply)
+				}
+				if !more {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// readPackets reads packets framed as $data#checksum, and the
+// interrupt byte sent to stop a running program
+func (s *GDBServer) readPackets(packets chan<- gdbPacket, done <-chan struct{}) {
+	r := bufio.NewReader(s.conn)
+	for {
+		var p gdbPacket
+		c, err := r.ReadByte()
+		switch {
+		case err != nil:
+			p.err = err
+		case c == 0x03:
+			p.interrupt = true
+		case c == '$':
+			var data string
+			if data, err = r.ReadString('#'); err != nil {
+				p.err = err
+				break
+			}
+			p.data = unescape(data[:len(data)-1])
+			sum := make([]byte, 2)
+			if _, err = io.ReadFull(r, sum); err != nil {
+				p.err = err
+				break
+			}
+			want, _ := strconv.ParseUint(string(sum), 16, 8)
+			p.badSum = byte(want) != checksum(data[:len(data)-1])
+		default:
+			// acknowledgements and noise between packets
+			continue
+		}
+
+		select {
+		case packets <- p:
+		case <-done:
+			return
+		}
+		if p.err != nil {
+			return
+		}
+	}
+}
+
+func (s *GDBServer) write(data string) {
+	io.WriteString(s.conn, data)
+}
+
+func (s *GDBServer) send(data string) {
+	s.write(fmt.Sprintf("$%s#%02x", data, checksum(data)))
+}
+
+// handle answers a packet, returning nil if it has no reply yet
+// and false once the session is over
+func (s *GDBServer) handle(data string) (*string, bool) {
+	reply := func(r string) (*string, bool) {
+		return &r, true
+	}
+
+	switch {
+	case data == "?":
+		return reply(s.stopReply())
+	case strings.HasPrefix(data, "qSupported"):
+		s.swbreak = strings.Contains(data, "swbreak+")
+		return reply("PacketSize=4000;qXfer:features:read+;QStartNoAckMode+;swbreak+;hwbreak+;ReverseStep+;ReverseContinue+")
+	case data == "QStartNoAckMode":
+		s.send("OK")
+		s.noAck = true
+		return nil, true
+	case strings.HasPrefix(data, "qXfer:features:read:target.xml:"):
+		return reply(s.readTargetXML(strings.TrimPrefix(data, "qXfer:features:read:target.xml:")))
+	case data == "qAttached":
+		return reply("1")
+	case data == "qC":
+		return reply("QC1")
+	case data == "qfThreadInfo":
+		return reply("m1")
+	case data == "qsThreadInfo":
+		return reply("l")
+	case strings.HasPrefix(data, "qRcmd,"):
+		return reply(s.command(data[len("qRcmd,"):]))
+	case strings.HasPrefix(data, "H"), strings.HasPrefix(data, "T"):
+		return reply("OK")
+	case data == "g":
+		return reply(s.readRegisters())
+	case strings.HasPrefix(data, "G"):
+		return reply(s.writeRegisters(data[1:]))
+	case strings.HasPrefix(data, "p"):
+		return reply(s.readRegister(data[1:]))
+	case strings.HasPrefix(data, "P"):
+		return reply(s.writeRegister(data[1:]))
+	case strings.HasPrefix(data, "m"):
+		return reply(s.readMemory(data[1:]))
+	case strings.HasPrefix(data, "M"):
+		return reply(s.writeMemory(data[1:]))
+	case strings.HasPrefix(data, "Z"), strings.HasPrefix(data, "z"):
+		return reply(s.setPoint(data[0] == 'Z', data[1:]))
+	case data == "vCont?":
+		return reply("vCont;c;C;s;S")
+	case strings.HasPrefix(data, "vCont;") && len(data) > len("vCont;"):
+		return s.resume(strings.ToLower(data[len("vCont;"):][:1]), "")
+	case strings.HasPrefix(data, "c"), strings.HasPrefix(data, "s"):
+		return s.resume(data[:1], data[1:])
+	case strings.HasPrefix(data, "C"), strings.HasPrefix(data, "S"):
+		// signals mean nothing to a CHIP-8, so C and S are c and s
+		addr := ""
+		if i := strings.IndexByte(data, ';'); i >= 0 {
+			addr = data[i+1:]
+		}
+		return s.resume(strings.ToLower(data[:1]), addr)
+	case data == "bs", data == "bc":
+		return reply(s.reverse(data == "bc"))
+	case strings.HasPrefix(data, "D"):
+		s.send("OK")
+		return nil, false
+	case data == "k":
+		return nil, false
+	}
+
+	// an empty reply means the packet isn't supported
+	return reply("")
+}
+
+// command runs a monitor command, sending its output to the console
+func (s *GDBServer) command(args string) string {
+	line, err := hex.DecodeString(args)
+	if err != nil {
+		return "E01"
+	}
+	out, err := s.monitor.Exec(string(line))
+	if err != nil {
+		out = err.Error()
+	}
+	if out != "" {
+		s.send("O" + hex.EncodeToString([]byte(out+"\n")))
+	}
+
+	return "OK"
+}
+
+// resume continues or steps, optionally from a new address
+func (s *GDBServer) resume(action, addr string) (*string, bool) {
+	if addr != "" {
+		pc, err := strconv.ParseUint(addr, 16, 16)
+		if err != nil || pc >= emu.RamSize {
+			r := "E01"
+			return &r, true
+		}
+		s.d.Edit(func(e *emu.Emulator) {
+			e.CPU().PC = uint16(pc)
+		})
+	}
+
+	// forget a stop that raced with an interrupt
+	select {
+	case <-s.stops:
+	default:
+	}
+
+	s.running = true
+	if action == "s" {
+		s.d.StepIn()
+	} else {
+		s.d.Continue()
+	}
+
+	return nil, true
+}
+
+// reverse steps or continues backwards, which happens at once
+func (s *GDBServer) reverse(continuing bool) string {
+	var reason string
+	var err error
+	if continuing {
+		reason, err = s.d.ReverseContinue()
+	} else {
+		reason, err = s.d.StepBack()
+	}
+	if err != nil {
+		// the client reports that there is no more history
+		return "T05replaylog:begin;thread:1;"
+	}
+	s.lastStop = reason
+
+	return s.stopReply()
+}
+
+// stopReply describes why the program stopped
+func (s *GDBServer) stopReply() string {
+	switch s.lastStop {
+	case StopPause:
+		return "T02thread:1;"
+	case StopData:
+		hit := s.d.LastHit()
+		kind := "awatch"
+		switch hit.Watchpoint.Access {
+		case AccessWrite:
+			kind = "watch"
+		case AccessRead:
+			kind = "rwatch"
+		}
+		return fmt.Sprintf("T05%s:%x;thread:1;", kind, hit.Addr)
+	case StopBreakpoint:
+		if s.swbreak {
+			return "T05swbreak:;thread:1;"
+		}
+	}
+
+	return "T05thread:1;"
+}
+
+func (s *GDBServer) readTargetXML(args string) string {
+	var offset, length int
+	if _, err := fmt.Sscanf(args, "%x,%x", &offset, &length); err != nil {
+		return "E01"
+	}
+	if offset >= len(gdbTargetXML) {
+		return "l"
+	}
+	end := offset + length
+	if end >= len(gdbTargetXML) {
+		return "l" + escape(gdbTargetXML[offset:])
+	}
+
+	return "m" + escape(gdbTargetXML[offset:end])
+}
+
+// registers returns all of the registers in order
+func registers(cpu *emu.CPU) []byte {
+	regs := append([]byte(nil), cpu.V[:]...)
+	regs = append(regs, byte(cpu.I>>8), byte(cpu.I), byte(cpu.PC>>8), byte(cpu.PC), cpu.SP)
+
+	return regs
+}
+
+// registerSpan is where register n is in the output of registers
+func registerSpan(n int) (int, int) {
+	switch {
+	case n < 16:
+		return n, n + 1
+	case n == gdbRegI:
+		return 16, 18
+	case n == gdbRegPC:
+		return 18, 20
+	}
+
+	return 20, 21
+}
+
+func (s *GDBServer) readRegisters() string {
+	var regs []byte
+	s.d.View(func(e *emu.Emulator) {
+		regs = registers(e.CPU())
+	})
+
+	return hex.EncodeToString(regs)
+}
+
+func (s *GDBServer) writeRegisters(data string) string {
+	regs, err := hex.DecodeString(data)
+	if err != nil || len(regs) != 21 {
+		return "E01"
+	}
+	s.d.Edit(func(e *emu.Emulator) {
+		cpu := e.CPU()
+		copy(cpu.V[:], regs)
+		cpu.I = uint16(regs[16])<<8 | uint16(regs[17])
+		cpu.PC = uint16(regs[18])<<8 | uint16(regs[19])
+		cpu.SP = regs[20]
+	})
+
+	return "OK"
+}
+
+func (s *GDBServer) readRegister(data string) string {
+	n, err := strconv.ParseUint(data, 16, 8)
+	if err != nil || n >= gdbRegs {
+		return "E01"
+	}
+	var regs []byte
+	s.d.View(func(e *emu.Emulator) {
+		regs = registers(e.CPU())
+	})
+	start, end := registerSpan(int(n))
+
+	return hex.EncodeToString(regs[start:end])
+}
+
+func (s *GDBServer) writeRegister(data string) string {
+	parts := strings.SplitN(data, "=", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	n, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil || n >= gdbRegs {
+		return "E01"
+	}
+	value, err := hex.DecodeString(parts[1])
+	start, end := registerSpan(int(n))
+	if err != nil || len(value) != end-start {
+		return "E01"
+	}
+
+	s.d.Edit(func(e *emu.Emulator) {
+		cpu := e.CPU()
+		switch {
+		case n < 16:
+			cpu.V[n] = value[0]
+		case n == gdbRegI:
+			cpu.I = uint16(value[0])<<8 | uint16(value[1])
+		case n == gdbRegPC:
+			cpu.PC = uint16(value[0])<<8 | uint16(value[1])
+		default:
+			cpu.SP = value[0]
+		}
+	})
+
+	return "OK"
+}
+
+// memoryRange parses addr,length and checks it is inside RAM
+func memoryRange(args string) (int, int, bool) {
+	var addr, length int
+	if _, err := fmt.Sscanf(args, "%x,%x", &addr, &length); err != nil {
+		return 0, 0, false
+	}
+	if addr < 0 || length < 0 || addr+length > emu.RamSize {
+		return 0, 0, false
+	}
+
+	return addr, length, true
+}
+
+func (s *GDBServer) readMemory(args string) string {
+	addr, length, ok := memoryRange(args)
+	if !ok {
+		return "E01"
+	}
+	var data []byte
+	s.d.View(func(e *emu.Emulator) {
+		data = append(data, e.Memory().RAM[addr:addr+length]...)
+	})
+
+	return hex.EncodeToString(data)
+}
+
+func (s *GDBServer) writeMemory(args string) string {
+	parts := strings.SplitN(args, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	addr, length, ok := memoryRange(parts[0])
+	data, err := hex.DecodeString(parts[1])
+	if !ok || err != nil || len(data) != length {
+		return "E01"
+	}
+	s.d.Edit(func(e *emu.Emulator) {
+		copy(e.Memory().RAM[addr:], data)
+	})
+
+	return "OK"
+}
+
+// setPoint inserts or removes a breakpoint (types 0 and 1)
+// or a write, read or access watchpoint (types 2, 3 and 4)
+func (s *GDBServer) setPoint(insert bool, args string) string {
+	var kind, addr, length int
+	if _, err := fmt.Sscanf(args, "%d,%x,%x", &kind, &addr, &length); err != nil {
+		return "E01"
+	}
+	if addr < 0 || addr >= emu.RamSize {
+		return "E01"
+	}
+
+	switch kind {
+	case 0, 1:
+		if insert {
+			s.breakpoints[uint16(addr)] = true
+		} else {
+			delete(s.breakpoints, uint16(addr))
+		}
+		var breakpoints []Breakpoint
+		for addr := range s.breakpoints {
+			breakpoints = append(breakpoints, Breakpoint{Addr: addr})
+		}
+		s.d.SetBreakpoints(gdbGroup, breakpoints)
+	case 2, 3, 4:
+		access := map[int]Access{2: AccessWrite, 3: AccessRead, 4: AccessRead | AccessWrite}[kind]
+		w := Watchpoint{Addr: uint16(addr), Len: uint16(length), Access: access}
+		if insert {
+			s.watchpoints[w] = true
+		} else {
+			delete(s.watchpoints, w)
+		}
+		var watchpoints []Watchpoint
+		for w := range s.watchpoints {
+			watchpoints = append(watchpoints, w)
+		}
+		s.d.SetWatchpoints(gdbGroup, watchpoints)
+	default:
+		return ""
+	}
+
+	return "OK"
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+
+	return sum
+}
+
+// escape protects the bytes that frame packets in binary replies
+func escape(data string) string {
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '#', '$', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func unescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			b.WriteByte(data[i] ^ 0x20)
+		} else {
+			b.WriteByte(data[i])
+		}
+	}
+
+	return b.String()
+}
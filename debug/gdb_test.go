@@ -0,0 +1,156 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gdbClient sends packets and reads replies, acknowledging each one
+type gdbClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *gdbClient) send(data string) {
+	fmt.Fprintf(c.conn, "$%s#%02x", data, checksum(data))
+}
+
+// reply reads the next packet, skipping acknowledgements
+func (c *gdbClient) reply() string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.r.ReadString('$'); err != nil {
+		c.t.Fatal(err)
+	}
+	data, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	sum := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, sum); err != nil {
+		c.t.Fatal(err)
+	}
+	data = strings.TrimSuffix(data, "#")
+	if want := fmt.Sprintf("%02x", checksum(data)); string(sum) != want {
+		c.t.Errorf("Expected checksum %s for %q but was %s", want, data, sum)
+	}
+	c.conn.Write([]byte("+"))
+
+	return data
+}
+
+func (c *gdbClient) expect(request, want string) {
+	c.t.Helper()
+	c.send(request)
+	if got := c.reply(); got != want {
+		c.t.Errorf("Expected %s to reply %q but was %q", request, want, got)
+	}
+}
+
+func TestGDBServer(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	d := newDebuggerFor(storeROM)
+	d.Continue()
+	served := make(chan error, 1)
+	go func() {
+		served <- NewGDBServer(serverConn, d).Serve()
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				d.RunFrame(10, 0)
+			}
+		}
+	}()
+
+	c := &gdbClient{t: t, conn: clientConn, r: bufio.NewReader(clientConn)}
+	c.send("qSupported:swbreak+")
+	if features := c.reply(); !strings.Contains(features, "qXfer:features:read+") {
+		t.Errorf("Expected target descriptions in %q", features)
+	}
+	c.send("qXfer:features:read:target.xml:0,fff")
+	if xml := c.reply(); !strings.HasPrefix(xml, "l<?xml") || !strings.Contains(xml, `name="pc"`) {
+		t.Errorf("Expected the whole target description but was %q", xml)
+	}
+
+	// attaching stops the program
+	c.expect("?", "T02thread:1;")
+
+	// set a breakpoint where the program starts again, then restart it
+	c.expect("Z0,204,2", "OK")
+	c.expect("P11=0200", "OK")
+	c.send("c")
+	if stop := c.reply(); stop != "T05swbreak:;thread:1;" {
+		t.Errorf("Expected a breakpoint stop but was %q", stop)
+	}
+	c.expect("p11", "0204")
+	c.expect("p10", "0300")
+	c.expect("m300,2", "0000")
+
+	c.expect("z0,204,2", "OK")
+	c.expect("Z2,300,1", "OK")
+	c.send("c")
+	if stop := c.reply(); stop != "T05watch:300;thread:1;" {
+		t.Errorf("Expected a watchpoint stop but was %q", stop)
+	}
+	c.expect("m300,1", "05")
+
+	c.expect("M300,2:abcd", "OK")
+	c.expect("m300,2", "abcd")
+	c.send("g")
+	if regs := c.reply(); len(regs) != 42 || !strings.HasPrefix(regs, "05") {
+		t.Errorf("Expected 21 bytes of registers starting with V0 but was %q", regs)
+	}
+
+	// monitor commands write to the console, and GDB keeps run control
+	for command, want := range map[string]string{"print V0 + 1": "6\n", "continue": "continue is not available here\n"} {
+		c.send("qRcmd," + hex.EncodeToString([]byte(command)))
+		if out := c.reply(); out != "O"+hex.EncodeToString([]byte(want)) {
+			t.Errorf("Expected monitor output %q for %s but was %q", want, command, out)
+		}
+		if ok := c.reply(); ok != "OK" {
+			t.Errorf("Expected OK after monitor output but was %q", ok)
+		}
+	}
+
+	// stepping runs one instruction
+	c.expect("z2,300,1", "OK")
+	c.send("s")
+	if stop := c.reply(); stop != "T05thread:1;" {
+		t.Errorf("Expected a step stop but was %q", stop)
+	}
+	// and stepping back undoes it, though JP 0x206 stays put
+	c.expect("bs", "T05thread:1;")
+	c.expect("p11", "0206")
+	c.expect("bc", "T05replaylog:begin;thread:1;")
+
+	// an interrupt stops a running program
+	c.send("c")
+	time.Sleep(10 * time.Millisecond)
+	clientConn.Write([]byte{0x03})
+	if stop := c.reply(); stop != "T02thread:1;" {
+		t.Errorf("Expected an interrupt stop but was %q", stop)
+	}
+
+	c.expect("D", "OK")
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if d.Stopped() {
+		t.Error("Expected detaching to let the program run")
+	}
+}
@@ -0,0 +1,240 @@
+package debug
+
+import (
+	"errors"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+const (
+	// snapshotInterval is how many frames apart the history's snapshots are
+	snapshotInterval = emu.FrameRate
+	// historyFrames is how far back the debugger can go, 10 minutes
+	historyFrames = 10 * 60 * emu.FrameRate
+)
+
+// ErrNoHistory is returned when going backwards with nothing to go back to
+var ErrNoHistory = errors.New("no history to go back through")
+
+// history is what the debugger needs to go backwards: snapshots taken
+// as frames start, and the input of every frame since the first snapshot.
+// Any earlier instruction is reached by restoring the snapshot before it
+// and running the frames again, which the emulator does exactly the same.
+type history struct {
+	// start is the frame of the first snapshot and input
+	start     int
+	inputs    []frameInput
+	snapshots []snapshot
+}
+
+// frameInput is what a frame was run with
+type frameInput struct {
+	cycles int
+	keys   emu.Keys
+}
+
+// snapshot is the emulator's state as a frame starts, or partway
+// through it if inFrame is set
+type snapshot struct {
+	frame   int
+	cycle   int
+	inFrame bool
+	state   *emu.State
+}
+
+func (s snapshot) position() position {
+	return position{s.frame, s.cycle}
+}
+
+// position is a point in the program's run, counted in frames
+// since it started, then instructions run in the frame
+type position struct {
+	frame int
+	cycle int
+}
+
+func (p position) before(q position) bool {
+	return p.frame < q.frame || p.frame == q.frame && p.cycle < q.cycle
+}
+
+// Edit calls f to change the emulator, such as setting a register.
+// Changes can't be replayed, so the history starts again from here.
+func (d *Debugger) Edit(f func(e *emu.Emulator)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f(d.e)
+	d.e.Memory().Changed()
+	d.history = history{}
+	if d.inFrame {
+		d.history = history{
+			start:     d.frame,
+			inputs:    []frameInput{d.input},
+			snapshots: []snapshot{{frame: d.frame, cycle: d.cycle, inFrame: true, state: d.e.Save()}},
+		}
+	}
+}
+
+// StepBack goes back one instruction, returning why it stopped
+func (d *Debugger) StepBack() (string, error) {
+	return d.reverse(false)
+}
+
+// ReverseContinue goes back to the last place a breakpoint would have
+// stopped the program, or to just before the last instruction that made
+// a watched access, or as far back as the history goes, returning why
+// it stopped. Hit counts and tracepoints are ignored.
+func (d *Debugger) ReverseContinue() (string, error) {
+	return d.reverse(true)
+}
+
+// record notes the input of the frame about to start, replacing any
+// frames after it that were run before going backwards
+func (d *Debugger) record(cycles int, keys emu.Keys) {
+	h := &d.history
+	if n := d.frame - h.start; len(h.snapshots) > 0 && n >= 0 && n <= len(h.inputs) {
+		h.inputs = h.inputs[:n]
+		for len(h.snapshots) > 0 && h.snapshots[len(h.snapshots)-1].frame > d.frame {
+			h.snapshots = h.snapshots[:len(h.snapshots)-1]
+		}
+	} else {
+		*h = history{start: d.frame}
+	}
+
+	if len(h.snapshots) == 0 || d.frame-h.snapshots[len(h.snapshots)-1].frame >= snapshotInterval {
+		h.snapshots = append(h.snapshots, snapshot{frame: d.frame, state: d.e.Save()})
+	}
+	d.input = frameInput{cycles: cycles, keys: keys}
+	h.inputs = append(h.inputs, d.input)
+
+	// forget the oldest snapshot's frames once there are too many
+	if len(h.inputs) > historyFrames && len(h.snapshots) > 1 {
+		next := h.snapshots[1].frame
+		h.inputs = h.inputs[next-h.start:]
+		h.snapshots = h.snapshots[1:]
+		h.start = next
+	}
+}
+
+// reverse finds the last position before the current one where the
+// program would stop, going by breakpoints and watchpoints if continuing,
+// or at any instruction if stepping, and goes there
+func (d *Debugger) reverse(continuing bool) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h := &d.history
+	now := position{d.frame, d.cycle}
+	if len(h.snapshots) == 0 || !h.snapshots[0].position().before(now) {
+		return "", ErrNoHistory
+	}
+
+	// search back a snapshot at a time, replaying from each one
+	// up to the next, for the last place to stop
+	var found position
+	var hit WatchHit
+	reason := ""
+	for i := len(h.snapshots) - 1; i >= 0 && reason == ""; i-- {
+		end := now
+		if i+1 < len(h.snapshots) {
+			if next := h.snapshots[i+1].position(); next.before(end) {
+				end = next
+			}
+		}
+		if !h.snapshots[i].position().before(end) {
+			continue
+		}
+
+		var last position
+		d.replay(i, end, func(p position) bool {
+			watched := d.hitPending
+			d.hitPending = false
+			defer func() {
+				last = p
+			}()
+			switch {
+			case continuing && watched:
+				// stop before the instruction that made the access
+				found, reason, hit = last, StopData, d.hit
+			case p == end || !d.instructionAt(p) || d.e.Input.WaitingForInput:
+			case !continuing:
+				found, reason = p, StopStep
+			case d.breaksAt():
+				found, reason = p, StopBreakpoint
+			}
+			return false
+		})
+	}
+	if reason == "" {
+		found, reason = h.snapshots[0].position(), StopStep
+	}
+
+	i := len(h.snapshots) - 1
+	for found.before(h.snapshots[i].position()) {
+		i--
+	}
+	d.replay(i, found, nil)
+	d.stopped = true
+	d.step = stepNone
+	if reason == StopData {
+		d.lastHit = hit
+	}
+
+	return reason, nil
+}
+
+// replay restores snapshot i and runs the recorded frames up to position
+// end, calling visit at each position on the way and at end: before each
+// instruction, and after the last instruction of each frame. It stops
+// early, leaving the emulator there, if visit returns true.
+func (d *Debugger) replay(i int, end position, visit func(p position) bool) {
+	h := &d.history
+	s := h.snapshots[i]
+	d.e.Restore(s.state)
+	d.hitPending = false
+	d.replaying = true
+	defer func() {
+		d.replaying = false
+	}()
+
+	d.cycle = s.cycle
+	for d.frame = s.frame; d.frame-h.start < len(h.inputs); d.frame++ {
+		d.input = h.inputs[d.frame-h.start]
+		// a snapshot partway through a frame carries on from there
+		if d.frame != s.frame || !s.inFrame {
+			d.e.StartFrame(d.input.cycles, d.input.keys)
+			d.cycle = 0
+		}
+		d.inFrame = true
+		for ; ; d.cycle++ {
+			p := position{d.frame, d.cycle}
+			if visit != nil && visit(p) || p == end {
+				return
+			}
+			if !d.e.StepFrame() {
+				break
+			}
+		}
+		d.e.EndFrame()
+		d.inFrame = false
+	}
+	d.cycle = 0
+}
+
+// instructionAt reports whether there is an instruction to run at a
+// position, rather than the end of a frame
+func (d *Debugger) instructionAt(p position) bool {
+	return p.cycle < d.history.inputs[p.frame-d.history.start].cycles
+}
+
+// breaksAt reports whether a breakpoint at the PC would stop the program,
+// going by conditions but not hit counts
+func (d *Debugger) breaksAt() bool {
+	for _, bp := range d.breakpoints[d.e.CPU().PC] {
+		if bp.Log == nil && (bp.Condition == nil || bp.Condition.True(d.e)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package debug
+
+import (
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// countStoreROM counts up in V0, storing it at 0x300 each time
+var countStoreROM = []byte{
+	0xA3, 0x00, // 0x200 LD I, 0x300
+	0x70, 0x01, // 0x202 ADD V0, 1
+	0xF0, 0x55, // 0x204 LD [I], V0
+	0x12, 0x02, // 0x206 JP 0x202
+}
+
+// runFrames runs the program freely for some frames, then pauses it
+// partway through a frame
+func runFrames(d *Debugger, frames int) {
+	d.Continue()
+	for i := 0; i < frames; i++ {
+		d.RunFrame(10, 0)
+	}
+	d.SetBreakpoints("pause", []Breakpoint{{Addr: 0x206}})
+	d.RunFrame(10, 0)
+	d.SetBreakpoints("pause", nil)
+}
+
+func TestDebuggerStepBack(t *testing.T) {
+	d := newDebuggerFor(countStoreROM)
+	if _, err := d.StepBack(); err != ErrNoHistory {
+		t.Errorf("Expected no history before running but was %v", err)
+	}
+
+	runFrames(d, 3)
+	pc, _, v := cpuState(d)
+	if pc != 0x206 {
+		t.Fatalf("Expected to pause at 0x206 but was at 0x%X", pc)
+	}
+
+	for _, want := range []uint16{0x204, 0x202, 0x206, 0x204} {
+		if reason, err := d.StepBack(); err != nil || reason != StopStep {
+			t.Fatalf("Expected to step back but was %q, %v", reason, err)
+		}
+		if pc, _, _ := cpuState(d); pc != want {
+			t.Errorf("Expected to step back to 0x%X but was at 0x%X", want, pc)
+		}
+	}
+	if _, _, back := cpuState(d); back[0] != v[0]-1 {
+		t.Errorf("Expected V0 to go back from %d to %d but was %d", v[0], v[0]-1, back[0])
+	}
+
+	// running forwards again does the same as before
+	for i := 0; i < 4; i++ {
+		d.StepIn()
+		runUntilStopped(t, d)
+	}
+	if pc2, _, v2 := cpuState(d); pc2 != pc || v2 != v {
+		t.Errorf("Expected to return to 0x%X with %v but was at 0x%X with %v", pc, v, pc2, v2)
+	}
+}
+
+func TestDebuggerReverseContinue(t *testing.T) {
+	d := newDebuggerFor(countStoreROM)
+	// long enough for several snapshots, and for V0 to wrap around
+	runFrames(d, 3*snapshotInterval)
+
+	// V0 counts to about 600, so it was 5 three times
+	condition, _ := ParseExpr("V0 == 5", nil)
+	d.SetBreakpoints("test", []Breakpoint{{Addr: 0x204, Condition: condition}})
+	var frames []int
+	for i := 0; i < 3; i++ {
+		if reason, err := d.ReverseContinue(); err != nil || reason != StopBreakpoint {
+			t.Fatalf("Expected to go back to the breakpoint but was %q, %v", reason, err)
+		}
+		if pc, _, v := cpuState(d); pc != 0x204 || v[0] != 5 {
+			t.Errorf("Expected to stop at 0x204 with V0 = 5 but was at 0x%X with %d", pc, v[0])
+		}
+		frames = append(frames, d.frame)
+	}
+	// the first time was in the second frame
+	if frames[0] <= frames[1] || frames[1] <= frames[2] || frames[2] != 1 {
+		t.Errorf("Expected each hit to be earlier, back to frame 1, but was %v", frames)
+	}
+
+	if reason, err := d.ReverseContinue(); err != nil || reason != StopStep {
+		t.Errorf("Expected to stop at the start of the history but was %q, %v", reason, err)
+	}
+	if pc, _, _ := cpuState(d); pc != 0x200 {
+		t.Errorf("Expected the start of the history at 0x200 but was 0x%X", pc)
+	}
+}
+
+func TestDebuggerReverseWatchpoint(t *testing.T) {
+	d := newDebuggerFor(countStoreROM)
+	runFrames(d, 5)
+	var stored byte
+	d.View(func(e *emu.Emulator) {
+		stored = e.Memory().RAM[0x300]
+	})
+
+	// who wrote this byte?
+	d.SetWatchpoints("test", []Watchpoint{{Addr: 0x300, Len: 1, Access: AccessWrite}})
+	if reason, err := d.ReverseContinue(); err != nil || reason != StopData {
+		t.Fatalf("Expected to go back to the write but was %q, %v", reason, err)
+	}
+	if hit := d.LastHit(); hit.PC != 0x204 || hit.Value != stored {
+		t.Errorf("Expected 0x204 to have written %d but was %+v", stored, hit)
+	}
+	if pc, _, v := cpuState(d); pc != 0x204 || v[0] != stored {
+		t.Errorf("Expected to stop at the write but was at 0x%X with V0 = %d", pc, v[0])
+	}
+
+	// changing the state starts the history again
+	d.Edit(func(e *emu.Emulator) {
+		e.CPU().V[0] = 0
+	})
+	if _, err := d.ReverseContinue(); err != ErrNoHistory {
+		t.Errorf("Expected editing to forget the history but was %v", err)
+	}
+	d.StepIn()
+	runUntilStopped(t, d)
+	if _, err := d.StepBack(); err != nil {
+		t.Fatal(err)
+	}
+	if pc, _, v := cpuState(d); pc != 0x204 || v[0] != 0 {
+		t.Errorf("Expected to step back to the edit at 0x204 with V0 = 0 but was at 0x%X with %d", pc, v[0])
+	}
+}
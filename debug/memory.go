@@ -0,0 +1,255 @@
+package debug
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// Region is a part of memory with its own purpose, as the memory viewer shows it
+type Region int
+
+const (
+	// RegionFont is the built-in font from emu.RamFontStart
+	RegionFont Region = iota
+	// RegionInterpreter is the rest of the memory below programs,
+	// which the original interpreter kept for itself
+	RegionInterpreter
+	// RegionProgram is from emu.RamProgramStart, where the ROM is loaded
+	RegionProgram
+)
+
+func (r Region) String() string {
+	switch r {
+	case RegionFont:
+		return "font"
+	case RegionInterpreter:
+		return "interpreter"
+	}
+
+	return "program"
+}
+
+// RegionOf returns the region an address is in
+func RegionOf(addr uint16) Region {
+	switch {
+	case addr >= uint16(emu.RamFontStart) && addr < uint16(emu.RamFontStart)+emu.RamFontSize:
+		return RegionFont
+	case addr < emu.RamProgramStart:
+		return RegionInterpreter
+	}
+
+	return RegionProgram
+}
+
+// hexDumpWidth is how many bytes a hex dump shows on each line
+const hexDumpWidth = 16
+
+// WriteHexDump writes memory that starts at addr as lines of
+// 16 bytes in hex then ASCII, such as
+//
+//	0x200  A3 00 60 05 F0 55 12 06  00 00 00 00 00 00 00 00  ..`..U..........
+func WriteHexDump(w io.Writer, mem []byte, addr uint16) error {
+	out := bufio.NewWriter(w)
+	for i := 0; i < len(mem); i += hexDumpWidth {
+		row := mem[i:]
+		if len(row) > hexDumpWidth {
+			row = row[:hexDumpWidth]
+		}
+
+		fmt.Fprintf(out, "%s ", hexAddr(addr+uint16(i)))
+		for j := 0; j < hexDumpWidth; j++ {
+			if j%8 == 0 {
+				out.WriteByte(' ')
+			}
+			if j < len(row) {
+				fmt.Fprintf(out, "%02X ", row[j])
+			} else {
+				out.WriteString("   ")
+			}
+		}
+		out.WriteByte(' ')
+		for _, b := range row {
+			out.WriteByte(Printable(b))
+		}
+		out.WriteByte('\n')
+	}
+
+	return out.Flush()
+}
+
+// Printable returns a byte as the ASCII column of a hex dump shows it,
+// with a dot for anything that isn't printable
+func Printable(b byte) byte {
+	if b < ' ' || b > '~' {
+		return '.'
+	}
+
+	return b
+}
+
+// Pattern is a sequence of bytes to search memory for,
+// where -1 matches any byte
+type Pattern []int
+
+// ParsePattern parses hex bytes such as "A3 00 60" or "A30060",
+// where ?? matches any byte
+func ParsePattern(s string) (Pattern, error) {
+	digits := strings.Join(strings.Fields(s), "")
+	if digits == "" || len(digits)%2 != 0 {
+		return nil, fmt.Errorf("invalid byte pattern %q: want pairs of hex digits", s)
+	}
+
+	p := make(Pattern, len(digits)/2)
+	for i := range p {
+		pair := digits[2*i : 2*i+2]
+		if pair == "??" {
+			p[i] = -1
+			continue
+		}
+		b, err := strconv.ParseUint(pair, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte pattern %q: bad byte %q", s, pair)
+		}
+		p[i] = int(b)
+	}
+
+	return p, nil
+}
+
+// Bytes returns the pattern as bytes, for writing to memory.
+// It fails if the pattern has wildcards.
+func (p Pattern) Bytes() ([]byte, error) {
+	b := make([]byte, len(p))
+	for i, v := range p {
+		if v < 0 {
+			return nil, errors.New("?? can only be used for searching")
+		}
+		b[i] = byte(v)
+	}
+
+	return b, nil
+}
+
+// Find returns the first address from start where the pattern matches,
+// wrapping around to the beginning of memory, or -1 if it doesn't match anywhere
+func (p Pattern) Find(mem []byte, start int) int {
+	for n := 0; n < len(mem); n++ {
+		addr := (start + n) % len(mem)
+		if p.matches(mem, addr) {
+			return addr
+		}
+	}
+
+	return -1
+}
+
+func (p Pattern) matches(mem []byte, addr int) bool {
+	if addr+len(p) > len(mem) {
+		return false
+	}
+	for i, v := range p {
+		if v >= 0 && mem[addr+i] != byte(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// TrackWrites starts or stops noting which frame each byte of memory was
+// last written in, for showing the bytes a program has just changed
+func (d *Debugger) TrackWrites(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case on && d.written == nil:
+		d.written = make([]int, emu.RamSize)
+	case !on:
+		d.written = nil
+	}
+	d.updateWatchpoints()
+}
+
+// Written fills ages with how many frames ago each byte from addr was last
+// written by the program, 0 for the current frame, or -1 for bytes that
+// haven't been written since TrackWrites started
+func (d *Debugger) Written(addr uint16, ages []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i := range ages {
+		ages[i] = -1
+		a := int(addr) + i
+		if d.written == nil || a >= len(d.written) || d.written[a] == 0 {
+			continue
+		}
+		// after going backwards, writes in the undone frames don't count
+		if age := d.frame - (d.written[a] - 1); age >= 0 {
+			ages[i] = age
+		}
+	}
+}
+
+// TrackSprites starts or stops noting the sprites that Dxyn draws
+func (d *Debugger) TrackSprites(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case on && d.sprites == nil:
+		d.sprites = make(map[uint16]int)
+	case !on:
+		d.sprites = nil
+	}
+	d.updateWatchpoints()
+}
+
+// Sprites returns the addresses of the sprites drawn since TrackSprites
+// started, and the most bytes drawn from each
+func (d *Debugger) Sprites() map[uint16]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sprites := make(map[uint16]int, len(d.sprites))
+	for addr, rows := range d.sprites {
+		sprites[addr] = rows
+	}
+
+	return sprites
+}
+
+// noteAccess records a write, a read for coverage or a sprite being drawn,
+// if they are tracked
+func (d *Debugger) noteAccess(a emu.MemoryAccess) {
+	if a.Write {
+		if d.written != nil {
+			d.written[a.Addr] = d.frame + 1
+		}
+		return
+	}
+
+	// replaying frames to go backwards runs them a second time
+	if d.coverage != nil && !d.replaying {
+		d.coverage.Read[a.Addr]++
+	}
+	// Dxyn reads its first row at I
+	if d.sprites != nil && a.Addr == d.e.CPU().I {
+		if op := d.e.Memory().Opcode(a.PC); op&0xF000 == 0xD000 {
+			n := int(op & 0xF)
+			// SCHIP's Dxy0 draws 16 rows of two bytes in hires
+			if n == 0 && d.e.Display.Hires {
+				n = 32
+			}
+			if n > d.sprites[a.Addr] {
+				d.sprites[a.Addr] = n
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package debug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteHexDump(t *testing.T) {
+	var b strings.Builder
+	mem := append([]byte("Hi!\x00"), make([]byte, 16)...)
+	if err := WriteHexDump(&b, mem, 0x300); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "0x300  48 69 21 00 00 00 00 00  00 00 00 00 00 00 00 00  Hi!.............\n" +
+		"0x310  00 00 00 00                                       ....\n"
+	if b.String() != want {
+		t.Errorf("Expected\n%s\nbut was\n%s", want, b.String())
+	}
+}
+
+func TestRegionOf(t *testing.T) {
+	for addr, want := range map[uint16]Region{
+		0x000: RegionFont,
+		0x04F: RegionFont,
+		0x050: RegionInterpreter,
+		0x1FF: RegionInterpreter,
+		0x200: RegionProgram,
+		0xFFF: RegionProgram,
+	} {
+		if r := RegionOf(addr); r != want {
+			t.Errorf("0x%03X: expected region %d but was %d", addr, want, r)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	mem := []byte{0xA3, 0x00, 0x60, 0x05, 0xA3, 0x10, 0x60, 0x07}
+
+	for _, test := range []struct {
+		pattern string
+		start   int
+		want    int
+	}{
+		{"A3 ?? 60", 0, 0},
+		{"a3??60", 1, 4},
+		{"A3 ?? 60", 5, 0},
+		{"6007", 0, 6},
+		{"07 A3", 0, -1},
+	} {
+		p, err := ParsePattern(test.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", test.pattern, err)
+			continue
+		}
+		if addr := p.Find(mem, test.start); addr != test.want {
+			t.Errorf("%s from %d: expected %d but was %d", test.pattern, test.start, test.want, addr)
+		}
+	}
+
+	for _, s := range []string{"", "A", "A3 G0", "A3 ?0"} {
+		if _, err := ParsePattern(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+	if p, _ := ParsePattern("00 ??"); p != nil {
+		if _, err := p.Bytes(); err == nil {
+			t.Errorf("Expected a wildcard not to make bytes")
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	addr, length, err := ParseRange("0x300-0x33F")
+	if err != nil || addr != 0x300 || length != 0x40 {
+		t.Errorf("Expected 0x300 for 0x40 bytes but was 0x%X for 0x%X, %v", addr, length, err)
+	}
+	if _, _, err := ParseRange("0x300-0x2FF"); err == nil {
+		t.Errorf("Expected an error for a backwards range")
+	}
+}
+
+func TestDebuggerTrackWrites(t *testing.T) {
+	d := newDebuggerFor(countStoreROM)
+	d.TrackWrites(true)
+	d.Continue()
+	for i := 0; i < 3; i++ {
+		d.RunFrame(10, 0)
+	}
+
+	ages := make([]int, 2)
+	d.Written(0x300, ages)
+	if ages[0] != 1 || ages[1] != -1 {
+		t.Errorf("Expected 0x300 to be written last frame and 0x301 never but was %v", ages)
+	}
+
+	d.TrackWrites(false)
+	d.Written(0x300, ages)
+	if ages[0] != -1 {
+		t.Errorf("Expected nothing tracked once stopped but was %v", ages)
+	}
+}
+
+func TestDebuggerTrackSprites(t *testing.T) {
+	d := newDebuggerFor([]byte{
+		0xA2, 0x08, // 0x200 LD I, 0x208
+		0xD0, 0x03, // 0x202 DRW V0, V0, 3
+		0xF0, 0x65, // 0x204 LD V0, [I]
+		0x12, 0x06, // 0x206 JP 0x206
+		0xFF, 0x81, 0xFF,
+	})
+	d.TrackSprites(true)
+	d.Continue()
+	d.RunFrame(10, 0)
+
+	sprites := d.Sprites()
+	if len(sprites) != 1 || sprites[0x208] != 3 {
+		t.Errorf("Expected a 3 row sprite at 0x208 and not the Fx65 read but was %v", sprites)
+	}
+}
+
+func TestDebuggerTrackHiresSprites(t *testing.T) {
+	d := newDebuggerFor([]byte{
+		0xA2, 0x0C, // 0x200 LD I, 0x20C
+		0xD0, 0x00, // 0x202 DRW V0, V0, 0 in lores
+		0x00, 0xFF, // 0x204 HIGH
+		0xA2, 0x2C, // 0x206 LD I, 0x22C
+		0xD0, 0x00, // 0x208 DRW V0, V0, 0 in hires
+		0x12, 0x0A, // 0x20A JP 0x20A
+	})
+	d.TrackSprites(true)
+	d.Continue()
+	d.RunFrame(10, 0)
+
+	sprites := d.Sprites()
+	if len(sprites) != 1 || sprites[0x22C] != 32 {
+		t.Errorf("Expected a 32 byte sprite at 0x22C and nothing drawn in lores but was %v", sprites)
+	}
+}
@@ -0,0 +1,448 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// monitorHelp lists the monitor commands
+const monitorHelp = `break ADDR [hits N] [if COND]   stop at an address or label
+trace ADDR "MSG" [hits N] [if COND]   log a message such as "score={V5} at {PC}"
+delete [N...]                   delete breakpoints, or all of them
+info                            list breakpoints
+print EXPR                      evaluate an expression, such as [I] + V0
+regs                            show the registers
+x RANGE                         show memory such as 0x300-0x33F in hex and ASCII
+find PATTERN                    find bytes such as A3 ?? 60, after the last match
+set ADDR BYTES                  write bytes such as 00 FF to memory
+save RANGE FILE                 save memory to a file
+load ADDR FILE                  load a file into memory
+continue, step, next, finish, pause
+back, rcontinue                 step or continue backwards
+help                            show this list
+
+Hit counts are N or >=N to stop from the Nth hit, ==N, >N or %N.`
+
+// monitorControls are the commands that run and stop the program
+var monitorControls = map[string]bool{
+	"continue": true, "c": true,
+	"step": true, "s": true,
+	"next": true, "n": true,
+	"finish":    true,
+	"pause":     true,
+	"back":      true,
+	"rcontinue": true, "rc": true,
+}
+
+// Monitor runs debugging commands typed as text, such as
+// break 0x206 if V3 == 0x10, for the command-line monitor, GDB's
+// monitor command and an editor's debug console. Anything that isn't
+// a command is evaluated as an expression.
+type Monitor struct {
+	d     *Debugger
+	group string
+	// Control allows the commands that run and stop the program,
+	// which clients with run control of their own leave off
+	Control bool
+
+	breakpoints map[int]Breakpoint
+	next        int
+	// found is where find last matched, so the next find carries on after it
+	found int
+}
+
+// NewMonitor makes a monitor whose breakpoints are a group in the debugger
+func NewMonitor(d *Debugger, group string) *Monitor {
+	return &Monitor{
+		d:           d,
+		group:       group,
+		breakpoints: make(map[int]Breakpoint),
+		next:        1,
+		found:       -1,
+	}
+}
+
+// Exec runs a command, returning its output
+func (m *Monitor) Exec(line string) (string, error) {
+	line = strings.TrimSpace(line)
+	name, args := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, args = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	if monitorControls[name] {
+		if !m.Control {
+			return "", fmt.Errorf("%s is not available here", name)
+		}
+		switch name {
+		case "continue", "c":
+			m.d.Continue()
+		case "step", "s":
+			m.d.StepIn()
+		case "next", "n":
+			m.d.StepOver()
+		case "finish":
+			m.d.StepOut()
+		case "pause":
+			m.d.Pause()
+		case "back":
+			return m.reverse(m.d.StepBack())
+		case "rcontinue", "rc":
+			return m.reverse(m.d.ReverseContinue())
+		}
+		return "", nil
+	}
+
+	switch name {
+	case "":
+		return "", nil
+	case "help", "?":
+		return monitorHelp, nil
+	case "break", "b":
+		return m.setBreakpoint(args, false)
+	case "trace", "t":
+		return m.setBreakpoint(args, true)
+	case "delete", "d":
+		return "", m.delete(args)
+	case "info":
+		return m.info(), nil
+	case "regs":
+		return m.regs(), nil
+	case "print", "p":
+		return m.print(args)
+	case "x":
+		return m.examine(args)
+	case "find":
+		return m.find(args)
+	case "set":
+		return m.set(args)
+	case "save":
+		return m.save(args)
+	case "load":
+		return m.load(args)
+	}
+
+	return m.print(line)
+}
+
+// reverse reports where going backwards stopped
+func (m *Monitor) reverse(reason string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	var pc uint16
+	m.d.View(func(e *emu.Emulator) {
+		pc = e.CPU().PC
+	})
+
+	return fmt.Sprintf("stopped at %s (%s)", hexAddr(pc), reason), nil
+}
+
+// setBreakpoint parses ADDR ["MSG"] [hits N] [if COND]
+func (m *Monitor) setBreakpoint(args string, trace bool) (string, error) {
+	addrArg, rest := args, ""
+	if i := strings.IndexAny(args, " \t"); i >= 0 {
+		addrArg, rest = args[:i], strings.TrimSpace(args[i+1:])
+	}
+	if addrArg == "" {
+		return "", errors.New("missing address")
+	}
+	addr, err := m.d.Symbols.Resolve(addrArg)
+	if err != nil {
+		return "", err
+	}
+	bp := Breakpoint{Addr: addr}
+
+	if trace {
+		if !strings.HasPrefix(rest, `"`) {
+			return "", errors.New(`missing "message"`)
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return "", errors.New(`missing closing " on message`)
+		}
+		if bp.Log, err = ParseMessage(rest[1:end+1], m.d.Symbols); err != nil {
+			return "", err
+		}
+		rest = strings.TrimSpace(rest[end+2:])
+	}
+
+	if rest != "" && keyword(rest, "hits") {
+		count := strings.TrimSpace(rest[len("hits"):])
+		if i := strings.IndexAny(count, " \t"); i >= 0 {
+			count, rest = count[:i], strings.TrimSpace(count[i+1:])
+		} else {
+			rest = ""
+		}
+		if bp.Hits, err = ParseHitCondition(count); err != nil {
+			return "", err
+		}
+	}
+	if rest != "" {
+		if !keyword(rest, "if") {
+			return "", fmt.Errorf("unexpected %q", rest)
+		}
+		if bp.Condition, err = ParseExpr(rest[len("if"):], m.d.Symbols); err != nil {
+			return "", err
+		}
+	}
+
+	n := m.next
+	m.next++
+	m.breakpoints[n] = bp
+	m.update()
+
+	kind := "breakpoint"
+	if trace {
+		kind = "tracepoint"
+	}
+
+	return fmt.Sprintf("%s %d at %s", kind, n, hexAddr(addr)), nil
+}
+
+// keyword reports whether s starts with a word
+func keyword(s, word string) bool {
+	return strings.HasPrefix(s, word) && (len(s) == len(word) || s[len(word)] == ' ' || s[len(word)] == '\t')
+}
+
+func (m *Monitor) delete(args string) error {
+	if args == "" {
+		m.breakpoints = make(map[int]Breakpoint)
+		m.update()
+		return nil
+	}
+
+	for _, arg := range strings.Fields(args) {
+		n, err := strconv.Atoi(arg)
+		if _, ok := m.breakpoints[n]; err != nil || !ok {
+			return fmt.Errorf("no breakpoint %s", arg)
+		}
+		delete(m.breakpoints, n)
+	}
+	m.update()
+
+	return nil
+}
+
+func (m *Monitor) update() {
+	var breakpoints []Breakpoint
+	for _, n := range m.numbers() {
+		breakpoints = append(breakpoints, m.breakpoints[n])
+	}
+	m.d.SetBreakpoints(m.group, breakpoints)
+}
+
+func (m *Monitor) numbers() []int {
+	numbers := make([]int, 0, len(m.breakpoints))
+	for n := range m.breakpoints {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	return numbers
+}
+
+func (m *Monitor) info() string {
+	if len(m.breakpoints) == 0 {
+		return "no breakpoints"
+	}
+
+	lines := make([]string, 0, len(m.breakpoints))
+	for _, n := range m.numbers() {
+		bp := m.breakpoints[n]
+		line := fmt.Sprintf("%d  %s", n, hexAddr(bp.Addr))
+		if bp.Log != nil {
+			line += fmt.Sprintf(" %q", bp.Log)
+		}
+		if bp.Hits.Op != "" {
+			line += " hits " + bp.Hits.String()
+		}
+		if bp.Condition != nil {
+			line += " if " + bp.Condition.String()
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (m *Monitor) regs() string {
+	var b strings.Builder
+	m.d.View(func(e *emu.Emulator) {
+		cpu := e.CPU()
+		for i, v := range cpu.V {
+			sep := " "
+			if i%8 == 7 {
+				sep = "\n"
+			}
+			fmt.Fprintf(&b, "V%X=%02X%s", i, v, sep)
+		}
+		fmt.Fprintf(&b, "I=%s PC=%s SP=%X DT=%d ST=%d", hexAddr(cpu.I), hexAddr(cpu.PC), cpu.SP, cpu.DelayTimer, cpu.SoundTimer)
+	})
+
+	return b.String()
+}
+
+func (m *Monitor) print(args string) (string, error) {
+	x, err := ParseExpr(args, m.d.Symbols)
+	if err != nil {
+		return "", err
+	}
+
+	var out string
+	m.d.View(func(e *emu.Emulator) {
+		out = x.Format(e)
+		if v := x.Eval(e); !x.addr && v > 9 {
+			out += fmt.Sprintf(" (0x%X)", v)
+		}
+	})
+
+	return out, nil
+}
+
+// examineLength is how much memory x shows for a single address
+const examineLength = 0x40
+
+// memoryRange parses a range of memory, or a single address or label,
+// which is length bytes long
+func (m *Monitor) memoryRange(s string, length uint16) (uint16, uint16, error) {
+	if strings.IndexByte(s, '-') < 0 {
+		addr, err := m.d.Symbols.Resolve(s)
+		if err != nil {
+			return 0, 0, err
+		}
+		if length > emu.RamSize-addr {
+			length = emu.RamSize - addr
+		}
+		return addr, length, nil
+	}
+
+	return ParseRange(s)
+}
+
+func (m *Monitor) examine(args string) (string, error) {
+	if args == "" {
+		return "", errors.New("missing address")
+	}
+	addr, length, err := m.memoryRange(args, examineLength)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	m.d.View(func(e *emu.Emulator) {
+		err = WriteHexDump(&b, e.Memory().RAM[addr:addr+length], addr)
+	})
+
+	return strings.TrimSuffix(b.String(), "\n"), err
+}
+
+func (m *Monitor) find(args string) (string, error) {
+	p, err := ParsePattern(args)
+	if err != nil {
+		return "", err
+	}
+
+	found := -1
+	m.d.View(func(e *emu.Emulator) {
+		found = p.Find(e.Memory().RAM[:], m.found+1)
+	})
+	if found < 0 {
+		return "", fmt.Errorf("%s not found", strings.TrimSpace(args))
+	}
+	m.found = found
+
+	return "found at " + hexAddr(uint16(found)), nil
+}
+
+// split separates the first argument from the rest
+func split(args string) (string, string) {
+	if i := strings.IndexAny(args, " \t"); i >= 0 {
+		return args[:i], strings.TrimSpace(args[i+1:])
+	}
+
+	return args, ""
+}
+
+func (m *Monitor) set(args string) (string, error) {
+	addrArg, rest := split(args)
+	if rest == "" {
+		return "", errors.New("usage: set ADDR BYTES")
+	}
+	addr, err := m.d.Symbols.Resolve(addrArg)
+	if err != nil {
+		return "", err
+	}
+	p, err := ParsePattern(rest)
+	if err != nil {
+		return "", err
+	}
+	b, err := p.Bytes()
+	if err != nil {
+		return "", err
+	}
+
+	return "", m.write(addr, b)
+}
+
+// write copies bytes into memory, as long as they fit
+func (m *Monitor) write(addr uint16, b []byte) error {
+	if int(addr)+len(b) > emu.RamSize {
+		return fmt.Errorf("%d bytes don't fit in memory at %s", len(b), hexAddr(addr))
+	}
+	m.d.Edit(func(e *emu.Emulator) {
+		copy(e.Memory().RAM[addr:], b)
+	})
+
+	return nil
+}
+
+func (m *Monitor) save(args string) (string, error) {
+	rangeArg, filename := split(args)
+	if filename == "" {
+		return "", errors.New("usage: save RANGE FILE")
+	}
+	addr, length, err := m.memoryRange(rangeArg, 1)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, length)
+	m.d.View(func(e *emu.Emulator) {
+		copy(b, e.Memory().RAM[addr:])
+	})
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("saved %s to %s", formatRange(addr, length), filename), nil
+}
+
+func (m *Monitor) load(args string) (string, error) {
+	addrArg, filename := split(args)
+	if filename == "" {
+		return "", errors.New("usage: load ADDR FILE")
+	}
+	addr, err := m.d.Symbols.Resolve(addrArg)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", fmt.Errorf("%s is empty", filename)
+	}
+	if err := m.write(addr, b); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("loaded %s from %s", formatRange(addr, uint16(len(b))), filename), nil
+}
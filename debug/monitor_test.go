@@ -0,0 +1,100 @@
+package debug
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMonitor(t *testing.T) {
+	d := newDebuggerFor(countROM)
+	m := NewMonitor(d, "monitor")
+	m.Control = true
+	var logs []string
+	d.OnLog(func(msg string) {
+		logs = append(logs, msg)
+	})
+
+	for _, test := range []struct {
+		command string
+		want    string
+	}{
+		{"break 0x204 if V0 == 4", "breakpoint 1 at 0x204"},
+		{`trace 202 "v0={V0}" hits ==2`, "tracepoint 2 at 0x202"},
+		{"info", "1  0x204 if V0 == 4\n2  0x202 \"v0={V0}\" hits ==2"},
+		{"continue", ""},
+	} {
+		out, err := m.Exec(test.command)
+		if err != nil {
+			t.Fatalf("%s: %v", test.command, err)
+		}
+		if out != test.want {
+			t.Errorf("%s: expected %q but was %q", test.command, test.want, out)
+		}
+	}
+
+	if reason := runUntilStopped(t, d); reason != StopBreakpoint {
+		t.Errorf("Expected to stop at the breakpoint but was %q", reason)
+	}
+	if len(logs) != 1 || logs[0] != "v0=1" {
+		t.Errorf("Expected the second pass to be traced but was %q", logs)
+	}
+	for command, want := range map[string]string{"print V0 * 4": "16 (0x10)", "V0": "4", "PC": "0x204"} {
+		if out, err := m.Exec(command); err != nil || out != want {
+			t.Errorf("%s: expected %q but was %q, %v", command, want, out, err)
+		}
+	}
+
+	if _, err := m.Exec("delete 1 2"); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := m.Exec("info"); out != "no breakpoints" {
+		t.Errorf("Expected no breakpoints but was %q", out)
+	}
+
+	for _, command := range []string{"break", "break nowhere", "break 0x204 when V0", `trace 0x204 "{V0"`, "delete 7", "print V0 +"} {
+		if _, err := m.Exec(command); err == nil {
+			t.Errorf("%s: expected an error", command)
+		}
+	}
+}
+
+func TestMonitorMemory(t *testing.T) {
+	d := newDebuggerFor(storeROM)
+	m := NewMonitor(d, "monitor")
+	dir, err := ioutil.TempDir("", "chip8go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "mem.bin")
+
+	for _, test := range []struct {
+		command string
+		want    string
+	}{
+		{"x 0x200-0x207", "0x200  A3 00 60 05 F0 55 12 06                           ..`..U.."},
+		{"find 60 ??", "found at 0x006"},
+		{"find 60 05", "found at 0x202"},
+		{"find 12 06", "found at 0x206"},
+		{"set 0x300 48 69", ""},
+		{"save 0x300-0x301 " + file, "saved 0x300-0x301 to " + file},
+		{"load 0x310 " + file, "loaded 0x310-0x311 from " + file},
+		{"[0x311]", "105 (0x69)"},
+	} {
+		out, err := m.Exec(test.command)
+		if err != nil {
+			t.Fatalf("%s: %v", test.command, err)
+		}
+		if out != test.want {
+			t.Errorf("%s: expected %q but was %q", test.command, test.want, out)
+		}
+	}
+
+	for _, command := range []string{"x", "find 99 99 99", "set 0xFFF 00 00", "set 0x300 ??", "save 0x300", "load 0x300 " + file + ".missing"} {
+		if _, err := m.Exec(command); err == nil {
+			t.Errorf("%s: expected an error", command)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package debug
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format
+// that go tool pprof reads, so its viewers can browse a CHIP-8 program.
+// Each subroutine is a function named after its address, and each
+// instruction a line numbered with its address, in a file named after
+// the ROM. Samples are labelled with their state: running, key wait
+// or timer poll.
+func (p *Profile) WritePprof(w io.Writer, mem *emu.Memory, romName string) error {
+	b := &pprofBuilder{
+		strings:   map[string]int64{"": 0},
+		stringTab: []string{""},
+		functions: make(map[uint16]uint64),
+		locations: make(map[[2]uint16]uint64),
+	}
+
+	var profile protoBuffer
+	var valueType protoBuffer
+	valueType.int(1, b.string("cycles"))
+	valueType.int(2, b.string("count"))
+	profile.message(1, valueType)
+	profile.message(11, valueType)
+	profile.int(12, 1)
+
+	// samples are sorted so that the same run always writes the same file
+	keys := make([]stackKey, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		for k := 0; k < a.depth && k < b.depth; k++ {
+			if a.pcs[k] != b.pcs[k] {
+				return a.pcs[k] < b.pcs[k]
+			}
+		}
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+		return a.state < b.state
+	})
+	for _, key := range keys {
+		var ids []uint64
+		for i := 0; i < key.depth; i++ {
+			// the subroutine is the target of the call that the next frame out made
+			function := uint16(emu.RamProgramStart)
+			if i+1 < key.depth {
+				function = mem.Opcode(key.pcs[i+1]) & 0xFFF
+			}
+			ids = append(ids, b.location(key.pcs[i], function))
+		}
+
+		var sample, label protoBuffer
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{uint64(p.samples[key])})
+		label.int(1, b.string("state"))
+		label.int(2, b.string(stateNames[key.state]))
+		sample.message(3, label)
+		profile.message(2, sample)
+	}
+
+	var m protoBuffer
+	m.int(1, 1)
+	m.int(3, emu.RamSize)
+	m.int(5, b.string(romName))
+	// the mapping has functions, filenames and line numbers
+	m.int(7, 1)
+	m.int(8, 1)
+	m.int(9, 1)
+	profile.message(3, m)
+
+	for _, loc := range b.locationList {
+		profile.message(4, loc)
+	}
+	// functions are numbered in the order they were first seen
+	addrs := make([]uint16, 0, len(b.functions))
+	for addr := range b.functions {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return b.functions[addrs[i]] < b.functions[addrs[j]]
+	})
+	for _, addr := range addrs {
+		var f protoBuffer
+		name := b.string(functionName(addr))
+		f.int(1, int64(b.functions[addr]))
+		f.int(2, name)
+		f.int(3, name)
+		f.int(4, b.string(romName))
+		f.int(5, int64(addr))
+		profile.message(5, f)
+	}
+	for _, s := range b.stringTab {
+		profile.bytes(6, []byte(s))
+	}
+	profile.int(10, int64(len(p.Draws))*1e9/emu.FrameRate)
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// functionName names a subroutine after its address
+func functionName(addr uint16) string {
+	if addr == emu.RamProgramStart {
+		return "main"
+	}
+
+	return fmt.Sprintf("sub_%03X", addr)
+}
+
+// pprofBuilder numbers the strings, functions and locations of a profile
+type pprofBuilder struct {
+	strings      map[string]int64
+	stringTab    []string
+	functions    map[uint16]uint64
+	locations    map[[2]uint16]uint64
+	locationList []protoBuffer
+}
+
+func (b *pprofBuilder) string(s string) int64 {
+	i, ok := b.strings[s]
+	if !ok {
+		i = int64(len(b.stringTab))
+		b.strings[s] = i
+		b.stringTab = append(b.stringTab, s)
+	}
+
+	return i
+}
+
+// location returns the ID of an instruction's location in a subroutine
+func (b *pprofBuilder) location(pc, function uint16) uint64 {
+	if id, ok := b.locations[[2]uint16{pc, function}]; ok {
+		return id
+	}
+
+	fid, ok := b.functions[function]
+	if !ok {
+		fid = uint64(len(b.functions) + 1)
+		b.functions[function] = fid
+	}
+	id := uint64(len(b.locationList) + 1)
+	b.locations[[2]uint16{pc, function}] = id
+
+	var loc, line protoBuffer
+	loc.int(1, int64(id))
+	loc.int(2, 1)
+	loc.int(3, int64(pc))
+	line.int(1, int64(fid))
+	line.int(2, int64(pc))
+	loc.message(4, line)
+	b.locationList = append(b.locationList, loc)
+
+	return id
+}
+
+// protoBuffer encodes the few protocol buffer field types a profile needs
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+// int writes a varint field, leaving it out if it is zero as proto3 does
+func (b *protoBuffer) int(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(uint64(v))
+}
+
+// bytes writes a length-delimited field, such as a string
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *protoBuffer) message(field int, m protoBuffer) {
+	b.bytes(field, m)
+}
+
+// packed writes a repeated varint field
+func (b *protoBuffer) packed(field int, vs []uint64) {
+	var p protoBuffer
+	for _, v := range vs {
+		p.varint(v)
+	}
+	b.bytes(field, p)
+}
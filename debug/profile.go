@@ -0,0 +1,261 @@
+package debug
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// maxTimerPollLoop is how many instructions after an Fx07 a jump back to it
+// can be for the loop to count as waiting for the delay timer
+const maxTimerPollLoop = 4
+
+// Profile counts what a program spends its cycles on as it runs:
+// the instructions run at each address and of each kind, the cycles spent
+// waiting for a key in Fx0A or polling the delay timer, the sprites drawn
+// each frame and the calls to each subroutine.
+type Profile struct {
+	// Instructions counts the instructions run at each address
+	Instructions [emu.RamSize]int64
+	// Classes counts the instructions run by OpcodeClass, such as Dxyn
+	Classes map[string]int64
+	// KeyWait is the cycles spent waiting for a key in Fx0A
+	KeyWait int64
+	// TimerPoll is the instructions run in loops that read the delay timer
+	// until it runs out, such as Fx07 then 3x00 then a jump back
+	TimerPoll int64
+	// Draws is the number of sprites drawn in each frame
+	Draws []int
+	// Calls counts the calls to each subroutine
+	Calls map[uint16]int64
+
+	samples map[stackKey]int64
+	// polls holds the addresses of the timer polling loops found so far
+	polls map[uint16]bool
+	draws int
+}
+
+// sampleState is what a sample's cycle was spent on
+type sampleState int
+
+const (
+	stateRunning sampleState = iota
+	stateKeyWait
+	stateTimerPoll
+)
+
+var stateNames = [...]string{"running", "key wait", "timer poll"}
+
+// stackKey is the call stack a cycle was spent in, the address of the
+// instruction then the calls it is inside, innermost first
+type stackKey struct {
+	pcs   [len(emu.CPU{}.Stack) + 1]uint16
+	depth int
+	state sampleState
+}
+
+// NewProfile starts an empty profile
+func NewProfile() *Profile {
+	return &Profile{
+		Classes: make(map[string]int64),
+		Calls:   make(map[uint16]int64),
+		samples: make(map[stackKey]int64),
+		polls:   make(map[uint16]bool),
+	}
+}
+
+// RunFrame runs a frame of the emulator like Emulator.RunFrame,
+// counting each instruction
+func (p *Profile) RunFrame(e *emu.Emulator, cycles int, keys emu.Keys) {
+	p.draws = 0
+	e.StartFrame(cycles, keys)
+	for {
+		cpu := e.CPU()
+		pc, waiting := cpu.PC, e.Input.WaitingForInput
+		key := p.stack(e)
+		if !e.StepFrame() {
+			break
+		}
+
+		if !ranInstruction(e, pc, waiting) {
+			key.pcs[0] = pc - 2
+			key.state = stateKeyWait
+			p.KeyWait++
+			p.samples[key]++
+			continue
+		}
+		if p.note(e.Memory(), pc) {
+			key.state = stateTimerPoll
+		}
+		p.samples[key]++
+	}
+	e.EndFrame()
+	p.Draws = append(p.Draws, p.draws)
+}
+
+// ranInstruction reports whether a step of the emulator from pc ran an
+// instruction. A cycle waiting for a key leaves the PC after the Fx0A,
+// while a key coming in runs the next instruction.
+func ranInstruction(e *emu.Emulator, pc uint16, waiting bool) bool {
+	return !waiting || !e.Input.WaitingForInput || e.CPU().PC != pc
+}
+
+// stack makes the key for a cycle at the current PC
+func (p *Profile) stack(e *emu.Emulator) stackKey {
+	cpu := e.CPU()
+	key := stackKey{depth: 1}
+	key.pcs[0] = cpu.PC
+	for i := int(cpu.SP); i > 0 && key.depth < len(key.pcs); i-- {
+		key.pcs[key.depth] = cpu.Stack[i] - 2
+		key.depth++
+	}
+
+	return key
+}
+
+// note counts the instruction at an address, returning whether
+// it is part of a timer polling loop
+func (p *Profile) note(mem *emu.Memory, pc uint16) bool {
+	instruction := mem.Opcode(pc)
+	class := emu.OpcodeClass(instruction)
+	p.Instructions[pc%emu.RamSize]++
+	p.Classes[class]++
+	switch class {
+	case "Dxyn":
+		p.draws++
+	case "2nnn":
+		p.Calls[instruction&0xFFF]++
+	case "Fx07":
+		p.findTimerPoll(mem, pc)
+	}
+
+	if p.polls[pc] {
+		p.TimerPoll++
+		return true
+	}
+
+	return false
+}
+
+// findTimerPoll looks for a loop that jumps back to an Fx07
+// within a few instructions, marking its addresses as polling
+func (p *Profile) findTimerPoll(mem *emu.Memory, pc uint16) {
+	for i := uint16(1); i <= maxTimerPollLoop; i++ {
+		addr := pc + 2*i
+		if int(addr)+1 >= emu.RamSize {
+			return
+		}
+		if mem.Opcode(addr) == 0x1000|pc {
+			for a := pc; a <= addr; a += 2 {
+				p.polls[a] = true
+			}
+			return
+		}
+	}
+}
+
+// Cycles is the number of cycles profiled, running instructions or waiting
+func (p *Profile) Cycles() int64 {
+	var n int64
+	for _, count := range p.Instructions {
+		n += count
+	}
+
+	return n + p.KeyWait
+}
+
+// profileCount is an address or opcode class and how often it came up
+type profileCount struct {
+	name  string
+	addr  uint16
+	count int64
+}
+
+// sortCounts orders counts from the most to the least,
+// then by address and name
+func sortCounts(counts []profileCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		if a.addr != b.addr {
+			return a.addr < b.addr
+		}
+		return a.name < b.name
+	})
+}
+
+// WriteReport writes the profile as text: a summary, then the top
+// addresses by instructions run with their disassembly, the opcode classes,
+// the subroutines by calls and the sprite draws per frame
+func (p *Profile) WriteReport(w io.Writer, mem *emu.Memory, top int) error {
+	cycles := p.Cycles()
+	instructions := cycles - p.KeyWait
+	percent := func(n int64) float64 {
+		if cycles == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(cycles)
+	}
+
+	fmt.Fprintf(w, "%d frames, %d cycles\n", len(p.Draws), cycles)
+	fmt.Fprintf(w, "  %-14s %10d  %5.1f%%\n", "instructions", instructions, percent(instructions))
+	fmt.Fprintf(w, "  %-14s %10d  %5.1f%%\n", "key wait", p.KeyWait, percent(p.KeyWait))
+	fmt.Fprintf(w, "  %-14s %10d  %5.1f%%\n", "timer poll", p.TimerPoll, percent(p.TimerPoll))
+
+	var addrs []profileCount
+	for addr, count := range p.Instructions {
+		if count > 0 {
+			addrs = append(addrs, profileCount{addr: uint16(addr), count: count})
+		}
+	}
+	sortCounts(addrs)
+	if len(addrs) > top {
+		addrs = addrs[:top]
+	}
+	fmt.Fprintf(w, "\nhot addresses\n")
+	for _, c := range addrs {
+		fmt.Fprintf(w, "  0x%03X %10d  %5.1f%%  %s\n", c.addr, c.count, percent(c.count), emu.Disassemble(mem.Opcode(c.addr)))
+	}
+
+	var classes []profileCount
+	for class, count := range p.Classes {
+		classes = append(classes, profileCount{name: class, count: count})
+	}
+	sortCounts(classes)
+	fmt.Fprintf(w, "\nopcode classes\n")
+	for _, c := range classes {
+		fmt.Fprintf(w, "  %-5s %10d  %5.1f%%\n", c.name, c.count, percent(c.count))
+	}
+
+	var calls []profileCount
+	for addr, count := range p.Calls {
+		calls = append(calls, profileCount{addr: addr, count: count})
+	}
+	sortCounts(calls)
+	fmt.Fprintf(w, "\nsubroutine calls\n")
+	for _, c := range calls {
+		fmt.Fprintf(w, "  0x%03X %10d\n", c.addr, c.count)
+	}
+
+	min, max, total := 0, 0, 0
+	for i, n := range p.Draws {
+		if i == 0 || n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+		total += n
+	}
+	mean := 0.0
+	if len(p.Draws) > 0 {
+		mean = float64(total) / float64(len(p.Draws))
+	}
+	_, err := fmt.Fprintf(w, "\nsprite draws per frame\n  min %d, mean %.1f, max %d, total %d\n", min, mean, max, total)
+
+	return err
+}
@@ -0,0 +1,97 @@
+package debug
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// profileROM calls a subroutine that waits for the delay timer
+// and draws a sprite, then waits for a key that never comes
+var profileROM = []byte{
+	0x22, 0x06, // 200 CALL 0x206
+	0xF0, 0x0A, // 202 LD V0, K
+	0x12, 0x04, // 204 JP 0x204
+	0x60, 0x03, // 206 LD V0, 0x03
+	0xF0, 0x15, // 208 LD DT, V0
+	0xF0, 0x07, // 20A LD V0, DT
+	0x30, 0x00, // 20C SE V0, 0x00
+	0x12, 0x0A, // 20E JP 0x20A
+	0xD0, 0x01, // 210 DRW V0, V0, 1
+	0x00, 0xEE, // 212 RET
+}
+
+func runProfile(t *testing.T) (*Profile, *emu.Emulator) {
+	e := &emu.Emulator{Seed: 1}
+	e.SetupROM(profileROM)
+	p := NewProfile()
+	for i := 0; i < 6; i++ {
+		p.RunFrame(e, 10, 0)
+	}
+
+	return p, e
+}
+
+func TestProfile(t *testing.T) {
+	p, _ := runProfile(t)
+
+	if n := p.Cycles(); n != 60 {
+		t.Errorf("Expected 60 cycles but was %d", n)
+	}
+	if p.Instructions[0x200] != 1 || p.Classes["2nnn"] != 1 || p.Calls[0x206] != 1 {
+		t.Errorf("Expected one call to 0x206 but was %v", p.Calls)
+	}
+	if p.Classes["Fx0A"] != 1 || p.KeyWait == 0 || p.Instructions[0x204] != 0 {
+		t.Errorf("Expected Fx0A to wait, but waited %d cycles", p.KeyWait)
+	}
+	if polls := p.Instructions[0x20A] + p.Instructions[0x20C] + p.Instructions[0x20E]; p.TimerPoll != polls || polls < 27 {
+		t.Errorf("Expected the timer loop's %d instructions to be polling but was %d", polls, p.TimerPoll)
+	}
+	if p.Instructions[0x206] != 1 || p.TimerPoll+p.KeyWait+6 != p.Cycles() {
+		t.Errorf("Expected every other cycle to be polling or waiting, but %d of %d were", p.TimerPoll+p.KeyWait, p.Cycles())
+	}
+
+	draws := 0
+	for _, n := range p.Draws {
+		draws += n
+	}
+	if len(p.Draws) != 6 || draws != 1 {
+		t.Errorf("Expected 1 draw in 6 frames but was %v", p.Draws)
+	}
+}
+
+func TestProfileReport(t *testing.T) {
+	p, e := runProfile(t)
+
+	var b strings.Builder
+	if err := p.WriteReport(&b, e.Memory(), 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"6 frames, 60 cycles", "  0x20A ", "LD V0, DT", "  Fx07 ", "  0x206          1\n", "min 0, mean 0.2, max 1, total 1"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected the report to contain %q but was\n%s", want, b.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf, e.Memory(), "test.ch8"); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"cycles", "main", "sub_206", "test.ch8", "key wait", "timer poll"} {
+		if !bytes.Contains(pb, []byte(want)) {
+			t.Errorf("Expected the profile's strings to include %q", want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package debug
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const sourceMapHeader = "chip8go sourcemap 1"
+
+// SourceMap relates ROM addresses to the assembler source they came from.
+// It is read from text written by an assembler:
+//
+//	chip8go sourcemap 1
+//	label 0x200 main
+//	line 0x200 12 game.8o
+//
+// Each label line names an address, and each line line gives the
+// address of the first instruction of a source line. Source files are
+// relative to the source map.
+type SourceMap struct {
+	labels map[string]uint16
+	lines  []sourceLine // sorted by address
+}
+
+type sourceLine struct {
+	addr uint16
+	file string
+	line int
+}
+
+// Source is a position in an assembler source file
+type Source struct {
+	File string
+	Line int
+}
+
+// ReadSourceMapFile loads a source map, resolving the source files
+// it names relative to its own directory
+func ReadSourceMapFile(filename string) (*SourceMap, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := ReadSourceMap(f, filepath.Dir(filename))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return m, nil
+}
+
+// ReadSourceMap loads a source map, resolving relative source files from dir
+func ReadSourceMap(r io.Reader, dir string) (*SourceMap, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != sourceMapHeader {
+		return nil, errors.New("not a chip8go source map")
+	}
+
+	m := &SourceMap{labels: make(map[string]uint16)}
+	lineNumber := 1
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var err error
+		switch {
+		case fields[0] == "label" && len(fields) == 3:
+			var addr uint16
+			if addr, err = parseAddr(fields[1]); err == nil {
+				m.labels[fields[2]] = addr
+			}
+		case fields[0] == "line" && len(fields) >= 4:
+			var addr uint16
+			var line int
+			if addr, err = parseAddr(fields[1]); err != nil {
+				break
+			}
+			if line, err = strconv.Atoi(fields[2]); err != nil {
+				break
+			}
+			// file names may have spaces
+			file := strings.Join(fields[3:], " ")
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			m.lines = append(m.lines, sourceLine{addr, filepath.Clean(file), line})
+		default:
+			err = fmt.Errorf("unknown entry %q", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(m.lines, func(i, j int) bool {
+		return m.lines[i].addr < m.lines[j].addr
+	})
+
+	return m, nil
+}
+
+// parseAddr parses an address in hex, with or without 0x
+func parseAddr(s string) (uint16, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	addr, err := strconv.ParseUint(s, 16, 16)
+	if err != nil || addr >= 0x1000 {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+
+	return uint16(addr), nil
+}
+
+// Label returns the address of a label
+func (m *SourceMap) Label(name string) (uint16, bool) {
+	if m == nil {
+		return 0, false
+	}
+	addr, ok := m.labels[name]
+
+	return addr, ok
+}
+
+// Resolve returns the address of a label, or an address in hex
+func (m *SourceMap) Resolve(name string) (uint16, error) {
+	if addr, ok := m.Label(name); ok {
+		return addr, nil
+	}
+	addr, err := parseAddr(name)
+	if err != nil {
+		return 0, fmt.Errorf("no label or address %q", name)
+	}
+
+	return addr, nil
+}
+
+// Function returns the closest label at or before an address,
+// which is usually the subroutine it belongs to
+func (m *SourceMap) Function(addr uint16) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	best, found := "", false
+	var bestAddr uint16
+	for name, a := range m.labels {
+		if a <= addr && (!found || a > bestAddr || (a == bestAddr && name < best)) {
+			best, bestAddr, found = name, a, true
+		}
+	}
+
+	return best, found
+}
+
+// Addresses returns the addresses of the instructions of a source line.
+// Files are matched by their full path, or by name if no full path matches.
+func (m *SourceMap) Addresses(file string, line int) []uint16 {
+	if m == nil {
+		return nil
+	}
+	file = filepath.Clean(file)
+
+	var addrs []uint16
+	for _, match := range []func(string) bool{
+		func(f string) bool { return f == file },
+		func(f string) bool { return filepath.Base(f) == filepath.Base(file) },
+	} {
+		for _, l := range m.lines {
+			if l.line == line && match(l.file) {
+				addrs = append(addrs, l.addr)
+			}
+		}
+		if len(addrs) > 0 {
+			break
+		}
+	}
+
+	return addrs
+}
+
+// Source returns the source line an address belongs to,
+// the last line starting at or before it
+func (m *SourceMap) Source(addr uint16) (Source, bool) {
+	if m == nil {
+		return Source{}, false
+	}
+	i := sort.Search(len(m.lines), func(i int) bool {
+		return m.lines[i].addr > addr
+	})
+	if i == 0 {
+		return Source{}, false
+	}
+	l := m.lines[i-1]
+
+	return Source{File: l.file, Line: l.line}, true
+}
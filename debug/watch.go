@@ -0,0 +1,194 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// Access is a kind of memory access
+type Access int
+
+const (
+	AccessRead Access = 1 << iota
+	AccessWrite
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	}
+
+	return "access"
+}
+
+// Watchpoint stops the program after an instruction reads or writes
+// any of the Len bytes from Addr, as chosen by Access, or just logs
+// the access if Log is set
+type Watchpoint struct {
+	Addr   uint16
+	Len    uint16
+	Access Access
+	Log    bool
+}
+
+// ParseWatchpoint parses a range of memory and the accesses to watch,
+// such as 0x300, 0x300-0x30F for 16 bytes, or 0x300:w for writes only.
+// The access is r, w or rw, and defaults to rw.
+func ParseWatchpoint(s string) (Watchpoint, error) {
+	w := Watchpoint{Len: 1, Access: AccessRead | AccessWrite}
+
+	spec := s
+	if i := strings.LastIndexByte(spec, ':'); i >= 0 {
+		switch strings.ToLower(spec[i+1:]) {
+		case "r":
+			w.Access = AccessRead
+		case "w":
+			w.Access = AccessWrite
+		case "rw", "wr":
+		default:
+			return w, fmt.Errorf("invalid watchpoint %q: access must be r, w or rw", s)
+		}
+		spec = spec[:i]
+	}
+
+	var err error
+	if w.Addr, w.Len, err = parseRange(spec); err != nil {
+		return w, fmt.Errorf("invalid watchpoint %q: %v", s, err)
+	}
+
+	return w, nil
+}
+
+// ParseRange parses a range of memory such as 0x300 for one byte or
+// 0x300-0x30F for 16, returning its address and length
+func ParseRange(s string) (addr, length uint16, err error) {
+	if addr, length, err = parseRange(s); err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q: %v", s, err)
+	}
+
+	return addr, length, nil
+}
+
+func parseRange(s string) (addr, length uint16, err error) {
+	start, end := s, ""
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		start, end = s[:i], s[i+1:]
+	}
+	if addr, err = parseAddr(start); err != nil {
+		return 0, 0, err
+	}
+	if end == "" {
+		return addr, 1, nil
+	}
+	last, err := parseAddr(end)
+	if err != nil || last < addr {
+		return 0, 0, errors.New("bad end of range")
+	}
+
+	return addr, last - addr + 1, nil
+}
+
+// Range formats the watched memory as ParseWatchpoint reads it
+func (w Watchpoint) Range() string {
+	return formatRange(w.Addr, w.Len)
+}
+
+// formatRange formats a range of memory as ParseRange reads it
+func formatRange(addr, length uint16) string {
+	if length <= 1 {
+		return hexAddr(addr)
+	}
+
+	return hexAddr(addr) + "-" + hexAddr(addr+length-1)
+}
+
+// WatchHit is an access to a watched byte
+type WatchHit struct {
+	Watchpoint Watchpoint
+	Addr       uint16
+	Value      byte
+	Access     Access
+	// PC is the address of the instruction that made the access
+	PC uint16
+}
+
+func (h WatchHit) String() string {
+	verb := "read"
+	if h.Access == AccessWrite {
+		verb = "wrote"
+	}
+
+	return fmt.Sprintf("%s %s 0x%02X at %s", hexAddr(h.PC), verb, h.Value, hexAddr(h.Addr))
+}
+
+// SetWatchpoints replaces the watchpoints in a group
+func (d *Debugger) SetWatchpoints(group string, watchpoints []Watchpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(watchpoints) == 0 {
+		delete(d.watchGroups, group)
+	} else {
+		d.watchGroups[group] = append([]Watchpoint(nil), watchpoints...)
+	}
+	d.updateWatchpoints()
+}
+
+// LastHit returns the access that last stopped the program at a watchpoint
+func (d *Debugger) LastHit() WatchHit {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.lastHit
+}
+
+// updateWatchpoints gathers the watchpoint groups, only hooking
+// memory accesses while there is something to watch or track
+func (d *Debugger) updateWatchpoints() {
+	d.watchpoints = d.watchpoints[:0]
+	for _, group := range d.watchGroups {
+		d.watchpoints = append(d.watchpoints, group...)
+	}
+
+	if d.e == nil {
+		return
+	}
+	if len(d.watchpoints) > 0 || d.written != nil || d.sprites != nil || d.coverage != nil {
+		d.e.SetMemoryHook(d.memoryAccess)
+	} else {
+		d.e.SetMemoryHook(nil)
+	}
+}
+
+// memoryAccess checks an access against the watchpoints, and notes
+// it if writes or sprites are tracked. It is called by the emulator
+// while the frame loop holds the lock.
+func (d *Debugger) memoryAccess(a emu.MemoryAccess) {
+	d.noteAccess(a)
+	access := AccessRead
+	if a.Write {
+		access = AccessWrite
+	}
+
+	for _, w := range d.watchpoints {
+		if w.Access&access == 0 || a.Addr < w.Addr || a.Addr >= w.Addr+w.Len {
+			continue
+		}
+		hit := WatchHit{Watchpoint: w, Addr: a.Addr, Value: a.Value, Access: access, PC: a.PC}
+		if w.Log {
+			if !d.replaying {
+				d.logs = append(d.logs, fmt.Sprintf("frame %d: %s", d.frame, hit))
+			}
+		} else if !d.hitPending {
+			// the first access stops the program, once the instruction finishes
+			d.hit = hit
+			d.hitPending = true
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/szTheory/chip8go/debug"
+)
+
+// dumpArgs are the arguments to the dump command
+type dumpArgs struct {
+	headlessArgs
+	movieFilename string
+	memRange      string
+	format        string
+}
+
+func (d *dumpArgs) flags(name string) *flag.FlagSet {
+	fs := headlessFlags(name, &d.headlessArgs, &d.movieFilename)
+	fs.StringVar(&d.memRange, "range", "0x000-0xFFF", "memory `range` to dump, such as 0x200-0x2FF")
+	fs.StringVar(&d.format, "format", "hex", "hex for a hex and ASCII listing, or bin for the raw bytes")
+
+	return fs
+}
+
+// runDump runs a game for some frames, then writes its memory
+// to the -o file or stdout
+func runDump(args []string) error {
+	d := &dumpArgs{headlessArgs: headlessArgs{options: defaultOptions()}}
+	fs := d.flags("dump")
+	if err := parseHeadless("dump", fs, &d.headlessArgs, &d.movieFilename, args); err != nil {
+		return err
+	}
+	addr, length, err := debug.ParseRange(d.memRange)
+	if err != nil {
+		return usageError("dump", "%v", err)
+	}
+	if d.format != "hex" && d.format != "bin" {
+		return usageError("dump", "invalid format %q: want hex or bin", d.format)
+	}
+
+	e := d.emulator()
+	if err := d.run(e, func(n int) error { return nil }); err != nil {
+		return err
+	}
+	mem := e.Memory().RAM[addr : addr+length]
+
+	if d.out == "" {
+		return writeDump(os.Stdout, mem, addr, d.format)
+	}
+	f, err := os.Create(d.out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeDump(f, mem, addr, d.format); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// writeDump writes memory starting at addr in a dump format
+func writeDump(w io.Writer, mem []byte, addr uint16, format string) error {
+	if format == "bin" {
+		_, err := w.Write(mem)
+		return err
+	}
+
+	return debug.WriteHexDump(w, mem, addr)
+}
@@ -0,0 +1,282 @@
+package emu
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// BeeperSampleRate is the rate of the samples produced by the beeper
+const BeeperSampleRate = 44100
+
+// Waveform is the shape of the beeper tone
+type Waveform int
+
+const (
+	WaveSine Waveform = iota
+	WaveSquare
+	WaveTriangle
+	WaveSawtooth
+	WaveNoise
+	// WaveVIP imitates the COSMAC VIP's buzzer:
+	// a hard-edged square wave at a fixed pitch
+	WaveVIP
+)
+
+var waveformNames = []string{"sine", "square", "triangle", "sawtooth", "noise", "vip"}
+
+// vipFrequency is roughly the pitch of the COSMAC VIP's buzzer
+const vipFrequency = 1400
+
+// ParseWaveform parses a waveform name
+func ParseWaveform(s string) (Waveform, error) {
+	for i, name := range waveformNames {
+		if strings.EqualFold(s, name) {
+			return Waveform(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid waveform %q: want one of %s", s, strings.Join(waveformNames, ", "))
+}
+
+// WaveformNames lists the waveform names accepted by ParseWaveform
+func WaveformNames() []string {
+	return append([]string(nil), waveformNames...)
+}
+
+func (w Waveform) String() string {
+	if int(w) < len(waveformNames) {
+		return waveformNames[w]
+	}
+
+	return fmt.Sprintf("Waveform(%d)", int(w))
+}
+
+// BeeperSettings configure the tone played while the sound timer runs
+type BeeperSettings struct {
+	Waveform  Waveform
+	Frequency float64 // Hz, ignored by WaveVIP
+	Volume    float64 // 0 to 1
+	Mute      bool
+	// Attack and Release are how long the tone takes to fade in and out,
+	// in seconds. Short ramps avoid the clicks of switching a wave on and
+	// off mid-cycle. WaveVIP switches instantly, like the real hardware.
+	Attack  float64
+	Release float64
+}
+
+// DefaultBeeperSettings are a 440 Hz sine wave with short ramps
+func DefaultBeeperSettings() BeeperSettings {
+	return BeeperSettings{
+		Waveform:  WaveSine,
+		Frequency: 440,
+		Volume:    1,
+		Attack:    0.005,
+		Release:   0.010,
+	}
+}
+
+// Beeper synthesizes the CHIP-8 tone as 16-bit stereo samples.
+// The emulator opens and closes its gate as the sound timer starts and stops,
+// and Read is called from the audio thread.
+type Beeper struct {
+	mu       sync.Mutex
+	settings BeeperSettings
+
+	gate  bool
+	gain  float64 // envelope, ramping towards 1 while the gate is open
+	phase float64 // position in the current cycle, from 0 to 1
+	noise uint32  // LFSR state for WaveNoise
+	level float64 // current noise level, held for half a cycle
+
+	remaining []byte
+}
+
+// NewBeeper makes a silent beeper
+func NewBeeper(settings BeeperSettings) *Beeper {
+	return &Beeper{settings: settings, noise: 0xACE1}
+}
+
+// SetSettings changes the tone. It takes effect from the next sample.
+func (b *Beeper) SetSettings(settings BeeperSettings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.settings = settings
+}
+
+// Settings returns the current tone settings
+func (b *Beeper) Settings() BeeperSettings {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.settings
+}
+
+// SetGate starts or stops the tone
+func (b *Beeper) SetGate(on bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.gate = on
+}
+
+// Read fills the buffer with 16-bit little-endian stereo samples.
+// It never ends, playing silence while the gate is closed.
+func (b *Beeper) Read(buf []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.remaining) > 0 {
+		n := copy(buf, b.remaining)
+		b.remaining = b.remaining[n:]
+
+		return n, nil
+	}
+
+	// only whole stereo frames can be rendered, so keep the rest
+	// of the last one for the next read
+	var origBuf []byte
+	if len(buf)%4 > 0 {
+		origBuf = buf
+		buf = make([]byte, len(origBuf)+4-len(origBuf)%4)
+	}
+
+	for i := 0; i < len(buf)/4; i++ {
+		putSample(buf, i, b.next())
+	}
+
+	if origBuf != nil {
+		n := copy(origBuf, buf)
+		b.remaining = buf[n:]
+
+		return n, nil
+	}
+
+	return len(buf), nil
+}
+
+// FrameBytes is the size of one frame of samples from RenderFrame
+const FrameBytes = SamplesPerFrame * 4
+
+// RenderFrame fills buf with one frame of 16-bit little-endian stereo
+// samples, opening and closing the gate at the offsets reported by
+// Emulator.GateChanges. Unlike Read, it follows the emulated timeline
+// rather than the wall clock, so the same run always sounds the same.
+// buf must be at least FrameBytes long.
+func (b *Beeper) RenderFrame(buf []byte, changes []GateChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the emulator has already left the gate as the frame ends it, and the
+	// changes alternate, so the frame starts from before the first one
+	if len(changes) > 0 {
+		b.gate = !changes[0].On
+	}
+	next := 0
+	for i := 0; i < SamplesPerFrame; i++ {
+		for ; next < len(changes) && changes[next].Sample <= i; next++ {
+			b.gate = changes[next].On
+		}
+		putSample(buf, i, b.next())
+	}
+	for ; next < len(changes); next++ {
+		b.gate = changes[next].On
+	}
+}
+
+// putSample writes a sample from -1 to 1 to both channels of stereo frame i
+func putSample(buf []byte, i int, sample float64) {
+	value := int16(sample * math.MaxInt16)
+	buf[4*i] = byte(value)
+	buf[4*i+1] = byte(value >> 8)
+	buf[4*i+2] = byte(value)
+	buf[4*i+3] = byte(value >> 8)
+}
+
+// Close from io.Closer
+func (b *Beeper) Close() error {
+	return nil
+}
+
+// next advances by one sample and returns it, from -1 to 1
+func (b *Beeper) next() float64 {
+	s := &b.settings
+	frequency := s.Frequency
+	attack, release := s.Attack, s.Release
+	if s.Waveform == WaveVIP {
+		frequency = vipFrequency
+		attack, release = 0, 0
+	}
+
+	// move the envelope towards its target
+	if b.gate {
+		b.gain = ramp(b.gain, 1, attack)
+	} else {
+		b.gain = ramp(b.gain, 0, release)
+	}
+	if b.gain == 0 {
+		// restart the wave so every beep begins the same way
+		b.phase = 0
+		return 0
+	}
+
+	var sample float64
+	switch s.Waveform {
+	case WaveSquare, WaveVIP:
+		sample = 1
+		if b.phase >= 0.5 {
+			sample = -1
+		}
+	case WaveTriangle:
+		sample = 1 - 4*math.Abs(b.phase-0.5)
+	case WaveSawtooth:
+		sample = 2*b.phase - 1
+	case WaveNoise:
+		sample = b.level
+	default:
+		sample = math.Sin(2 * math.Pi * b.phase)
+	}
+
+	// noise changes level twice per cycle so it follows the pitch
+	previous := b.phase
+	b.phase += frequency / BeeperSampleRate
+	if b.phase >= 1 {
+		b.phase -= math.Floor(b.phase)
+	}
+	if s.Waveform == WaveNoise && (b.phase < previous || (previous < 0.5 && b.phase >= 0.5)) {
+		b.stepNoise()
+	}
+
+	volume := s.Volume
+	if s.Mute {
+		volume = 0
+	}
+
+	return sample * b.gain * volume
+}
+
+// stepNoise advances a 16-bit Galois LFSR to pick the next noise level
+func (b *Beeper) stepNoise() {
+	lsb := b.noise & 1
+	b.noise >>= 1
+	if lsb == 1 {
+		b.noise ^= 0xB400
+	}
+	b.level = float64(b.noise&0xFF)/127.5 - 1
+}
+
+// ramp moves value towards target in steps that would take
+// the given time in seconds to cover the whole range
+func ramp(value, target, seconds float64) float64 {
+	if seconds <= 0 {
+		return target
+	}
+	step := 1 / (seconds * BeeperSampleRate)
+	if value < target {
+		return math.Min(value+step, target)
+	}
+
+	return math.Max(value-step, target)
+}
@@ -0,0 +1,80 @@
+package emu
+
+import (
+	"math"
+	"testing"
+)
+
+// samples reads n mono samples from the beeper's left channel
+func samples(b *Beeper, n int) []int16 {
+	buf := make([]byte, n*4)
+	b.Read(buf)
+
+	out := make([]int16, n)
+	for i := range out {
+		out[i] = int16(uint16(buf[4*i]) | uint16(buf[4*i+1])<<8)
+	}
+
+	return out
+}
+
+func TestBeeperSilentUntilGateOpens(t *testing.T) {
+	b := NewBeeper(DefaultBeeperSettings())
+	for _, s := range samples(b, 1000) {
+		if s != 0 {
+			t.Fatalf("Expected silence with the gate closed but got %d", s)
+		}
+	}
+}
+
+func TestBeeperEnvelopeAvoidsClicks(t *testing.T) {
+	settings := DefaultBeeperSettings()
+	settings.Waveform = WaveSquare
+	b := NewBeeper(settings)
+
+	b.SetGate(true)
+	on := samples(b, 1000)
+	b.SetGate(false)
+	off := samples(b, 1000)
+
+	// a square wave jumps between +/- full scale once ramped up, but the
+	// first samples of the attack and the release must be quiet
+	if math.Abs(float64(on[0])) > 500 {
+		t.Errorf("Expected the attack to start quietly but first sample was %d", on[0])
+	}
+	if math.Abs(float64(on[len(on)-1])) < 30000 {
+		t.Errorf("Expected full volume after the attack but was %d", on[len(on)-1])
+	}
+	for i := 1; i < len(off); i++ {
+		if math.Abs(float64(off[i])) > math.Abs(float64(off[i-1]))+500 {
+			t.Fatalf("Expected the release to fade out but sample %d jumped from %d to %d", i, off[i-1], off[i])
+		}
+	}
+	if off[len(off)-1] != 0 {
+		t.Errorf("Expected silence after the release but was %d", off[len(off)-1])
+	}
+}
+
+func TestBeeperVIPIsHardEdged(t *testing.T) {
+	settings := DefaultBeeperSettings()
+	settings.Waveform = WaveVIP
+	b := NewBeeper(settings)
+
+	b.SetGate(true)
+	if s := samples(b, 1)[0]; s != math.MaxInt16 {
+		t.Errorf("Expected the VIP buzzer to start at full volume but was %d", s)
+	}
+}
+
+func TestBeeperMute(t *testing.T) {
+	settings := DefaultBeeperSettings()
+	settings.Mute = true
+	b := NewBeeper(settings)
+
+	b.SetGate(true)
+	for _, s := range samples(b, 1000) {
+		if s != 0 {
+			t.Fatalf("Expected silence when muted but got %d", s)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package emu
+
+// Engine is how RunFrame runs instructions
+type Engine int
+
+const (
+	// EngineInterpreter runs one decoded instruction at a time
+	EngineInterpreter Engine = iota
+	// EngineBlocks translates straight-line runs of instructions into
+	// chains of closures, cached by the address they start at, and runs
+	// a whole block at a time
+	EngineBlocks
+)
+
+// maxBlockLength is the most instructions a block holds, which bounds
+// how far back a write has to look for blocks it overlaps
+const maxBlockLength = 32
+
+// blockOp runs one instruction of a block, moving the PC past it first
+// as EmulateCycle does
+type blockOp func(e *Emulator)
+
+// block is a run of instructions that only the last can leave, so they
+// can run one after another without looking at the PC in between
+type block struct {
+	start, end uint16
+	ops        []blockOp
+}
+
+// blockCache holds the blocks translated so far by their start address.
+// Like the decode table, it is kept current by Memory.Write and
+// Memory.Changed, so running a block doesn't check its code is unchanged.
+type blockCache [RamSize]*block
+
+// invalidate drops the blocks that include the byte at addr
+func (c *blockCache) invalidate(addr uint16) {
+	lo := 0
+	if int(addr) >= 2*maxBlockLength {
+		lo = int(addr) - 2*maxBlockLength + 1
+	}
+	for start := lo; start <= int(addr); start++ {
+		if b := c[start]; b != nil && b.end > addr {
+			c[start] = nil
+		}
+	}
+}
+
+// endsBlock reports whether an instruction has to be the last of its
+// block: those that can leave the straight line, wait for a key, or write
+// to memory that could hold the block itself
+func endsBlock(instruction uint16) bool {
+	switch instruction >> 12 {
+	case 0x1, 0x2, 0x3, 0x4, 0x5, 0x9, 0xB, 0xE:
+		return true
+	case 0x0:
+		return instruction == 0x00EE
+	case 0xF:
+		switch instruction & 0xFF {
+		case 0x0A, 0x33, 0x55:
+			return true
+		}
+	}
+
+	return false
+}
+
+// translate makes the block starting at start, with a closure for each
+// instruction that calls its decoded handler
+func (m *Memory) translate(start uint16) *block {
+	b := &block{start: start}
+	pc := start
+	for len(b.ops) < maxBlockLength && int(pc)+1 < RamSize {
+		d := decode(m.Opcode(pc))
+		next := pc + 2
+		b.ops = append(b.ops, func(e *Emulator) {
+			e.cpu.PC = next
+			d.run(e, &d)
+		})
+		pc = next
+		if endsBlock(d.op) {
+			break
+		}
+	}
+	b.end = pc
+
+	return b
+}
+
+// block returns the cached block starting at addr, translating it if
+// there is none
+func (m *Memory) block(addr uint16) *block {
+	b := m.blocks[addr]
+	if b == nil {
+		b = m.translate(addr)
+		m.blocks[addr] = b
+	}
+
+	return b
+}
+
+// runBlocks runs the rest of a frame a block at a time. Keys only change
+// between frames and a key can only be caught once an Fx0A has ended a
+// block, so they are looked at as the frame starts and while waiting
+// rather than before each instruction, and the frame's cycles are counted
+// as each instruction runs for the beeper's timing.
+func (e *Emulator) runBlocks() {
+	if e.frameCycle < e.frameCycles {
+		e.updateKeys()
+	}
+	for e.frameCycle < e.frameCycles {
+		if e.waitingForKey() {
+			return
+		}
+
+		ops := e.memory.block(e.cpu.PC).ops
+		if len(ops) == 0 {
+			// there is no whole instruction left at the end of memory,
+			// which the interpreter fails on
+			e.EmulateCycle()
+			e.frameCycle++
+			continue
+		}
+		if left := e.frameCycles - e.frameCycle; len(ops) > left {
+			ops = ops[:left]
+		}
+		for _, op := range ops {
+			op(e)
+			e.frameCycle++
+		}
+	}
+}
+
+// waitingForKey answers a waiting Fx0A with a key that was just pressed,
+// or ends the frame and reports true if it is still waiting
+func (e *Emulator) waitingForKey() bool {
+	if !e.Input.WaitingForInput {
+		return false
+	}
+	e.updateKeys()
+	if e.Input.WaitingForInput {
+		e.frameCycle = e.frameCycles
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,180 @@
+package emu
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// frameKeys holds key 5 down for a few frames now and then, so that
+// games waiting on keys go on
+func frameKeys(f int) Keys {
+	if f%40 < 3 {
+		return 1 << 5
+	}
+
+	return 0
+}
+
+func TestBlocksMatchInterpreter(t *testing.T) {
+	for _, name := range benchmarkROMs {
+		for _, speed := range []int{1, 7, 10, 100} {
+			blocks := &Emulator{Seed: 1, Engine: EngineBlocks}
+			blocks.Setup("../games/" + name + ".ch8")
+			interpreted := &Emulator{Seed: 1}
+			interpreted.Setup("../games/" + name + ".ch8")
+
+			for f := 0; f < 600; f++ {
+				blocks.RunFrame(speed, frameKeys(f))
+				interpreted.RunFrame(speed, frameKeys(f))
+				if !reflect.DeepEqual(blocks.Save(), interpreted.Save()) {
+					t.Fatalf("%s at speed %d: expected the blocks to run as the interpreter does in frame %d", name, speed, f)
+				}
+				if !reflect.DeepEqual(blocks.GateChanges(), interpreted.GateChanges()) {
+					t.Fatalf("%s at speed %d: expected the beeper to change as with the interpreter in frame %d", name, speed, f)
+				}
+			}
+		}
+	}
+}
+
+func TestBlocksInvalidation(t *testing.T) {
+	e := &Emulator{Seed: 1, Engine: EngineBlocks}
+	e.SetupROM([]byte{
+		0x60, 0x12, // 200 LD V0, 0x12
+		0x61, 0x0E, // 202 LD V1, 0x0E
+		0xA2, 0x0E, // 204 LD I, 0x20E
+		0x12, 0x0A, // 206 JP 0x20A
+		0x00, 0x00, // 208
+		0x73, 0x01, // 20A ADD V3, 0x01
+		0x74, 0x01, // 20C ADD V4, 0x01
+		0x75, 0x01, // 20E ADD V5, 0x01
+		0xF1, 0x55, // 210 LD [I], V1
+		0x12, 0x0A, // 212 JP 0x20A
+	})
+
+	// the first time round runs the block from 0x20A to the store, which
+	// then writes JP 0x20E over ADD V5 in the middle of it
+	e.RunFrame(8, 0)
+	if e.memory.blocks[0x20A] != nil {
+		t.Errorf("Expected the store to drop the block it wrote over")
+	}
+	if e.cpu.V[3] != 1 || e.cpu.V[4] != 1 || e.cpu.V[5] != 1 {
+		t.Errorf("Expected the first time round to add to V3 to V5 but they were %v", e.cpu.V[3:6])
+	}
+
+	// the second time round jumps to itself at 0x20E
+	e.RunFrame(5, 0)
+	if e.cpu.PC != 0x20E || e.cpu.V[3] != 2 || e.cpu.V[4] != 2 || e.cpu.V[5] != 1 {
+		t.Errorf("Expected the rewritten block to loop at 0x20E but PC was 0x%03X and V3 to V5 %v", e.cpu.PC, e.cpu.V[3:6])
+	}
+
+	// changing RAM directly is seen once the memory is told, as Debugger.Edit does
+	e.memory.RAM[0x20E], e.memory.RAM[0x20F] = 0x12, 0x0A
+	e.memory.Changed()
+	e.RunFrame(3, 0)
+	if e.cpu.PC != 0x20E || e.cpu.V[3] != 3 || e.cpu.V[4] != 3 {
+		t.Errorf("Expected the edited jump to go back to 0x20A but PC was 0x%03X and V3 and V4 %v", e.cpu.PC, e.cpu.V[3:5])
+	}
+}
+
+func TestBlocksSelfModifying(t *testing.T) {
+	e := &Emulator{Seed: 1, Engine: EngineBlocks}
+	e.SetupROM([]byte{
+		0x60, 0x12, // 200 LD V0, 0x12
+		0x61, 0x0A, // 202 LD V1, 0x0A
+		0xA2, 0x0E, // 204 LD I, 0x20E
+		0x12, 0x0A, // 206 JP 0x20A
+		0x00, 0x00, // 208
+		0x73, 0x01, // 20A ADD V3, 0x01
+		0x74, 0x01, // 20C ADD V4, 0x01
+		0x75, 0x01, // 20E ADD V5, 0x01
+		0x33, 0x03, // 210 SE V3, 0x03
+		0x12, 0x0A, // 212 JP 0x20A
+		0xF1, 0x55, // 214 LD [I], V1
+		0x12, 0x0A, // 216 JP 0x20A
+	})
+
+	// the block from 0x20A runs twice and stays cached
+	e.RunFrame(14, 0)
+	if e.memory.blocks[0x20A] == nil {
+		t.Fatalf("Expected the block at 0x20A to be cached")
+	}
+	saved := e.Save()
+
+	// the third time round skips to the store, which writes JP 0x20A over
+	// ADD V5 in the middle of the cached block, so V5 stops counting
+	e.RunFrame(6, 0)
+	e.RunFrame(9, 0)
+	if e.cpu.PC != 0x20A || e.cpu.V[3] != 6 || e.cpu.V[4] != 6 || e.cpu.V[5] != 3 {
+		t.Errorf("Expected the rewritten block to loop without V5 but PC was 0x%03X and V3 to V5 %v", e.cpu.PC, e.cpu.V[3:6])
+	}
+
+	// restoring the code from before the store drops the rewritten block
+	e.Restore(saved)
+	e.RunFrame(6, 0)
+	if e.cpu.V[5] != 3 {
+		t.Errorf("Expected the restored block to add to V5 again but it was %d", e.cpu.V[5])
+	}
+}
+
+func TestBlocksWaitForKey(t *testing.T) {
+	e := &Emulator{Seed: 1, Engine: EngineBlocks}
+	e.SetupROM([]byte{
+		0xF2, 0x0A, // 200 LD V2, K
+		0x73, 0x01, // 202 ADD V3, 0x01
+		0x12, 0x02, // 204 JP 0x202
+	})
+
+	e.RunFrame(10, 0)
+	if !e.Input.WaitingForInput || e.cpu.V[3] != 0 {
+		t.Errorf("Expected to be waiting for a key without running on")
+	}
+	e.RunFrame(10, 1<<7)
+	if e.Input.WaitingForInput || e.cpu.V[2] != 7 || e.cpu.V[3] != 5 {
+		t.Errorf("Expected key 7 in V2 and 5 additions but V2 was %d and V3 %d", e.cpu.V[2], e.cpu.V[3])
+	}
+}
+
+func TestBlocksEndOfMemory(t *testing.T) {
+	// the last byte of memory isn't a whole instruction, so it fails
+	// as it does in the interpreter rather than making an empty block
+	for _, engine := range []Engine{EngineInterpreter, EngineBlocks} {
+		e := &Emulator{Seed: 1, Engine: engine}
+		e.SetupROM([]byte{0x1F, 0xFF}) // 200 JP 0xFFF
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected running from 0xFFF with engine %d to panic", engine)
+				}
+			}()
+			e.RunFrame(10, 0)
+		}()
+	}
+}
+
+// benchmarkFrames reports how many instructions a second each game runs
+// at a frame at a time with an engine
+func benchmarkFrames(b *testing.B, engine Engine) {
+	const speed = 1000
+	for _, name := range benchmarkROMs {
+		b.Run(name, func(b *testing.B) {
+			e := &Emulator{Seed: 1, Engine: engine}
+			e.Setup("../games/" + name + ".ch8")
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				e.RunFrame(speed, 0)
+			}
+			b.ReportMetric(float64(b.N)*speed/time.Since(start).Seconds(), "instructions/s")
+		})
+	}
+}
+
+func BenchmarkRunFrameInterpreter(b *testing.B) {
+	benchmarkFrames(b, EngineInterpreter)
+}
+
+func BenchmarkRunFrameBlocks(b *testing.B) {
+	benchmarkFrames(b, EngineBlocks)
+}
@@ -0,0 +1,180 @@
+package emu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CheatRegisters is the address cheats and cheat searches give V0,
+// with the rest of the V registers after it, as games such as BRIX
+// keep variables like the number of lives in registers
+const CheatRegisters = RamSize
+
+// CheatSize is how many bytes cheats cover: memory, then V0 to VF
+const CheatSize = CheatRegisters + 16
+
+// Cheat holds a byte of memory or a register at a value, like the cheat
+// codes of classic emulators, such as keeping the number of lives from
+// going down. Cheats are written as each frame starts.
+type Cheat struct {
+	// Addr is a memory address, or CheatRegisters onwards for a register
+	Addr  uint16
+	Value byte
+	// Compare is the byte that must be in memory for the cheat to apply,
+	// if HasCompare is set, for addresses the game uses for several things
+	Compare    byte
+	HasCompare bool
+	// Name says what the cheat does, such as "lives"
+	Name string
+	// Off keeps the cheat in the list without applying it
+	Off bool
+}
+
+// ParseCheat parses a cheat code of hex numbers ADDR:VALUE or
+// ADDR:VALUE:COMPARE, such as 2F6:03, with a name after it if there is one.
+// The address may be a register from V0 to VF instead.
+func ParseCheat(s string) (Cheat, error) {
+	s = strings.TrimSpace(s)
+	code, name := s, ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		code, name = s[:i], strings.TrimSpace(s[i+1:])
+	}
+
+	parts := strings.Split(code, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return Cheat{}, fmt.Errorf("invalid cheat %q: want ADDR:VALUE or ADDR:VALUE:COMPARE", s)
+	}
+	addr, err := parseCheatAddr(parts[0])
+	if err != nil {
+		return Cheat{}, fmt.Errorf("invalid cheat %q: bad address %q", s, parts[0])
+	}
+	c := Cheat{Addr: addr, Name: name}
+	if c.Value, err = parseHexByte(parts[1]); err != nil {
+		return Cheat{}, fmt.Errorf("invalid cheat %q: bad value %q", s, parts[1])
+	}
+	if len(parts) == 3 {
+		c.HasCompare = true
+		if c.Compare, err = parseHexByte(parts[2]); err != nil {
+			return Cheat{}, fmt.Errorf("invalid cheat %q: bad compare byte %q", s, parts[2])
+		}
+	}
+
+	return c, nil
+}
+
+func parseCheatAddr(s string) (uint16, error) {
+	if len(s) == 2 && (s[0] == 'V' || s[0] == 'v') {
+		x, err := strconv.ParseUint(s[1:], 16, 4)
+		return CheatRegisters + uint16(x), err
+	}
+	addr, err := strconv.ParseUint(trimHex(s), 16, 16)
+	if err == nil && addr >= RamSize {
+		err = fmt.Errorf("address 0x%X is past the end of memory", addr)
+	}
+
+	return uint16(addr), err
+}
+
+// FormatCheatAddr formats an address as cheat codes have it,
+// such as 2F6, or VE for a register
+func FormatCheatAddr(addr uint16) string {
+	if addr >= CheatRegisters {
+		return fmt.Sprintf("V%X", addr-CheatRegisters)
+	}
+
+	return fmt.Sprintf("%03X", addr)
+}
+
+func trimHex(s string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+}
+
+func parseHexByte(s string) (byte, error) {
+	v, err := strconv.ParseUint(trimHex(s), 16, 8)
+	return byte(v), err
+}
+
+// Code formats the cheat as ParseCheat reads it, without the name
+func (c Cheat) Code() string {
+	code := fmt.Sprintf("%s:%02X", FormatCheatAddr(c.Addr), c.Value)
+	if c.HasCompare {
+		code += fmt.Sprintf(":%02X", c.Compare)
+	}
+
+	return code
+}
+
+func (c Cheat) String() string {
+	if c.Name == "" {
+		return c.Code()
+	}
+
+	return c.Code() + " " + c.Name
+}
+
+// ReadCheats loads a cheat file, which has a cheat code on each line with
+// an optional name. A - before the code turns the cheat off, and lines
+// starting with # are comments.
+func ReadCheats(r io.Reader) ([]Cheat, error) {
+	var cheats []Cheat
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		off := strings.HasPrefix(line, "-")
+		c, err := ParseCheat(strings.TrimPrefix(line, "-"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		c.Off = off
+		cheats = append(cheats, c)
+	}
+
+	return cheats, scanner.Err()
+}
+
+// WriteCheats saves cheats in the form ReadCheats loads
+func WriteCheats(w io.Writer, cheats []Cheat) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range cheats {
+		if c.Off {
+			bw.WriteByte('-')
+		}
+		fmt.Fprintln(bw, c)
+	}
+
+	return bw.Flush()
+}
+
+// CheatByte returns the byte at a cheat address, in memory or a register
+func (e *Emulator) CheatByte(addr uint16) byte {
+	return *e.cheatByte(addr)
+}
+
+func (e *Emulator) cheatByte(addr uint16) *byte {
+	if addr >= CheatRegisters {
+		return &e.cpu.V[addr-CheatRegisters]
+	}
+
+	return &e.memory.RAM[addr]
+}
+
+// applyCheats writes the cheats that are on
+func (e *Emulator) applyCheats() {
+	for _, c := range e.Cheats {
+		b := e.cheatByte(c.Addr)
+		if c.Off || c.HasCompare && *b != c.Compare {
+			continue
+		}
+		// a cheat on code has to be decoded again before it runs
+		if c.Addr < CheatRegisters && *b != c.Value {
+			e.memory.invalidate(c.Addr)
+		}
+		*b = c.Value
+	}
+}
@@ -0,0 +1,127 @@
+package emu
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCheat(t *testing.T) {
+	c, err := ParseCheat("0x2F6:03:02 infinite lives")
+	want := Cheat{Addr: 0x2F6, Value: 3, Compare: 2, HasCompare: true, Name: "infinite lives"}
+	if err != nil || c != want {
+		t.Errorf("Expected %+v but was %+v, %v", want, c, err)
+	}
+	if c.String() != "2F6:03:02 infinite lives" {
+		t.Errorf("Expected the code to format back but was %q", c)
+	}
+
+	if c, err := ParseCheat("ve:05"); err != nil || c.Addr != CheatRegisters+0xE || c.Code() != "VE:05" {
+		t.Errorf("Expected register VE but was %+v, %v", c, err)
+	}
+
+	for _, bad := range []string{"", "2F6", "2F6:", "1000:01", "VG:01", "2F6:100", "2F6:01:xx", "2F6:01:02:03"} {
+		if _, err := ParseCheat(bad); err == nil {
+			t.Errorf("Expected an error for cheat %q", bad)
+		}
+	}
+}
+
+func TestCheatsRoundTrip(t *testing.T) {
+	cheats := []Cheat{
+		{Addr: 0x2F6, Value: 3, Name: "lives"},
+		{Addr: 0x300, Value: 0x10, Compare: 0x20, HasCompare: true, Off: true},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCheats(&buf, cheats); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "2F6:03 lives\n-300:10:20\n" {
+		t.Errorf("Unexpected cheat file %q", buf.String())
+	}
+	actual, err := ReadCheats(strings.NewReader("# BRIX\n\n" + buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cheats, actual) {
+		t.Errorf("Expected %+v but was %+v", cheats, actual)
+	}
+
+	if _, err := ReadCheats(strings.NewReader("2F6:03\nlives\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2 but was %v", err)
+	}
+}
+
+func TestCheatsApply(t *testing.T) {
+	e := &Emulator{Seed: 1}
+	e.SetupROM([]byte{0x12, 0x00}) // JP 0x200
+	ram := &e.Memory().RAM
+	ram[0x301] = 7
+	e.Cheats = []Cheat{
+		{Addr: 0x300, Value: 9},
+		{Addr: 0x301, Value: 1, Compare: 5, HasCompare: true},
+		{Addr: 0x302, Value: 4, Off: true},
+		{Addr: CheatRegisters + 0xE, Value: 5},
+	}
+	e.RunFrame(1, 0)
+
+	if ram[0x300] != 9 || ram[0x301] != 7 || ram[0x302] != 0 {
+		t.Errorf("Expected only the first cheat to apply but memory was % X", ram[0x300:0x303])
+	}
+	if e.CPU().V[0xE] != 5 {
+		t.Errorf("Expected VE to be 5 but was %d", e.CPU().V[0xE])
+	}
+}
+
+func TestCheatsPatchCode(t *testing.T) {
+	e := &Emulator{Seed: 1}
+	e.SetupROM([]byte{
+		0x70, 0x01, // 200 ADD V0, 0x01
+		0x12, 0x00, // 202 JP 0x200
+	})
+	e.RunFrame(2, 0)
+
+	// the cheat turns the add into LD V0, 0x42 after it has run
+	e.Cheats = []Cheat{{Addr: 0x200, Value: 0x60}, {Addr: 0x201, Value: 0x42}}
+	e.RunFrame(2, 0)
+	if e.CPU().V[0] != 0x42 {
+		t.Errorf("Expected the patched instruction to run but V0 was 0x%02X", e.CPU().V[0])
+	}
+}
+
+func TestCheatSearch(t *testing.T) {
+	e := &Emulator{Seed: 1}
+	e.SetupROM([]byte{0x12, 0x00})
+	ram, v := &e.Memory().RAM, &e.CPU().V
+	ram[0x300], ram[0x301], v[0xE] = 3, 3, 5
+	s := NewCheatSearch(e)
+
+	ram[0x300], ram[0x301], v[0xE] = 2, 4, 4
+	if n := s.Filter(e, SearchDecreased, 0); n != 2 {
+		t.Errorf("Expected 2 addresses to decrease but was %d", n)
+	}
+	if n := s.Filter(e, SearchEqual, 0); n != 2 {
+		t.Errorf("Expected both to stay the same but was %d", n)
+	}
+	ram[0x300] = 1
+	f, value, err := ParseSearchFilter("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Filter(e, f, value); n != 1 || s.Candidates()[0] != 0x300 || s.Previous(0x300) != 1 {
+		t.Errorf("Expected to find 0x300 but was %v", s.Candidates())
+	}
+	v[0xE] = 0xAB
+	s = NewCheatSearch(e)
+	if n := s.Filter(e, SearchValue, 0xAB); n != 1 || s.Candidates()[0] != CheatRegisters+0xE {
+		t.Errorf("Expected to find VE but was %v", s.Candidates())
+	}
+
+	for _, bad := range []string{"", "more", "256"} {
+		if _, _, err := ParseSearchFilter(bad); err == nil {
+			t.Errorf("Expected an error for search %q", bad)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package emu
+
+// CompiledBlock is a block of a ROM's instructions recompiled ahead of
+// time into a Go function, as chip8go recompile writes them
+type CompiledBlock struct {
+	// Start and End are the addresses of the block's code, End being
+	// the address after its last instruction
+	Start, End uint16
+	// Length is how many instructions the block runs
+	Length int
+	// Run runs the block's instructions, leaving the PC at the next
+	// instruction to run
+	Run func(e *Emulator, c *CPU)
+}
+
+// compiledBlock is a CompiledBlock with the code it was compiled from,
+// so that it only runs while RAM holds that code
+type compiledBlock struct {
+	CompiledBlock
+	code string
+}
+
+// CompiledProgram is a ROM's recompiled blocks by start address, for
+// Emulator.Compiled. An emulator given it runs the blocks in RunFrame,
+// whatever its Engine, and falls back to the interpreter where there is
+// no block, where the frame ends partway through one, or where RAM no
+// longer holds the code a block was compiled from.
+type CompiledProgram struct {
+	hash   string
+	blocks [RamSize]*compiledBlock
+}
+
+// NewCompiledProgram gives the blocks recompiled from a ROM, as the
+// recompiler's output does
+func NewCompiledProgram(rom []byte, blocks []CompiledBlock) *CompiledProgram {
+	p := &CompiledProgram{hash: HashROM(rom)}
+	for _, b := range blocks {
+		code := string(rom[b.Start-RamProgramStart : b.End-RamProgramStart])
+		p.blocks[b.Start] = &compiledBlock{CompiledBlock: b, code: code}
+	}
+
+	return p
+}
+
+// ROMHash is the hash of the ROM the program was compiled from, as HashROM gives it
+func (p *CompiledProgram) ROMHash() string {
+	return p.hash
+}
+
+// Exec runs an instruction of a recompiled block that the block leaves
+// to the emulator, with the PC already past it. i is its place in the
+// block, for the beeper's timing.
+func (e *Emulator) Exec(i int, instruction uint16) {
+	e.frameCycle = e.compiledCycle + i
+	d := decode(instruction)
+	d.run(e, &d)
+}
+
+// runCompiled runs the rest of a frame with the recompiled blocks,
+// interpreting the instructions outside them, with keys looked at as
+// runBlocks does
+func (e *Emulator) runCompiled() {
+	if e.frameCycle < e.frameCycles {
+		e.updateKeys()
+	}
+	for e.frameCycle < e.frameCycles {
+		if e.waitingForKey() {
+			return
+		}
+
+		b := e.compiled.blocks[e.cpu.PC]
+		if b == nil || b.Length > e.frameCycles-e.frameCycle || string(e.memory.RAM[b.Start:b.End]) != b.code {
+			e.EmulateCycle()
+			e.frameCycle++
+			continue
+		}
+		e.compiledCycle = e.frameCycle
+		b.Run(e, e.cpu)
+		e.frameCycle = e.compiledCycle + b.Length
+	}
+}
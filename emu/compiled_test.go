@@ -0,0 +1,54 @@
+package emu
+
+import "testing"
+
+func TestCompiled(t *testing.T) {
+	rom := []byte{
+		0x60, 0x01, // 200 LD V0, 0x01
+		0x71, 0x01, // 202 ADD V1, 0x01
+		0x12, 0x02, // 204 JP 0x202
+	}
+	// the block counts its runs in V2, which the ROM doesn't touch
+	p := NewCompiledProgram(rom, []CompiledBlock{{Start: 0x202, End: 0x206, Length: 2, Run: func(e *Emulator, c *CPU) {
+		c.V[1]++
+		c.V[2]++
+		c.PC = 0x202
+	}}})
+
+	// an emulator without the program, or set up with another ROM, doesn't run it
+	plain := &Emulator{Seed: 1}
+	plain.SetupROM(rom)
+	other := &Emulator{Seed: 1, Compiled: p}
+	other.SetupROM(append([]byte{0x00, 0xE0}, rom...))
+	for _, e := range []*Emulator{plain, other} {
+		e.RunFrame(5, 0)
+		if e.cpu.V[2] != 0 {
+			t.Errorf("Expected the block to run only with its own ROM but V2 was %d", e.cpu.V[2])
+		}
+	}
+
+	e := &Emulator{Seed: 1, Compiled: p}
+	e.SetupROM(rom)
+
+	// 0x200 is interpreted, then the block runs twice
+	e.RunFrame(5, 0)
+	if e.cpu.V[0] != 1 || e.cpu.V[1] != 2 || e.cpu.V[2] != 2 {
+		t.Errorf("Expected the block to run twice after LD V0 but V0 to V2 were %v", e.cpu.V[:3])
+	}
+
+	// the block doesn't fit in a frame of 1, so the interpreter runs
+	// to the jump, and the next frame has room for the block after it
+	e.RunFrame(1, 0)
+	e.RunFrame(3, 0)
+	if e.cpu.PC != 0x202 || e.cpu.V[1] != 4 || e.cpu.V[2] != 3 {
+		t.Errorf("Expected the interpreter to finish the block but PC was 0x%03X and V1 and V2 %v", e.cpu.PC, e.cpu.V[1:3])
+	}
+
+	// once its code changes, as Debugger.Edit tells the memory, the block isn't run
+	e.memory.RAM[0x203] = 0x02
+	e.memory.Changed()
+	e.RunFrame(4, 0)
+	if e.cpu.V[1] != 8 || e.cpu.V[2] != 3 {
+		t.Errorf("Expected the interpreter to run the changed code but V1 and V2 were %v", e.cpu.V[1:3])
+	}
+}
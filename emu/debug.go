@@ -0,0 +1,28 @@
+package emu
+
+// CPU gives debuggers access to the registers, timers and stack
+func (e *Emulator) CPU() *CPU {
+	return e.cpu
+}
+
+// Memory gives debuggers access to RAM
+func (e *Emulator) Memory() *Memory {
+	return e.memory
+}
+
+// SetMemoryHook calls hook whenever an instruction reads or writes data
+// in RAM, or stops calling it if hook is nil. Without a hook, memory
+// accesses only pay for a nil check.
+func (e *Emulator) SetMemoryHook(hook func(MemoryAccess)) {
+	if hook == nil {
+		e.memory.hook = nil
+		return
+	}
+
+	e.memory.hook = func(a MemoryAccess) {
+		// the PC has moved past the instruction, and none of
+		// the instructions that touch memory jump
+		a.PC = e.cpu.PC - 2
+		hook(a)
+	}
+}
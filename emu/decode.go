@@ -0,0 +1,137 @@
+package emu
+
+// decodedOp is an instruction decoded once, with its operands split out
+// and the handler that runs it, so that running it again skips decoding
+type decodedOp struct {
+	// run is nil until the instruction is decoded
+	run   opHandler
+	op    uint16
+	nnn   uint16
+	x, y  byte
+	n, kk byte
+}
+
+type opHandler func(e *Emulator, d *decodedOp)
+
+// decodeTable caches the decoded instruction at each address of RAM.
+// Memory.Write invalidates the entries a write overlaps, and code that
+// changes RAM directly, as debuggers and cheats do, calls Memory.Changed,
+// so running an instruction doesn't have to check it is still current.
+type decodeTable [RamSize]decodedOp
+
+// redecode decodes the instruction at addr into the table, for when
+// it hasn't been decoded since it last changed
+func (m *Memory) redecode(addr uint16) {
+	m.table[addr] = decode(m.Opcode(addr))
+}
+
+// invalidate drops the decoded instructions and blocks that include
+// the byte at addr
+func (m *Memory) invalidate(addr uint16) {
+	m.table[addr].run = nil
+	if addr > 0 {
+		m.table[addr-1].run = nil
+	}
+	if m.blocks != nil {
+		m.blocks.invalidate(addr)
+	}
+}
+
+// invalidateAll drops every decoded instruction and block, after all of RAM changes
+func (m *Memory) invalidateAll() {
+	m.table = decodeTable{}
+	if m.blocks != nil {
+		m.blocks = new(blockCache)
+	}
+}
+
+// Changed tells the memory that RAM was changed directly rather than
+// through Write, so that the instructions in it are decoded again
+// before they run. Debugger.Edit calls it after each edit.
+func (m *Memory) Changed() {
+	m.invalidateAll()
+}
+
+// decode splits an instruction into its operands and picks its handler
+func decode(instruction uint16) decodedOp {
+	d := decodedOp{
+		nnn: instruction & 0xFFF,
+		n:   byte(instruction & 0xF),
+		x:   byte(instruction & 0xF00 >> 8),
+		y:   byte(instruction & 0xF0 >> 4),
+		kk:  byte(instruction & 0xFF),
+		op:  instruction,
+	}
+	d.run = opHandlers[instruction>>12]
+	switch {
+	case instruction == 0x00E0:
+		d.run = func(e *Emulator, d *decodedOp) { e.op00E0() }
+	case instruction == 0x00EE:
+		d.run = func(e *Emulator, d *decodedOp) { e.op00EE() }
+	case instruction == 0x00FE:
+		d.run = func(e *Emulator, d *decodedOp) { e.op00FE() }
+	case instruction == 0x00FF:
+		d.run = func(e *Emulator, d *decodedOp) { e.op00FF() }
+	case instruction>>12 == 0x8:
+		d.run = aluHandlers[d.n]
+	case instruction>>12 == 0xE:
+		d.run = keyHandlers[d.kk]
+	case instruction>>12 == 0xF:
+		d.run = miscHandlers[d.kk]
+	}
+	if d.run == nil {
+		d.run = func(e *Emulator, d *decodedOp) { panicInstructionNotImplemented(d.op) }
+	}
+
+	return d
+}
+
+// opHandlers run the instructions by their first nibble, except for
+// 00E0, 00EE, 00FE and 00FF and the groups under 8, E and F
+var opHandlers = [16]opHandler{
+	0x0: func(e *Emulator, d *decodedOp) { e.op0nnn(d.nnn) },
+	0x1: func(e *Emulator, d *decodedOp) { e.op1nnn(d.nnn) },
+	0x2: func(e *Emulator, d *decodedOp) { e.op2nnn(d.nnn) },
+	0x3: func(e *Emulator, d *decodedOp) { e.op3xkk(d.x, d.kk) },
+	0x4: func(e *Emulator, d *decodedOp) { e.op4xkk(d.x, d.kk) },
+	0x5: func(e *Emulator, d *decodedOp) { e.op5xy0(d.x, d.y) },
+	0x6: func(e *Emulator, d *decodedOp) { e.op6xkk(d.x, d.kk) },
+	0x7: func(e *Emulator, d *decodedOp) { e.op7xkk(d.x, d.kk) },
+	0x9: func(e *Emulator, d *decodedOp) { e.op9xy0(d.x, d.y) },
+	0xA: func(e *Emulator, d *decodedOp) { e.opAnnn(d.nnn) },
+	0xB: func(e *Emulator, d *decodedOp) { e.opBnnn(d.nnn) },
+	0xC: func(e *Emulator, d *decodedOp) { e.opCxkk(d.x, d.kk) },
+	0xD: func(e *Emulator, d *decodedOp) { e.opDxyn(d.x, d.y, d.n) },
+}
+
+// aluHandlers run 8xyn by n
+var aluHandlers = [16]opHandler{
+	0x0: func(e *Emulator, d *decodedOp) { e.op8xy0(d.x, d.y) },
+	0x1: func(e *Emulator, d *decodedOp) { e.op8xy1(d.x, d.y) },
+	0x2: func(e *Emulator, d *decodedOp) { e.op8xy2(d.x, d.y) },
+	0x3: func(e *Emulator, d *decodedOp) { e.op8xy3(d.x, d.y) },
+	0x4: func(e *Emulator, d *decodedOp) { e.op8xy4(d.x, d.y) },
+	0x5: func(e *Emulator, d *decodedOp) { e.op8xy5(d.x, d.y) },
+	0x6: func(e *Emulator, d *decodedOp) { e.op8xy6(d.x, d.y) },
+	0x7: func(e *Emulator, d *decodedOp) { e.op8xy7(d.x, d.y) },
+	0xE: func(e *Emulator, d *decodedOp) { e.op8xyE(d.x, d.y) },
+}
+
+// keyHandlers run Exkk by kk
+var keyHandlers = [256]opHandler{
+	0x9E: func(e *Emulator, d *decodedOp) { e.opEx9E(d.x) },
+	0xA1: func(e *Emulator, d *decodedOp) { e.opExA1(d.x) },
+}
+
+// miscHandlers run Fxkk by kk
+var miscHandlers = [256]opHandler{
+	0x07: func(e *Emulator, d *decodedOp) { e.opFx07(d.x) },
+	0x0A: func(e *Emulator, d *decodedOp) { e.opFx0A(d.x) },
+	0x15: func(e *Emulator, d *decodedOp) { e.opFx15(d.x) },
+	0x18: func(e *Emulator, d *decodedOp) { e.opFx18(d.x) },
+	0x1E: func(e *Emulator, d *decodedOp) { e.opFx1E(d.x) },
+	0x29: func(e *Emulator, d *decodedOp) { e.opFx29(d.x) },
+	0x33: func(e *Emulator, d *decodedOp) { e.opFx33(d.x) },
+	0x55: func(e *Emulator, d *decodedOp) { e.opFx55(d.x) },
+	0x65: func(e *Emulator, d *decodedOp) { e.opFx65(d.x) },
+}
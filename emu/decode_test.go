@@ -0,0 +1,104 @@
+package emu
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var benchmarkROMs = []string{"BRIX", "PONG2", "TETRIS", "UFO"}
+
+// runCycles runs frames of 10 instructions with no keys held,
+// running each instruction with cycle
+func runCycles(e *Emulator, frames int, cycle func()) {
+	for f := 0; f < frames; f++ {
+		for c := 0; c < 10; c++ {
+			cycle()
+		}
+		e.EndFrame()
+	}
+}
+
+func TestDecodedMatchesInterpreter(t *testing.T) {
+	for _, name := range benchmarkROMs {
+		decoded := &Emulator{Seed: 1}
+		decoded.Setup("../games/" + name + ".ch8")
+		interpreted := &Emulator{Seed: 1}
+		interpreted.Setup("../games/" + name + ".ch8")
+
+		runCycles(decoded, 600, decoded.EmulateCycle)
+		runCycles(interpreted, 600, interpreted.interpretCycle)
+		if !reflect.DeepEqual(decoded.Save(), interpreted.Save()) {
+			t.Errorf("%s: expected the decoded instructions to run as the interpreter does", name)
+		}
+	}
+}
+
+func TestDecodeInvalidation(t *testing.T) {
+	e := &Emulator{Seed: 1}
+	e.SetupROM([]byte{
+		0x60, 0x12, // 200 LD V0, 0x12
+		0x61, 0x0A, // 202 LD V1, 0x0A
+		0xA2, 0x0A, // 204 LD I, 0x20A
+		0xF1, 0x55, // 206 LD [I], V1
+		0x63, 0x01, // 208 LD V3, 0x01
+		0x63, 0x05, // 20A LD V3, 0x05
+		0x12, 0x0C, // 20C JP 0x20C
+	})
+	// decode the instruction the store replaces with JP 0x20A
+	e.memory.redecode(0x20A)
+
+	for i := 0; i < 8; i++ {
+		e.EmulateCycle()
+	}
+	if e.cpu.PC != 0x20A || e.cpu.V[3] != 1 {
+		t.Errorf("Expected the store to leave a loop at 0x20A but PC was 0x%03X and V3 %d", e.cpu.PC, e.cpu.V[3])
+	}
+
+	// changing RAM directly is seen once the memory is told, as Debugger.Edit does
+	e.memory.RAM[0x20A], e.memory.RAM[0x20B] = 0x63, 0x05
+	e.memory.Changed()
+	e.EmulateCycle()
+	if e.cpu.PC != 0x20C || e.cpu.V[3] != 5 {
+		t.Errorf("Expected LD V3, 0x05 to run after the RAM changed but PC was 0x%03X and V3 %d", e.cpu.PC, e.cpu.V[3])
+	}
+}
+
+// benchmarkInstructions is how many instructions each iteration of
+// a benchmark runs from the start of a game, so that every benchmark
+// of a game runs the same instructions whatever b.N is
+const benchmarkInstructions = 10000
+
+// benchmarkCycles reports how many instructions a second each game runs
+// at, with the timers ticking every 10 instructions
+func benchmarkCycles(b *testing.B, cycle func(e *Emulator) func()) {
+	for _, name := range benchmarkROMs {
+		b.Run(name, func(b *testing.B) {
+			e := &Emulator{Seed: 1}
+			e.Setup("../games/" + name + ".ch8")
+			state := e.Save()
+			run := cycle(e)
+			b.ResetTimer()
+			var elapsed time.Duration
+			for i := 0; i < b.N; i++ {
+				// restoring reseeds the generator, which would be timed
+				// as the instructions' own cost
+				b.StopTimer()
+				e.Restore(state)
+				b.StartTimer()
+				start := time.Now()
+				runCycles(e, benchmarkInstructions/10, run)
+				elapsed += time.Since(start)
+			}
+			b.ReportMetric(float64(b.N)*benchmarkInstructions/elapsed.Seconds(), "instructions/s")
+		})
+	}
+}
+
+func BenchmarkEmulateCycle(b *testing.B) {
+	benchmarkCycles(b, func(e *Emulator) func() { return e.EmulateCycle })
+}
+
+func BenchmarkInterpretCycle(b *testing.B) {
+	benchmarkCycles(b, func(e *Emulator) func() { return e.interpretCycle })
+}
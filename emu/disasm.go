@@ -0,0 +1,178 @@
+package emu
+
+import (
+	"fmt"
+	"io"
+)
+
+// Disassemble returns the Cowgod-style mnemonic for an instruction,
+// or a DW data directive when the instruction is not recognised.
+func Disassemble(instruction uint16) string {
+	nnn := instruction & 0xFFF
+	n := instruction & 0xF
+	x := instruction & 0xF00 >> 8
+	y := instruction & 0xF0 >> 4
+	kk := instruction & 0xFF
+
+	switch instruction {
+	case 0x00E0:
+		return "CLS"
+	case 0x00EE:
+		return "RET"
+	case 0x00FE:
+		return "LOW"
+	case 0x00FF:
+		return "HIGH"
+	}
+
+	switch instruction >> 12 {
+	case 0x0:
+		return fmt.Sprintf("SYS 0x%03X", nnn)
+	case 0x1:
+		return fmt.Sprintf("JP 0x%03X", nnn)
+	case 0x2:
+		return fmt.Sprintf("CALL 0x%03X", nnn)
+	case 0x3:
+		return fmt.Sprintf("SE V%X, 0x%02X", x, kk)
+	case 0x4:
+		return fmt.Sprintf("SNE V%X, 0x%02X", x, kk)
+	case 0x5:
+		if n == 0 {
+			return fmt.Sprintf("SE V%X, V%X", x, y)
+		}
+	case 0x6:
+		return fmt.Sprintf("LD V%X, 0x%02X", x, kk)
+	case 0x7:
+		return fmt.Sprintf("ADD V%X, 0x%02X", x, kk)
+	case 0x8:
+		switch n {
+		case 0x0:
+			return fmt.Sprintf("LD V%X, V%X", x, y)
+		case 0x1:
+			return fmt.Sprintf("OR V%X, V%X", x, y)
+		case 0x2:
+			return fmt.Sprintf("AND V%X, V%X", x, y)
+		case 0x3:
+			return fmt.Sprintf("XOR V%X, V%X", x, y)
+		case 0x4:
+			return fmt.Sprintf("ADD V%X, V%X", x, y)
+		case 0x5:
+			return fmt.Sprintf("SUB V%X, V%X", x, y)
+		case 0x6:
+			return fmt.Sprintf("SHR V%X, V%X", x, y)
+		case 0x7:
+			return fmt.Sprintf("SUBN V%X, V%X", x, y)
+		case 0xE:
+			return fmt.Sprintf("SHL V%X, V%X", x, y)
+		}
+	case 0x9:
+		if n == 0 {
+			return fmt.Sprintf("SNE V%X, V%X", x, y)
+		}
+	case 0xA:
+		return fmt.Sprintf("LD I, 0x%03X", nnn)
+	case 0xB:
+		return fmt.Sprintf("JP V0, 0x%03X", nnn)
+	case 0xC:
+		return fmt.Sprintf("RND V%X, 0x%02X", x, kk)
+	case 0xD:
+		return fmt.Sprintf("DRW V%X, V%X, %d", x, y, n)
+	case 0xE:
+		switch kk {
+		case 0x9E:
+			return fmt.Sprintf("SKP V%X", x)
+		case 0xA1:
+			return fmt.Sprintf("SKNP V%X", x)
+		}
+	case 0xF:
+		switch kk {
+		case 0x07:
+			return fmt.Sprintf("LD V%X, DT", x)
+		case 0x0A:
+			return fmt.Sprintf("LD V%X, K", x)
+		case 0x15:
+			return fmt.Sprintf("LD DT, V%X", x)
+		case 0x18:
+			return fmt.Sprintf("LD ST, V%X", x)
+		case 0x1E:
+			return fmt.Sprintf("ADD I, V%X", x)
+		case 0x29:
+			return fmt.Sprintf("LD F, V%X", x)
+		case 0x33:
+			return fmt.Sprintf("LD B, V%X", x)
+		case 0x55:
+			return fmt.Sprintf("LD [I], V%X", x)
+		case 0x65:
+			return fmt.Sprintf("LD V%X, [I]", x)
+		}
+	}
+
+	return fmt.Sprintf("DW 0x%04X", instruction)
+}
+
+// OpcodeClass names the form of an instruction as the specifications
+// write it, such as 8xy4 or Fx0A, or returns DW when it isn't one
+func OpcodeClass(instruction uint16) string {
+	switch instruction {
+	case 0x00E0:
+		return "00E0"
+	case 0x00EE:
+		return "00EE"
+	case 0x00FE:
+		return "00FE"
+	case 0x00FF:
+		return "00FF"
+	}
+
+	op, n, kk := instruction>>12, instruction&0xF, instruction&0xFF
+	switch op {
+	case 0x0:
+		return "0nnn"
+	case 0x1, 0x2, 0xA, 0xB:
+		return fmt.Sprintf("%Xnnn", op)
+	case 0x3, 0x4, 0x6, 0x7, 0xC:
+		return fmt.Sprintf("%Xxkk", op)
+	case 0x5, 0x9:
+		if n == 0 {
+			return fmt.Sprintf("%Xxy0", op)
+		}
+	case 0x8:
+		if n <= 0x7 || n == 0xE {
+			return fmt.Sprintf("8xy%X", n)
+		}
+	case 0xD:
+		return "Dxyn"
+	case 0xE:
+		if kk == 0x9E || kk == 0xA1 {
+			return fmt.Sprintf("Ex%02X", kk)
+		}
+	case 0xF:
+		switch kk {
+		case 0x07, 0x0A, 0x15, 0x18, 0x1E, 0x29, 0x33, 0x55, 0x65:
+			return fmt.Sprintf("Fx%02X", kk)
+		}
+	}
+
+	return "DW"
+}
+
+// WriteListing writes a linear disassembly of a ROM loaded at RamProgramStart,
+// one instruction per line with its address and raw bytes.
+func WriteListing(w io.Writer, rom []byte) error {
+	for i := 0; i < len(rom); i += 2 {
+		addr := RamProgramStart + i
+		if i+1 == len(rom) {
+			if _, err := fmt.Fprintf(w, "%03X  %02X    DB 0x%02X\n", addr, rom[i], rom[i]); err != nil {
+				return err
+			}
+			break
+		}
+
+		instruction := uint16(rom[i])<<8 | uint16(rom[i+1])
+		if _, err := fmt.Fprintf(w, "%03X  %04X  %s\n", addr, instruction, Disassemble(instruction)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package emu
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	tests := map[uint16]string{
+		0x00E0: "CLS",
+		0x00EE: "RET",
+		0x00FF: "HIGH",
+		0x1234: "JP 0x234",
+		0x2ABC: "CALL 0xABC",
+		0x3A0F: "SE VA, 0x0F",
+		0x8126: "SHR V1, V2",
+		0x8128: "DW 0x8128",
+		0xD125: "DRW V1, V2, 5",
+		0xE39E: "SKP V3",
+		0xF455: "LD [I], V4",
+		0xFF99: "DW 0xFF99",
+	}
+
+	for instruction, expected := range tests {
+		if actual := Disassemble(instruction); actual != expected {
+			t.Errorf("Expected %04X to disassemble as %q but was %q", instruction, expected, actual)
+		}
+	}
+}
+
+func TestOpcodeClass(t *testing.T) {
+	tests := map[uint16]string{
+		0x00E0: "00E0",
+		0x00FE: "00FE",
+		0x0123: "0nnn",
+		0x2ABC: "2nnn",
+		0x3A0F: "3xkk",
+		0x5120: "5xy0",
+		0x5121: "DW",
+		0x812E: "8xyE",
+		0x8128: "DW",
+		0xD125: "Dxyn",
+		0xE3A1: "ExA1",
+		0xF40A: "Fx0A",
+		0xFF99: "DW",
+	}
+
+	for instruction, expected := range tests {
+		if actual := OpcodeClass(instruction); actual != expected {
+			t.Errorf("Expected %04X to be %q but was %q", instruction, expected, actual)
+		}
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteListing(&buf, []byte{0x00, 0xE0, 0x12, 0x00, 0xAB}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "200  00E0  CLS\n202  1200  JP 0x200\n204  AB    DB 0xAB\n"
+	if buf.String() != expected {
+		t.Errorf("Expected listing\n%s\nbut was\n%s", expected, buf.String())
+	}
+}
@@ -1,44 +1,270 @@
 package emu
 
+import (
+	"image"
+	"image/color"
+)
+
+// Display is the screen as bit planes, a bit per pixel in each, so that
+// a row of a sprite is drawn with a shift and an XOR
 type Display struct {
-	Pixels [ScreenWidthPx][ScreenHeightPx]byte
+	// Planes hold the pixels. A pixel's value has its bit from plane 0 as
+	// the lowest bit, as XO-CHIP draws in colour with both; CHIP-8 only
+	// draws to plane 0.
+	Planes [DisplayPlanes]Plane
 	Draw   bool
+	// Clip drops sprite pixels past the screen edges instead of wrapping them
+	Clip bool
+	// Hires doubles the resolution to HiresWidthPx by HiresHeightPx,
+	// as SCHIP and XO-CHIP programs can
+	Hires bool
 }
 
 const (
 	ScreenWidthPx  = 64
 	ScreenHeightPx = 32
 
+	// HiresWidthPx and HiresHeightPx are the size of the display in hires
+	// mode, which a Plane has room for
+	HiresWidthPx  = 128
+	HiresHeightPx = 64
+	// DisplayPlanes is how many bit planes the display has
+	DisplayPlanes = 2
+
 	SpriteWidthPx       = 8
 	PixelFontByteLength = 5
 )
 
-func (d *Display) Clear() {
-	for x := 0; x < ScreenWidthPx; x++ {
-		for y := 0; y < ScreenHeightPx; y++ {
-			d.Pixels[x][y] = 0
+// Row is a line of up to 128 pixels as a 128-bit number, a bit per pixel
+// with the leftmost pixel in the top bit of Row[0]
+type Row [2]uint64
+
+// shiftRight moves the pixels n places to the right, dropping those
+// that go past the end of the row
+func (r Row) shiftRight(n uint) Row {
+	switch {
+	case n == 0:
+		return r
+	case n >= 128:
+		return Row{}
+	case n >= 64:
+		return Row{0, r[0] >> (n - 64)}
+	}
+
+	return Row{r[0] >> n, r[1]>>n | r[0]<<(64-n)}
+}
+
+// shiftLeft moves the pixels n places to the left, dropping those
+// that go past the start of the row
+func (r Row) shiftLeft(n uint) Row {
+	switch {
+	case n == 0:
+		return r
+	case n >= 128:
+		return Row{}
+	case n >= 64:
+		return Row{r[1] << (n - 64), 0}
+	}
+
+	return Row{r[0]<<n | r[1]>>(64-n), r[1] << n}
+}
+
+func (r Row) and(o Row) Row {
+	return Row{r[0] & o[0], r[1] & o[1]}
+}
+
+func (r Row) or(o Row) Row {
+	return Row{r[0] | o[0], r[1] | o[1]}
+}
+
+func (r Row) xor(o Row) Row {
+	return Row{r[0] ^ o[0], r[1] ^ o[1]}
+}
+
+// Bit reports whether pixel x of the row is set
+func (r Row) Bit(x int) bool {
+	return r[x/64]>>(63-uint(x%64))&1 != 0
+}
+
+// Plane is one bit plane of the display, a Row for each line
+type Plane [HiresHeightPx]Row
+
+// Bytes packs the top left width by height pixels of the plane a bit per
+// pixel, a row at a time with the leftmost pixel in the top bit, as
+// sprites are stored in memory. width is rounded up to a whole byte.
+func (p *Plane) Bytes(width, height int) []byte {
+	stride := (width + 7) / 8
+	b := make([]byte, 0, stride*height)
+	for y := 0; y < height; y++ {
+		for i := 0; i < stride; i++ {
+			b = append(b, byte(p[y][i/8]>>(56-8*uint(i%8))))
 		}
 	}
+
+	return b
+}
+
+func (d *Display) Clear() {
+	d.Planes = [DisplayPlanes]Plane{}
 }
 
 // Sprites are XORed onto the existing screen.
 // Returns true if any pixels were erased, false otherwise
 func (d *Display) DrawSprite(x byte, y byte, row byte) bool {
+	rows := [1]uint16{uint16(row) << 8}
+	return d.DrawRows(0, int(x), int(y), rows[:], SpriteWidthPx)
+}
+
+// DrawRows XORs the rows of a sprite, the top width bits of each, onto
+// a plane with its top left pixel at (x, y), wrapping it around the
+// screen's edges or clipping it there if Clip is set. SCHIP's 16 pixel
+// wide sprites are drawn with a width of 16. The shifts and mask are
+// worked out once for the sprite, then each row is a shift and an XOR.
+// It returns true if any pixels were erased.
+func (d *Display) DrawRows(plane, x, y int, rows []uint16, width int) bool {
+	w, h := d.Width(), d.Height()
+	x, y = x%w, y%h
+	keep := uint16(0xFFFF) << uint(16-width)
+	p := &d.Planes[plane]
 	erased := false
-	yIndex := y % ScreenHeightPx
 
-	for i := x; i < x+8; i++ {
-		xIndex := i % ScreenWidthPx
+	if !d.Hires {
+		// the whole row fits in the first word, and shifting by 64
+		// gives 0, so there is nothing to wrap when x is 0
+		for i, bits := range rows {
+			line := y + i
+			if line >= h {
+				if d.Clip {
+					break
+				}
+				line -= h
+			}
+			sprite := uint64(bits&keep) << 48
+			drawn := sprite >> uint(x)
+			if !d.Clip {
+				drawn |= sprite << uint(w-x)
+			}
 
-		wasSet := d.Pixels[xIndex][yIndex] == 1
-		value := row >> (x + 8 - i - 1) & 1
+			r := &p[line][0]
+			erased = erased || *r&drawn != 0
+			*r ^= drawn
+		}
 
-		d.Pixels[xIndex][yIndex] ^= value
+		return erased
+	}
 
-		if wasSet && d.Pixels[xIndex][yIndex] == 0 {
-			erased = true
+	for i, bits := range rows {
+		line := y + i
+		if line >= h {
+			if d.Clip {
+				break
+			}
+			line -= h
+		}
+		sprite := Row{uint64(bits&keep) << 48}
+		drawn := sprite.shiftRight(uint(x))
+		if !d.Clip {
+			drawn = drawn.or(sprite.shiftLeft(uint(w - x)))
 		}
+
+		r := &p[line]
+		erased = erased || r.and(drawn) != Row{}
+		*r = r.xor(drawn)
 	}
 
 	return erased
 }
+
+// Pixel is the value of the pixel at (x, y), a bit from each plane
+func (d *Display) Pixel(x, y int) byte {
+	var v byte
+	for i := range d.Planes {
+		if d.Planes[i][y].Bit(x) {
+			v |= 1 << uint(i)
+		}
+	}
+
+	return v
+}
+
+// SetPixel sets the pixel at (x, y) to a value, a bit for each plane
+func (d *Display) SetPixel(x, y int, v byte) {
+	bit := Row{1 << 63}.shiftRight(uint(x))
+	for i := range d.Planes {
+		r := &d.Planes[i][y]
+		if v&(1<<uint(i)) != 0 {
+			*r = r.or(bit)
+		} else {
+			*r = r.and(Row{^bit[0], ^bit[1]})
+		}
+	}
+}
+
+// ReadRow fills values with the value of each pixel of line y, as Pixel
+// gives them, so that the display can be drawn a row at a time.
+// values must be at least Width long.
+func (d *Display) ReadRow(y int, values []byte) {
+	values = values[:d.Width()]
+	for i := range d.Planes {
+		r := &d.Planes[i][y]
+		if i > 0 && *r == (Row{}) {
+			continue
+		}
+		for w := 0; w < len(values); w += 64 {
+			word, pixels := r[w/64], values[w:w+64]
+			if i == 0 {
+				for x := range pixels {
+					pixels[x] = byte(word >> 63)
+					word <<= 1
+				}
+				continue
+			}
+			for x := range pixels {
+				pixels[x] |= byte(word>>63) << uint(i)
+				word <<= 1
+			}
+		}
+	}
+}
+
+// Bytes returns the value of each pixel as Pixel gives it, a row at a time
+// from the top left
+func (d *Display) Bytes() []byte {
+	w, h := d.Width(), d.Height()
+	b := make([]byte, w*h)
+	for y := 0; y < h; y++ {
+		d.ReadRow(y, b[y*w:])
+	}
+
+	return b
+}
+
+// Image returns the display as an image a pixel per display pixel,
+// coloured from the palette by each pixel's value
+func (d *Display) Image(p color.Palette) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, d.Width(), d.Height()), p)
+	copy(img.Pix, d.Bytes())
+
+	return img
+}
+
+// Width of the display in pixels.
+// Frontends should size their output from Width and Height,
+// which double when a game switches to hires with 00FF
+// and go back with 00FE.
+func (d *Display) Width() int {
+	if d.Hires {
+		return HiresWidthPx
+	}
+
+	return ScreenWidthPx
+}
+
+// Height of the display in pixels
+func (d *Display) Height() int {
+	if d.Hires {
+		return HiresHeightPx
+	}
+
+	return ScreenHeightPx
+}
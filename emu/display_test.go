@@ -0,0 +1,118 @@
+package emu
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+)
+
+// rowString draws a line of the display's first plane as # and .
+func rowString(d *Display, y int) string {
+	line := make([]byte, d.Width())
+	for x := range line {
+		line[x] = '.'
+		if d.Planes[0][y].Bit(x) {
+			line[x] = '#'
+		}
+	}
+
+	return string(line)
+}
+
+func TestDrawSprite(t *testing.T) {
+	d := new(Display)
+	if d.DrawSprite(2, 1, 0xF0) {
+		t.Errorf("Expected drawing on a clear screen not to erase anything")
+	}
+	if !d.DrawSprite(4, 1, 0xC3) {
+		t.Errorf("Expected drawing over pixels to erase them")
+	}
+	if want := "..##......##" + string(bytes.Repeat([]byte{'.'}, 52)); rowString(d, 1) != want {
+		t.Errorf("Expected the sprites XORed together but got %s", rowString(d, 1))
+	}
+
+	// y wraps as well as x
+	d.Clear()
+	d.DrawSprite(60, ScreenHeightPx+3, 0xFF)
+	if want := "####" + string(bytes.Repeat([]byte{'.'}, 56)) + "####"; rowString(d, 3) != want {
+		t.Errorf("Expected the sprite to wrap around the right edge but got %s", rowString(d, 3))
+	}
+
+	d.Clear()
+	d.Clip = true
+	d.DrawSprite(60, 3, 0xFF)
+	if want := string(bytes.Repeat([]byte{'.'}, 60)) + "####"; rowString(d, 3) != want {
+		t.Errorf("Expected the sprite to be clipped at the right edge but got %s", rowString(d, 3))
+	}
+}
+
+func TestDrawRowsBottomEdge(t *testing.T) {
+	rows := []uint16{0x8000, 0x4000, 0x2000, 0x1000}
+	d := new(Display)
+	d.DrawRows(0, 0, ScreenHeightPx-2, rows, SpriteWidthPx)
+	for y, x := range map[int]int{30: 0, 31: 1, 0: 2, 1: 3} {
+		if d.Pixel(x, y) != 1 {
+			t.Errorf("Expected the sprite to wrap to the top, setting (%d, %d)", x, y)
+		}
+	}
+
+	d.Clear()
+	d.Clip = true
+	if d.DrawRows(0, 0, ScreenHeightPx-2, rows, SpriteWidthPx); d.Planes[0][0] != (Row{}) || d.Planes[0][1] != (Row{}) {
+		t.Errorf("Expected the sprite to be clipped at the bottom edge")
+	}
+}
+
+func TestDrawRowsHires(t *testing.T) {
+	d := &Display{Hires: true}
+	if d.Width() != HiresWidthPx || d.Height() != HiresHeightPx {
+		t.Fatalf("Expected a %dx%d hires display but was %dx%d", HiresWidthPx, HiresHeightPx, d.Width(), d.Height())
+	}
+
+	// a 16 pixel SCHIP row across the middle and around the right edge
+	d.DrawRows(0, 56, 40, []uint16{0xFFFF}, 16)
+	d.DrawRows(0, 120, 40, []uint16{0x8001}, 16)
+	dots := string(bytes.Repeat([]byte{'.'}, 48))
+	want := ".......#" + dots + "################" + dots + "#......."
+	if rowString(d, 40) != want {
+		t.Errorf("Expected the rows to cross the words and wrap but got\n%s\nwant\n%s", rowString(d, 40), want)
+	}
+}
+
+func TestPlanes(t *testing.T) {
+	d := new(Display)
+	d.DrawRows(0, 0, 0, []uint16{0xC000}, 8)
+	d.DrawRows(1, 1, 0, []uint16{0xC000}, 8)
+	for x, want := range []byte{1, 3, 2, 0} {
+		if v := d.Pixel(x, 0); v != want {
+			t.Errorf("Expected pixel %d to be %d but was %d", x, want, v)
+		}
+	}
+
+	d.SetPixel(1, 0, 0)
+	d.SetPixel(63, 31, 2)
+	if d.Pixel(1, 0) != 0 || d.Pixel(63, 31) != 2 || d.Planes[0][31] != (Row{}) {
+		t.Errorf("Expected SetPixel to set each plane's bit")
+	}
+
+	if b := d.Planes[1].Bytes(16, 1); !bytes.Equal(b, []byte{0x20, 0x00}) {
+		t.Errorf("Expected plane 1's first row packed as 20 00 but got % X", b)
+	}
+	b := d.Bytes()
+	if len(b) != ScreenWidthPx*ScreenHeightPx || b[0] != 1 || b[2] != 2 || b[len(b)-1] != 2 {
+		t.Errorf("Expected a byte for each pixel's value")
+	}
+
+	palette := color.Palette{color.Black, color.White, color.Gray{0x40}, color.Gray{0x80}}
+	img := d.Image(palette)
+	if img.Bounds().Dx() != ScreenWidthPx || img.At(2, 0) != palette[2] {
+		t.Errorf("Expected the image coloured by each pixel's value")
+	}
+}
+
+func BenchmarkDrawSprite(b *testing.B) {
+	d := new(Display)
+	for i := 0; i < b.N; i++ {
+		d.DrawSprite(byte(i%ScreenWidthPx), byte(i%ScreenHeightPx), byte(i))
+	}
+}
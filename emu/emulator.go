@@ -3,18 +3,52 @@ package emu
 import (
 	"fmt"
 	"math/rand"
-
-	"github.com/hajimehoshi/ebiten/audio"
+	"time"
 )
 
 type Emulator struct {
-	cpu         *CPU
-	memory      *Memory
-	Display     *Display
-	Input       *Input
-	AudioPlayer *audio.Player
+	cpu     *CPU
+	memory  *Memory
+	Display *Display
+	Input   *Input
+	// Beeper plays while the sound timer is running.
+	// Setup makes a default one if it is nil.
+	Beeper *Beeper
+
+	// Quirks must be set before Setup is called
+	Quirks Quirks
+	// Engine runs RunFrame's instructions; it must be set before Setup
+	// is called too
+	Engine Engine
+	// Compiled is a ROM recompiled ahead of time, whose blocks RunFrame
+	// runs in place of the Engine while the emulator is set up with that
+	// ROM. It must be set before Setup is called.
+	Compiled *CompiledProgram
+	// Seed for the random number generator used by Cxkk.
+	// Zero seeds it from the current time.
+	Seed int64
+	// Cheats are written as each frame starts
+	Cheats []Cheat
+
+	rng *rand.Rand
+	// rngSeed and rngDraws let State recreate the generator, whose state can't be copied
+	rngSeed  int64
+	rngDraws int64
 
 	waitingForInputRegisterOffset byte
+
+	// compiled is Compiled if it was compiled from the ROM set up,
+	// and compiledCycle the frame cycle its running block started on
+	compiled      *CompiledProgram
+	compiledCycle int
+
+	// frame state for RunFrame
+	previousKeys Keys
+	justPressed  Keys
+	frameCycle   int
+	frameCycles  int
+	gateOn       bool
+	gateChanges  []GateChange
 }
 
 func (e *Emulator) SoundEnabled() bool {
@@ -22,23 +56,53 @@ func (e *Emulator) SoundEnabled() bool {
 }
 
 func (e *Emulator) Setup(romFilename string) {
+	rom, err := ReadROM(romFilename)
+	if err != nil {
+		panic(err)
+	}
+
+	e.SetupROM(rom)
+}
+
+// SetupROM resets the emulator with a ROM already read into memory
+func (e *Emulator) SetupROM(rom []byte) {
 	// cpu
 	e.cpu = new(CPU)
 	e.cpu.Setup()
 
 	// memory
 	e.memory = new(Memory)
+	if e.Engine == EngineBlocks {
+		e.memory.blocks = new(blockCache)
+	}
 	e.memory.Setup()
-	e.memory.LoadGame(romFilename)
+	e.memory.LoadROM(rom)
+	e.compiled = nil
+	if e.Compiled != nil && e.Compiled.hash == HashROM(rom) {
+		e.compiled = e.Compiled
+	}
 
 	// display
 	e.Display = new(Display)
+	e.Display.Clip = e.Quirks.ClipSprites
+
+	// random number generator
+	seed := e.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	e.rng = rand.New(rand.NewSource(seed))
+	e.rngSeed = seed
+	e.rngDraws = 0
 
 	// input
 	e.Input = new(Input)
 
 	// audio
-	e.AudioPlayer = NewAudioPlayer()
+	if e.Beeper == nil {
+		e.Beeper = NewBeeper(DefaultBeeperSettings())
+	}
+	e.Beeper.SetGate(false)
 }
 
 func (e *Emulator) CatchInput(keyIndex byte) {
@@ -46,6 +110,9 @@ func (e *Emulator) CatchInput(keyIndex byte) {
 	e.Input.WaitingForInput = false
 }
 
+// EmulateCycle runs the instruction at the PC, unless the emulator is
+// waiting for a key. Instructions are decoded once and cached by address,
+// so running them again goes straight to their handlers.
 func (e *Emulator) EmulateCycle() {
 	// LD Vx, K
 	// Blocks execution until input is received
@@ -53,8 +120,29 @@ func (e *Emulator) EmulateCycle() {
 		return
 	}
 
+	// looked up here rather than in a Memory method, which is too large
+	// for the compiler to inline
+	pc := e.cpu.PC
+	d := &e.memory.table[pc]
+	if d.run == nil {
+		e.memory.redecode(pc)
+	}
+	e.cpu.PC = pc + 2
+	d.run(e, d)
+}
+
+// interpretCycle is EmulateCycle decoding each instruction as it runs,
+// as the emulator used to, kept to check and benchmark the decoded
+// instructions against
+func (e *Emulator) interpretCycle() {
+	// LD Vx, K
+	// Blocks execution until input is received
+	if e.Input.WaitingForInput {
+		return
+	}
+
 	// Fetch instruction at program counter
-	var instruction uint16 = (uint16(e.memory.RAM[e.cpu.PC]) << 8) | uint16(e.memory.RAM[e.cpu.PC+1])
+	instruction := e.memory.Opcode(e.cpu.PC)
 
 	// Advance program counter
 	e.cpu.PC += 2
@@ -72,6 +160,10 @@ func (e *Emulator) EmulateCycle() {
 		e.op00E0()
 	case 0x00EE:
 		e.op00EE()
+	case 0x00FE:
+		e.op00FE()
+	case 0x00FF:
+		e.op00FF()
 	default:
 		switch byte(instruction & 0xF000 >> 12) {
 		case 0x0:
@@ -161,6 +253,14 @@ func (e *Emulator) EmulateCycle() {
 	}
 }
 
+// updateGate starts or stops the beeper when the sound timer does
+func (e *Emulator) updateGate() {
+	if on := e.SoundEnabled(); on != e.gateOn {
+		e.gateOn = on
+		e.setGate(on)
+	}
+}
+
 func (e *Emulator) UpdateDelayTimer() {
 	if e.cpu.DelayTimer > 0 {
 		e.cpu.DelayTimer--
@@ -170,6 +270,7 @@ func (e *Emulator) UpdateDelayTimer() {
 func (e *Emulator) UpdateSoundTimer() {
 	if e.cpu.SoundTimer > 0 {
 		e.cpu.SoundTimer--
+		e.updateGate()
 	}
 }
 
@@ -179,6 +280,20 @@ func (e *Emulator) op00E0() {
 	e.Display.Clear()
 }
 
+// 00FE - LOW
+// Switch to the 64x32 display, clearing it. SCHIP.
+func (e *Emulator) op00FE() {
+	e.Display.Hires = false
+	e.Display.Clear()
+}
+
+// 00FF - HIGH
+// Switch to the 128x64 display, clearing it. SCHIP.
+func (e *Emulator) op00FF() {
+	e.Display.Hires = true
+	e.Display.Clear()
+}
+
 // 00EE - RET
 // Return from a subroutine.
 // The interpreter sets the program counter to the address at the top of
@@ -273,6 +388,7 @@ func (e *Emulator) op8xy0(x, y byte) {
 // also 1. Otherwise, it is 0.
 func (e *Emulator) op8xy1(x, y byte) {
 	e.cpu.V[x] |= e.cpu.V[y]
+	e.resetVF()
 }
 
 // 8xy2 - AND Vx, Vy
@@ -283,6 +399,7 @@ func (e *Emulator) op8xy1(x, y byte) {
 // Otherwise, it is 0.
 func (e *Emulator) op8xy2(x, y byte) {
 	e.cpu.V[x] &= e.cpu.V[y]
+	e.resetVF()
 }
 
 // 8xy3 - XOR Vx, Vy
@@ -293,6 +410,14 @@ func (e *Emulator) op8xy2(x, y byte) {
 // corresponding bit in the result is set to 1. Otherwise, it is 0.
 func (e *Emulator) op8xy3(x, y byte) {
 	e.cpu.V[x] ^= e.cpu.V[y]
+	e.resetVF()
+}
+
+// The COSMAC VIP logic instructions clobber VF as a side effect
+func (e *Emulator) resetVF() {
+	if e.Quirks.LogicResetsVF {
+		e.cpu.V[0xF] = 0
+	}
 }
 
 // 8xy4 - ADD Vx, Vy
@@ -304,7 +429,7 @@ func (e *Emulator) op8xy4(x, y byte) {
 	sum := uint16(e.cpu.V[x]) + uint16(e.cpu.V[y])
 
 	var overflowStatus byte
-	if sum > 0xFFFF {
+	if sum > 0xFF {
 		overflowStatus = 1
 	}
 	e.cpu.V[0xF] = overflowStatus
@@ -331,9 +456,12 @@ func (e *Emulator) op8xy5(x, y byte) {
 // If the least-significant bit of Vx is 1, then VF is set to 1, otherwise 0.
 // Then Vx is divided by 2.
 func (e *Emulator) op8xy6(x, y byte) {
+	if e.Quirks.ShiftUsesVy {
+		e.cpu.V[x] = e.cpu.V[y]
+	}
 
 	var lsbIsOne byte
-	if (e.cpu.V[x] & 0xF) == 1 {
+	if (e.cpu.V[x] & 0x1) == 1 {
 		lsbIsOne = 1
 	}
 	e.cpu.V[0xF] = lsbIsOne
@@ -360,6 +488,10 @@ func (e *Emulator) op8xy7(x, y byte) {
 // If the most-significant bit of Vx is 1, then VF is set to 1,
 // otherwise to 0. Then Vx is multiplied by 2.
 func (e *Emulator) op8xyE(x, y byte) {
+	if e.Quirks.ShiftUsesVy {
+		e.cpu.V[x] = e.cpu.V[y]
+	}
+
 	var msbIsOne byte
 	if (e.cpu.V[x] >> 7) == 1 {
 		msbIsOne = 1
@@ -390,7 +522,12 @@ func (e *Emulator) opAnnn(addr uint16) {
 // Jump to location nnn + V0.
 // The program counter is set to nnn plus the value of V0.
 func (e *Emulator) opBnnn(addr uint16) {
-	e.cpu.PC = addr + uint16(e.cpu.V[0])
+	var offsetRegister byte
+	if e.Quirks.JumpUsesVx {
+		offsetRegister = byte(addr >> 8)
+	}
+
+	e.cpu.PC = addr + uint16(e.cpu.V[offsetRegister])
 }
 
 // Cxkk - RND Vx, byte
@@ -399,7 +536,8 @@ func (e *Emulator) opBnnn(addr uint16) {
 // ANDed with the value kk. The results are stored in Vx. See instruction
 // 8xy2 for more information on AND.
 func (e *Emulator) opCxkk(x, kk byte) {
-	randomValue := byte(rand.Uint32() % 255)
+	randomValue := byte(e.rng.Uint32() % 255)
+	e.rngDraws++
 
 	e.cpu.V[x] = randomValue & kk
 }
@@ -412,20 +550,31 @@ func (e *Emulator) opCxkk(x, kk byte) {
 // VF is set to 1, otherwise it is set to 0. If the sprite is positioned so part of it
 // is outside the coordinates of the display, it wraps around to the opposite
 // side of the screen.
+// In hires mode, Dxy0 draws a 16x16 sprite of two bytes a row, as on SCHIP.
 func (e *Emulator) opDxyn(x, y, n byte) {
-	xVal := e.cpu.V[x]
-	yVal := e.cpu.V[y]
+	xVal, yVal := int(e.cpu.V[x]), int(e.cpu.V[y])
+	width, size := SpriteWidthPx, uint16(1)
+	if n == 0 && e.Display.Hires {
+		n, width, size = 16, 16, 2
+	}
+	// clipped rows aren't read
+	if height := e.Display.Height(); e.Quirks.ClipSprites && yVal%height+int(n) > height {
+		n = byte(height - yVal%height)
+	}
 
 	e.cpu.V[0xF] = 0
 
-	var i byte = 0
-	for ; i < n; i++ {
-		row := e.memory.RAM[e.cpu.I+uint16(i)]
-
-		if erased := e.Display.DrawSprite(xVal, yVal+i, row); erased {
-			e.cpu.V[0xF] = 1
+	var rows [16]uint16
+	for i := uint16(0); i < uint16(n); i++ {
+		addr := e.cpu.I + i*size
+		rows[i] = uint16(e.memory.Read(addr)) << 8
+		if size == 2 {
+			rows[i] |= uint16(e.memory.Read(addr + 1))
 		}
 	}
+	if e.Display.DrawRows(0, xVal, yVal, rows[:n], width) {
+		e.cpu.V[0xF] = 1
+	}
 }
 
 // Ex9E - SKP Vx
@@ -475,6 +624,7 @@ func (e *Emulator) opFx15(x byte) {
 // ST is set equal to the value of Vx.
 func (e *Emulator) opFx18(x byte) {
 	e.cpu.SoundTimer = e.cpu.V[x]
+	e.updateGate()
 }
 
 // Fx1E - ADD I, Vx
@@ -501,13 +651,9 @@ func (e *Emulator) opFx29(x byte) {
 func (e *Emulator) opFx33(x byte) {
 	decimalValue := e.cpu.V[x]
 
-	e.memory.RAM[e.cpu.I] = decimalValue / 100 //hundreds
-	decimalValue -= e.memory.RAM[e.cpu.I] * 100
-
-	e.memory.RAM[e.cpu.I+1] = decimalValue / 10 //tens
-	decimalValue -= e.memory.RAM[e.cpu.I+1] * 10
-
-	e.memory.RAM[e.cpu.I+2] = decimalValue / 1 //ones
+	e.memory.Write(e.cpu.I, decimalValue/100)     //hundreds
+	e.memory.Write(e.cpu.I+1, decimalValue/10%10) //tens
+	e.memory.Write(e.cpu.I+2, decimalValue%10)    //ones
 }
 
 // Fx55 - LD [I], Vx
@@ -517,7 +663,11 @@ func (e *Emulator) opFx33(x byte) {
 func (e *Emulator) opFx55(x byte) {
 	var i byte = 0
 	for ; i <= x; i++ {
-		e.memory.RAM[e.cpu.I+uint16(i)] = e.cpu.V[i]
+		e.memory.Write(e.cpu.I+uint16(i), e.cpu.V[i])
+	}
+
+	if e.Quirks.LoadStoreIncrementsI {
+		e.cpu.I += uint16(x) + 1
 	}
 }
 
@@ -528,7 +678,11 @@ func (e *Emulator) opFx55(x byte) {
 func (e *Emulator) opFx65(x byte) {
 	var i byte = 0
 	for ; i <= x; i++ {
-		e.cpu.V[i] = e.memory.RAM[e.cpu.I+uint16(i)]
+		e.cpu.V[i] = e.memory.Read(e.cpu.I + uint16(i))
+	}
+
+	if e.Quirks.LoadStoreIncrementsI {
+		e.cpu.I += uint16(x) + 1
 	}
 }
 
@@ -56,3 +56,102 @@ func TestOpFx65(t *testing.T) {
 		}
 	}
 }
+
+// 8xy4 - ADD Vx, Vy
+func TestOp8xy4(t *testing.T) {
+	tests := []struct {
+		x, y, sum, carry byte
+	}{
+		{0x12, 0x34, 0x46, 0},
+		{0x80, 0x7F, 0xFF, 0},
+		{0x80, 0x80, 0x00, 1},
+		{0xFF, 0x02, 0x01, 1},
+	}
+
+	e := new(Emulator)
+	e.SetupROM(nil)
+	for _, test := range tests {
+		e.cpu.V[1], e.cpu.V[2] = test.x, test.y
+		e.op8xy4(1, 2)
+		if e.cpu.V[1] != test.sum || e.cpu.V[0xF] != test.carry {
+			t.Errorf("Expected 0x%02X + 0x%02X to be 0x%02X carry %d but was 0x%02X carry %d",
+				test.x, test.y, test.sum, test.carry, e.cpu.V[1], e.cpu.V[0xF])
+		}
+	}
+}
+
+// 8xy6 - SHR Vx {, Vy}
+func TestOp8xy6(t *testing.T) {
+	tests := []struct {
+		x, shifted, lsb byte
+	}{
+		{0x01, 0x00, 1},
+		{0x02, 0x01, 0},
+		{0x13, 0x09, 1},
+		{0xF0, 0x78, 0},
+	}
+
+	e := new(Emulator)
+	e.SetupROM(nil)
+	for _, test := range tests {
+		e.cpu.V[1] = test.x
+		e.op8xy6(1, 2)
+		if e.cpu.V[1] != test.shifted || e.cpu.V[0xF] != test.lsb {
+			t.Errorf("Expected 0x%02X shifted right to be 0x%02X with VF %d but was 0x%02X with VF %d",
+				test.x, test.shifted, test.lsb, e.cpu.V[1], e.cpu.V[0xF])
+		}
+	}
+}
+
+// 00FF - HIGH, then Dxy0 - DRW Vx, Vy, 0
+func TestOp00FF(t *testing.T) {
+	rom := []byte{
+		0x00, 0xFF, // 200 HIGH
+		0x60, 0x78, // 202 LD V0, 0x78
+		0xA2, 0x0A, // 204 LD I, 0x20A
+		0xD0, 0x10, // 206 DRW V0, V1, 0
+		0x00, 0xFE, // 208 LOW
+		0xFF, 0x00, // 20A the sprite's first row
+		0x80, 0x01, // 20C and its second
+	}
+
+	for name, cycle := range map[string]func(e *Emulator) func(){
+		"decoded":     func(e *Emulator) func() { return e.EmulateCycle },
+		"interpreted": func(e *Emulator) func() { return e.interpretCycle },
+	} {
+		e := new(Emulator)
+		e.SetupROM(rom)
+		run := cycle(e)
+
+		for i := 0; i < 4; i++ {
+			run()
+		}
+		if !e.Display.Hires || e.Display.Pixel(120, 0) != 1 || e.Display.Pixel(127, 0) != 1 || e.Display.Pixel(0, 0) != 0 {
+			t.Errorf("%s: expected the sprite's first row from 120 to the right edge of the hires display", name)
+		}
+		if e.Display.Pixel(120, 1) != 1 || e.Display.Pixel(7, 1) != 1 || e.Display.Pixel(121, 1) != 0 {
+			t.Errorf("%s: expected the 16x16 sprite to read two bytes a row, wrapping the second", name)
+		}
+
+		run()
+		if e.Display.Hires || e.Display.Pixel(120, 0) != 0 {
+			t.Errorf("%s: expected LOW to switch back to the cleared 64x32 display", name)
+		}
+	}
+}
+
+// Dxy0 - DRW Vx, Vy, 0 draws nothing on the 64x32 display, as on CHIP-8
+func TestOpDxy0Lores(t *testing.T) {
+	e := new(Emulator)
+	e.SetupROM([]byte{
+		0xA2, 0x04, // 200 LD I, 0x204
+		0xD0, 0x00, // 202 DRW V0, V0, 0
+		0xFF, 0xFF, // 204 data
+	})
+	e.EmulateCycle()
+	e.EmulateCycle()
+
+	if e.Display.Planes[0][0] != (Row{}) || e.cpu.V[0xF] != 0 {
+		t.Errorf("Expected Dxy0 to draw nothing outside hires")
+	}
+}
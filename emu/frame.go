@@ -0,0 +1,106 @@
+package emu
+
+const (
+	// FrameRate is how often the timers count down, in Hz
+	FrameRate = 60
+	// SamplesPerFrame is the number of beeper samples in one frame
+	SamplesPerFrame = BeeperSampleRate / FrameRate
+)
+
+// Keys is the state of the hex keypad, one bit per key
+type Keys uint16
+
+// IsPressed reports whether a key is down
+func (k Keys) IsPressed(keyIndex byte) bool {
+	return k&(1<<keyIndex) != 0
+}
+
+// GateChange is the beeper starting or stopping partway through a frame.
+// A frame's changes alternate between starting and stopping.
+type GateChange struct {
+	// Sample is the offset into the frame's samples, from 0 to SamplesPerFrame.
+	// Changes at SamplesPerFrame happen as the next frame starts.
+	Sample int
+	On     bool
+}
+
+// RunFrame emulates one 60Hz frame: the given number of instructions
+// with the keypad held in the given state, then a tick of the timers.
+// A key that wasn't held in the previous frame answers one waiting Fx0A.
+func (e *Emulator) RunFrame(cycles int, keys Keys) {
+	e.StartFrame(cycles, keys)
+	if e.compiled != nil {
+		e.runCompiled()
+	} else if e.Engine == EngineBlocks {
+		e.runBlocks()
+	} else {
+		for e.StepFrame() {
+		}
+	}
+	e.EndFrame()
+}
+
+// StartFrame begins a frame that is run one instruction at a time with
+// StepFrame and finished with EndFrame, so a debugger can stop partway
+// through. RunFrame does all three.
+func (e *Emulator) StartFrame(cycles int, keys Keys) {
+	e.gateChanges = e.gateChanges[:0]
+	e.frameCycles = cycles
+	e.frameCycle = 0
+
+	e.justPressed = keys &^ e.previousKeys
+	e.previousKeys = keys
+	e.applyCheats()
+}
+
+// StepFrame runs the next instruction of the frame.
+// It returns false, without running anything, once the frame's cycles are done.
+func (e *Emulator) StepFrame() bool {
+	if e.frameCycle >= e.frameCycles {
+		return false
+	}
+
+	e.updateKeys()
+	e.EmulateCycle()
+	e.frameCycle++
+
+	return true
+}
+
+// updateKeys holds the frame's keys down and answers a waiting Fx0A
+// with a key that was just pressed
+func (e *Emulator) updateKeys() {
+	var i byte
+	for ; i < 16; i++ {
+		e.Input.Update(i, e.previousKeys.IsPressed(i))
+		if e.justPressed.IsPressed(i) && e.Input.WaitingForInput {
+			e.CatchInput(i)
+			e.justPressed &^= 1 << i
+		}
+	}
+}
+
+// EndFrame ticks the timers at the end of a frame
+func (e *Emulator) EndFrame() {
+	e.frameCycle = e.frameCycles
+	e.UpdateDelayTimer()
+	e.UpdateSoundTimer()
+}
+
+// GateChanges lists when the beeper started and stopped during
+// the last call to RunFrame, in order, so that the sound can be
+// rendered sample-accurately with Beeper.RenderFrame
+func (e *Emulator) GateChanges() []GateChange {
+	return e.gateChanges
+}
+
+// setGate starts or stops the beeper, noting when in the frame it happened
+func (e *Emulator) setGate(on bool) {
+	sample := SamplesPerFrame
+	if e.frameCycle < e.frameCycles {
+		sample = e.frameCycle * SamplesPerFrame / e.frameCycles
+	}
+	e.gateChanges = append(e.gateChanges, GateChange{Sample: sample, On: on})
+
+	e.Beeper.SetGate(on)
+}
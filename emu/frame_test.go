@@ -0,0 +1,109 @@
+package emu
+
+import (
+	"bytes"
+	"testing"
+)
+
+// beepROM sets the sound timer to 2 halfway through the first frame
+var beepROM = []byte{
+	0x60, 0x02, // LD V0, 2
+	0x00, 0xE0, // CLS
+	0xF0, 0x18, // LD ST, V0
+	0x12, 0x06, // JP 0x206
+}
+
+func TestRunFrameGateChanges(t *testing.T) {
+	e := new(Emulator)
+	e.SetupROM(beepROM)
+
+	e.RunFrame(6, 0)
+	changes := e.GateChanges()
+	if len(changes) != 1 || !changes[0].On || changes[0].Sample != 2*SamplesPerFrame/6 {
+		t.Errorf("Expected the gate to open on the third cycle but was %+v", changes)
+	}
+
+	e.RunFrame(6, 0)
+	changes = e.GateChanges()
+	if len(changes) != 1 || changes[0].On || changes[0].Sample != SamplesPerFrame {
+		t.Errorf("Expected the gate to close at the end of the second frame but was %+v", changes)
+	}
+}
+
+func TestRunFrameAudioIsDeterministic(t *testing.T) {
+	render := func() []byte {
+		e := &Emulator{Seed: 1}
+		e.SetupROM(beepROM)
+
+		var out bytes.Buffer
+		samples := make([]byte, FrameBytes)
+		for i := 0; i < 4; i++ {
+			e.RunFrame(6, 0)
+			e.Beeper.RenderFrame(samples, e.GateChanges())
+			out.Write(samples)
+		}
+		return out.Bytes()
+	}
+
+	first, second := render(), render()
+	if !bytes.Equal(first, second) {
+		t.Errorf("Expected two renders of the same run to match")
+	}
+	if bytes.Count(first, []byte{0}) == len(first) {
+		t.Errorf("Expected the beep to be audible")
+	}
+}
+
+func TestRenderFrameFollowsGateChanges(t *testing.T) {
+	// a square wave without an envelope is only silent while the gate is closed
+	e := &Emulator{Seed: 1, Beeper: NewBeeper(BeeperSettings{Waveform: WaveSquare, Frequency: 440, Volume: 1})}
+	e.SetupROM(beepROM)
+
+	var audible []int
+	samples := make([]byte, FrameBytes)
+	for f := 0; f < 3; f++ {
+		e.RunFrame(6, 0)
+		e.Beeper.RenderFrame(samples, e.GateChanges())
+		for i := 0; i < SamplesPerFrame; i++ {
+			if samples[4*i] != 0 || samples[4*i+1] != 0 {
+				audible = append(audible, f*SamplesPerFrame+i)
+			}
+		}
+	}
+
+	// the tone starts on the third of six cycles and stops after the second frame
+	start, end := 2*SamplesPerFrame/6, 2*SamplesPerFrame
+	if len(audible) == 0 {
+		t.Fatalf("Expected the beep to be audible")
+	}
+	if audible[0] != start || audible[len(audible)-1] != end-1 || len(audible) != end-start {
+		t.Errorf("Expected samples %d to %d to be audible but got %d from %d to %d",
+			start, end-1, len(audible), audible[0], audible[len(audible)-1])
+	}
+}
+
+func TestRunFrameCatchesNewKeyPress(t *testing.T) {
+	e := new(Emulator)
+	e.SetupROM([]byte{
+		0xF3, 0x0A, // LD V3, K
+		0xF4, 0x0A, // LD V4, K
+		0x12, 0x04, // JP 0x204
+	})
+
+	e.RunFrame(4, 0)
+	e.RunFrame(4, 1<<5)
+	if e.cpu.V[3] != 5 {
+		t.Errorf("Expected key 5 in V3 but was %d", e.cpu.V[3])
+	}
+
+	// one press only answers one Fx0A, and holding it doesn't count again
+	e.RunFrame(4, 1<<5)
+	if !e.Input.WaitingForInput {
+		t.Fatalf("Expected the second Fx0A to wait for a new key press")
+	}
+
+	e.RunFrame(4, 1<<5|1<<9)
+	if e.Input.WaitingForInput || e.cpu.V[4] != 9 {
+		t.Errorf("Expected key 9 in V4 but was waiting=%v V4=%d", e.Input.WaitingForInput, e.cpu.V[4])
+	}
+}
@@ -1,6 +1,9 @@
 package emu
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"io/ioutil"
 )
 
@@ -10,6 +13,22 @@ type Memory struct {
 	// and the 96 bytes below that (0xEA0-0xEFF) are reserved for the call stack,
 	// internal use, and other variables
 	RAM [RamSize]byte
+
+	// hook is told about each data access; see Emulator.SetMemoryHook
+	hook func(MemoryAccess)
+	// table holds the instructions decoded so far
+	table decodeTable
+	// blocks holds the blocks translated so far, for EngineBlocks only
+	blocks *blockCache
+}
+
+// MemoryAccess is an instruction reading or writing a byte of RAM
+type MemoryAccess struct {
+	// PC is the address of the instruction
+	PC    uint16
+	Addr  uint16
+	Value byte
+	Write bool
 }
 
 const (
@@ -18,30 +37,85 @@ const (
 	RamFontStart    byte = 0x0
 )
 
+// RamFontSize is the length of the built-in font, 16 characters from RamFontStart
+const RamFontSize = 16 * PixelFontByteLength
+
 func (m *Memory) Setup() {
 	m.installFont()
 }
 
-func (m *Memory) LoadGame(romFilename string) {
+// RamProgramSize is the largest ROM that fits in memory
+const RamProgramSize = RamSize - RamProgramStart
+
+var ErrROMTooLarge = errors.New("ROM was too large to fit into Chip-8 memory")
+
+// ReadROM reads a game file and checks that it fits into memory
+func ReadROM(romFilename string) ([]byte, error) {
 	contents, err := ioutil.ReadFile(romFilename)
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) > RamProgramSize {
+		return nil, ErrROMTooLarge
+	}
+
+	return contents, nil
+}
+
+// HashROM identifies a ROM by the SHA-1 of its contents
+func HashROM(rom []byte) string {
+	sum := sha1.Sum(rom)
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Memory) LoadGame(romFilename string) {
+	contents, err := ReadROM(romFilename)
 	if err != nil {
 		panic(err)
 	}
 
-	for i, n := range contents {
-		location := RamProgramStart + i
-		if location > RamSize {
-			panic("ROM was too large to fit into Chip-8 memory")
-		}
+	m.LoadROM(contents)
+}
+
+// LoadROM copies a ROM to the start of program memory
+func (m *Memory) LoadROM(rom []byte) {
+	if len(rom) > RamProgramSize {
+		panic(ErrROMTooLarge)
+	}
+
+	copy(m.RAM[RamProgramStart:], rom)
+	m.invalidateAll()
+}
 
-		m.RAM[location] = n
+// Read returns the byte at addr, for instructions reading data
+func (m *Memory) Read(addr uint16) byte {
+	value := m.RAM[addr]
+	if m.hook != nil {
+		m.hook(MemoryAccess{Addr: addr, Value: value})
 	}
+
+	return value
+}
+
+// Write stores a byte at addr, for instructions writing data
+func (m *Memory) Write(addr uint16, value byte) {
+	m.RAM[addr] = value
+	m.invalidate(addr)
+	if m.hook != nil {
+		m.hook(MemoryAccess{Addr: addr, Value: value, Write: true})
+	}
+}
+
+// Opcode returns the instruction at addr. Fetches aren't passed to
+// the hook, since watching code would then stop on every instruction.
+func (m *Memory) Opcode(addr uint16) uint16 {
+	return uint16(m.RAM[addr])<<8 | uint16(m.RAM[addr+1])
 }
 
 func (m *Memory) installFont() {
 	// Chip-8's 4x5 pixel font set (0-F)
 	// See http://devernay.free.fr/hacks/chip8/C8TECH10.HTM#2.4
-	fontBytes := [80]byte{
+	fontBytes := [RamFontSize]byte{
 		0xF0, 0x90, 0x90, 0x90, 0xF0, //0
 		0x20, 0x60, 0x20, 0x20, 0x70, //1
 		0xF0, 0x10, 0xF0, 0x80, 0xF0, //2
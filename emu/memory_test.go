@@ -0,0 +1,46 @@
+package emu
+
+import (
+	"testing"
+)
+
+func TestMemoryHook(t *testing.T) {
+	e := new(Emulator)
+	e.SetupROM([]byte{
+		0xA3, 0x00, // 0x200 LD I, 0x300
+		0x60, 0xFE, // 0x202 LD V0, 254
+		0xF0, 0x33, // 0x204 LD B, V0
+		0xF1, 0x65, // 0x206 LD V1, [I]
+	})
+
+	var accesses []MemoryAccess
+	e.SetMemoryHook(func(a MemoryAccess) {
+		accesses = append(accesses, a)
+	})
+	for i := 0; i < 4; i++ {
+		e.EmulateCycle()
+	}
+
+	expected := []MemoryAccess{
+		{PC: 0x204, Addr: 0x300, Value: 2, Write: true},
+		{PC: 0x204, Addr: 0x301, Value: 5, Write: true},
+		{PC: 0x204, Addr: 0x302, Value: 4, Write: true},
+		{PC: 0x206, Addr: 0x300, Value: 2},
+		{PC: 0x206, Addr: 0x301, Value: 5},
+	}
+	if len(accesses) != len(expected) {
+		t.Fatalf("Expected %d accesses but was %+v", len(expected), accesses)
+	}
+	for i, a := range accesses {
+		if a != expected[i] {
+			t.Errorf("Access %d expected %+v but was %+v", i, expected[i], a)
+		}
+	}
+
+	e.SetMemoryHook(nil)
+	e.cpu.PC = 0x206
+	e.EmulateCycle()
+	if len(accesses) != len(expected) {
+		t.Errorf("Expected no accesses after removing the hook")
+	}
+}
@@ -0,0 +1,126 @@
+package emu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const movieHeader = "chip8go movie 1"
+
+// Movie is a recording of the keypad, one state per frame.
+// Replayed with the same ROM, seed, speed and quirks it reproduces
+// a run exactly.
+type Movie struct {
+	ROM    string // SHA-1 of the ROM, as returned by HashROM
+	Seed   int64
+	Speed  int
+	Quirks Quirks
+	Frames []Keys
+}
+
+// Keys returns the keypad state for a frame,
+// with no keys held after the end of the movie
+func (m *Movie) Keys(frame int) Keys {
+	if frame < 0 || frame >= len(m.Frames) {
+		return 0
+	}
+
+	return m.Frames[frame]
+}
+
+// Write saves the movie as text: a header, then a line with the frame
+// number and hex key mask each time the keypad changes
+func (m *Movie) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, movieHeader)
+	fmt.Fprintf(bw, "rom %s\n", m.ROM)
+	fmt.Fprintf(bw, "seed %d\n", m.Seed)
+	fmt.Fprintf(bw, "speed %d\n", m.Speed)
+	fmt.Fprintf(bw, "quirks %s\n", m.Quirks)
+	fmt.Fprintf(bw, "frames %d\n", len(m.Frames))
+
+	var previous Keys
+	for frame, keys := range m.Frames {
+		if frame == 0 || keys != previous {
+			fmt.Fprintf(bw, "%d %04x\n", frame, uint16(keys))
+		}
+		previous = keys
+	}
+
+	return bw.Flush()
+}
+
+// ReadMovie loads a movie saved by Movie.Write
+func ReadMovie(r io.Reader) (*Movie, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != movieHeader {
+		return nil, errors.New("not a chip8go movie")
+	}
+
+	m := new(Movie)
+	length := -1
+	var keys Keys
+	lineNumber := 1
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("movie line %d: want two fields", lineNumber)
+		}
+
+		var err error
+		switch fields[0] {
+		case "rom":
+			m.ROM = fields[1]
+		case "seed":
+			m.Seed, err = strconv.ParseInt(fields[1], 10, 64)
+		case "speed":
+			m.Speed, err = strconv.Atoi(fields[1])
+		case "quirks":
+			m.Quirks, err = ParseQuirks(fields[1])
+		case "frames":
+			length, err = strconv.Atoi(fields[1])
+		default:
+			var frame int
+			var mask uint64
+			if frame, err = strconv.Atoi(fields[0]); err != nil {
+				break
+			}
+			if mask, err = strconv.ParseUint(fields[1], 16, 16); err != nil {
+				break
+			}
+			if frame < len(m.Frames) {
+				err = errors.New("frames out of order")
+				break
+			}
+			for len(m.Frames) < frame {
+				m.Frames = append(m.Frames, keys)
+			}
+			keys = Keys(mask)
+			m.Frames = append(m.Frames, keys)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("movie line %d: %v", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// the keys stay as they were until the end of the movie
+	if length < len(m.Frames) && length >= 0 {
+		return nil, fmt.Errorf("movie has %d frames but a change at frame %d", length, len(m.Frames)-1)
+	}
+	for len(m.Frames) < length {
+		m.Frames = append(m.Frames, keys)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,46 @@
+package emu
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMovieRoundTrip(t *testing.T) {
+	m := &Movie{
+		ROM:    "f13766c14aeb02ad8d4d103cb5eadd282d20cddc",
+		Seed:   42,
+		Speed:  12,
+		Quirks: QuirksPresets["cosmac"],
+		Frames: []Keys{0, 0, 1 << 4, 1 << 4, 1<<4 | 1<<6, 0, 0},
+	}
+
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := ReadMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, actual) {
+		t.Errorf("Expected %+v but was %+v", m, actual)
+	}
+}
+
+func TestReadMovieErrors(t *testing.T) {
+	bad := []string{
+		"",
+		"some other file\n",
+		movieHeader + "\nseed pony\n",
+		movieHeader + "\n5 0001\n2 0000\n",
+		movieHeader + "\nframes 2\n5 0001\n",
+	}
+
+	for _, input := range bad {
+		if _, err := ReadMovie(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected an error reading %q", input)
+		}
+	}
+}
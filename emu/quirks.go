@@ -0,0 +1,111 @@
+package emu
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quirks toggles the behaviours that differ between CHIP-8 interpreters.
+// The zero value matches this emulator's original behaviour.
+type Quirks struct {
+	// 8xy6/8xyE shift Vy into Vx instead of shifting Vx in place
+	ShiftUsesVy bool
+	// Fx55/Fx65 leave I pointing past the last register transferred
+	LoadStoreIncrementsI bool
+	// Bnnn jumps to nnn + Vx (x taken from the high nibble of nnn)
+	// instead of nnn + V0
+	JumpUsesVx bool
+	// 8xy1/8xy2/8xy3 set VF to 0
+	LogicResetsVF bool
+	// sprites are clipped at the screen edges instead of wrapping
+	ClipSprites bool
+}
+
+// quirkNames maps the names accepted by ParseQuirks to each flag.
+var quirkNames = map[string]func(q *Quirks) *bool{
+	"shift":     func(q *Quirks) *bool { return &q.ShiftUsesVy },
+	"loadstore": func(q *Quirks) *bool { return &q.LoadStoreIncrementsI },
+	"jump":      func(q *Quirks) *bool { return &q.JumpUsesVx },
+	"vfreset":   func(q *Quirks) *bool { return &q.LogicResetsVF },
+	"clip":      func(q *Quirks) *bool { return &q.ClipSprites },
+}
+
+// QuirksPresets are named quirk profiles for common interpreters.
+var QuirksPresets = map[string]Quirks{
+	"default": {},
+	"cosmac": {
+		ShiftUsesVy:          true,
+		LoadStoreIncrementsI: true,
+		LogicResetsVF:        true,
+		ClipSprites:          true,
+	},
+	"schip": {
+		JumpUsesVx:  true,
+		ClipSprites: true,
+	},
+}
+
+// ParseQuirks parses a comma separated list of preset and quirk names.
+// Names are applied left to right; a quirk name prefixed with "-" turns
+// that quirk off, so "cosmac,-clip" is the COSMAC VIP profile with wrapping
+// sprites.
+func ParseQuirks(s string) (Quirks, error) {
+	var q Quirks
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if preset, ok := QuirksPresets[name]; ok {
+			q = preset
+			continue
+		}
+
+		enable := true
+		if strings.HasPrefix(name, "-") {
+			enable = false
+			name = name[1:]
+		} else if strings.HasPrefix(name, "+") {
+			name = name[1:]
+		}
+
+		field, ok := quirkNames[name]
+		if !ok {
+			return q, fmt.Errorf("unknown quirk %q (want one of %s)", name, QuirkNames())
+		}
+		*field(&q) = enable
+	}
+
+	return q, nil
+}
+
+// QuirkNames lists the preset and quirk names accepted by ParseQuirks.
+func QuirkNames() string {
+	var names []string
+	for name := range QuirksPresets {
+		names = append(names, name)
+	}
+	for name := range quirkNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// String formats the enabled quirks in the form accepted by ParseQuirks.
+func (q Quirks) String() string {
+	var names []string
+	for name, field := range quirkNames {
+		if *field(&q) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "default"
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ",")
+}
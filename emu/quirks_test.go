@@ -0,0 +1,72 @@
+package emu
+
+import (
+	"testing"
+)
+
+func TestParseQuirks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Quirks
+	}{
+		{"", Quirks{}},
+		{"default", Quirks{}},
+		{"schip", QuirksPresets["schip"]},
+		{"cosmac,-clip", Quirks{ShiftUsesVy: true, LoadStoreIncrementsI: true, LogicResetsVF: true}},
+		{"jump, +clip", Quirks{JumpUsesVx: true, ClipSprites: true}},
+	}
+
+	for _, test := range tests {
+		actual, err := ParseQuirks(test.input)
+		if err != nil {
+			t.Errorf("ParseQuirks(%q) failed: %v", test.input, err)
+		}
+		if actual != test.expected {
+			t.Errorf("ParseQuirks(%q) expected %+v but was %+v", test.input, test.expected, actual)
+		}
+
+		roundTrip, err := ParseQuirks(actual.String())
+		if err != nil || roundTrip != actual {
+			t.Errorf("ParseQuirks(%q) did not round trip, got %+v", actual.String(), roundTrip)
+		}
+	}
+
+	if _, err := ParseQuirks("wobble"); err == nil {
+		t.Errorf("Expected an error for an unknown quirk")
+	}
+}
+
+// 8xy6 - SHR Vx {, Vy}
+func TestShiftQuirk(t *testing.T) {
+	e := &Emulator{cpu: new(CPU)}
+	e.cpu.V[1] = 0x10
+	e.cpu.V[2] = 0x08
+
+	e.op8xy6(1, 2)
+	if e.cpu.V[1] != 0x08 {
+		t.Errorf("Expected V1 shifted in place to 0x08 but was 0x%02X", e.cpu.V[1])
+	}
+
+	e.Quirks.ShiftUsesVy = true
+	e.op8xy6(1, 2)
+	if e.cpu.V[1] != 0x04 {
+		t.Errorf("Expected V2 shifted into V1 as 0x04 but was 0x%02X", e.cpu.V[1])
+	}
+}
+
+// Fx55 - LD [I], Vx
+func TestLoadStoreQuirk(t *testing.T) {
+	e := &Emulator{cpu: new(CPU), memory: new(Memory)}
+	e.cpu.I = 0x300
+
+	e.opFx55(3)
+	if e.cpu.I != 0x300 {
+		t.Errorf("Expected I to stay at 0x300 but was 0x%03X", e.cpu.I)
+	}
+
+	e.Quirks.LoadStoreIncrementsI = true
+	e.opFx55(3)
+	if e.cpu.I != 0x304 {
+		t.Errorf("Expected I to advance to 0x304 but was 0x%03X", e.cpu.I)
+	}
+}
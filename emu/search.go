@@ -0,0 +1,107 @@
+package emu
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SearchFilter is how a cheat search narrows down its candidates
+type SearchFilter int
+
+const (
+	// SearchEqual keeps the addresses whose byte hasn't changed
+	SearchEqual SearchFilter = iota
+	SearchChanged
+	SearchIncreased
+	SearchDecreased
+	// SearchValue keeps the addresses that hold a value
+	SearchValue
+)
+
+// ParseSearchFilter parses a search filter: equal (=), changed (!=),
+// increased (>), decreased (<), or a number to search for that value
+func ParseSearchFilter(s string) (SearchFilter, byte, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "equal", "=":
+		return SearchEqual, 0, nil
+	case "changed", "!=":
+		return SearchChanged, 0, nil
+	case "increased", ">":
+		return SearchIncreased, 0, nil
+	case "decreased", "<":
+		return SearchDecreased, 0, nil
+	}
+
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 0, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid search %q: want equal, changed, increased, decreased or a value from 0 to 255", s)
+	}
+
+	return SearchValue, byte(v), nil
+}
+
+// CheatSearch finds the address of a variable, such as the number of lives,
+// by comparing memory and the registers from one step of the search to the
+// next: lose a life, keep the addresses that decreased, and so on until only
+// a few are left. Addresses are as cheats have them, with the registers
+// from CheatRegisters.
+type CheatSearch struct {
+	candidates []uint16
+	previous   [CheatSize]byte
+}
+
+// NewCheatSearch starts a search with every address as a candidate
+func NewCheatSearch(e *Emulator) *CheatSearch {
+	s := &CheatSearch{candidates: make([]uint16, CheatSize)}
+	for i := range s.candidates {
+		s.candidates[i] = uint16(i)
+	}
+	s.snapshot(e)
+
+	return s
+}
+
+func (s *CheatSearch) snapshot(e *Emulator) {
+	copy(s.previous[:], e.memory.RAM[:])
+	copy(s.previous[CheatRegisters:], e.cpu.V[:])
+}
+
+// Filter keeps the candidates that pass a filter, comparing memory with the
+// previous step or value for SearchValue, and returns how many are left
+func (s *CheatSearch) Filter(e *Emulator, f SearchFilter, value byte) int {
+	kept := s.candidates[:0]
+	for _, addr := range s.candidates {
+		now, before := e.CheatByte(addr), s.previous[addr]
+		var keep bool
+		switch f {
+		case SearchEqual:
+			keep = now == before
+		case SearchChanged:
+			keep = now != before
+		case SearchIncreased:
+			keep = now > before
+		case SearchDecreased:
+			keep = now < before
+		case SearchValue:
+			keep = now == value
+		}
+		if keep {
+			kept = append(kept, addr)
+		}
+	}
+	s.candidates = kept
+	s.snapshot(e)
+
+	return len(kept)
+}
+
+// Candidates returns the addresses still in the search
+func (s *CheatSearch) Candidates() []uint16 {
+	return s.candidates
+}
+
+// Previous returns the byte at an address at the last step of the search
+func (s *CheatSearch) Previous(addr uint16) byte {
+	return s.previous[addr]
+}
@@ -0,0 +1,67 @@
+package emu
+
+import "math/rand"
+
+// State is a snapshot of everything that changes as the emulator runs,
+// so it can be restored to go back in time. It is about 6KB.
+type State struct {
+	cpu     CPU
+	ram     [RamSize]byte
+	display Display
+	input   Input
+
+	rngDraws                      int64
+	waitingForInputRegisterOffset byte
+
+	previousKeys Keys
+	justPressed  Keys
+	frameCycle   int
+	frameCycles  int
+	gateOn       bool
+}
+
+// Save takes a snapshot of the emulator
+func (e *Emulator) Save() *State {
+	return &State{
+		cpu:                           *e.cpu,
+		ram:                           e.memory.RAM,
+		display:                       *e.Display,
+		input:                         *e.Input,
+		rngDraws:                      e.rngDraws,
+		waitingForInputRegisterOffset: e.waitingForInputRegisterOffset,
+		previousKeys:                  e.previousKeys,
+		justPressed:                   e.justPressed,
+		frameCycle:                    e.frameCycle,
+		frameCycles:                   e.frameCycles,
+		gateOn:                        e.gateOn,
+	}
+}
+
+// Restore returns the emulator to a snapshot it saved. The memory hook
+// and beeper are kept, though the beeper is gated as it was.
+func (e *Emulator) Restore(s *State) {
+	*e.cpu = s.cpu
+	e.memory.RAM = s.ram
+	e.memory.invalidateAll()
+	*e.Display = s.display
+	*e.Input = s.input
+	e.waitingForInputRegisterOffset = s.waitingForInputRegisterOffset
+	e.previousKeys = s.previousKeys
+	e.justPressed = s.justPressed
+	e.frameCycle = s.frameCycle
+	e.frameCycles = s.frameCycles
+	e.gateChanges = e.gateChanges[:0]
+	if e.gateOn != s.gateOn {
+		e.gateOn = s.gateOn
+		e.Beeper.SetGate(s.gateOn)
+	}
+
+	// the generator is reseeded and run up to the same number of draws
+	if s.rngDraws < e.rngDraws {
+		e.rng = rand.New(rand.NewSource(e.rngSeed))
+		e.rngDraws = 0
+	}
+	for ; e.rngDraws < s.rngDraws; e.rngDraws++ {
+		e.rng.Uint32()
+	}
+}
@@ -0,0 +1,48 @@
+package emu
+
+import "testing"
+
+// randomROM stores random bytes at 0x300 and draws a sprite
+var randomROM = []byte{
+	0xA3, 0x00, // 0x200 LD I, 0x300
+	0xC1, 0xFF, // 0x202 RND V1, 0xFF
+	0x70, 0x01, // 0x204 ADD V0, 1
+	0xF1, 0x55, // 0x206 LD [I], V1
+	0xD0, 0x12, // 0x208 DRW V0, V1, 2
+	0x12, 0x02, // 0x20A JP 0x202
+}
+
+func TestStateRestore(t *testing.T) {
+	e := &Emulator{Seed: 7}
+	e.SetupROM(randomROM)
+	e.RunFrame(10, 0)
+	e.StartFrame(10, 1)
+	e.StepFrame()
+	saved := e.Save()
+
+	run := func() (CPU, [RamSize]byte, Display) {
+		for e.StepFrame() {
+		}
+		e.EndFrame()
+		for i := 0; i < 5; i++ {
+			e.RunFrame(10, 0)
+		}
+		return *e.cpu, e.memory.RAM, *e.Display
+	}
+
+	cpu, ram, display := run()
+	e.Restore(saved)
+	if e.cpu.PC != saved.cpu.PC || e.frameCycle != 1 {
+		t.Fatalf("Expected to restore to the second instruction of the frame but was at 0x%X, cycle %d", e.cpu.PC, e.frameCycle)
+	}
+	cpu2, ram2, display2 := run()
+	if cpu != cpu2 {
+		t.Errorf("Expected the same registers after restoring but was %+v, not %+v", cpu2, cpu)
+	}
+	if ram != ram2 {
+		t.Error("Expected the same memory after restoring, including random numbers")
+	}
+	if display != display2 {
+		t.Error("Expected the same display after restoring")
+	}
+}
@@ -0,0 +1,520 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/audio"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/sqweek/dialog"
+	"github.com/szTheory/chip8go/analysis"
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/video"
+)
+
+func playGame(r *runArgs) error {
+	game, err := newGame(r)
+	if err != nil {
+		return err
+	}
+
+	// with --gdb the game runs under a debugger that GDB clients attach to,
+	// with --monitor under one controlled from stdin, with --watch
+	// under one that logs memory accesses and with --coverage under
+	// one that records what the game runs
+	var gdb net.Listener
+	if r.options.GDB != "" {
+		if gdb, err = net.Listen("tcp", r.options.GDB); err != nil {
+			return err
+		}
+		defer gdb.Close()
+	}
+	if gdb != nil || r.options.Monitor || len(r.options.Watch) > 0 || r.options.Coverage != "" {
+		game.debugger = debug.New(nil)
+		logWatches(game.debugger, r.options.Watch)
+	}
+
+	if r.romFilename == "" {
+		if err := game.pickGame(); err != nil {
+			return err
+		}
+	} else if err := game.loadGame(r.romFilename); err != nil {
+		return err
+	}
+	var coverage *debug.Coverage
+	if r.options.Coverage != "" {
+		if coverage, err = loadCoverage(r.options.Coverage, game.romHash); err != nil {
+			return err
+		}
+		game.debugger.TrackCoverage(coverage)
+	}
+	if game.debugger != nil {
+		game.debugger.Continue()
+	}
+	if gdb != nil {
+		go serveGDB(gdb, game.debugger)
+	}
+	if r.options.Monitor {
+		go runMonitor(game.debugger, os.Stdin, os.Stdout)
+	}
+
+	if err := game.run(); err != nil {
+		return err
+	}
+	if coverage != nil {
+		game.debugger.TrackCoverage(nil)
+		if err := saveCoverage(r.options.Coverage, coverage); err != nil {
+			return err
+		}
+	}
+
+	return game.saveMovie()
+}
+
+// debugGame plays a game for a debugging client, until the window
+// is closed or the client disconnects
+func debugGame(req launchRequest) error {
+	game, err := newGame(req.run)
+	if err == nil {
+		game.debugger = req.debug
+		err = game.loadGame(req.run.romFilename)
+	}
+	req.ready <- err
+	if err != nil {
+		return err
+	}
+
+	return game.run()
+}
+
+type Game struct {
+	emulator    *emu.Emulator
+	beeper      *emu.Beeper
+	audioPlayer *audio.Player
+	romFilename string
+	romHash     string
+	// detection is the platform and quirks detected for the ROM,
+	// which --quirks auto uses
+	detection analysis.Detection
+
+	// base holds the options before per-ROM settings are applied
+	base     options
+	options  options
+	explicit map[string]bool
+	settings *settings
+
+	quirks  emu.Quirks
+	seed    int64
+	palette video.Palette
+	filters *video.Pipeline
+	border  color.Color
+	aspect  float64
+	keymap  [16]ebiten.Key
+
+	// display is a copy of the emulator's display taken for each frame
+	// drawn, as a debugger can change it from another goroutine
+	display emu.Display
+	frame   *image.RGBA
+	canvas  *ebiten.Image
+
+	// movie records the keypad while --record is given
+	movie *emu.Movie
+
+	// cheats are applied to the game from the start, and saved
+	// to cheatsFile when they are changed in the cheat finder
+	cheats     []emu.Cheat
+	cheatsFile string
+
+	// debugger runs the emulator instead when a debugging client
+	// launched the game, --gdb, --monitor or --watch is given
+	// or the memory or sprite viewer or cheat finder has been opened
+	debugger   *debug.Debugger
+	memView    memoryView
+	spriteView spriteView
+	cheatView  cheatView
+
+	// last seen window size, and frames left until it is saved
+	windowW, windowH int
+	resizeFrames     int
+}
+
+// newGame sets up a game from parsed run arguments
+func newGame(r *runArgs) (*Game, error) {
+	g := &Game{
+		base:     r.options,
+		explicit: r.explicit,
+		settings: r.settings,
+		beeper:   emu.NewBeeper(r.options.beeperSettings()),
+	}
+
+	var err error
+	if g.keymap, err = r.settings.keymap(); err != nil {
+		return nil, err
+	}
+	if err := g.applyOptions(r.options); err != nil {
+		return nil, err
+	}
+
+	// pick the seed up front so that a recorded movie can replay it
+	g.seed = r.options.Seed
+	if g.seed == 0 {
+		g.seed = time.Now().UnixNano()
+	}
+
+	return g, nil
+}
+
+// applyOptions switches to a new set of options
+func (g *Game) applyOptions(opts options) error {
+	quirks, err := romQuirks(opts.Quirks, g.detection)
+	if err != nil {
+		return err
+	}
+	palette, err := g.resolvePalette(opts.Palette)
+	if err != nil {
+		return err
+	}
+	filters, err := video.ParseFilters(opts.Filter)
+	if err != nil {
+		return err
+	}
+	border, err := video.ParseColor(opts.Border)
+	if err != nil {
+		return err
+	}
+	aspect, err := parseAspect(opts.Aspect)
+	if err != nil {
+		return err
+	}
+
+	g.options = opts
+	g.quirks = quirks
+	g.palette = palette
+	g.filters = video.NewPipeline(filters)
+	g.border = border
+	g.aspect = aspect
+	g.beeper.SetSettings(opts.beeperSettings())
+
+	return nil
+}
+
+func (g *Game) run() error {
+	g.copyDisplay()
+	g.windowW, g.windowH = windowSize(&g.display, g.options.Scale, g.aspect)
+	ebiten.SetWindowSize(g.windowW, g.windowH)
+	ebiten.SetWindowResizable(true)
+	ebiten.SetFullscreen(g.options.Fullscreen)
+
+	var err error
+	if g.audioPlayer, err = newAudioPlayer(g.beeper); err != nil {
+		return err
+	}
+
+	return ebiten.RunGame(g)
+}
+
+// Update the logical state
+func (g *Game) Update(screen *ebiten.Image) error {
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyF8):
+		g.toggleMemoryView()
+	case inpututil.IsKeyJustPressed(ebiten.KeyF7):
+		g.toggleSpriteView()
+	case inpututil.IsKeyJustPressed(ebiten.KeyF6):
+		g.toggleCheatView()
+	}
+	// the overlays take the keyboard while they are open
+	var keys emu.Keys
+	switch {
+	case g.memView.open:
+		g.updateMemoryView()
+	case g.spriteView.open:
+		g.updateSpriteView()
+	case g.cheatView.open:
+		g.updateCheatView()
+	default:
+		// Enter key resets game
+		if ebiten.IsKeyPressed(ebiten.KeyEnter) {
+			g.reset()
+		}
+		g.updateHotkeys()
+		for keyIndex, key := range g.keymap {
+			if ebiten.IsKeyPressed(key) {
+				keys |= 1 << keyIndex
+			}
+		}
+	}
+	g.updateWindow()
+
+	if g.debugger != nil {
+		if err := g.debugger.RunFrame(g.options.Speed, keys); err != nil {
+			return err
+		}
+	} else {
+		g.emulator.RunFrame(g.options.Speed, keys)
+	}
+
+	if g.movie != nil {
+		g.movie.Frames = append(g.movie.Frames, keys)
+	}
+
+	return nil
+}
+
+// updateHotkeys handles the emulator controls that are saved as settings.
+// M toggles the sound, - and = change the speed of the current game
+// and P switches it to the next colour theme.
+func (g *Game) updateHotkeys() {
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyM):
+		g.options.Mute = !g.options.Mute
+		g.base.Mute = g.options.Mute
+		g.settings.Mute = g.options.Mute
+		g.beeper.SetSettings(g.options.beeperSettings())
+		g.saveSettings()
+	case inpututil.IsKeyJustPressed(ebiten.KeyMinus) && g.options.Speed > 1:
+		g.setSpeed(g.options.Speed - 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEqual):
+		g.setSpeed(g.options.Speed + 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyP):
+		g.setTheme(video.NextTheme(g.palette.String()))
+	}
+}
+
+func (g *Game) setTheme(theme video.Theme) {
+	g.options.Palette = theme.Name
+	g.palette = theme.Palette
+	g.settings.updateROM(g.romHash, func(r *romSettings) {
+		r.Palette = theme.Name
+	})
+	g.saveSettings()
+}
+
+// resolvePalette parses a palette option for the loaded ROM
+func (g *Game) resolvePalette(s string) (video.Palette, error) {
+	return romPalette(s, g.romHash)
+}
+
+func (g *Game) setSpeed(speed int) {
+	// a movie replays at the speed it started with
+	if g.movie != nil {
+		return
+	}
+
+	g.options.Speed = speed
+	g.settings.updateROM(g.romHash, func(r *romSettings) {
+		r.Speed = speed
+	})
+	g.saveSettings()
+}
+
+// saveSettings writes settings changed in the app back to the settings file.
+// Failing to save isn't worth interrupting a game for.
+func (g *Game) saveSettings() {
+	if err := g.settings.save(); err != nil {
+		os.Stderr.WriteString("chip8go: saving settings: " + err.Error() + "\n")
+	}
+}
+
+// Render the screen
+func (g *Game) Draw(screen *ebiten.Image) {
+	g.copyDisplay()
+	display := &g.display
+	width, height := display.Width(), display.Height()
+
+	if g.frame == nil || g.frame.Rect.Dx() != width || g.frame.Rect.Dy() != height {
+		g.frame = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+	video.DrawFrame(g.frame, display, g.palette)
+	filtered := g.filters.Apply(g.frame)
+
+	// the canvas is remade when the game changes display resolution
+	// or the filters change the frame size
+	canvasW, canvasH := filtered.Rect.Dx(), filtered.Rect.Dy()
+	if g.canvas != nil {
+		if w, h := g.canvas.Size(); w != canvasW || h != canvasH {
+			g.canvas.Dispose()
+			g.canvas = nil
+		}
+	}
+	if g.canvas == nil {
+		var err error
+		if g.canvas, err = ebiten.NewImage(canvasW, canvasH, ebiten.FilterDefault); err != nil {
+			panic(err)
+		}
+	}
+	if err := g.canvas.ReplacePixels(filtered.Pix); err != nil {
+		panic(err)
+	}
+
+	g.drawDisplay(screen, g.canvas)
+	switch {
+	case g.memView.open:
+		g.drawMemoryView(screen)
+	case g.spriteView.open:
+		g.drawSpriteView(screen)
+	case g.cheatView.open:
+		g.drawCheatView(screen)
+	}
+}
+
+// copyDisplay takes a copy of the emulator's display to draw,
+// under the debugger's lock if there is one
+func (g *Game) copyDisplay() {
+	if g.debugger != nil {
+		g.debugger.View(func(e *emu.Emulator) {
+			g.display = *e.Display
+		})
+	} else {
+		g.display = *g.emulator.Display
+	}
+}
+
+// Layout uses the whole window, and drawDisplay scales the display to fit
+func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
+	return outsideWidth, outsideHeight
+}
+
+func (g *Game) reset() {
+	g.emulator = &emu.Emulator{
+		Quirks:   g.quirks,
+		Seed:     g.seed,
+		Beeper:   g.beeper,
+		Cheats:   append([]emu.Cheat(nil), g.cheats...),
+		Compiled: compiledFor(g.romHash),
+	}
+	g.emulator.Setup(g.romFilename)
+	if g.debugger != nil {
+		g.debugger.Reset(g.emulator)
+	}
+
+	// resetting starts the recording over
+	if g.options.Record != "" {
+		g.movie = &emu.Movie{
+			ROM:    g.romHash,
+			Seed:   g.seed,
+			Speed:  g.options.Speed,
+			Quirks: g.quirks,
+		}
+	}
+}
+
+// setCheats changes the cheats applied to the game
+func (g *Game) setCheats(cheats []emu.Cheat) {
+	g.cheats = cheats
+	set := func(e *emu.Emulator) {
+		e.Cheats = append([]emu.Cheat(nil), cheats...)
+	}
+	if g.debugger != nil {
+		g.debugger.Edit(set)
+	} else {
+		set(g.emulator)
+	}
+}
+
+// saveCheats writes the cheats to the ROM's cheat file
+func (g *Game) saveCheats() error {
+	if err := os.MkdirAll(filepath.Dir(g.cheatsFile), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(g.cheatsFile)
+	if err != nil {
+		return err
+	}
+	if err := emu.WriteCheats(f, g.cheats); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// saveMovie writes the recorded keypad to the --record file
+func (g *Game) saveMovie() error {
+	if g.movie == nil {
+		return nil
+	}
+
+	f, err := os.Create(g.options.Record)
+	if err != nil {
+		return err
+	}
+	if err := g.movie.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (g *Game) pickGame() error {
+	picker := dialog.File().Filter("CHIP-8 game file", "ch8")
+	if len(g.settings.Recent) > 0 {
+		picker = picker.SetStartDir(filepath.Dir(g.settings.Recent[0]))
+	}
+
+	romFilename, err := picker.Load()
+	if err != nil {
+		return err
+	}
+	if romFilename == "" {
+		return errors.New("No game selected")
+	}
+
+	return g.loadGame(romFilename)
+}
+
+// loadGame starts a game with its per-ROM settings
+// and adds it to the recent list
+func (g *Game) loadGame(romFilename string) error {
+	rom, err := emu.ReadROM(romFilename)
+	if err != nil {
+		return err
+	}
+	g.romHash = emu.HashROM(rom)
+	g.detection = analysis.Detect(rom)
+
+	opts := g.base
+	opts.applyROM(g.settings.rom(g.romHash), g.explicit)
+	if err := g.applyOptions(opts); err != nil {
+		return err
+	}
+
+	// cheats are kept per ROM unless --cheats names a file
+	g.cheatsFile = opts.Cheats
+	if g.cheatsFile == "" {
+		g.cheatsFile = g.settings.cheatsFilename(g.romHash)
+	}
+	if g.cheats, err = loadCheats(g.cheatsFile, opts.Cheat); err != nil {
+		return err
+	}
+
+	title := "Chip-8 - " + path.Base(romFilename)
+	if opts.Quirks == quirksAuto {
+		title += fmt.Sprintf(" - %s", g.detection)
+		warnPlatform("run", romFilename, g.detection)
+	}
+	ebiten.SetWindowTitle(title)
+	g.romFilename = romFilename
+	g.reset()
+
+	g.settings.addRecent(romFilename)
+	g.settings.updateROM(g.romHash, func(r *romSettings) {
+		r.Name = path.Base(romFilename)
+	})
+	g.saveSettings()
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/szTheory/chip8go/debug"
+)
+
+// serveGDB accepts GDB clients one at a time for as long as the game runs
+func serveGDB(l net.Listener, d *debug.Debugger) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		if err := debug.NewGDBServer(conn, d).Serve(); err != nil {
+			fmt.Fprintf(os.Stderr, "chip8go: gdb: %v\n", err)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/szTheory/chip8go/analysis"
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/media"
+)
+
+// defaultHeadlessFrames is how long to run without a movie, 10 seconds
+const defaultHeadlessFrames = 10 * emu.FrameRate
+
+// headlessArgs are the arguments shared by the commands that run
+// a game without a window
+type headlessArgs struct {
+	options
+	movie       *emu.Movie
+	romFilename string
+	rom         []byte
+	frames      int
+	out         string
+	cheats      []emu.Cheat
+	// debugger runs the frames instead of the emulator if it is set,
+	// for commands that track what the game does
+	debugger *debug.Debugger
+}
+
+// headlessFlags registers the options that affect a headless run.
+// The ROM is read and the movie applied by parseHeadless.
+func headlessFlags(name string, h *headlessArgs, movieFilename *string) *flag.FlagSet {
+	o := &h.options
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.IntVar(&o.Speed, "speed", o.Speed, "instructions executed per 60Hz frame")
+	fs.StringVar(&o.Quirks, "quirks", o.Quirks, "interpreter quirks, or auto to detect them from the ROM: "+emu.QuirkNames())
+	fs.Int64Var(&o.Seed, "seed", o.Seed, "random number seed for Cxkk (0 is the same as 1)")
+	fs.Float64Var(&o.Volume, "volume", o.Volume, "beeper volume from 0 to 1")
+	fs.StringVar(&o.Wave, "wave", o.Wave, "beeper waveform: "+strings.Join(emu.WaveformNames(), ", "))
+	fs.Float64Var(&o.Tone, "tone", o.Tone, "beeper pitch in Hz")
+	fs.Var(&o.Watch, "watch", "log reads and writes of a memory `range` such as 0x300-0x30F:w to stderr (repeatable)")
+	fs.StringVar(&o.Cheats, "cheats", "", "apply the cheats in a `file`")
+	fs.Var(&o.Cheat, "cheat", "freeze a byte with a cheat `code` such as 2F6:03 (repeatable)")
+	fs.StringVar(movieFilename, "movie", "", "replay the keypad from a movie `file` recorded with run --record")
+	fs.IntVar(&h.frames, "frames", 0, "frames to run (default the movie length, or 10 seconds)")
+	fs.StringVar(&h.out, "o", "", "output `file`")
+	fs.StringVar(&h.out, "out", "", "output `file`, the same as -o")
+
+	return fs
+}
+
+// parseHeadless parses the flags and ROM for a headless command.
+// Headless runs ignore the settings file so their output only depends
+// on the command line. A movie supplies the seed, speed and quirks it was recorded with,
+// unless they are given as flags.
+func parseHeadless(name string, fs *flag.FlagSet, h *headlessArgs, movieFilename *string, args []string) error {
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return flagError(name, err)
+	}
+	if len(positional) != 1 {
+		return usageError(name, "expected exactly one ROM file")
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	h.romFilename = positional[0]
+	if h.rom, err = emu.ReadROM(h.romFilename); err != nil {
+		return err
+	}
+
+	if *movieFilename != "" {
+		f, err := os.Open(*movieFilename)
+		if err != nil {
+			return err
+		}
+		h.movie, err = emu.ReadMovie(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", *movieFilename, err)
+		}
+		if h.movie.ROM != "" && h.movie.ROM != emu.HashROM(h.rom) {
+			fmt.Fprintf(os.Stderr, "chip8go %s: warning: %s was recorded with a different ROM\n", name, *movieFilename)
+		}
+
+		if !explicit["seed"] {
+			h.Seed = h.movie.Seed
+		}
+		if !explicit["speed"] && h.movie.Speed > 0 {
+			h.Speed = h.movie.Speed
+		}
+		if !explicit["quirks"] {
+			h.Quirks = h.movie.Quirks.String()
+		}
+		if h.frames == 0 {
+			h.frames = len(h.movie.Frames)
+		}
+	}
+	if h.frames == 0 {
+		h.frames = defaultHeadlessFrames
+	}
+
+	// headless runs must be repeatable, so a zero seed, whether from the
+	// default, -seed 0 or a movie, can't fall through to the clock
+	if h.Seed == 0 {
+		h.Seed = 1
+	}
+
+	if h.Quirks == quirksAuto {
+		d := analysis.Detect(h.rom)
+		warnPlatform(name, h.romFilename, d)
+		h.Quirks = d.Quirks
+	}
+	if err := h.options.validate(); err != nil {
+		return usageError(name, "%v", err)
+	}
+	if h.cheats, err = loadCheats(h.Cheats, h.Cheat); err != nil {
+		return err
+	}
+	if h.frames < 0 {
+		return usageError(name, "invalid frames %d", h.frames)
+	}
+
+	return nil
+}
+
+// parseInterspersed parses flags that may come after the arguments,
+// as in chip8go profile rom.ch8 -frames 600, returning the arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// outFilename is the -o file, or the ROM name with a new extension
+func (h *headlessArgs) outFilename(ext string) string {
+	if h.out != "" {
+		return h.out
+	}
+	base := filepath.Base(h.romFilename)
+
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ext
+}
+
+// emulator sets up an emulator for the headless run, loaded with the ROM
+func (h *headlessArgs) emulator() *emu.Emulator {
+	quirks, _ := emu.ParseQuirks(h.Quirks)
+	e := &emu.Emulator{
+		Quirks:   quirks,
+		Seed:     h.Seed,
+		Beeper:   emu.NewBeeper(h.beeperSettings()),
+		Cheats:   h.cheats,
+		Compiled: compiledFor(emu.HashROM(h.rom)),
+	}
+	e.SetupROM(h.rom)
+
+	return e
+}
+
+// run emulates the requested frames, calling frame after each one
+func (h *headlessArgs) run(e *emu.Emulator, frame func(n int) error) error {
+	runFrame := func(keys emu.Keys) error {
+		e.RunFrame(h.Speed, keys)
+		return nil
+	}
+	// watching memory needs a debugger, which only logs
+	d := h.debugger
+	if d == nil && len(h.Watch) > 0 {
+		d = debug.New(e)
+	}
+	if d != nil {
+		logWatches(d, h.Watch)
+		d.Continue()
+		runFrame = func(keys emu.Keys) error {
+			return d.RunFrame(h.Speed, keys)
+		}
+	}
+
+	for n := 0; n < h.frames; n++ {
+		var keys emu.Keys
+		if h.movie != nil {
+			keys = h.movie.Keys(n)
+		}
+		if err := runFrame(keys); err != nil {
+			return err
+		}
+
+		if err := frame(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runWAV(args []string) error {
+	h := &headlessArgs{options: defaultOptions()}
+	var movieFilename string
+	fs := headlessFlags("wav", h, &movieFilename)
+	if err := parseHeadless("wav", fs, h, &movieFilename, args); err != nil {
+		return err
+	}
+
+	f, err := os.Create(h.outFilename(".wav"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	wav, err := media.NewWAVWriter(f, emu.BeeperSampleRate, 2)
+	if err != nil {
+		return err
+	}
+
+	e := h.emulator()
+	samples := make([]byte, emu.FrameBytes)
+	err = h.run(e, func(n int) error {
+		e.Beeper.RenderFrame(samples, e.GateChanges())
+		_, err := wav.Write(samples)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := wav.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+func TestHeadlessSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rom := []byte{0x12, 0x00}
+	romFilename := filepath.Join(dir, "test.ch8")
+	if err := ioutil.WriteFile(romFilename, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	movie := func(seed int64) string {
+		filename := filepath.Join(dir, fmt.Sprintf("%d.movie", seed))
+		f, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		m := &emu.Movie{ROM: emu.HashROM(rom), Seed: seed, Speed: 10, Frames: []emu.Keys{0}}
+		if err := m.Write(f); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		seed int64
+	}{
+		{"default", []string{romFilename}, 1},
+		{"flag", []string{"-seed", "42", romFilename}, 42},
+		{"zero flag", []string{"-seed", "0", romFilename}, 1},
+		{"movie", []string{"-movie", movie(7), romFilename}, 7},
+		{"zero movie", []string{"-movie", movie(0), romFilename}, 1},
+		{"flag over movie", []string{"-movie", movie(7), "-seed", "0", romFilename}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &headlessArgs{options: defaultOptions()}
+			var movieFilename string
+			fs := headlessFlags("wav", h, &movieFilename)
+			if err := parseHeadless("wav", fs, h, &movieFilename, test.args); err != nil {
+				t.Fatal(err)
+			}
+			if h.Seed != test.seed {
+				t.Errorf("Expected seed %d but got %d", test.seed, h.Seed)
+			}
+		})
+	}
+}
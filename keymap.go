@@ -0,0 +1,67 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+)
+
+// defaultKeymap puts the CHIP-8 keypad on the left side of the keyboard
+var defaultKeymap = [16]ebiten.Key{
+	0x0: ebiten.KeyX,
+	0x1: ebiten.Key1,
+	0x2: ebiten.Key2,
+	0x3: ebiten.Key3,
+	0x4: ebiten.KeyQ,
+	0x5: ebiten.KeyW,
+	0x6: ebiten.KeyE,
+	0x7: ebiten.KeyA,
+	0x8: ebiten.KeyS,
+	0x9: ebiten.KeyD,
+	0xA: ebiten.KeyZ,
+	0xB: ebiten.KeyC,
+	0xC: ebiten.Key4,
+	0xD: ebiten.KeyR,
+	0xE: ebiten.KeyF,
+	0xF: ebiten.KeyV,
+}
+
+// keymap resolves the saved key names on top of the default keymap
+func (s *settings) keymap() ([16]ebiten.Key, error) {
+	keymap := defaultKeymap
+	for digit, name := range s.Keys {
+		index, err := strconv.ParseUint(digit, 16, 4)
+		if err != nil {
+			return keymap, fmt.Errorf("invalid CHIP-8 key %q: want 0-F", digit)
+		}
+		key, ok := keyByName(name)
+		if !ok {
+			return keymap, fmt.Errorf("invalid key name %q for CHIP-8 key %s", name, digit)
+		}
+		keymap[index] = key
+	}
+
+	return keymap, nil
+}
+
+// keyByName finds a key by the name returned from ebiten.Key.String
+func keyByName(name string) (ebiten.Key, bool) {
+	for k := ebiten.Key(0); k <= ebiten.KeyMax; k++ {
+		if strings.EqualFold(k.String(), name) {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+// checkKeys validates the keymap in the settings file
+func (s *settings) checkKeys() error {
+	_, err := s.keymap()
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// scaling modes for fitting the display into the window
+const (
+	// scale by the largest whole number that fits, keeping pixels sharp
+	scaleInteger = "integer"
+	// scale as large as fits, keeping the aspect ratio
+	scaleFit = "fit"
+	// fill the whole window
+	scaleStretch = "stretch"
+)
+
+var scalingModes = []string{scaleInteger, scaleFit, scaleStretch}
+
+// pixel aspect ratios (width / height) by name
+var pixelAspects = map[string]float64{
+	"square": 1,
+	// 64x32 pixels stretched across a 4:3 television
+	"vip": (4.0 / 64) / (3.0 / 32),
+}
+
+func validScaling(mode string) error {
+	for _, m := range scalingModes {
+		if mode == m {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid scaling %q: want one of %s", mode, strings.Join(scalingModes, ", "))
+}
+
+// parseAspect parses a pixel aspect ratio, either a name from pixelAspects
+// or a width/height ratio such as 0.75
+func parseAspect(s string) (float64, error) {
+	if aspect, ok := pixelAspects[s]; ok {
+		return aspect, nil
+	}
+	aspect, err := strconv.ParseFloat(s, 64)
+	if err != nil || aspect < 0.25 || aspect > 4 || math.IsNaN(aspect) {
+		return 0, fmt.Errorf("invalid aspect %q: want square, vip or a ratio from 0.25 to 4", s)
+	}
+
+	return aspect, nil
+}
+
+// displayRect places a w by h display with the given pixel aspect
+// in an outer area, returning its offset and per-axis scale
+func displayRect(outerW, outerH, w, h int, mode string, aspect float64) (x, y, scaleX, scaleY float64) {
+	switch mode {
+	case scaleStretch:
+		scaleX = float64(outerW) / float64(w)
+		scaleY = float64(outerH) / float64(h)
+	case scaleFit:
+		scaleY = math.Min(float64(outerW)/(float64(w)*aspect), float64(outerH)/float64(h))
+		scaleX = scaleY * aspect
+	default:
+		// whole numbers on both axes, with the width rounded to the nearest
+		// multiple that keeps the aspect ratio
+		k := 1
+		for {
+			next := k + 1
+			if float64(w)*math.Max(1, math.Round(float64(next)*aspect)) > float64(outerW) || next*h > outerH {
+				break
+			}
+			k = next
+		}
+		scaleY = float64(k)
+		scaleX = math.Max(1, math.Round(float64(k)*aspect))
+	}
+
+	x = math.Floor((float64(outerW) - float64(w)*scaleX) / 2)
+	y = math.Floor((float64(outerH) - float64(h)*scaleY) / 2)
+
+	return x, y, scaleX, scaleY
+}
+
+// windowSize is the initial window size for a display at the given scale
+func windowSize(d *emu.Display, scale int, aspect float64) (int, int) {
+	return int(math.Round(float64(d.Width()*scale) * aspect)), d.Height() * scale
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDisplayRect(t *testing.T) {
+	vip := pixelAspects["vip"]
+	tests := []struct {
+		name           string
+		outerW, outerH int
+		w, h           int
+		mode           string
+		aspect         float64
+		x, y, sx, sy   float64
+	}{
+		{"integer exact", 640, 320, 64, 32, scaleInteger, 1, 0, 0, 10, 10},
+		{"integer odd window", 651, 333, 64, 32, scaleInteger, 1, 5, 6, 10, 10},
+		{"integer too small", 50, 20, 64, 32, scaleInteger, 1, -7, -6, 1, 1},
+		{"integer vip", 640, 480, 64, 32, scaleInteger, vip, 0, 0, 10, 15},
+		{"integer vip odd window", 700, 500, 64, 32, scaleInteger, vip, 30, 10, 10, 15},
+		{"integer hires", 1280, 640, 128, 64, scaleInteger, 1, 0, 0, 10, 10},
+		{"integer hires vip", 1280, 640, 128, 64, scaleInteger, vip, 192, 0, 7, 10},
+		{"fit wide window", 800, 480, 64, 32, scaleFit, 1, 0, 40, 12.5, 12.5},
+		{"fit vip", 640, 480, 64, 32, scaleFit, vip, 0, 0, 10, 15},
+		{"fit hires odd window", 1001, 501, 128, 64, scaleFit, 1, 0, 0, 7.8203125, 7.8203125},
+		{"stretch odd window", 651, 333, 64, 32, scaleStretch, 1, 0, 0, 10.171875, 10.40625},
+		{"stretch ignores aspect", 640, 640, 64, 32, scaleStretch, vip, 0, 0, 10, 20},
+		{"stretch hires", 640, 480, 128, 64, scaleStretch, 1, 0, 0, 5, 7.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			x, y, sx, sy := displayRect(test.outerW, test.outerH, test.w, test.h, test.mode, test.aspect)
+			got := []float64{x, y, sx, sy}
+			want := []float64{test.x, test.y, test.sx, test.sy}
+			for i := range got {
+				if math.Abs(got[i]-want[i]) > 1e-9 {
+					t.Errorf("Expected offset %v,%v and scale %v,%v but got %v,%v and %v,%v",
+						test.x, test.y, test.sx, test.sy, x, y, sx, sy)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestParseAspect(t *testing.T) {
+	tests := []struct {
+		s      string
+		aspect float64
+		ok     bool
+	}{
+		{"square", 1, true},
+		{"vip", 2.0 / 3, true},
+		{"0.75", 0.75, true},
+		{"0.25", 0.25, true},
+		{"4", 4, true},
+		{"", 0, false},
+		{"wide", 0, false},
+		{"VIP", 0, false},
+		{"0.2", 0, false},
+		{"4.5", 0, false},
+		{"-1", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"4:3", 0, false},
+	}
+
+	for _, test := range tests {
+		aspect, err := parseAspect(test.s)
+		if test.ok != (err == nil) {
+			t.Errorf("Expected %q to parse %v but got error %v", test.s, test.ok, err)
+			continue
+		}
+		if math.Abs(aspect-test.aspect) > 1e-9 {
+			t.Errorf("Expected %q to be %v but got %v", test.s, test.aspect, aspect)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+// AVI video codecs
+const (
+	// AVIRaw stores frames as uncompressed 24-bit bitmaps
+	AVIRaw = "raw"
+	// AVIMJPEG stores each frame as a JPEG image
+	AVIMJPEG = "mjpeg"
+)
+
+// maxAVISize is the largest file allowed by the original AVI format,
+// which has 32-bit chunk sizes and no OpenDML extensions
+const maxAVISize = 1 << 30
+
+// ErrAVITooLarge is returned when a recording outgrows maxAVISize
+var ErrAVITooLarge = errors.New("media: AVI files are limited to 1GB, try mjpeg or y4m")
+
+// AVIWriter writes a video stream and a 16-bit PCM audio stream to an AVI
+// file, interleaving one chunk of audio after each frame so they stay in
+// sync. Sizes and the index are filled in by Close, so the output must be
+// seekable.
+type AVIWriter struct {
+	w          io.WriteSeeker
+	width      int
+	height     int
+	fps        int
+	codec      string
+	sampleRate int
+	channels   int
+	quality    int
+
+	frames     int
+	audioBytes int
+	offset     int64 // bytes written so far
+	moviStart  int64 // offset of the "movi" list type
+	size       int64 // size of the finished file, known once closed
+	index      []aviIndexEntry
+	frame      []byte
+	closed     bool
+}
+
+type aviIndexEntry struct {
+	id     string
+	flags  uint32
+	offset uint32 // relative to moviStart
+	size   uint32
+}
+
+// NewAVIWriter starts an AVI file for frames of the given size.
+// quality is the JPEG quality for AVIMJPEG, from 1 to 100.
+func NewAVIWriter(w io.WriteSeeker, width, height, fps int, codec string, sampleRate, channels, quality int) (*AVIWriter, error) {
+	if codec != AVIRaw && codec != AVIMJPEG {
+		return nil, errors.New("media: unknown AVI codec " + codec)
+	}
+
+	avi := &AVIWriter{
+		w:          w,
+		width:      width,
+		height:     height,
+		fps:        fps,
+		codec:      codec,
+		sampleRate: sampleRate,
+		channels:   channels,
+		quality:    quality,
+	}
+	if err := avi.writeHeaders(); err != nil {
+		return nil, err
+	}
+	avi.moviStart = avi.offset - 4
+
+	return avi, nil
+}
+
+// WriteFrame appends a video frame followed by the audio samples
+// (interleaved 16-bit little-endian) that play during it
+func (avi *AVIWriter) WriteFrame(img image.Image, samples []byte) error {
+	if avi.closed {
+		return errors.New("media: write to closed AVIWriter")
+	}
+	if b := img.Bounds(); b.Dx() != avi.width || b.Dy() != avi.height {
+		return errors.New("media: frame size doesn't match the AVI")
+	}
+
+	var data []byte
+	var id string
+	switch avi.codec {
+	case AVIMJPEG:
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: avi.quality}); err != nil {
+			return err
+		}
+		data, id = buf.Bytes(), "00dc"
+	default:
+		data, id = avi.bitmap(img), "00db"
+	}
+
+	if err := avi.writeChunk(id, 0x10, data); err != nil {
+		return err
+	}
+	avi.frames++
+
+	if len(samples) > 0 {
+		if err := avi.writeChunk("01wb", 0x10, samples); err != nil {
+			return err
+		}
+		avi.audioBytes += len(samples)
+	}
+
+	return nil
+}
+
+// Close writes the index and fills in the header sizes.
+// It doesn't close the underlying writer.
+func (avi *AVIWriter) Close() error {
+	if avi.closed {
+		return nil
+	}
+	avi.closed = true
+
+	moviSize := avi.offset - avi.moviStart
+	idx := make([]byte, 0, 16*len(avi.index))
+	for _, entry := range avi.index {
+		idx = append(idx, entry.id...)
+		idx = appendUint32(idx, entry.flags)
+		idx = appendUint32(idx, entry.offset)
+		idx = appendUint32(idx, entry.size)
+	}
+	if err := avi.write([]byte("idx1")); err != nil {
+		return err
+	}
+	if err := avi.write(appendUint32(nil, uint32(len(idx)))); err != nil {
+		return err
+	}
+	if err := avi.write(idx); err != nil {
+		return err
+	}
+	avi.size = avi.offset
+
+	// rewrite the headers now that the counts are known
+	if _, err := avi.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	avi.offset = 0
+	if err := avi.writeHeaders(); err != nil {
+		return err
+	}
+	if _, err := avi.w.Seek(avi.moviStart-4, io.SeekStart); err != nil {
+		return err
+	}
+	if err := avi.write(appendUint32(nil, uint32(moviSize))); err != nil {
+		return err
+	}
+	_, err := avi.w.Seek(avi.size, io.SeekStart)
+	if err == nil && avi.size > maxAVISize {
+		err = ErrAVITooLarge
+	}
+
+	return err
+}
+
+// writeHeaders writes the RIFF header, the hdrl list and the start of
+// the movi list, using the counts so far
+func (avi *AVIWriter) writeHeaders() error {
+	frameSize := avi.width * avi.height * 3
+	blockAlign := avi.channels * 2
+	microsPerFrame := uint32(1000000 / avi.fps)
+	maxBytesPerSec := uint32(frameSize*avi.fps + avi.sampleRate*blockAlign)
+
+	// main header
+	avih := appendUint32(nil, microsPerFrame)
+	avih = appendUint32(avih, maxBytesPerSec)
+	avih = appendUint32(avih, 0)    // padding granularity
+	avih = appendUint32(avih, 0x10) // AVIF_HASINDEX
+	avih = appendUint32(avih, uint32(avi.frames))
+	avih = appendUint32(avih, 0) // initial frames
+	avih = appendUint32(avih, 2) // streams
+	avih = appendUint32(avih, uint32(frameSize))
+	avih = appendUint32(avih, uint32(avi.width))
+	avih = appendUint32(avih, uint32(avi.height))
+	avih = append(avih, make([]byte, 16)...)
+
+	// video stream
+	handler, compression := "DIB ", uint32(0)
+	if avi.codec == AVIMJPEG {
+		handler, compression = "MJPG", binary.LittleEndian.Uint32([]byte("MJPG"))
+	}
+	vids := streamHeader("vids", handler, 1, uint32(avi.fps), uint32(avi.frames), uint32(frameSize), 0, avi.width, avi.height)
+	bitmapInfo := appendUint32(nil, 40)
+	bitmapInfo = appendUint32(bitmapInfo, uint32(avi.width))
+	bitmapInfo = appendUint32(bitmapInfo, uint32(avi.height))
+	bitmapInfo = appendUint16(bitmapInfo, 1)  // planes
+	bitmapInfo = appendUint16(bitmapInfo, 24) // bits per pixel
+	bitmapInfo = appendUint32(bitmapInfo, compression)
+	bitmapInfo = appendUint32(bitmapInfo, uint32(frameSize))
+	bitmapInfo = append(bitmapInfo, make([]byte, 16)...)
+
+	// audio stream
+	auds := streamHeader("auds", "\x00\x00\x00\x00", uint32(blockAlign), uint32(avi.sampleRate*blockAlign),
+		uint32(avi.audioBytes/blockAlign), 0, uint32(blockAlign), 0, 0)
+	waveFormat := appendUint16(nil, 1) // PCM
+	waveFormat = appendUint16(waveFormat, uint16(avi.channels))
+	waveFormat = appendUint32(waveFormat, uint32(avi.sampleRate))
+	waveFormat = appendUint32(waveFormat, uint32(avi.sampleRate*blockAlign))
+	waveFormat = appendUint16(waveFormat, uint16(blockAlign))
+	waveFormat = appendUint16(waveFormat, 16)
+
+	hdrl := list("hdrl",
+		chunk("avih", avih),
+		list("strl", chunk("strh", vids), chunk("strf", bitmapInfo)),
+		list("strl", chunk("strh", auds), chunk("strf", waveFormat)),
+	)
+
+	var riffSize uint32
+	if avi.size > 0 {
+		riffSize = uint32(avi.size - 8)
+	}
+	header := append([]byte("RIFF"), appendUint32(nil, riffSize)...)
+	header = append(header, "AVI "...)
+	header = append(header, hdrl...)
+	header = append(header, "LIST"...)
+	header = appendUint32(header, 0) // movi size, filled in by Close
+	header = append(header, "movi"...)
+
+	return avi.write(header)
+}
+
+// bitmap converts an image to bottom-up BGR rows, as AVI expects
+func (avi *AVIWriter) bitmap(img image.Image) []byte {
+	if avi.frame == nil {
+		avi.frame = make([]byte, avi.width*avi.height*3)
+	}
+	b := img.Bounds()
+	i := 0
+	for y := b.Max.Y - 1; y >= b.Min.Y; y-- {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			avi.frame[i] = byte(bl >> 8)
+			avi.frame[i+1] = byte(g >> 8)
+			avi.frame[i+2] = byte(r >> 8)
+			i += 3
+		}
+	}
+
+	return avi.frame
+}
+
+func (avi *AVIWriter) writeChunk(id string, flags uint32, data []byte) error {
+	avi.index = append(avi.index, aviIndexEntry{
+		id:     id,
+		flags:  flags,
+		offset: uint32(avi.offset - avi.moviStart),
+		size:   uint32(len(data)),
+	})
+	if avi.offset+int64(len(data)) > maxAVISize {
+		return ErrAVITooLarge
+	}
+
+	return avi.write(chunk(id, data))
+}
+
+func (avi *AVIWriter) write(data []byte) error {
+	n, err := avi.w.Write(data)
+	avi.offset += int64(n)
+
+	return err
+}
+
+func streamHeader(kind, handler string, scale, rate, length, bufferSize, sampleSize uint32, width, height int) []byte {
+	h := append([]byte(kind), handler...)
+	h = appendUint32(h, 0) // flags
+	h = appendUint32(h, 0) // priority and language
+	h = appendUint32(h, 0) // initial frames
+	h = appendUint32(h, scale)
+	h = appendUint32(h, rate)
+	h = appendUint32(h, 0) // start
+	h = appendUint32(h, length)
+	h = appendUint32(h, bufferSize)
+	h = appendUint32(h, 0xFFFFFFFF) // default quality
+	h = appendUint32(h, sampleSize)
+	h = appendUint16(h, 0)
+	h = appendUint16(h, 0)
+	h = appendUint16(h, uint16(width))
+	h = appendUint16(h, uint16(height))
+
+	return h
+}
+
+// chunk is a RIFF chunk, padded to an even length
+func chunk(id string, data []byte) []byte {
+	c := append([]byte(id), appendUint32(nil, uint32(len(data)))...)
+	c = append(c, data...)
+	if len(data)%2 == 1 {
+		c = append(c, 0)
+	}
+
+	return c
+}
+
+// list is a RIFF list of chunks
+func list(kind string, chunks ...[]byte) []byte {
+	var body []byte
+	body = append(body, kind...)
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+
+	return chunk("LIST", body)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
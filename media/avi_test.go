@@ -0,0 +1,101 @@
+package media
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAVIWriter(t *testing.T) {
+	for _, codec := range []string{AVIRaw, AVIMJPEG} {
+		t.Run(codec, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "chip8go-*.avi")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			avi, err := NewAVIWriter(f, 4, 2, 60, codec, 44100, 2, 90)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+			img.Set(0, 0, color.RGBA{0x10, 0x20, 0x30, 0xFF})
+			samples := make([]byte, 735*4)
+			for i := 0; i < 3; i++ {
+				if err := avi.WriteFrame(img, samples); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := avi.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			contents, err := ioutil.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents[0:4]) != "RIFF" || string(contents[8:12]) != "AVI " {
+				t.Fatalf("Expected a RIFF AVI header")
+			}
+			if size := binary.LittleEndian.Uint32(contents[4:]); size != uint32(len(contents)-8) {
+				t.Errorf("Expected RIFF size %d but was %d", len(contents)-8, size)
+			}
+
+			// the main header follows "LIST size hdrl avih size"
+			if frames := binary.LittleEndian.Uint32(contents[48:]); frames != 3 {
+				t.Errorf("Expected 3 frames in the header but was %d", frames)
+			}
+
+			// walk the top level chunks to check their sizes add up
+			var ids []string
+			var idx1 []byte
+			for offset := 12; offset < len(contents); {
+				id := string(contents[offset : offset+4])
+				size := int(binary.LittleEndian.Uint32(contents[offset+4:]))
+				if id == "LIST" {
+					id = string(contents[offset+8 : offset+12])
+				}
+				if id == "idx1" {
+					idx1 = contents[offset+8 : offset+8+size]
+				}
+				ids = append(ids, id)
+				offset += 8 + size + size%2
+				if offset > len(contents) {
+					t.Fatalf("Chunk %s runs past the end of the file", id)
+				}
+			}
+			if len(ids) != 3 || ids[0] != "hdrl" || ids[1] != "movi" || ids[2] != "idx1" {
+				t.Fatalf("Expected hdrl, movi and idx1 but was %v", ids)
+			}
+
+			// video and audio alternate so they stay in sync
+			if len(idx1) != 6*16 {
+				t.Fatalf("Expected 6 index entries but was %d bytes", len(idx1))
+			}
+			for i := 0; i < 6; i++ {
+				id := string(idx1[i*16 : i*16+4])
+				if i%2 == 1 && id != "01wb" || i%2 == 0 && id[:2] != "00" {
+					t.Errorf("Index entry %d is %s", i, id)
+				}
+			}
+		})
+	}
+}
+
+func TestAVIWriterBitmapIsBottomUpBGR(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1, 2))
+	img.Set(0, 0, color.RGBA{1, 2, 3, 0xFF})
+	img.Set(0, 1, color.RGBA{4, 5, 6, 0xFF})
+
+	avi := &AVIWriter{width: 1, height: 2}
+	got := avi.bitmap(img)
+	want := []byte{6, 5, 4, 3, 2, 1}
+	if string(got) != string(want) {
+		t.Errorf("Expected %v but was %v", want, got)
+	}
+}
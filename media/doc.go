@@ -0,0 +1,3 @@
+// Package media writes emulator output to standard file formats
+// without any external tools.
+package media
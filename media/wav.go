@@ -0,0 +1,86 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// WAVWriter writes 16-bit PCM samples to a RIFF WAVE file.
+// The sizes in the header are filled in by Close, so the output
+// must be seekable.
+type WAVWriter struct {
+	w          io.WriteSeeker
+	sampleRate int
+	channels   int
+	dataBytes  int64
+	closed     bool
+}
+
+const wavHeaderSize = 44
+
+// NewWAVWriter starts a WAV file with the given sample rate and channel count
+func NewWAVWriter(w io.WriteSeeker, sampleRate, channels int) (*WAVWriter, error) {
+	wav := &WAVWriter{w: w, sampleRate: sampleRate, channels: channels}
+	if err := wav.writeHeader(); err != nil {
+		return nil, err
+	}
+
+	return wav, nil
+}
+
+// Write appends interleaved 16-bit little-endian samples
+func (wav *WAVWriter) Write(samples []byte) (int, error) {
+	if wav.closed {
+		return 0, errors.New("media: write to closed WAVWriter")
+	}
+	n, err := wav.w.Write(samples)
+	wav.dataBytes += int64(n)
+
+	return n, err
+}
+
+// Close fills in the header sizes. It doesn't close the underlying writer.
+func (wav *WAVWriter) Close() error {
+	if wav.closed {
+		return nil
+	}
+	wav.closed = true
+
+	// chunks are padded to an even length
+	if wav.dataBytes%2 == 1 {
+		if _, err := wav.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	if _, err := wav.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := wav.writeHeader(); err != nil {
+		return err
+	}
+	_, err := wav.w.Seek(0, io.SeekEnd)
+
+	return err
+}
+
+func (wav *WAVWriter) writeHeader() error {
+	blockAlign := wav.channels * 2
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(wavHeaderSize-8+wav.dataBytes+wav.dataBytes%2))
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(wav.channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(wav.sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(wav.sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(wav.dataBytes))
+
+	_, err := wav.w.Write(header)
+	return err
+}
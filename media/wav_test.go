@@ -0,0 +1,49 @@
+package media
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWAVWriter(t *testing.T) {
+	f, err := ioutil.TempFile("", "chip8go-*.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	wav, err := NewWAVWriter(f, 44100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+	if _, err := wav.Write(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := wav.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != wavHeaderSize+len(samples) {
+		t.Fatalf("Expected %d bytes but was %d", wavHeaderSize+len(samples), len(contents))
+	}
+	if string(contents[0:4]) != "RIFF" || string(contents[8:12]) != "WAVE" {
+		t.Errorf("Expected a RIFF WAVE header")
+	}
+	if size := binary.LittleEndian.Uint32(contents[4:]); size != uint32(len(contents)-8) {
+		t.Errorf("Expected RIFF size %d but was %d", len(contents)-8, size)
+	}
+	if size := binary.LittleEndian.Uint32(contents[40:]); size != uint32(len(samples)) {
+		t.Errorf("Expected data size %d but was %d", len(samples), size)
+	}
+	if rate := binary.LittleEndian.Uint32(contents[24:]); rate != 44100 {
+		t.Errorf("Expected sample rate 44100 but was %d", rate)
+	}
+}
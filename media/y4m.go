@@ -0,0 +1,102 @@
+package media
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Y4MWriter writes frames to a YUV4MPEG2 stream, the uncompressed format
+// read by most encoders. Colours are converted to full-range BT.601 with
+// 4:2:0 chroma, averaged over each 2x2 block.
+type Y4MWriter struct {
+	w             *bufio.Writer
+	width, height int
+	y, cb, cr     []byte
+}
+
+// NewY4MWriter starts a stream of frames of the given size and frame rate.
+// The output needn't be seekable.
+func NewY4MWriter(w io.Writer, width, height, fps int) (*Y4MWriter, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C420jpeg\n", width, height, fps); err != nil {
+		return nil, err
+	}
+
+	chromaSize := ((width + 1) / 2) * ((height + 1) / 2)
+	return &Y4MWriter{
+		w:      bw,
+		width:  width,
+		height: height,
+		y:      make([]byte, width*height),
+		cb:     make([]byte, chromaSize),
+		cr:     make([]byte, chromaSize),
+	}, nil
+}
+
+// WriteFrame appends a frame
+func (y4m *Y4MWriter) WriteFrame(img image.Image) error {
+	b := img.Bounds()
+	if b.Dx() != y4m.width || b.Dy() != y4m.height {
+		return errors.New("media: frame size doesn't match the Y4M stream")
+	}
+
+	chromaWidth := (y4m.width + 1) / 2
+	sumCb := make([]int, len(y4m.cb))
+	sumCr := make([]int, len(y4m.cr))
+	counts := make([]int, len(y4m.cb))
+	for y := 0; y < y4m.height; y++ {
+		for x := 0; x < y4m.width; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			luma, cb, cr := rgbToYCbCr(int(r>>8), int(g>>8), int(bl>>8))
+			y4m.y[y*y4m.width+x] = byte(luma)
+
+			i := (y/2)*chromaWidth + x/2
+			sumCb[i] += cb
+			sumCr[i] += cr
+			counts[i]++
+		}
+	}
+	for i, n := range counts {
+		y4m.cb[i] = byte((sumCb[i] + n/2) / n)
+		y4m.cr[i] = byte((sumCr[i] + n/2) / n)
+	}
+
+	if _, err := y4m.w.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+	for _, plane := range [][]byte{y4m.y, y4m.cb, y4m.cr} {
+		if _, err := y4m.w.Write(plane); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close flushes the stream. It doesn't close the underlying writer.
+func (y4m *Y4MWriter) Close() error {
+	return y4m.w.Flush()
+}
+
+// rgbToYCbCr converts to full-range BT.601, as JPEG does
+func rgbToYCbCr(r, g, b int) (int, int, int) {
+	y := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	cb := (-11056*r - 21712*g + 32768*b + 257<<15) >> 16
+	cr := (32768*r - 27440*g - 5328*b + 257<<15) >> 16
+
+	return clamp(y), clamp(cb), clamp(cr)
+}
+
+func clamp(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+
+	return v
+}
@@ -0,0 +1,39 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestY4MWriter(t *testing.T) {
+	var buf bytes.Buffer
+	y4m, err := NewY4MWriter(&buf, 4, 2, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			img.Set(x, y, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF})
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := y4m.WriteFrame(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := y4m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	header := "YUV4MPEG2 W4 H2 F60:1 Ip A1:1 C420jpeg\n"
+	frame := "FRAME\n" +
+		"\xFF\xFF\x00\x00\xFF\xFF\x00\x00" + // luma
+		"\x80\x80" + // blue chroma
+		"\x80\x80" // red chroma
+	if want := header + frame + frame; buf.String() != want {
+		t.Errorf("Expected %q but was %q", want, buf.String())
+	}
+}
@@ -0,0 +1,312 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+)
+
+const (
+	memRowBytes = 16
+	// where a row's hex and ASCII columns start, in characters,
+	// as debug.WriteHexDump lays them out
+	memHexColumn   = 7
+	memASCIIColumn = memHexColumn + 3*memRowBytes + 2
+
+	// recentWriteFrames is how long written bytes stay highlighted
+	recentWriteFrames = emu.FrameRate
+)
+
+var (
+	memBackground   = color.RGBA{0x00, 0x00, 0x00, 0xE0}
+	memFont         = color.RGBA{0x20, 0x30, 0x70, 0xFF}
+	memInterpreter  = color.RGBA{0x30, 0x30, 0x30, 0xFF}
+	memProgram      = color.RGBA{0x10, 0x40, 0x20, 0xFF}
+	memIndex        = color.RGBA{0x90, 0x80, 0x00, 0xFF}
+	memCursor       = color.RGBA{0x90, 0x20, 0x90, 0xFF}
+	memRecentWrites = color.RGBA{0xC0, 0x20, 0x20, 0xFF}
+)
+
+// memoryView is the memory viewer, a hex editor drawn over the game
+// that F8 opens and closes. The game is paused when it opens, and
+// the keyboard goes to the viewer instead of the keypad.
+// Arrows and Page Up and Down move the cursor, and typing two hex digits
+// changes the byte under it. Space runs or pauses the game, I jumps to
+// the byte at I, G goes to an address, / finds a byte pattern and :
+// runs a monitor command, such as save or load.
+type memoryView struct {
+	open bool
+	// resume is set if the game was running when the viewer opened
+	resume bool
+	cursor uint16
+	// top is the first address shown, and rows how many rows fit
+	top  uint16
+	rows int
+	// high is the first hex digit typed for the byte at the cursor, or -1
+	high int
+
+	prompt  textPrompt
+	message string
+
+	monitor *debug.Monitor
+	ages    []int
+}
+
+// toggleMemoryView opens or closes the memory viewer,
+// making a debugger to run the game if there isn't one
+func (g *Game) toggleMemoryView() {
+	v := &g.memView
+	if v.open {
+		v.open = false
+		g.debugger.TrackWrites(false)
+		if v.resume {
+			g.debugger.Continue()
+		}
+		return
+	}
+
+	g.closeOverlays()
+	g.attachDebugger()
+	if v.monitor == nil {
+		v.monitor = debug.NewMonitor(g.debugger, "memory view")
+		v.monitor.Control = true
+		v.high = -1
+		v.cursor = emu.RamProgramStart
+		v.rows = 1
+	}
+	v.open = true
+	v.resume = !g.debugger.Stopped()
+	v.message = ""
+	g.debugger.TrackWrites(true)
+	g.debugger.Pause()
+}
+
+// updateMemoryView handles the keyboard while the memory viewer is open
+func (g *Game) updateMemoryView() {
+	v := &g.memView
+	if v.prompt.active() {
+		if label, line, entered := v.prompt.update(); entered {
+			v.message = ""
+			if err := g.runMemoryPrompt(label, line); err != nil {
+				v.message = err.Error()
+			}
+		}
+		return
+	}
+
+	move := 0
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		g.toggleMemoryView()
+		return
+	case repeating(ebiten.KeyLeft):
+		move = -1
+	case repeating(ebiten.KeyRight):
+		move = 1
+	case repeating(ebiten.KeyUp):
+		move = -memRowBytes
+	case repeating(ebiten.KeyDown):
+		move = memRowBytes
+	case repeating(ebiten.KeyPageUp):
+		move = -memRowBytes * v.rows
+	case repeating(ebiten.KeyPageDown):
+		move = memRowBytes * v.rows
+	}
+	if move != 0 {
+		v.moveTo(int(v.cursor) + move)
+		return
+	}
+
+	for _, c := range ebiten.InputChars() {
+		// the rest of what was typed with : or / goes to the prompt
+		if v.prompt.active() {
+			v.prompt.input = append(v.prompt.input, c)
+			continue
+		}
+		switch c {
+		case ' ':
+			g.togglePause()
+		case 'g', 'G':
+			v.prompt.start("goto ")
+		case '/':
+			v.prompt.start("find ")
+		case ':':
+			v.prompt.start(":")
+		case 'i', 'I':
+			g.debugger.View(func(e *emu.Emulator) {
+				v.moveTo(int(e.CPU().I))
+			})
+		default:
+			g.typeHexDigit(c)
+		}
+	}
+}
+
+// typeHexDigit edits the byte at the cursor, a nibble at a time
+func (g *Game) typeHexDigit(c rune) {
+	v := &g.memView
+	digit := strings.IndexRune("0123456789abcdef", c|0x20)
+	if digit < 0 {
+		return
+	}
+	if v.high < 0 {
+		v.high = digit
+		return
+	}
+
+	addr, b := v.cursor, byte(v.high<<4|digit)
+	g.debugger.Edit(func(e *emu.Emulator) {
+		e.Memory().RAM[addr] = b
+	})
+	v.high = -1
+	v.moveTo(int(v.cursor) + 1)
+}
+
+// moveTo moves the cursor, scrolling to keep it in view
+func (v *memoryView) moveTo(addr int) {
+	if addr < 0 {
+		addr = 0
+	}
+	if addr >= emu.RamSize {
+		addr = emu.RamSize - 1
+	}
+	v.cursor = uint16(addr)
+	v.high = -1
+
+	row := addr &^ (memRowBytes - 1)
+	switch {
+	case row < int(v.top):
+		v.top = uint16(row)
+	case row >= int(v.top)+v.rows*memRowBytes:
+		v.top = uint16(row - (v.rows-1)*memRowBytes)
+	}
+}
+
+func (g *Game) runMemoryPrompt(prompt, line string) error {
+	v := &g.memView
+	switch prompt {
+	case "goto ":
+		addr, err := g.debugger.Symbols.Resolve(line)
+		if err != nil {
+			return err
+		}
+		v.moveTo(int(addr))
+	case "find ":
+		p, err := debug.ParsePattern(line)
+		if err != nil {
+			return err
+		}
+		found := -1
+		g.debugger.View(func(e *emu.Emulator) {
+			found = p.Find(e.Memory().RAM[:], int(v.cursor)+1)
+		})
+		if found < 0 {
+			return fmt.Errorf("%s not found", line)
+		}
+		v.moveTo(found)
+	default:
+		out, err := v.monitor.Exec(line)
+		if err != nil {
+			return err
+		}
+		// only the first line fits
+		v.message = strings.SplitN(out, "\n", 2)[0]
+	}
+
+	return nil
+}
+
+// drawMemoryView draws the memory viewer over the game
+func (g *Game) drawMemoryView(screen *ebiten.Image) {
+	v := &g.memView
+	w, h := screen.Size()
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), memBackground)
+
+	v.rows = (h - 2*charH) / charH
+	if v.rows < 1 {
+		v.rows = 1
+	}
+	start := int(v.top)
+	end := start + v.rows*memRowBytes
+	if end > emu.RamSize {
+		end = emu.RamSize
+	}
+
+	mem := make([]byte, end-start)
+	var index, pc uint16
+	g.debugger.View(func(e *emu.Emulator) {
+		copy(mem, e.Memory().RAM[start:end])
+		index, pc = e.CPU().I, e.CPU().PC
+	})
+	if len(v.ages) != len(mem) {
+		v.ages = make([]int, len(mem))
+	}
+	g.debugger.Written(v.top, v.ages)
+
+	for i := range mem {
+		addr := uint16(start + i)
+		c := memFont
+		switch debug.RegionOf(addr) {
+		case debug.RegionInterpreter:
+			c = memInterpreter
+		case debug.RegionProgram:
+			c = memProgram
+		}
+		if age := v.ages[i]; age >= 0 && age < recentWriteFrames {
+			c = memRecentWrites
+		}
+		if addr == index {
+			c = memIndex
+		}
+		if addr == v.cursor {
+			c = memCursor
+		}
+		memCell(screen, i, c)
+	}
+
+	var dump strings.Builder
+	debug.WriteHexDump(&dump, mem, v.top)
+	ebitenutil.DebugPrintAt(screen, dump.String(), 0, charH)
+
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s %s  I=0x%03X PC=0x%03X  %s", v.cursorText(), debug.RegionOf(v.cursor), index, pc, g.runState()), 0, 0)
+
+	status := "arrows move  0-F edit  g goto  / find  i to I  : command  space run  F8 close"
+	switch {
+	case v.prompt.active():
+		status = v.prompt.String()
+	case v.message != "":
+		status = v.message
+	}
+	ebitenutil.DebugPrintAt(screen, status, 0, h-charH)
+}
+
+// cursorText is the cursor's address, with the first digit typed for it
+func (v *memoryView) cursorText() string {
+	s := fmt.Sprintf("0x%03X", v.cursor)
+	if v.high >= 0 {
+		s += fmt.Sprintf(" = %X_", v.high)
+	}
+
+	return s
+}
+
+// memCell fills the background of the ith byte shown, in both columns
+func memCell(screen *ebiten.Image, i int, c color.Color) {
+	row, col := i/memRowBytes, i%memRowBytes
+	y := float64(charH + row*charH)
+	hex := memHexColumn + 3*col
+	if col >= memRowBytes/2 {
+		hex++
+	}
+	ebitenutil.DrawRect(screen, float64(hex*charW), y, 2*charW+2, charH, c)
+	ebitenutil.DrawRect(screen, float64((memASCIIColumn+col)*charW), y, charW+1, charH, c)
+}
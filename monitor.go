@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+)
+
+const monitorPrompt = "(chip8go) "
+
+// runMonitor runs debugger commands read from in, such as
+// break 0x206 if V3 == 0x10, until in ends
+func runMonitor(d *debug.Debugger, in io.Reader, out io.Writer) {
+	m := debug.NewMonitor(d, "monitor")
+	m.Control = true
+	d.OnStop(func(reason string) {
+		var pc uint16
+		d.View(func(e *emu.Emulator) {
+			pc = e.CPU().PC
+		})
+		fmt.Fprintf(out, "\nstopped at 0x%03X (%s)\n%s", pc, reason, monitorPrompt)
+	})
+
+	fmt.Fprint(out, monitorPrompt)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		output, err := m.Exec(scanner.Text())
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "error: %v\n", err)
+		case output != "":
+			fmt.Fprintln(out, output)
+		}
+		fmt.Fprint(out, monitorPrompt)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build headless
+// +build headless
+
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/szTheory/chip8go/analysis"
+	"github.com/szTheory/chip8go/emu"
+)
+
+// Built with the headless tag, chip8go leaves out the window and audio
+// so it can run without a display. Only the non-GUI commands work.
+
+func playGame(r *runArgs) error {
+	return errors.New("this chip8go was built without a GUI (headless tag); it can't play games")
+}
+
+// debugGame runs a game for a debugging client without a window,
+// in real time with no keys held, until the client disconnects
+func debugGame(req launchRequest) error {
+	rom, err := emu.ReadROM(req.run.romFilename)
+	if err != nil {
+		req.ready <- err
+		return err
+	}
+	quirks, _ := romQuirks(req.run.options.Quirks, analysis.Detect(rom))
+	e := &emu.Emulator{
+		Quirks:   quirks,
+		Seed:     req.run.options.Seed,
+		Beeper:   emu.NewBeeper(req.run.options.beeperSettings()),
+		Compiled: compiledFor(emu.HashROM(rom)),
+	}
+	e.SetupROM(rom)
+	req.debug.Reset(e)
+	req.ready <- nil
+
+	ticker := time.NewTicker(time.Second / emu.FrameRate)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := req.debug.RunFrame(req.run.options.Speed, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkKeys accepts any keymap, since there are no keys to map
+func (s *settings) checkKeys() error {
+	return nil
+}
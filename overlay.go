@@ -0,0 +1,103 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/szTheory/chip8go/debug"
+)
+
+// the size of a character of ebitenutil's debug font,
+// which the debugging overlays are written in
+const (
+	charW = 6
+	charH = 16
+)
+
+// attachDebugger makes a debugger to run the game if there isn't one,
+// for the debugging overlays
+func (g *Game) attachDebugger() {
+	if g.debugger == nil {
+		g.debugger = debug.New(g.emulator)
+		g.debugger.Continue()
+	}
+}
+
+// closeOverlays closes any overlay that is open, before another opens
+func (g *Game) closeOverlays() {
+	switch {
+	case g.memView.open:
+		g.toggleMemoryView()
+	case g.spriteView.open:
+		g.toggleSpriteView()
+	case g.cheatView.open:
+		g.toggleCheatView()
+	}
+}
+
+// togglePause runs or pauses the game from an overlay
+func (g *Game) togglePause() {
+	if g.debugger.Stopped() {
+		g.debugger.Continue()
+	} else {
+		g.debugger.Pause()
+	}
+}
+
+// runState describes whether the game is running, for an overlay's status
+func (g *Game) runState() string {
+	if g.debugger.Stopped() {
+		return "paused"
+	}
+
+	return "running"
+}
+
+// repeating reports whether a key was just pressed, or has been held
+// long enough to repeat
+func repeating(key ebiten.Key) bool {
+	d := inpututil.KeyPressDuration(key)
+	return d == 1 || d > 20 && d%3 == 0
+}
+
+// textPrompt is a line typed into an overlay after a key such as / opens it
+type textPrompt struct {
+	label string
+	input []rune
+}
+
+// active reports whether a line is being typed
+func (p *textPrompt) active() bool {
+	return p.label != ""
+}
+
+// start begins typing a line after a label such as "goto "
+func (p *textPrompt) start(label string) {
+	p.label, p.input = label, nil
+}
+
+// update takes what was typed, returning the label and the line once Enter
+// is pressed. Esc abandons the line.
+func (p *textPrompt) update() (label, line string, entered bool) {
+	p.input = append(p.input, ebiten.InputChars()...)
+	switch {
+	case repeating(ebiten.KeyBackspace) && len(p.input) > 0:
+		p.input = p.input[:len(p.input)-1]
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		p.label = ""
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		label, line = p.label, strings.TrimSpace(string(p.input))
+		p.label = ""
+		return label, line, true
+	}
+
+	return "", "", false
+}
+
+func (p *textPrompt) String() string {
+	return p.label + string(p.input) + "_"
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+)
+
+// profileTop is how many of the hottest addresses the report lists by default
+const profileTop = 20
+
+// profileArgs are the arguments to the profile command
+type profileArgs struct {
+	headlessArgs
+	movieFilename string
+	pprof         string
+	top           int
+}
+
+func (p *profileArgs) flags(name string) *flag.FlagSet {
+	fs := headlessFlags(name, &p.headlessArgs, &p.movieFilename)
+	fs.StringVar(&p.pprof, "pprof", "", "also write the profile to a `file` for go tool pprof")
+	fs.IntVar(&p.top, "top", profileTop, "how many of the hottest addresses to list")
+
+	return fs
+}
+
+// runProfile runs a game for some frames, counting what it spends its
+// cycles on, and writes a report to the -o file or stdout
+func runProfile(args []string) error {
+	p := &profileArgs{headlessArgs: headlessArgs{options: defaultOptions()}}
+	fs := p.flags("profile")
+	if err := parseHeadless("profile", fs, &p.headlessArgs, &p.movieFilename, args); err != nil {
+		return err
+	}
+	if len(p.Watch) > 0 {
+		return usageError("profile", "memory can't be watched while profiling")
+	}
+	if p.top < 0 {
+		return usageError("profile", "invalid top %d", p.top)
+	}
+
+	e := p.emulator()
+	profile := debug.NewProfile()
+	for n := 0; n < p.frames; n++ {
+		var keys emu.Keys
+		if p.movie != nil {
+			keys = p.movie.Keys(n)
+		}
+		profile.RunFrame(e, p.Speed, keys)
+	}
+
+	if p.pprof != "" {
+		f, err := os.Create(p.pprof)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := profile.WritePprof(f, e.Memory(), filepath.Base(p.romFilename)); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	if p.out == "" {
+		return profile.WriteReport(os.Stdout, e.Memory(), p.top)
+	}
+	f, err := os.Create(p.out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := profile.WriteReport(f, e.Memory(), p.top); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/szTheory/chip8go/analysis"
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/recompile"
+)
+
+// compiledPrograms are the ROMs recompiled into chip8go, which the files
+// chip8go recompile writes into package main add as the program starts
+var compiledPrograms []*emu.CompiledProgram
+
+// compiledFor is the recompiled code for the ROM with a hash, or nil
+// if it wasn't recompiled into chip8go
+func compiledFor(hash string) *emu.CompiledProgram {
+	for _, p := range compiledPrograms {
+		if p.ROMHash() == hash {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// recompileArgs are the arguments to the recompile command
+type recompileArgs struct {
+	recompile.Options
+	out string
+}
+
+func (r *recompileArgs) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.StringVar(&r.out, "o", "", "write the Go source to this `file` instead of stdout")
+	fs.StringVar(&r.Package, "package", "main", "the generated file's `package`")
+	fs.BoolVar(&r.Standalone, "standalone", false, "add a main function that runs the ROM without a window and prints the screen")
+	fs.StringVar(&r.Quirks, "quirks", quirksAuto, "the quirks a standalone program runs with by default, or auto to detect them from the ROM: "+emu.QuirkNames())
+
+	return fs
+}
+
+// runRecompile translates a ROM's reachable code into Go source, then
+// says how much of it was recompiled
+func runRecompile(args []string) error {
+	r := new(recompileArgs)
+	rest, err := parseInterspersed(r.flags("recompile"), args)
+	if err != nil {
+		return flagError("recompile", err)
+	}
+	if len(rest) != 1 {
+		return usageError("recompile", "expected exactly one ROM file")
+	}
+
+	rom, err := emu.ReadROM(rest[0])
+	if err != nil {
+		return err
+	}
+	o := r.Options
+	o.Name = filepath.Base(rest[0])
+	if o.Quirks == quirksAuto {
+		o.Quirks = analysis.Detect(rom).Quirks
+	}
+	if _, err := emu.ParseQuirks(o.Quirks); err != nil {
+		return usageError("recompile", "%v", err)
+	}
+
+	if r.out == "" {
+		return generate(os.Stdout, rom, o)
+	}
+	f, err := os.Create(r.out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := generate(f, rom, o); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// generate writes the Go source and says how much was recompiled
+func generate(w io.Writer, rom []byte, o recompile.Options) error {
+	stats, err := recompile.Generate(w, rom, o)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "recompiled %s\n", stats)
+
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package recompile translates a CHIP-8 program's reachable code into Go
+// source ahead of time, as functions that run its blocks of instructions
+// against the emulator's machine state.
+package recompile
@@ -0,0 +1,334 @@
+package recompile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+
+	"github.com/szTheory/chip8go/analysis"
+	"github.com/szTheory/chip8go/emu"
+)
+
+// maxBlockLength is the most instructions a block runs, as a block only
+// runs if the rest of the frame has room for all of it
+const maxBlockLength = 8
+
+// Options are how the Go source is written
+type Options struct {
+	// Package is the package of the generated file, main if it is empty.
+	// A file in package main that isn't Standalone is for building into
+	// chip8go, which then runs the ROM recompiled.
+	Package string
+	// Standalone adds a main function that runs the ROM without a window,
+	// so the file builds into a program of its own
+	Standalone bool
+	// Name is the ROM's file name, for comments
+	Name string
+	// Quirks are what a standalone program runs with unless told
+	// otherwise, in the form ParseQuirks takes
+	Quirks string
+}
+
+// Stats counts what was recompiled and what is left to the interpreter
+type Stats struct {
+	Blocks       int
+	Instructions int
+	// SelfModified are the blocks left out as writes through I can change them
+	SelfModified int
+	// Uncompiled are the instructions the emulator doesn't run, or that
+	// are outside the ROM, which are left to the interpreter
+	Uncompiled int
+	// Computed are the Bnnn jumps, which the interpreter carries on from
+	// until it reaches a block
+	Computed int
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d blocks of %d instructions; left to the interpreter: %d self-modified blocks, %d instructions, %d computed jumps",
+		s.Blocks, s.Instructions, s.SelfModified, s.Uncompiled, s.Computed)
+}
+
+// Generate writes Go source declaring Program, a ROM's reachable code
+// recompiled into a function for each block, for Emulator.Compiled. Blocks
+// are split from the control-flow graph after instructions that write
+// through I or wait for a key, so that a write can only change blocks
+// that haven't started, which the emulator checks before running them.
+func Generate(w io.Writer, rom []byte, o Options) (Stats, error) {
+	if o.Package == "" {
+		o.Package = "main"
+	}
+	if o.Standalone && o.Package != "main" {
+		return Stats{}, fmt.Errorf("a standalone program needs package main, not %s", o.Package)
+	}
+	if len(rom) > emu.RamProgramSize {
+		return Stats{}, emu.ErrROMTooLarge
+	}
+
+	p := analysis.Analyze(rom)
+	blocks, stats := split(p, len(rom))
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by chip8go recompile from %s. DO NOT EDIT.\n\n", o.Name)
+	fmt.Fprintf(&src, "package %s\n\n", o.Package)
+	if o.Standalone {
+		fmt.Fprintf(&src, "import (\n\"flag\"\n\"fmt\"\n\"os\"\n\n\"github.com/szTheory/chip8go/emu\"\n)\n\n")
+	} else {
+		fmt.Fprintf(&src, "import \"github.com/szTheory/chip8go/emu\"\n\n")
+	}
+	fmt.Fprintf(&src, "// Program is %s recompiled, for emu.Emulator's Compiled field\nvar Program = emu.NewCompiledProgram(rom, blocks)\n\n", o.Name)
+	if o.Package == "main" && !o.Standalone {
+		// chip8go runs the ROMs in compiledPrograms recompiled
+		fmt.Fprintf(&src, "func init() {\ncompiledPrograms = append(compiledPrograms, Program)\n}\n\n")
+	}
+
+	fmt.Fprintf(&src, "// rom is %s, which the blocks were compiled from\nvar rom = []byte{", o.Name)
+	for i, b := range rom {
+		if i%16 == 0 {
+			src.WriteString("\n")
+		}
+		fmt.Fprintf(&src, "0x%02X,", b)
+	}
+	src.WriteString("\n}\n\n")
+
+	src.WriteString("var blocks = []emu.CompiledBlock{\n")
+	for _, b := range blocks {
+		fmt.Fprintf(&src, "{Start: 0x%03X, End: 0x%03X, Length: %d, Run: %s},\n", b.start(), b.end(), len(b), b.name())
+	}
+	src.WriteString("}\n")
+
+	for _, b := range blocks {
+		writeBlock(&src, b)
+	}
+	if o.Standalone {
+		writeMain(&src, o.Quirks)
+	}
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return Stats{}, fmt.Errorf("formatting the generated source: %v", err)
+	}
+	bw := bufio.NewWriter(w)
+	bw.Write(formatted)
+
+	return stats, bw.Flush()
+}
+
+// block is a straight-line run of instructions to recompile
+type block []*analysis.Instruction
+
+func (b block) start() uint16 {
+	return b[0].Addr
+}
+
+func (b block) end() uint16 {
+	return b[len(b)-1].Addr + 2
+}
+
+func (b block) name() string {
+	return fmt.Sprintf("block%03X", b.start())
+}
+
+// split cuts the basic blocks of a program into the blocks to recompile:
+// after writes through I and Fx0A, before instructions the emulator
+// doesn't run, and every maxBlockLength instructions. Blocks outside
+// the ROM or that writes through I can change are left out.
+func split(p *analysis.Program, size int) ([]block, Stats) {
+	var stats Stats
+	written := p.CodeWrites()
+	var blocks []block
+	add := func(b block) {
+		if len(b) == 0 {
+			return
+		}
+		for addr := b.start(); addr < b.end(); addr++ {
+			if written[addr] {
+				stats.SelfModified++
+				return
+			}
+		}
+		blocks = append(blocks, b)
+		stats.Blocks++
+		stats.Instructions += len(b)
+	}
+
+	g := p.CFG()
+	for _, start := range g.Starts() {
+		var b block
+		for _, ins := range g.Blocks[start].Instructions {
+			if ins.Extension != analysis.CHIP8 || int(ins.Addr) < emu.RamProgramStart || int(ins.Addr)+2 > emu.RamProgramStart+size {
+				add(b)
+				b = nil
+				stats.Uncompiled++
+				continue
+			}
+			if ins.Name == "Bnnn" {
+				stats.Computed++
+			}
+			b = append(b, ins)
+			switch ins.Name {
+			case "Fx0A", "Fx33", "Fx55":
+				add(b)
+				b = nil
+				continue
+			}
+			if len(b) == maxBlockLength {
+				add(b)
+				b = nil
+			}
+		}
+		add(b)
+	}
+
+	return blocks, stats
+}
+
+// writeBlock writes the function for a block, with each instruction's
+// disassembly as a comment
+func writeBlock(w *bytes.Buffer, b block) {
+	fmt.Fprintf(w, "\n// %s runs 0x%03X-0x%03X\n", b.name(), b.start(), b.end()-1)
+	fmt.Fprintf(w, "func %s(e *emu.Emulator, c *emu.CPU) {\n", b.name())
+	for i, ins := range b {
+		fmt.Fprintf(w, "// %03X  %s\n", ins.Addr, emu.Disassemble(ins.Opcode))
+		w.WriteString(statement(ins, i))
+	}
+	if last := b[len(b)-1]; !setsPC(last) {
+		fmt.Fprintf(w, "c.PC = 0x%03X\n", b.end())
+	}
+	w.WriteString("}\n")
+}
+
+// setsPC reports whether the code for an instruction sets the PC, as
+// jumps, calls, returns and skips do, and those left to Emulator.Exec
+func setsPC(ins *analysis.Instruction) bool {
+	switch ins.Name {
+	case "00EE", "1nnn", "2nnn", "3xkk", "4xkk", "5xy0", "9xy0":
+		return true
+	}
+
+	return !inline(ins.Name)
+}
+
+// inline reports whether an instruction is written out in Go rather than
+// left to Emulator.Exec
+func inline(name string) bool {
+	switch name {
+	case "00EE", "0nnn", "1nnn", "2nnn", "3xkk", "4xkk", "5xy0", "6xkk", "7xkk",
+		"8xy0", "8xy1", "8xy2", "8xy3", "8xy4", "8xy5", "8xy6", "8xy7", "8xyE",
+		"9xy0", "Annn", "Fx07", "Fx15", "Fx1E", "Fx29":
+		return true
+	}
+
+	return false
+}
+
+// statement is the Go for the ith instruction of a block, doing what the
+// emulator's handler for it does
+func statement(ins *analysis.Instruction, i int) string {
+	op := ins.Opcode
+	nnn, kk := op&0xFFF, op&0xFF
+	vx, vy := fmt.Sprintf("c.V[0x%X]", ins.X()), fmt.Sprintf("c.V[0x%X]", ins.Y())
+	next := ins.Addr + 2
+	skip := func(cond string) string {
+		return fmt.Sprintf("if %s {\nc.PC = 0x%03X\n} else {\nc.PC = 0x%03X\n}\n", cond, next+2, next)
+	}
+	flag := func(cond string) string {
+		return fmt.Sprintf("if %s {\nc.V[0xF] = 1\n} else {\nc.V[0xF] = 0\n}\n", cond)
+	}
+	const resetVF = "if e.Quirks.LogicResetsVF {\nc.V[0xF] = 0\n}\n"
+	shiftVy := fmt.Sprintf("if e.Quirks.ShiftUsesVy {\n%s = %s\n}\n", vx, vy)
+
+	switch ins.Name {
+	case "00EE":
+		return "c.PC = c.Stack[c.SP]\nc.SP--\n"
+	case "0nnn":
+		return ""
+	case "1nnn":
+		return fmt.Sprintf("c.PC = 0x%03X\n", nnn)
+	case "2nnn":
+		return fmt.Sprintf("c.SP++\nc.Stack[c.SP] = 0x%03X\nc.PC = 0x%03X\n", next, nnn)
+	case "3xkk":
+		return skip(fmt.Sprintf("%s == 0x%02X", vx, kk))
+	case "4xkk":
+		return skip(fmt.Sprintf("%s != 0x%02X", vx, kk))
+	case "5xy0":
+		return skip(fmt.Sprintf("%s == %s", vx, vy))
+	case "9xy0":
+		return skip(fmt.Sprintf("%s != %s", vx, vy))
+	case "6xkk":
+		return fmt.Sprintf("%s = 0x%02X\n", vx, kk)
+	case "7xkk":
+		return fmt.Sprintf("%s += 0x%02X\n", vx, kk)
+	case "8xy0":
+		return fmt.Sprintf("%s = %s\n", vx, vy)
+	case "8xy1":
+		return fmt.Sprintf("%s |= %s\n", vx, vy) + resetVF
+	case "8xy2":
+		return fmt.Sprintf("%s &= %s\n", vx, vy) + resetVF
+	case "8xy3":
+		return fmt.Sprintf("%s ^= %s\n", vx, vy) + resetVF
+	case "8xy4":
+		// the sum is worked out before VF is set, in case Vx or Vy is VF
+		return fmt.Sprintf("{\nsum := uint16(%s) + uint16(%s)\n", vx, vy) + flag("sum > 0xFF") + fmt.Sprintf("%s = byte(sum)\n}\n", vx)
+	case "8xy5":
+		return flag(fmt.Sprintf("%s > %s", vx, vy)) + fmt.Sprintf("%s -= %s\n", vx, vy)
+	case "8xy7":
+		return flag(fmt.Sprintf("%s > %s", vy, vx)) + fmt.Sprintf("%s = %s - %s\n", vx, vy, vx)
+	case "8xy6":
+		return shiftVy + flag(fmt.Sprintf("%s&0x1 == 1", vx)) + fmt.Sprintf("%s >>= 1\n", vx)
+	case "8xyE":
+		return shiftVy + flag(fmt.Sprintf("%s>>7 == 1", vx)) + fmt.Sprintf("%s <<= 1\n", vx)
+	case "Annn":
+		return fmt.Sprintf("c.I = 0x%03X\n", nnn)
+	case "Fx07":
+		return fmt.Sprintf("%s = c.DelayTimer\n", vx)
+	case "Fx15":
+		return fmt.Sprintf("c.DelayTimer = %s\n", vx)
+	case "Fx1E":
+		return fmt.Sprintf("c.I += uint16(%s)\n", vx)
+	case "Fx29":
+		return fmt.Sprintf("c.I = uint16(emu.RamFontStart) + uint16(%s*emu.PixelFontByteLength)\n", vx)
+	}
+
+	return fmt.Sprintf("c.PC = 0x%03X\ne.Exec(%d, 0x%04X)\n", next, i, op)
+}
+
+// writeMain writes a main function that runs the ROM for some frames
+// without a window, then prints the screen
+func writeMain(w *bytes.Buffer, quirks string) {
+	if quirks == "" {
+		quirks = "default"
+	}
+	w.WriteString(strings.Replace(`
+func main() {
+	frames := flag.Int("frames", 600, "frames to run")
+	speed := flag.Int("speed", 10, "instructions executed per 60Hz frame")
+	quirks := flag.String("quirks", QUIRKS, "interpreter quirks: "+emu.QuirkNames())
+	seed := flag.Int64("seed", 1, "random number seed for Cxkk")
+	flag.Parse()
+	q, err := emu.ParseQuirks(*quirks)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	e := &emu.Emulator{Quirks: q, Seed: *seed, Compiled: Program}
+	e.SetupROM(rom)
+	for f := 0; f < *frames; f++ {
+		e.RunFrame(*speed, 0)
+	}
+	for y := 0; y < e.Display.Height(); y++ {
+		line := make([]byte, e.Display.Width())
+		for x := range line {
+			line[x] = '.'
+			if e.Display.Pixel(x, y) != 0 {
+				line[x] = '#'
+			}
+		}
+		fmt.Println(string(line))
+	}
+}
+`, "QUIRKS", fmt.Sprintf("%q", quirks), 1))
+}
@@ -0,0 +1,133 @@
+package recompile
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/szTheory/chip8go/analysis"
+	"github.com/szTheory/chip8go/emu"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/PONG2.go.golden, the source recompiled from PONG2")
+
+// generatePONG2 recompiles PONG2 into a package
+func generatePONG2(t *testing.T, pkg string) []byte {
+	rom, err := emu.ReadROM("../games/PONG2.ch8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	stats, err := Generate(&out, rom, Options{Package: pkg, Name: "PONG2.ch8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blocks == 0 || stats.Instructions != len(analysis.Analyze(rom).Instructions) {
+		t.Errorf("Expected every reachable instruction to be recompiled but got %s", stats)
+	}
+
+	return out.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	const golden = "testdata/PONG2.go.golden"
+	src := generatePONG2(t, "recompiled")
+	if *update {
+		if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("Expected the source to match %s (run with -update to rewrite it)", golden)
+	}
+}
+
+// TestRecompiledMatchesInterpreter builds PONG2's recompiled source into
+// a package beside this one and runs testdata/matches_test.go in it,
+// which checks it runs as the interpreter does
+func TestRecompiledMatchesInterpreter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the recompiled source with the go command")
+	}
+	goCommand, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command isn't installed")
+	}
+
+	// inside the module, so that it builds against this emu package,
+	// and named with an underscore, so that ./... leaves it out
+	dir, err := ioutil.TempDir(".", "_recompiled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	check, err := ioutil.ReadFile("testdata/matches_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "matches_test.go"), check, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pong2.go"), generatePONG2(t, "recompiled"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goCommand, "test", ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("Expected the recompiled PONG2 to run as the interpreter does: %v\n%s", err, out)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	rom := []byte{
+		0x60, 0x05, // 200 LD V0, 0x05
+		0xA2, 0x0A, // 202 LD I, 0x20A
+		0xF0, 0x55, // 204 LD [I], V0
+		0x00, 0xFF, // 206 HIGH, which is left to the interpreter
+		0xB2, 0x0A, // 208 JP V0, 0x20A
+		0x60, 0x01, // 20A LD V0, 0x01
+		0x12, 0x0A, // 20C JP 0x20A
+	}
+	p := analysis.Analyze(rom)
+	blocks, stats := split(p, len(rom))
+
+	var starts []uint16
+	for _, b := range blocks {
+		starts = append(starts, b.start())
+	}
+	// 0x20A is written over by the store, so it is left to the interpreter
+	if want := []uint16{0x200, 0x208}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("Expected blocks at %X but got %X", want, starts)
+	}
+	if stats.SelfModified != 1 || stats.Uncompiled != 1 || stats.Computed != 1 {
+		t.Errorf("Expected a self-modified block, an uncompiled instruction and a computed jump but got %s", stats)
+	}
+}
+
+func TestGenerateStandalone(t *testing.T) {
+	rom := []byte{0x60, 0x01, 0x12, 0x02}
+	var out bytes.Buffer
+	if _, err := Generate(&out, rom, Options{Standalone: true, Name: "loop.ch8", Quirks: "cosmac"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package main\n", "func main() {", `flag.String("quirks", "cosmac"`, "c.V[0x0] = 0x01"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the source to contain %q", want)
+		}
+	}
+
+	if _, err := Generate(&out, rom, Options{Package: "game", Standalone: true}); err == nil {
+		t.Errorf("Expected a standalone program outside package main to fail")
+	}
+}
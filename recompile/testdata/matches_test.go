@@ -0,0 +1,39 @@
+package recompiled
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// TestMatchesInterpreter runs the ROM with the Program recompiled from
+// it beside it, against stepping through its frames, which doesn't use
+// the recompiled blocks
+func TestMatchesInterpreter(t *testing.T) {
+	for _, speed := range []int{1, 7, 10, 100} {
+		compiled := &emu.Emulator{Seed: 1, Compiled: Program}
+		compiled.SetupROM(rom)
+		stepped := &emu.Emulator{Seed: 1}
+		stepped.SetupROM(rom)
+
+		for f := 0; f < 600; f++ {
+			var keys emu.Keys
+			if f%50 < 20 {
+				keys = 1 << 1
+			}
+			compiled.RunFrame(speed, keys)
+			stepped.StartFrame(speed, keys)
+			for stepped.StepFrame() {
+			}
+			stepped.EndFrame()
+
+			if !reflect.DeepEqual(compiled.Save(), stepped.Save()) {
+				t.Fatalf("Expected the recompiled code at speed %d to run as the interpreter does in frame %d", speed, f)
+			}
+			if !reflect.DeepEqual(compiled.GateChanges(), stepped.GateChanges()) {
+				t.Fatalf("Expected the beeper at speed %d to change as with the interpreter in frame %d", speed, f)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/media"
+	"github.com/szTheory/chip8go/video"
+)
+
+// renderArgs are the arguments to the render command
+type renderArgs struct {
+	headlessArgs
+	movieFilename string
+	codec         string
+	quality       int
+}
+
+func (r *renderArgs) flags(name string) *flag.FlagSet {
+	o := &r.options
+	fs := headlessFlags(name, &r.headlessArgs, &r.movieFilename)
+	fs.IntVar(&o.Scale, "scale", o.Scale, "output pixels per display pixel")
+	fs.StringVar(&o.Palette, "palette", o.Palette, "colour theme ("+strings.Join(video.ThemeNames(), ", ")+"), hex colours \"fg,bg\", or auto")
+	fs.StringVar(&o.Filter, "filter", o.Filter, "display filters, comma separated: "+strings.Join(video.FilterNames(), ", "))
+	fs.StringVar(&r.codec, "codec", media.AVIMJPEG, "AVI video codec: "+media.AVIMJPEG+" or "+media.AVIRaw+" (uncompressed)")
+	fs.IntVar(&r.quality, "quality", 90, "JPEG quality for the mjpeg codec, from 1 to 100")
+
+	return fs
+}
+
+// runRender replays a game and writes every frame with its sound,
+// so the audio can't drift from the picture
+func runRender(args []string) error {
+	r := &renderArgs{headlessArgs: headlessArgs{options: defaultOptions()}}
+	fs := r.flags("render")
+	if err := parseHeadless("render", fs, &r.headlessArgs, &r.movieFilename, args); err != nil {
+		return err
+	}
+	if r.codec != media.AVIMJPEG && r.codec != media.AVIRaw {
+		return usageError("render", "invalid codec %q: want %s or %s", r.codec, media.AVIMJPEG, media.AVIRaw)
+	}
+	if r.quality < 1 || r.quality > 100 {
+		return usageError("render", "invalid quality %d: must be from 1 to 100", r.quality)
+	}
+
+	palette, err := romPalette(r.Palette, emu.HashROM(r.rom))
+	if err != nil {
+		return err
+	}
+	chain, _ := video.ParseFilters(r.Filter)
+	filters := video.NewPipeline(chain)
+
+	e := r.emulator()
+	width, height := e.Display.Width()*r.Scale, e.Display.Height()*r.Scale
+	frame := image.NewRGBA(image.Rect(0, 0, e.Display.Width(), e.Display.Height()))
+	picture := func() *image.RGBA {
+		if frame.Rect.Dx() != e.Display.Width() || frame.Rect.Dy() != e.Display.Height() {
+			frame = image.NewRGBA(image.Rect(0, 0, e.Display.Width(), e.Display.Height()))
+		}
+		video.DrawFrame(frame, e.Display, palette)
+
+		return video.Resize(filters.Apply(frame), width, height)
+	}
+	samples := make([]byte, emu.FrameBytes)
+
+	out := r.outFilename(".avi")
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(out), ".y4m") {
+		return r.renderY4M(f, e, picture, samples, width, height)
+	}
+
+	avi, err := media.NewAVIWriter(f, width, height, emu.FrameRate, r.codec, emu.BeeperSampleRate, 2, r.quality)
+	if err != nil {
+		return err
+	}
+	err = r.run(e, func(n int) error {
+		e.Beeper.RenderFrame(samples, e.GateChanges())
+		return avi.WriteFrame(picture(), samples)
+	})
+	if err != nil {
+		return err
+	}
+	if err := avi.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// renderY4M writes the frames to a Y4M file and the sound
+// to a WAV file of the same name
+func (r *renderArgs) renderY4M(f *os.File, e *emu.Emulator, picture func() *image.RGBA, samples []byte, width, height int) error {
+	wavFilename := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())) + ".wav"
+	wf, err := os.Create(wavFilename)
+	if err != nil {
+		return err
+	}
+	defer wf.Close()
+
+	y4m, err := media.NewY4MWriter(f, width, height, emu.FrameRate)
+	if err != nil {
+		return err
+	}
+	wav, err := media.NewWAVWriter(wf, emu.BeeperSampleRate, 2)
+	if err != nil {
+		return err
+	}
+
+	err = r.run(e, func(n int) error {
+		e.Beeper.RenderFrame(samples, e.GateChanges())
+		if _, err := wav.Write(samples); err != nil {
+			return err
+		}
+		return y4m.WriteFrame(picture())
+	})
+	if err != nil {
+		return err
+	}
+	if err := y4m.Close(); err != nil {
+		return err
+	}
+	if err := wav.Close(); err != nil {
+		return err
+	}
+	if err := wf.Close(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
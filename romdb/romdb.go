@@ -0,0 +1,58 @@
+// Package romdb holds metadata about known CHIP-8 ROMs,
+// looked up by the SHA-1 hash of the ROM contents.
+package romdb
+
+// Entry describes a known ROM
+type Entry struct {
+	Title  string
+	Author string
+	Year   int
+	// Palette is the ROM's preferred colours,
+	// in the form accepted by video.ParsePalette
+	Palette string
+	// Platform is the machine the ROM was written for:
+	// chip8, hires, schip or xochip
+	Platform string
+	// Quirks are the quirks the ROM needs, in the form accepted by
+	// emu.ParseQuirks, if they differ from its platform's
+	Quirks string
+}
+
+// Lookup finds the metadata for a ROM by its SHA-1 hash
+// as returned by emu.HashROM
+func Lookup(hash string) (Entry, bool) {
+	entry, ok := entries[hash]
+	return entry, ok
+}
+
+var entries = map[string]Entry{
+	// the games bundled in the games folder
+	"f13766c14aeb02ad8d4d103cb5eadd282d20cddc": {
+		Title:    "Brix",
+		Author:   "Andreas Gustafsson",
+		Year:     1990,
+		Palette:  "ffcc33,1a1033",
+		Platform: "chip8",
+	},
+	"a60611339661e3ab2d8af024ad1da5880a6f8665": {
+		Title:    "Pong 2",
+		Author:   "David Winter",
+		Year:     1990,
+		Palette:  "phosphor",
+		Platform: "chip8",
+	},
+	"5f518084744bf3cb8733f6e5454dfd1634320563": {
+		Title:    "Tetris",
+		Author:   "Fran Dachille",
+		Year:     1991,
+		Palette:  "lcd",
+		Platform: "chip8",
+	},
+	"bdb92475acfe11bc7814a2f5eade13fcd09b756a": {
+		Title:    "UFO",
+		Author:   "Lutz V",
+		Year:     1992,
+		Palette:  "amber",
+		Platform: "chip8",
+	},
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const maxRecent = 10
+
+// settings are the preferences saved between runs.
+//
+// Options are resolved in this order, later ones winning:
+// built-in defaults, the global options in the settings file,
+// the --config file, the per-ROM overrides for the loaded game,
+// then command-line flags. Only the settings file is written back.
+type settings struct {
+	options
+
+	// Keys maps each CHIP-8 key (a hex digit) to a keyboard key name
+	Keys map[string]string `json:"keys,omitempty"`
+	// ROMs holds per-game overrides, keyed by the SHA-1 of the ROM
+	ROMs map[string]romSettings `json:"roms,omitempty"`
+	// Recent lists the most recently played ROMs, newest first
+	Recent []string `json:"recent,omitempty"`
+
+	filename string
+}
+
+// romSettings override the global options for one game.
+// Empty values fall back to the global options.
+type romSettings struct {
+	Name    string `json:"name,omitempty"`
+	Speed   int    `json:"speed,omitempty"`
+	Quirks  string `json:"quirks,omitempty"`
+	Palette string `json:"palette,omitempty"`
+}
+
+// defaultSettingsFilename is chip8go/settings.json in the XDG config directory
+func defaultSettingsFilename() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "chip8go", "settings.json"), nil
+}
+
+// loadSettings reads the settings file, which doesn't need to exist yet
+func loadSettings(filename string) (*settings, error) {
+	s := &settings{options: defaultOptions(), filename: filename}
+
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, s); err != nil {
+		return nil, fmt.Errorf("settings %s: %v", filename, err)
+	}
+	if err := s.options.validate(); err != nil {
+		return nil, fmt.Errorf("settings %s: %v", filename, err)
+	}
+	if err := s.checkKeys(); err != nil {
+		return nil, fmt.Errorf("settings %s: %v", filename, err)
+	}
+	for hash, r := range s.ROMs {
+		opts := s.options
+		opts.applyROM(r, nil)
+		if err := opts.validate(); err != nil {
+			return nil, fmt.Errorf("settings %s: ROM %s: %v", filename, hash, err)
+		}
+	}
+
+	return s, nil
+}
+
+// loadConfig reads options from a --config file, which unlike the
+// settings file only holds options and is never written
+func (o *options) loadConfig(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(o); err != nil {
+		return fmt.Errorf("config %s: %v", filename, err)
+	}
+	if err := o.validate(); err != nil {
+		return fmt.Errorf("config %s: %v", filename, err)
+	}
+
+	return nil
+}
+
+// save writes the settings back to the file they were loaded from
+func (s *settings) save() error {
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0755); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a crash can't truncate the settings
+	tmp := s.filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(contents, '\n'), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.filename)
+}
+
+// cheatsFilename is where a ROM's cheats are kept, in a cheats
+// directory beside the settings file
+func (s *settings) cheatsFilename(hash string) string {
+	return filepath.Join(filepath.Dir(s.filename), "cheats", hash+".txt")
+}
+
+// rom returns the overrides for a ROM hash
+func (s *settings) rom(hash string) romSettings {
+	return s.ROMs[hash]
+}
+
+// updateROM changes the overrides for a ROM hash
+func (s *settings) updateROM(hash string, update func(r *romSettings)) {
+	if s.ROMs == nil {
+		s.ROMs = make(map[string]romSettings)
+	}
+	r := s.ROMs[hash]
+	update(&r)
+	s.ROMs[hash] = r
+}
+
+// addRecent moves a ROM to the front of the recent list
+func (s *settings) addRecent(romFilename string) {
+	if abs, err := filepath.Abs(romFilename); err == nil {
+		romFilename = abs
+	}
+
+	recent := []string{romFilename}
+	for _, f := range s.Recent {
+		if f != romFilename && len(recent) < maxRecent {
+			recent = append(recent, f)
+		}
+	}
+	s.Recent = recent
+}
+
+// applyROM layers per-ROM overrides on top of the options,
+// except for options given explicitly as flags
+func (o *options) applyROM(r romSettings, explicit map[string]bool) {
+	if r.Speed != 0 && !explicit["speed"] {
+		o.Speed = r.Speed
+	}
+	if r.Quirks != "" && !explicit["quirks"] {
+		o.Quirks = r.Quirks
+	}
+	if r.Palette != "" && !explicit["palette"] {
+		o.Palette = r.Palette
+	}
+}
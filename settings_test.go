@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeSettings writes a settings file into a new directory,
+// returning its name and a function removing the directory
+func writeSettings(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "chip8go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "settings.json")
+	if contents != "" {
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+
+	return filename, func() { os.RemoveAll(dir) }
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	const hash = "0123456789abcdef0123456789abcdef01234567"
+	defaults := defaultOptions()
+	tests := []struct {
+		name     string
+		file     string
+		args     []string
+		speed    int
+		palette  string
+		quirks   string
+		scale    int
+		explicit []string
+	}{
+		{"defaults", "", nil, defaults.Speed, defaults.Palette, defaults.Quirks, defaults.Scale, nil},
+		{"file", `{"speed": 20, "palette": "amber", "scale": 5}`, nil, 20, "amber", defaults.Quirks, 5, nil},
+		{"rom over file",
+			fmt.Sprintf(`{"speed": 20, "palette": "amber", "roms": {%q: {"speed": 30, "quirks": "cosmac"}}}`, hash),
+			nil, 30, "amber", "cosmac", defaults.Scale, nil},
+		{"flags over rom and file",
+			fmt.Sprintf(`{"speed": 20, "scale": 5, "roms": {%q: {"speed": 30, "palette": "lcd"}}}`, hash),
+			[]string{"--speed", "40", "--palette", "amber", "--scale=2"}, 40, "amber", defaults.Quirks, 2,
+			[]string{"palette", "scale", "speed"}},
+		{"flag at its default still wins",
+			fmt.Sprintf(`{"roms": {%q: {"speed": 30}}}`, hash),
+			[]string{fmt.Sprintf("--speed=%d", defaults.Speed)}, defaults.Speed, defaults.Palette, defaults.Quirks, defaults.Scale,
+			[]string{"speed"}},
+		{"other rom", `{"roms": {"ffff": {"speed": 30}}}`, nil, defaults.Speed, defaults.Palette, defaults.Quirks, defaults.Scale, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename, remove := writeSettings(t, test.file)
+			defer remove()
+
+			r, err := parseRunArgs(append([]string{"--settings", filename}, append(test.args, "game.ch8")...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := r.options
+			opts.applyROM(r.settings.rom(hash), r.explicit)
+
+			if opts.Speed != test.speed || opts.Palette != test.palette || opts.Quirks != test.quirks || opts.Scale != test.scale {
+				t.Errorf("Expected speed %d, palette %s, quirks %s and scale %d but got %d, %s, %s and %d",
+					test.speed, test.palette, test.quirks, test.scale, opts.Speed, opts.Palette, opts.Quirks, opts.Scale)
+			}
+			var explicit []string
+			for _, name := range []string{"palette", "quirks", "scale", "speed"} {
+				if r.explicit[name] {
+					explicit = append(explicit, name)
+				}
+			}
+			if !reflect.DeepEqual(explicit, test.explicit) {
+				t.Errorf("Expected %v to be given explicitly but got %v", test.explicit, explicit)
+			}
+			if r.romFilename != "game.ch8" {
+				t.Errorf("Expected the ROM game.ch8 but got %q", r.romFilename)
+			}
+		})
+	}
+}
+
+func TestLoadSettingsErrors(t *testing.T) {
+	for _, contents := range []string{
+		`{"speed": `,
+		`{"scale": 0}`,
+		`{"roms": {"abc": {"quirks": "nonsense"}}}`,
+	} {
+		filename, remove := writeSettings(t, contents)
+		if _, err := loadSettings(filename); err == nil {
+			t.Errorf("Expected an error loading %s", contents)
+		}
+		remove()
+	}
+}
+
+func TestConfigReadOnly(t *testing.T) {
+	filename, remove := writeSettings(t, `{"speed": 20, "palette": "amber"}`)
+	defer remove()
+	config := filepath.Join(filepath.Dir(filename), "config.json")
+	const contents = `{"speed": 30, "scale": 4}`
+	if err := ioutil.WriteFile(config, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := parseRunArgs([]string{"--settings", filename, "--config", config, "--scale", "2", "game.ch8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.options.Speed != 30 || r.options.Palette != "amber" || r.options.Scale != 2 {
+		t.Errorf("Expected the config over the settings and flags over both but got speed %d, palette %s and scale %d",
+			r.options.Speed, r.options.Palette, r.options.Scale)
+	}
+
+	// saving writes the settings file, without the config file's options
+	if err := r.settings.save(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(config); err != nil || string(b) != contents {
+		t.Errorf("Expected the config file to be left alone but it was %q (%v)", b, err)
+	}
+	saved, err := loadSettings(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Speed != 20 || saved.Scale != defaultOptions().Scale {
+		t.Errorf("Expected the saved settings without the config's speed and scale but got %d and %d", saved.Speed, saved.Scale)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, contents := range []string{
+		`{"speed": `,
+		`{"scale": 0}`,
+		`{"roms": {}}`,
+		`{"keys": {"5": "Up"}}`,
+	} {
+		filename, remove := writeSettings(t, contents)
+		o := defaultOptions()
+		if err := o.loadConfig(filename); err == nil {
+			t.Errorf("Expected an error loading %s as a config file", contents)
+		}
+		remove()
+	}
+}
+
+func TestSettingsSave(t *testing.T) {
+	filename, remove := writeSettings(t, "")
+	defer remove()
+
+	s, err := loadSettings(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Speed = 25
+	s.updateROM("abc", func(r *romSettings) { r.Palette = "amber" })
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadSettings(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Speed != 25 || loaded.rom("abc").Palette != "amber" || loaded.Scale != defaultOptions().Scale {
+		t.Errorf("Expected the saved speed and ROM palette over the defaults but got %+v", loaded)
+	}
+}
+
+func TestAddRecent(t *testing.T) {
+	abs := func(name string) string {
+		filename, err := filepath.Abs(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	var full []string
+	for i := 0; i < maxRecent; i++ {
+		full = append(full, abs(fmt.Sprintf("%d.ch8", i)))
+	}
+	tests := []struct {
+		name   string
+		recent []string
+		add    string
+		want   []string
+	}{
+		{"first", nil, "a.ch8", []string{abs("a.ch8")}},
+		{"newest first", []string{abs("a.ch8")}, "b.ch8", []string{abs("b.ch8"), abs("a.ch8")}},
+		{"moved to the front", []string{abs("a.ch8"), abs("b.ch8"), abs("c.ch8")}, "c.ch8",
+			[]string{abs("c.ch8"), abs("a.ch8"), abs("b.ch8")}},
+		{"same file by another path", []string{abs("a.ch8")}, filepath.Join("x", "..", "a.ch8"), []string{abs("a.ch8")}},
+		{"capped", full, "new.ch8", append([]string{abs("new.ch8")}, full[:maxRecent-1]...)},
+	}
+
+	for _, test := range tests {
+		s := &settings{Recent: append([]string(nil), test.recent...)}
+		s.addRecent(test.add)
+		if !reflect.DeepEqual(s.Recent, test.want) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.want, s.Recent)
+		}
+	}
+}
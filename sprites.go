@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/szTheory/chip8go/debug"
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/video"
+)
+
+// spriteColumns is how many sprites a sheet has across by default
+const spriteColumns = 16
+
+// spritesArgs are the arguments to the sprites command
+type spritesArgs struct {
+	headlessArgs
+	movieFilename string
+	memRange      string
+	size          string
+	columns       int
+	importSheet   string
+}
+
+func (s *spritesArgs) flags(name string) *flag.FlagSet {
+	o := &s.options
+	fs := headlessFlags(name, &s.headlessArgs, &s.movieFilename)
+	fs.StringVar(&s.memRange, "range", "", "memory `range` of the sprites, such as 0x300-0x3FF (default the whole ROM)")
+	fs.StringVar(&s.size, "size", "8x5", "sprite size, 8xN or 16xN")
+	fs.IntVar(&s.columns, "columns", spriteColumns, "sprites across the sheet")
+	fs.IntVar(&o.Scale, "scale", 4, "sheet pixels per sprite pixel")
+	fs.StringVar(&o.Palette, "palette", o.Palette, "colour theme ("+strings.Join(video.ThemeNames(), ", ")+"), hex colours \"fg,bg\", or auto")
+	fs.StringVar(&s.importSheet, "import", "", "read an edited sprite sheet `file` back into the ROM and save it as the -o file")
+
+	return fs
+}
+
+// runSprites exports a ROM's sprites as a PNG sheet, outlining the ones
+// the game draws as it runs, or imports an edited sheet as a patched ROM
+func runSprites(args []string) error {
+	s := &spritesArgs{headlessArgs: headlessArgs{options: defaultOptions()}}
+	fs := s.flags("sprites")
+	if err := parseHeadless("sprites", fs, &s.headlessArgs, &s.movieFilename, args); err != nil {
+		return err
+	}
+
+	var sheet video.SpriteSheet
+	var err error
+	if sheet.Width, sheet.Height, err = video.ParseSpriteSize(s.size); err != nil {
+		return usageError("sprites", "%v", err)
+	}
+	if sheet.Columns = s.columns; sheet.Columns < 1 {
+		return usageError("sprites", "invalid columns %d", s.columns)
+	}
+	addr, length := uint16(emu.RamProgramStart), uint16(len(s.rom))
+	if s.memRange != "" {
+		if addr, length, err = debug.ParseRange(s.memRange); err != nil {
+			return usageError("sprites", "%v", err)
+		}
+	}
+	palette, err := romPalette(s.Palette, emu.HashROM(s.rom))
+	if err != nil {
+		return err
+	}
+
+	if s.importSheet != "" {
+		return s.importSprites(sheet, palette, addr, length)
+	}
+
+	e := s.emulator()
+	s.debugger = debug.New(e)
+	s.debugger.TrackSprites(true)
+	if err := s.run(e, func(n int) error { return nil }); err != nil {
+		return err
+	}
+	drawn := s.debugger.Sprites()
+
+	mem := e.Memory().RAM[addr : addr+length]
+	img := sheet.Draw(mem, palette, drawnSprites(drawn, addr, sheet))
+	if s.Scale > 1 {
+		img = video.Resize(img, img.Rect.Dx()*s.Scale, img.Rect.Dy()*s.Scale)
+	}
+	out := s.outFilename(".png")
+	if err := writePNG(out, img); err != nil {
+		return err
+	}
+
+	// list the drawn sprites, which are what a ripper is after
+	addrs := make([]int, 0, len(drawn))
+	for a := range drawn {
+		addrs = append(addrs, int(a))
+	}
+	sort.Ints(addrs)
+	fmt.Printf("%s: %d sprites, %d drawn\n", out, sheet.Count(len(mem)), len(drawn))
+	for _, a := range addrs {
+		fmt.Printf("0x%03X  8x%d\n", a, drawn[uint16(a)])
+	}
+
+	return nil
+}
+
+// importSprites reads an edited sheet into the ROM bytes it was made from
+// and saves the patched ROM
+func (s *spritesArgs) importSprites(sheet video.SpriteSheet, palette video.Palette, addr, length uint16) error {
+	start := int(addr) - emu.RamProgramStart
+	if start < 0 || start+int(length) > len(s.rom) {
+		return usageError("sprites", "range 0x%03X-0x%03X is outside the ROM", addr, int(addr)+int(length)-1)
+	}
+
+	f, err := os.Open(s.importSheet)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", s.importSheet, err)
+	}
+
+	patched := append([]byte(nil), s.rom...)
+	if err := sheet.Read(img, patched[start:start+int(length)], palette); err != nil {
+		return fmt.Errorf("%s: %v", s.importSheet, err)
+	}
+
+	return ioutil.WriteFile(s.outFilename("-patched.ch8"), patched, 0644)
+}
+
+// drawnSprites reports which sprites on a sheet of memory from addr
+// include the start of a sprite the game has drawn
+func drawnSprites(drawn map[uint16]int, addr uint16, sheet video.SpriteSheet) func(i int) bool {
+	used := make(map[int]bool)
+	for a := range drawn {
+		if a >= addr {
+			used[int(a-addr)/sheet.SpriteBytes()] = true
+		}
+	}
+
+	return func(i int) bool {
+		return used[i]
+	}
+}
+
+// writePNG saves an image as a PNG file
+func writePNG(filename string, img image.Image) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
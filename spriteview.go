@@ -0,0 +1,269 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/video"
+)
+
+// spriteView is the sprite viewer, which F7 opens over the game. It draws
+// memory from an address as sprites, outlining the ones the game has drawn,
+// and clicking a pixel flips it. The game is paused when it opens.
+// Arrows move a sprite or a row at a time, and , and . a byte, W switches
+// between 8 and 16 pixel wide sprites, [ and ] change their height,
+// - and = zoom, G goes to an address, S saves the sheet as a PNG and
+// R saves the ROM with the changed pixels.
+type spriteView struct {
+	open bool
+	// resume is set if the game was running when the viewer opened
+	resume bool
+	addr   uint16
+	sheet  video.SpriteSheet
+	zoom   int
+	// rows is how many rows of sprites fit, as last drawn
+	rows int
+	// edited holds the addresses of the bytes changed by clicking pixels
+	edited map[uint16]bool
+
+	prompt  textPrompt
+	message string
+	image   *ebiten.Image
+}
+
+// toggleSpriteView opens or closes the sprite viewer
+func (g *Game) toggleSpriteView() {
+	v := &g.spriteView
+	if v.open {
+		v.open = false
+		if v.resume {
+			g.debugger.Continue()
+		}
+		return
+	}
+
+	g.closeOverlays()
+	g.attachDebugger()
+	if v.edited == nil {
+		v.addr = emu.RamProgramStart
+		v.sheet = video.SpriteSheet{Width: 8, Height: 5, Columns: 1}
+		v.zoom = 4
+		v.rows = 1
+		v.edited = make(map[uint16]bool)
+		// sprites are noted from now on, so they can be marked as the game runs
+		g.debugger.TrackSprites(true)
+	}
+	v.open = true
+	v.resume = !g.debugger.Stopped()
+	v.message = ""
+	g.debugger.Pause()
+}
+
+// updateSpriteView handles the keyboard and mouse while the sprite viewer is open
+func (g *Game) updateSpriteView() {
+	v := &g.spriteView
+	if v.prompt.active() {
+		if _, line, entered := v.prompt.update(); entered {
+			v.message = ""
+			if addr, err := g.debugger.Symbols.Resolve(line); err != nil {
+				v.message = err.Error()
+			} else {
+				v.addr = addr
+			}
+		}
+		return
+	}
+
+	size := v.sheet.SpriteBytes()
+	move := 0
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		g.toggleSpriteView()
+		return
+	case repeating(ebiten.KeyLeft):
+		move = -size
+	case repeating(ebiten.KeyRight):
+		move = size
+	case repeating(ebiten.KeyUp):
+		move = -size * v.sheet.Columns
+	case repeating(ebiten.KeyDown):
+		move = size * v.sheet.Columns
+	case repeating(ebiten.KeyPageUp):
+		move = -size * v.sheet.Columns * v.rows
+	case repeating(ebiten.KeyPageDown):
+		move = size * v.sheet.Columns * v.rows
+	}
+
+	for _, c := range ebiten.InputChars() {
+		if v.prompt.active() {
+			v.prompt.input = append(v.prompt.input, c)
+			continue
+		}
+		switch c {
+		case ' ':
+			g.togglePause()
+		case ',':
+			move--
+		case '.':
+			move++
+		case 'w', 'W':
+			if v.sheet.Width == 8 {
+				v.sheet.Width = 16
+			} else {
+				v.sheet.Width = 8
+			}
+		case '[':
+			if v.sheet.Height > 1 {
+				v.sheet.Height--
+			}
+		case ']':
+			if v.sheet.Height < 16 {
+				v.sheet.Height++
+			}
+		case '-':
+			if v.zoom > 1 {
+				v.zoom--
+			}
+		case '=':
+			v.zoom++
+		case 'g', 'G':
+			v.prompt.start("goto ")
+		case 's', 'S':
+			v.message = g.saveSpriteSheet()
+		case 'r', 'R':
+			v.message = g.savePatchedROM()
+		}
+	}
+	if addr := int(v.addr) + move; addr < 0 {
+		v.addr = 0
+	} else if addr < emu.RamSize {
+		v.addr = uint16(addr)
+	}
+
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		x, y := ebiten.CursorPosition()
+		offset, mask, ok := v.sheet.PixelAt(image.Pt(x/v.zoom, (y-charH)/v.zoom))
+		if addr := int(v.addr) + offset; ok && y >= charH && addr < emu.RamSize {
+			g.debugger.Edit(func(e *emu.Emulator) {
+				e.Memory().RAM[addr] ^= mask
+			})
+			v.edited[uint16(addr)] = true
+		}
+	}
+}
+
+// spriteMemory copies the memory shown as sprites
+func (g *Game) spriteMemory(length int) []byte {
+	v := &g.spriteView
+	if end := int(v.addr) + length; end > emu.RamSize {
+		length = emu.RamSize - int(v.addr)
+	}
+	mem := make([]byte, length)
+	g.debugger.View(func(e *emu.Emulator) {
+		copy(mem, e.Memory().RAM[v.addr:])
+	})
+
+	return mem
+}
+
+// saveSpriteSheet saves the sprites shown as a PNG beside the ROM,
+// returning what happened
+func (g *Game) saveSpriteSheet() string {
+	v := &g.spriteView
+	mem := g.spriteMemory(v.sheet.SpriteBytes() * v.sheet.Columns * v.rows)
+	img := v.sheet.Draw(mem, g.palette, drawnSprites(g.debugger.Sprites(), v.addr, v.sheet))
+
+	filename := fmt.Sprintf("%s-%03X.png", strings.TrimSuffix(g.romFilename, filepath.Ext(g.romFilename)), v.addr)
+	if err := writePNG(filename, img); err != nil {
+		return err.Error()
+	}
+
+	return "saved " + filename
+}
+
+// savePatchedROM saves the ROM with the pixels changed in the viewer,
+// leaving out anything else the game has changed in memory
+func (g *Game) savePatchedROM() string {
+	v := &g.spriteView
+	rom, err := emu.ReadROM(g.romFilename)
+	if err != nil {
+		return err.Error()
+	}
+	g.debugger.View(func(e *emu.Emulator) {
+		for addr := range v.edited {
+			if i := int(addr) - emu.RamProgramStart; i >= 0 && i < len(rom) {
+				rom[i] = e.Memory().RAM[addr]
+			}
+		}
+	})
+
+	filename := strings.TrimSuffix(g.romFilename, filepath.Ext(g.romFilename)) + "-patched.ch8"
+	if err := ioutil.WriteFile(filename, rom, 0644); err != nil {
+		return err.Error()
+	}
+
+	return "saved " + filename
+}
+
+// drawSpriteView draws the sprite viewer over the game
+func (g *Game) drawSpriteView(screen *ebiten.Image) {
+	v := &g.spriteView
+	w, h := screen.Size()
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), memBackground)
+
+	v.sheet.Columns = (w/v.zoom - 1) / (v.sheet.Width + 1)
+	v.rows = ((h-2*charH)/v.zoom - 1) / (v.sheet.Height + 1)
+	if v.sheet.Columns < 1 {
+		v.sheet.Columns = 1
+	}
+	if v.rows < 1 {
+		v.rows = 1
+	}
+
+	mem := g.spriteMemory(v.sheet.SpriteBytes() * v.sheet.Columns * v.rows)
+	if len(mem) > 0 {
+		img := v.sheet.Draw(mem, g.palette, drawnSprites(g.debugger.Sprites(), v.addr, v.sheet))
+		if v.image != nil {
+			if iw, ih := v.image.Size(); iw != img.Rect.Dx() || ih != img.Rect.Dy() {
+				v.image.Dispose()
+				v.image = nil
+			}
+		}
+		if v.image == nil {
+			var err error
+			if v.image, err = ebiten.NewImage(img.Rect.Dx(), img.Rect.Dy(), ebiten.FilterNearest); err != nil {
+				panic(err)
+			}
+		}
+		if err := v.image.ReplacePixels(img.Pix); err != nil {
+			panic(err)
+		}
+
+		geometry := ebiten.GeoM{}
+		geometry.Scale(float64(v.zoom), float64(v.zoom))
+		geometry.Translate(0, charH)
+		if err := screen.DrawImage(v.image, &ebiten.DrawImageOptions{GeoM: geometry}); err != nil {
+			panic(err)
+		}
+	}
+
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("0x%03X %dx%d sprites  %s", v.addr, v.sheet.Width, v.sheet.Height, g.runState()), 0, 0)
+	status := "arrows move  ,. byte  w width  [] height  -= zoom  g goto  s sheet  r rom  F7 close"
+	switch {
+	case v.prompt.active():
+		status = v.prompt.String()
+	case v.message != "":
+		status = v.message
+	}
+	ebitenutil.DebugPrintAt(screen, status, 0, h-charH)
+}
@@ -0,0 +1,3 @@
+// Package video turns the CHIP-8 display into images:
+// colour palettes and the frames drawn with them.
+package video
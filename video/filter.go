@@ -0,0 +1,382 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Filter post-processes a frame on the CPU, so it works without a GPU.
+// The output is Scale times the size of the input on each axis.
+type Filter struct {
+	Name  string
+	Scale int
+	apply func(dst, src *image.RGBA)
+}
+
+// Filters are the available filters, in hotkey order
+var Filters = []Filter{
+	{"none", 1, nil},
+	{"scanlines", 3, scanlines},
+	{"grid", 4, grid},
+	{"bloom", 1, bloom},
+	{"scale2x", 2, scale2x},
+	{"scale3x", 3, scale3x},
+	{"epx", 2, epx},
+}
+
+// FilterNames lists the available filter names
+func FilterNames() []string {
+	names := make([]string, len(Filters))
+	for i, f := range Filters {
+		names[i] = f.Name
+	}
+
+	return names
+}
+
+// Chain is a list of filters applied in order
+type Chain []Filter
+
+// ParseFilters parses a comma separated list of filter names
+// such as "scale2x,scanlines"
+func ParseFilters(s string) (Chain, error) {
+	var chain Chain
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, f := range Filters {
+			if f.Name == name {
+				if f.apply != nil {
+					chain = append(chain, f)
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid filter %q: want one of %s", name, strings.Join(FilterNames(), ", "))
+		}
+	}
+
+	return chain, nil
+}
+
+// NextFilter returns the name of the filter after the named one,
+// or the first filter if the name isn't a single filter
+func NextFilter(name string) string {
+	for i, f := range Filters {
+		if f.Name == name {
+			return Filters[(i+1)%len(Filters)].Name
+		}
+	}
+
+	return Filters[0].Name
+}
+
+// Scale is how much larger the output of the chain is than its input
+func (c Chain) Scale() int {
+	scale := 1
+	for _, f := range c {
+		scale *= f.Scale
+	}
+
+	return scale
+}
+
+// Apply runs the frame through each filter in turn.
+// The source frame is returned unchanged by an empty chain.
+func (c Chain) Apply(src *image.RGBA) *image.RGBA {
+	for _, f := range c {
+		size := src.Rect.Size()
+		dst := image.NewRGBA(image.Rect(0, 0, size.X*f.Scale, size.Y*f.Scale))
+		f.apply(dst, src)
+		src = dst
+	}
+
+	return src
+}
+
+// Pipeline runs frames through a chain, keeping the image each filter
+// draws into so that a frame doesn't allocate them. Make one when the
+// filters change; the images are only made again when the frame size does.
+type Pipeline struct {
+	Chain
+	images []*image.RGBA
+}
+
+// NewPipeline makes a pipeline for a chain of filters
+func NewPipeline(c Chain) *Pipeline {
+	return &Pipeline{Chain: c, images: make([]*image.RGBA, len(c))}
+}
+
+// Apply runs the frame through each filter in turn, as Chain.Apply does.
+// The image returned is reused by the next call.
+func (p *Pipeline) Apply(src *image.RGBA) *image.RGBA {
+	for i, f := range p.Chain {
+		size := src.Rect.Size().Mul(f.Scale)
+		dst := p.images[i]
+		if dst == nil || dst.Rect.Size() != size {
+			dst = image.NewRGBA(image.Rectangle{Max: size})
+			p.images[i] = dst
+		}
+		f.apply(dst, src)
+		src = dst
+	}
+
+	return src
+}
+
+// pixel reads a pixel as a packed value, clamping coordinates to the image
+// so that the edges repeat
+func pixel(img *image.RGBA, x, y int) uint32 {
+	size := img.Rect.Size()
+	if x < 0 {
+		x = 0
+	} else if x >= size.X {
+		x = size.X - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= size.Y {
+		y = size.Y - 1
+	}
+
+	i := y*img.Stride + x*4
+	p := img.Pix[i : i+4 : i+4]
+	return uint32(p[0])<<24 | uint32(p[1])<<16 | uint32(p[2])<<8 | uint32(p[3])
+}
+
+func setPixel(img *image.RGBA, x, y int, value uint32) {
+	i := y*img.Stride + x*4
+	p := img.Pix[i : i+4 : i+4]
+	p[0] = byte(value >> 24)
+	p[1] = byte(value >> 16)
+	p[2] = byte(value >> 8)
+	p[3] = byte(value)
+}
+
+// shade scales the colour channels of a packed pixel by num/den
+func shade(value uint32, num, den uint32) uint32 {
+	r := (value >> 24 & 0xFF) * num / den
+	g := (value >> 16 & 0xFF) * num / den
+	b := (value >> 8 & 0xFF) * num / den
+
+	return r<<24 | g<<16 | b<<8 | value&0xFF
+}
+
+// scanlines triples each pixel and darkens every third row,
+// like the gaps between the lines of a CRT
+func scanlines(dst, src *image.RGBA) {
+	size := src.Rect.Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			p := pixel(src, x, y)
+			dark := shade(p, 2, 5)
+			for i := 0; i < 3; i++ {
+				setPixel(dst, x*3+i, y*3, p)
+				setPixel(dst, x*3+i, y*3+1, p)
+				setPixel(dst, x*3+i, y*3+2, dark)
+			}
+		}
+	}
+}
+
+// grid draws each pixel as a 4x4 cell with a darker gap on its
+// right and bottom edges, like the segments of an LCD
+func grid(dst, src *image.RGBA) {
+	size := src.Rect.Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			p := pixel(src, x, y)
+			dark := shade(p, 7, 10)
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					if i == 3 || j == 3 {
+						setPixel(dst, x*4+i, y*4+j, dark)
+					} else {
+						setPixel(dst, x*4+i, y*4+j, p)
+					}
+				}
+			}
+		}
+	}
+}
+
+// bloom adds a soft glow around bright pixels: each pixel gains half
+// of the 3x3 box blur around it
+func bloom(dst, src *image.RGBA) {
+	size := src.Rect.Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			var sum [3]uint32
+			for j := -1; j <= 1; j++ {
+				for i := -1; i <= 1; i++ {
+					p := pixel(src, x+i, y+j)
+					sum[0] += p >> 24 & 0xFF
+					sum[1] += p >> 16 & 0xFF
+					sum[2] += p >> 8 & 0xFF
+				}
+			}
+
+			p := pixel(src, x, y)
+			var out uint32
+			for c := uint(0); c < 3; c++ {
+				shift := 24 - 8*c
+				value := p>>shift&0xFF + sum[c]/18
+				if value > 0xFF {
+					value = 0xFF
+				}
+				out |= value << shift
+			}
+			setPixel(dst, x, y, out|p&0xFF)
+		}
+	}
+}
+
+// scale2x is the AdvanceMAME Scale2x edge-smoothing upscaler.
+// Each pixel E with neighbours
+//
+//	. B .
+//	D E F
+//	. H .
+//
+// becomes four pixels that take the colour of a neighbour where
+// two neighbours agree along an edge.
+func scale2x(dst, src *image.RGBA) {
+	size := src.Rect.Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			b := pixel(src, x, y-1)
+			d := pixel(src, x-1, y)
+			e := pixel(src, x, y)
+			f := pixel(src, x+1, y)
+			h := pixel(src, x, y+1)
+
+			e0, e1, e2, e3 := e, e, e, e
+			if b != h && d != f {
+				if d == b {
+					e0 = d
+				}
+				if b == f {
+					e1 = f
+				}
+				if d == h {
+					e2 = d
+				}
+				if h == f {
+					e3 = f
+				}
+			}
+
+			setPixel(dst, x*2, y*2, e0)
+			setPixel(dst, x*2+1, y*2, e1)
+			setPixel(dst, x*2, y*2+1, e2)
+			setPixel(dst, x*2+1, y*2+1, e3)
+		}
+	}
+}
+
+// scale3x is the AdvanceMAME Scale3x upscaler, which works like
+// scale2x using all eight neighbours
+//
+//	A B C
+//	D E F
+//	G H I
+func scale3x(dst, src *image.RGBA) {
+	size := src.Rect.Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			a := pixel(src, x-1, y-1)
+			b := pixel(src, x, y-1)
+			c := pixel(src, x+1, y-1)
+			d := pixel(src, x-1, y)
+			e := pixel(src, x, y)
+			f := pixel(src, x+1, y)
+			g := pixel(src, x-1, y+1)
+			h := pixel(src, x, y+1)
+			i := pixel(src, x+1, y+1)
+
+			out := [9]uint32{e, e, e, e, e, e, e, e, e}
+			if b != h && d != f {
+				if d == b {
+					out[0] = d
+				}
+				if (d == b && e != c) || (b == f && e != a) {
+					out[1] = b
+				}
+				if b == f {
+					out[2] = f
+				}
+				if (d == b && e != g) || (d == h && e != a) {
+					out[3] = d
+				}
+				if (b == f && e != i) || (h == f && e != c) {
+					out[5] = f
+				}
+				if d == h {
+					out[6] = d
+				}
+				if (d == h && e != i) || (h == f && e != g) {
+					out[7] = h
+				}
+				if h == f {
+					out[8] = f
+				}
+			}
+
+			for j := 0; j < 9; j++ {
+				setPixel(dst, x*3+j%3, y*3+j/3, out[j])
+			}
+		}
+	}
+}
+
+// epx is Eric Johnston's EPX upscaler, the predecessor of Scale2x.
+// Each pixel P with neighbours
+//
+//	. A .
+//	C P B
+//	. D .
+//
+// is split in four, each quarter taking the colour of the two
+// neighbours it touches when they agree, unless three or more
+// neighbours agree.
+func epx(dst, src *image.RGBA) {
+	size := src.Rect.Size()
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			a := pixel(src, x, y-1)
+			b := pixel(src, x+1, y)
+			c := pixel(src, x-1, y)
+			d := pixel(src, x, y+1)
+			p := pixel(src, x, y)
+
+			p1, p2, p3, p4 := p, p, p, p
+			if !threeEqual(a, b, c, d) {
+				if c == a {
+					p1 = a
+				}
+				if a == b {
+					p2 = b
+				}
+				if d == c {
+					p3 = c
+				}
+				if b == d {
+					p4 = d
+				}
+			}
+
+			setPixel(dst, x*2, y*2, p1)
+			setPixel(dst, x*2+1, y*2, p2)
+			setPixel(dst, x*2, y*2+1, p3)
+			setPixel(dst, x*2+1, y*2+1, p4)
+		}
+	}
+}
+
+// threeEqual reports whether at least three of the values are the same
+func threeEqual(a, b, c, d uint32) bool {
+	return (a == b && (a == c || a == d)) || (c == d && (c == a || c == b))
+}
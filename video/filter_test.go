@@ -0,0 +1,125 @@
+package video
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+// testFrame draws a few sprites with diagonal edges for the upscalers to smooth
+func testFrame() *image.RGBA {
+	d := new(emu.Display)
+	sprites := [][]byte{
+		{0x18, 0x3C, 0x7E, 0xFF, 0xFF, 0x7E, 0x3C, 0x18}, // diamond
+		{0xF0, 0x90, 0xF0, 0x90, 0x90},                   // A from the font
+		{0x80, 0x40, 0x20, 0x10, 0x08, 0x04, 0x02, 0x01}, // diagonal line
+	}
+	for i, sprite := range sprites {
+		for row, b := range sprite {
+			d.DrawSprite(byte(2+i*10), byte(2+row), b)
+		}
+	}
+
+	return Frame(d, Themes[1].Palette)
+}
+
+func TestFiltersGolden(t *testing.T) {
+	src := testFrame()
+
+	for _, name := range FilterNames() {
+		chain, err := ParseFilters(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := chain.Apply(src)
+
+		size := src.Rect.Size().Mul(chain.Scale())
+		if actual.Rect.Size() != size {
+			t.Errorf("%s: expected a %v image but was %v", name, size, actual.Rect.Size())
+			continue
+		}
+
+		golden := filepath.Join("testdata", name+".png")
+		if *update {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, actual); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := readPNG(golden)
+		if err != nil {
+			t.Fatalf("%s: %v (run with -update to create it)", name, err)
+		}
+		if !bytes.Equal(expected.Pix, actual.Pix) {
+			t.Errorf("%s: output differs from %s", name, golden)
+		}
+	}
+}
+
+func TestFilterChain(t *testing.T) {
+	chain, err := ParseFilters("scale2x, scanlines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || chain.Scale() != 6 {
+		t.Errorf("Expected two filters scaling by 6 but was %d scaling by %d", len(chain), chain.Scale())
+	}
+
+	if chain, _ = ParseFilters("none"); len(chain) != 0 {
+		t.Errorf("Expected none to be an empty chain")
+	}
+	if _, err := ParseFilters("hq4x"); err == nil {
+		t.Errorf("Expected an error for an unknown filter")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	chain, _ := ParseFilters("scale2x,bloom")
+	p := NewPipeline(chain)
+	src := testFrame()
+
+	first := p.Apply(src)
+	if !bytes.Equal(first.Pix, chain.Apply(src).Pix) {
+		t.Errorf("Expected the pipeline to filter as the chain does")
+	}
+	if p.Apply(src) != first {
+		t.Errorf("Expected the pipeline to reuse its images for a frame of the same size")
+	}
+	hires := image.NewRGBA(image.Rect(0, 0, 128, 64))
+	if out := p.Apply(hires); out.Rect.Dx() != 256 || out.Rect.Dy() != 128 {
+		t.Errorf("Expected the images to be remade for a larger frame but got %v", out.Rect)
+	}
+}
+
+func readPNG(filename string) (*image.RGBA, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+
+	return rgba, nil
+}
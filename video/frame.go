@@ -0,0 +1,50 @@
+package video
+
+import (
+	"image"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+// Frame draws the display at one image pixel per display pixel
+func Frame(d *emu.Display, p Palette) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, d.Width(), d.Height()))
+	DrawFrame(img, d, p)
+
+	return img
+}
+
+// DrawFrame draws the display into an image the same size as the display
+func DrawFrame(img *image.RGBA, d *emu.Display, p Palette) {
+	width, height := d.Width(), d.Height()
+	var values [emu.HiresWidthPx]byte
+	for y := 0; y < height; y++ {
+		d.ReadRow(y, values[:])
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		for x, v := range values[:width] {
+			c := &p[v&3]
+			px := row[x*4 : x*4+4 : x*4+4]
+			px[0], px[1], px[2], px[3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
+
+// Resize scales an image to the given size by repeating or dropping
+// pixels, keeping the hard edges of the display
+func Resize(src *image.RGBA, width, height int) *image.RGBA {
+	size := src.Rect.Size()
+	if size.X == width && size.Y == height {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		srcRow := src.Pix[(y*size.Y/height)*src.Stride:]
+		row := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			copy(row[x*4:x*4+4], srcRow[(x*size.X/width)*4:])
+		}
+	}
+
+	return dst
+}
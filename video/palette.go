@@ -0,0 +1,132 @@
+package video
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Palette colours the display by the value of each pixel.
+// Each bit of a pixel value is one bitplane, so index 0 is the background,
+// 1 is the first plane, 2 the second plane and 3 where both planes overlap.
+type Palette [4]color.RGBA
+
+// Theme is a named built-in palette
+type Theme struct {
+	Name    string
+	Palette Palette
+}
+
+// Themes are the built-in palettes, in hotkey order
+var Themes = []Theme{
+	{"classic", Palette{rgb(0x000000), rgb(0xFFFFFF), rgb(0xAAAAAA), rgb(0x555555)}},
+	{"phosphor", Palette{rgb(0x0A1A0F), rgb(0x33FF66), rgb(0x1F9940), rgb(0xB3FFC6)}},
+	{"amber", Palette{rgb(0x1A1000), rgb(0xFFB000), rgb(0x996A00), rgb(0xFFE0A0)}},
+	{"lcd", Palette{rgb(0x9BBC0F), rgb(0x0F380F), rgb(0x306230), rgb(0x8BAC0F)}},
+	{"contrast", Palette{rgb(0x000000), rgb(0xFFFFFF), rgb(0xFFFF00), rgb(0x00FFFF)}},
+	// Okabe-Ito colours, distinguishable with the common colour vision deficiencies
+	{"colorblind", Palette{rgb(0x000000), rgb(0xF0E442), rgb(0x56B4E9), rgb(0xE69F00)}},
+}
+
+// DefaultTheme is used when neither the user nor the ROM picks a palette
+const DefaultTheme = "classic"
+
+// ThemeNames lists the built-in palette names
+func ThemeNames() []string {
+	names := make([]string, len(Themes))
+	for i, theme := range Themes {
+		names[i] = theme.Name
+	}
+
+	return names
+}
+
+// NextTheme returns the theme after the named one,
+// or the first theme if the name isn't a theme
+func NextTheme(name string) Theme {
+	for i, theme := range Themes {
+		if theme.Name == name {
+			return Themes[(i+1)%len(Themes)]
+		}
+	}
+
+	return Themes[0]
+}
+
+// ParsePalette parses a theme name, or hex colours in the order
+// foreground,background for one bitplane or
+// foreground,background,plane2,overlap for two.
+// A two colour palette shades the second plane between its colours.
+func ParsePalette(s string) (Palette, error) {
+	for _, theme := range Themes {
+		if strings.EqualFold(s, theme.Name) {
+			return theme.Palette, nil
+		}
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 && len(parts) != 4 {
+		return Palette{}, fmt.Errorf("invalid palette %q: want a theme (%s) or hex colours fg,bg[,plane2,overlap]",
+			s, strings.Join(ThemeNames(), ", "))
+	}
+
+	var colors [4]color.RGBA
+	for i, part := range parts {
+		c, err := ParseColor(part)
+		if err != nil {
+			return Palette{}, err
+		}
+		colors[i] = c
+	}
+
+	fg, bg := colors[0], colors[1]
+	if len(parts) == 2 {
+		return Palette{bg, fg, blend(fg, bg), blend(fg, blend(fg, bg))}, nil
+	}
+
+	return Palette{bg, fg, colors[2], colors[3]}, nil
+}
+
+// ParseColor parses an RRGGBB hex colour, with or without a leading #
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q: want RRGGBB", s)
+	}
+	value, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q: want RRGGBB", s)
+	}
+
+	return rgb(uint32(value)), nil
+}
+
+// String formats the palette in the form accepted by ParsePalette
+func (p Palette) String() string {
+	for _, theme := range Themes {
+		if theme.Palette == p {
+			return theme.Name
+		}
+	}
+
+	return fmt.Sprintf("%s,%s,%s,%s", hex(p[1]), hex(p[0]), hex(p[2]), hex(p[3]))
+}
+
+func rgb(value uint32) color.RGBA {
+	return color.RGBA{R: byte(value >> 16), G: byte(value >> 8), B: byte(value), A: 0xFF}
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// blend mixes two colours half and half
+func blend(a, b color.RGBA) color.RGBA {
+	return color.RGBA{
+		R: byte((uint16(a.R) + uint16(b.R)) / 2),
+		G: byte((uint16(a.G) + uint16(b.G)) / 2),
+		B: byte((uint16(a.B) + uint16(b.B)) / 2),
+		A: 0xFF,
+	}
+}
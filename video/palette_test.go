@@ -0,0 +1,63 @@
+package video
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/szTheory/chip8go/emu"
+)
+
+func TestParsePalette(t *testing.T) {
+	amber, err := ParsePalette("Amber")
+	if err != nil || amber != Themes[2].Palette {
+		t.Errorf("Expected the amber theme but was %v, %v", amber, err)
+	}
+
+	p, err := ParsePalette("#ff0000,000080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p[0] != (color.RGBA{0, 0, 0x80, 0xFF}) || p[1] != (color.RGBA{0xFF, 0, 0, 0xFF}) {
+		t.Errorf("Expected red on navy but was %v", p)
+	}
+
+	four := "ff0000,000000,00ff00,0000ff"
+	if p, err = ParsePalette(four); err != nil || p.String() != four {
+		t.Errorf("Expected %s to round trip but was %s, %v", four, p, err)
+	}
+
+	for _, bad := range []string{"", "mauve", "ffffff", "ffffff,00000g", "a,b,c"} {
+		if _, err := ParsePalette(bad); err == nil {
+			t.Errorf("Expected an error for palette %q", bad)
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	d := new(emu.Display)
+	d.SetPixel(3, 2, 1)
+	p := Themes[0].Palette
+
+	img := Frame(d, p)
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != d.Width() || h != d.Height() {
+		t.Fatalf("Expected a %dx%d frame but was %dx%d", d.Width(), d.Height(), w, h)
+	}
+	if img.RGBAAt(3, 2) != p[1] {
+		t.Errorf("Expected foreground at (3, 2) but was %v", img.RGBAAt(3, 2))
+	}
+	if img.RGBAAt(2, 3) != p[0] {
+		t.Errorf("Expected background at (2, 3) but was %v", img.RGBAAt(2, 3))
+	}
+}
+
+func BenchmarkDrawFrame(b *testing.B) {
+	d := new(emu.Display)
+	for y := 0; y < emu.ScreenHeightPx; y++ {
+		d.DrawSprite(byte(y), byte(y), 0xA5)
+	}
+	img := Frame(d, Themes[0].Palette)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DrawFrame(img, d, Themes[0].Palette)
+	}
+}
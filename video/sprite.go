@@ -0,0 +1,162 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// SpriteUsed outlines the sprites on a sheet that the program has drawn
+var SpriteUsed = color.RGBA{0xFF, 0x40, 0x40, 0xFF}
+
+// SpriteSheet lays memory out as CHIP-8 sprites, Columns to a row with
+// a pixel of space around each. Sprites are 8 pixels wide with a byte
+// per row, as Dxyn draws them, or 16 wide with two bytes per row like
+// SCHIP's 16x16 sprites.
+type SpriteSheet struct {
+	Width   int
+	Height  int
+	Columns int
+}
+
+// ParseSpriteSize parses a sprite size such as 8x5 or 16x16
+func ParseSpriteSize(s string) (width, height int, err error) {
+	parts := strings.Split(strings.ToLower(s), "x")
+	if len(parts) == 2 {
+		width, err = strconv.Atoi(parts[0])
+		if err == nil {
+			height, err = strconv.Atoi(parts[1])
+		}
+	}
+	if len(parts) != 2 || err != nil || width != 8 && width != 16 || height < 1 || height > 16 {
+		return 0, 0, fmt.Errorf("invalid sprite size %q: want 8xN or 16xN with N from 1 to 16", s)
+	}
+
+	return width, height, nil
+}
+
+// SpriteBytes is the size of each sprite in memory
+func (s SpriteSheet) SpriteBytes() int {
+	return s.Height * s.Width / 8
+}
+
+// Count is how many sprites there are in n bytes, counting a partial one
+func (s SpriteSheet) Count(n int) int {
+	return (n + s.SpriteBytes() - 1) / s.SpriteBytes()
+}
+
+// Size is the size of the image Draw makes for n bytes
+func (s SpriteSheet) Size(n int) image.Point {
+	count := s.Count(n)
+	columns := s.Columns
+	if count < columns {
+		columns = count
+	}
+	rows := (count + s.Columns - 1) / s.Columns
+
+	return image.Pt(columns*(s.Width+1)+1, rows*(s.Height+1)+1)
+}
+
+// Origin is where the top left pixel of the ith sprite is on the sheet
+func (s SpriteSheet) Origin(i int) image.Point {
+	return image.Pt(i%s.Columns*(s.Width+1)+1, i/s.Columns*(s.Height+1)+1)
+}
+
+// PixelAt finds the sprite pixel at a point on the sheet, returning
+// the offset of its byte in memory and its bit in the byte
+func (s SpriteSheet) PixelAt(pt image.Point) (offset int, mask byte, ok bool) {
+	if pt.X < 0 || pt.Y < 0 {
+		return 0, 0, false
+	}
+	column, x := pt.X/(s.Width+1), pt.X%(s.Width+1)-1
+	row, y := pt.Y/(s.Height+1), pt.Y%(s.Height+1)-1
+	if column >= s.Columns || x < 0 || y < 0 {
+		return 0, 0, false
+	}
+	i := row*s.Columns + column
+	offset = i*s.SpriteBytes() + y*s.Width/8 + x/8
+
+	return offset, 0x80 >> uint(x%8), true
+}
+
+// Draw draws memory as sprites, with the pixels in the palette's foreground
+// and background colours and the space between sprites in the second plane's,
+// or SpriteUsed around the sprites that used reports the program has drawn.
+// used may be nil.
+func (s SpriteSheet) Draw(mem []byte, p Palette, used func(i int) bool) *image.RGBA {
+	size := s.Size(len(mem))
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			img.SetRGBA(x, y, p[2])
+		}
+	}
+
+	for i := 0; i < s.Count(len(mem)); i++ {
+		o := s.Origin(i)
+		if used != nil && used(i) {
+			for x := -1; x <= s.Width; x++ {
+				img.SetRGBA(o.X+x, o.Y-1, SpriteUsed)
+				img.SetRGBA(o.X+x, o.Y+s.Height, SpriteUsed)
+			}
+			for y := 0; y < s.Height; y++ {
+				img.SetRGBA(o.X-1, o.Y+y, SpriteUsed)
+				img.SetRGBA(o.X+s.Width, o.Y+y, SpriteUsed)
+			}
+		}
+		for y := 0; y < s.Height; y++ {
+			for x := 0; x < s.Width; x++ {
+				c := p[0]
+				offset, mask, _ := s.PixelAt(image.Pt(o.X+x, o.Y+y))
+				if offset < len(mem) && mem[offset]&mask != 0 {
+					c = p[1]
+				}
+				img.SetRGBA(o.X+x, o.Y+y, c)
+			}
+		}
+	}
+
+	return img
+}
+
+// Read reads the sprites in an image laid out as Draw makes them, such as
+// an edited sheet, back into memory. The image may be scaled up by a whole
+// number. A pixel is set if it is closer to the palette's foreground than
+// its background.
+func (s SpriteSheet) Read(img image.Image, mem []byte, p Palette) error {
+	bounds := img.Bounds()
+	want := s.Size(len(mem))
+	scale := bounds.Dx() / want.X
+	if scale < 1 || bounds.Dx() != want.X*scale || bounds.Dy() != want.Y*scale {
+		return fmt.Errorf("sprite sheet is %dx%d, not %dx%d or a multiple of it", bounds.Dx(), bounds.Dy(), want.X, want.Y)
+	}
+
+	for i := range mem {
+		mem[i] = 0
+	}
+	for i := 0; i < s.Count(len(mem)); i++ {
+		o := s.Origin(i)
+		for y := 0; y < s.Height; y++ {
+			for x := 0; x < s.Width; x++ {
+				pt := image.Pt(o.X+x, o.Y+y)
+				offset, mask, _ := s.PixelAt(pt)
+				c := img.At(bounds.Min.X+pt.X*scale+scale/2, bounds.Min.Y+pt.Y*scale+scale/2)
+				if offset < len(mem) && distance(c, p[1]) < distance(c, p[0]) {
+					mem[offset] |= mask
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// distance is how far apart two colours are, as the sum of squares
+func distance(a color.Color, b color.RGBA) int {
+	r, g, bl, _ := a.RGBA()
+	dr, dg, db := int(r>>8)-int(b.R), int(g>>8)-int(b.G), int(bl>>8)-int(b.B)
+
+	return dr*dr + dg*dg + db*db
+}
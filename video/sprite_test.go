@@ -0,0 +1,60 @@
+package video
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestSpriteSheet(t *testing.T) {
+	s := SpriteSheet{Width: 8, Height: 3, Columns: 2}
+	mem := []byte{0xF0, 0x90, 0xF0, 0x81, 0x42, 0x24, 0x18}
+	p := Themes[0].Palette
+
+	img := s.Draw(mem, p, func(i int) bool { return i == 1 })
+	if size := img.Rect.Size(); size != image.Pt(19, 9) {
+		t.Fatalf("Expected a 19x9 sheet for 3 sprites but was %v", size)
+	}
+	if c := img.RGBAAt(1, 1); c != p[1] {
+		t.Errorf("Expected the first pixel to be set but was %v", c)
+	}
+	if c := img.RGBAAt(9, 0); c != SpriteUsed {
+		t.Errorf("Expected the second sprite to be outlined but was %v", c)
+	}
+	if c := img.RGBAAt(0, 5); c != p[2] {
+		t.Errorf("Expected the third sprite not to be outlined but was %v", c)
+	}
+
+	offset, mask, ok := s.PixelAt(image.Pt(17, 2))
+	if !ok || offset != 4 || mask != 0x01 {
+		t.Errorf("Expected the last bit of byte 4 but was %d 0x%02X %v", offset, mask, ok)
+	}
+	if _, _, ok := s.PixelAt(image.Pt(9, 1)); ok {
+		t.Errorf("Expected the space between sprites not to be a pixel")
+	}
+
+	read := make([]byte, len(mem))
+	if err := s.Read(img, read, p); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, mem) {
+		t.Errorf("Expected the sheet to read back as % X but was % X", mem, read)
+	}
+	if err := s.Read(Resize(img, 19*3, 9*3), read, p); err != nil || !bytes.Equal(read, mem) {
+		t.Errorf("Expected a sheet scaled 3 times to read back as % X but was % X, %v", mem, read, err)
+	}
+	if err := s.Read(img, make([]byte, 20), p); err == nil {
+		t.Errorf("Expected an error reading a sheet of the wrong size")
+	}
+}
+
+func TestParseSpriteSize(t *testing.T) {
+	if w, h, err := ParseSpriteSize("16X16"); w != 16 || h != 16 || err != nil {
+		t.Errorf("Expected 16x16 but was %dx%d, %v", w, h, err)
+	}
+	for _, bad := range []string{"", "8", "4x5", "8x0", "8x17", "axb"} {
+		if _, _, err := ParseSpriteSize(bad); err == nil {
+			t.Errorf("Expected an error for sprite size %q", bad)
+		}
+	}
+}
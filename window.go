@@ -0,0 +1,104 @@
+//go:build !headless
+// +build !headless
+
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/szTheory/chip8go/emu"
+	"github.com/szTheory/chip8go/video"
+)
+
+// frames to wait after the window stops resizing before saving its size
+const resizeSaveDelay = 30
+
+// updateWindow handles the window hotkeys and saves the window size
+// once the user has finished resizing it.
+// F11 toggles fullscreen, F10 cycles through the scaling modes
+// and F9 through the display filters.
+func (g *Game) updateWindow() {
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyF11):
+		g.options.Fullscreen = !ebiten.IsFullscreen()
+		ebiten.SetFullscreen(g.options.Fullscreen)
+		g.base.Fullscreen = g.options.Fullscreen
+		g.settings.Fullscreen = g.options.Fullscreen
+		g.saveSettings()
+	case inpututil.IsKeyJustPressed(ebiten.KeyF10):
+		for i, mode := range scalingModes {
+			if mode == g.options.Scaling {
+				g.options.Scaling = scalingModes[(i+1)%len(scalingModes)]
+				break
+			}
+		}
+		g.base.Scaling = g.options.Scaling
+		g.settings.Scaling = g.options.Scaling
+		g.saveSettings()
+	case inpututil.IsKeyJustPressed(ebiten.KeyF9):
+		g.options.Filter = video.NextFilter(g.options.Filter)
+		filters, _ := video.ParseFilters(g.options.Filter)
+		g.filters = video.NewPipeline(filters)
+		g.base.Filter = g.options.Filter
+		g.settings.Filter = g.options.Filter
+		g.saveSettings()
+	}
+
+	if ebiten.IsFullscreen() {
+		return
+	}
+	w, h := ebiten.WindowSize()
+	if w != g.windowW || h != g.windowH {
+		g.windowW, g.windowH = w, h
+		g.resizeFrames = resizeSaveDelay
+		return
+	}
+	if g.resizeFrames > 0 {
+		g.resizeFrames--
+		if g.resizeFrames == 0 {
+			g.saveWindowScale(h)
+		}
+	}
+}
+
+// saveWindowScale remembers the window height as a display scale.
+// The scale is of the 64x32 display, which hires games start in,
+// so a window resized while in hires isn't remembered at half size.
+func (g *Game) saveWindowScale(windowHeight int) {
+	scale := windowHeight / emu.ScreenHeightPx
+	if scale < 1 || scale == g.settings.Scale {
+		return
+	}
+	g.options.Scale = scale
+	g.base.Scale = scale
+	g.settings.Scale = scale
+	g.saveSettings()
+}
+
+// drawDisplay draws the display canvas centered on the screen
+// with the border colour around it.
+// The display is placed by its own size, so filters that enlarge
+// the canvas don't change how big it appears.
+func (g *Game) drawDisplay(screen, canvas *ebiten.Image) {
+	if err := screen.Fill(g.border); err != nil {
+		panic(err)
+	}
+
+	outerW, outerH := screen.Size()
+	w, h := g.display.Width(), g.display.Height()
+	x, y, scaleX, scaleY := displayRect(outerW, outerH, w, h, g.options.Scaling, g.aspect)
+	filterScale := float64(g.filters.Scale())
+
+	geometry := ebiten.GeoM{}
+	geometry.Scale(scaleX/filterScale, scaleY/filterScale)
+	geometry.Translate(x, y)
+
+	// filtered canvases are rarely drawn at a whole multiple of their size
+	filter := ebiten.FilterNearest
+	if len(g.filters.Chain) > 0 {
+		filter = ebiten.FilterLinear
+	}
+	if err := screen.DrawImage(canvas, &ebiten.DrawImageOptions{GeoM: geometry, Filter: filter}); err != nil {
+		panic(err)
+	}
+}